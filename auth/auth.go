@@ -0,0 +1,280 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"zo-backend/atomicfile"
+)
+
+// Права (scopes), которые выдаются клиентам API.
+const (
+	SCOPE_ADMIN              = "admin"              // управление клиентами API
+	SCOPE_PUBLIC_LK          = "public:lk"          // личный кабинет и баллы пользователя на сайте
+	SCOPE_PUBLIC_FACECAST    = "public:facecast"    // автологин на трансляциях Facecast
+	SCOPE_REPORTS_READ       = "reports:read"       // получение данных для отчетов
+	SCOPE_REPORTS_WRITE      = "reports:write"      // создание отчетов в хранилище
+	SCOPE_DASHAMAIL_READ     = "dashamail:read"     // чтение книг DashaMail
+	SCOPE_DASHAMAIL_WRITE    = "dashamail:write"    // запись в книги DashaMail
+	SCOPE_CERTIFICATES_WRITE = "certificates:write" // создание сертификатов
+)
+
+var allScopes = []string{
+	SCOPE_ADMIN,
+	SCOPE_PUBLIC_LK,
+	SCOPE_PUBLIC_FACECAST,
+	SCOPE_REPORTS_READ,
+	SCOPE_REPORTS_WRITE,
+	SCOPE_DASHAMAIL_READ,
+	SCOPE_DASHAMAIL_WRITE,
+	SCOPE_CERTIFICATES_WRITE,
+}
+
+func AllScopes() []string {
+	return append([]string(nil), allScopes...)
+}
+
+var (
+	ErrNoToken       = errors.New("no API token")
+	ErrInvalidToken  = errors.New("invalid API token")
+	ErrRevokedToken  = errors.New("revoked API token")
+	ErrUnknownClient = errors.New("unknown API client")
+)
+
+// Client - клиент API (frontend, сайт, внешний сервис). Сам токен не хранится: при выдаче он возвращается один раз,
+// а в хранилище остается только его хеш.
+type Client struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+func (c Client) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+type record struct {
+	Client
+	TokenHash string `json:"tokenHash"`
+}
+
+// Store хранит клиентов API в JSON-файле. Токен имеет вид "<ID клиента>.<секрет>".
+type Store struct {
+	path    string
+	clients map[string]record
+	locker  sync.RWMutex
+}
+
+// NewStore загружает клиентов из файла path (если файл уже есть).
+func NewStore(path string) (*Store, error) {
+	errExplanation := "can't init API clients store"
+
+	if path == "" {
+		return nil, errWithExplanation(errExplanation, fmt.Errorf("clients file path must be set"))
+	}
+
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, errWithExplanation(errExplanation, err)
+	}
+
+	s := &Store{path: path, clients: make(map[string]record)}
+
+	data, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, errWithExplanation(errExplanation, err)
+	default:
+		var records []record
+		if err = json.Unmarshal(data, &records); err != nil {
+			return nil, errWithExplanation(errExplanation, fmt.Errorf("can't read clients file %s: %+v", path, err))
+		}
+		for _, r := range records {
+			s.clients[r.ID] = r
+		}
+	}
+
+	return s, nil
+}
+
+// Issue создает клиента с правами scopes и возвращает его вместе с токеном.
+func (s *Store) Issue(name string, scopes []string) (Client, string, error) {
+	errExplanation := "issuing API token error"
+
+	if name == "" {
+		return Client{}, "", errWithExplanation(errExplanation, fmt.Errorf("client name must be set"))
+	}
+
+	if len(scopes) == 0 {
+		return Client{}, "", errWithExplanation(errExplanation, fmt.Errorf("at least one scope is required"))
+	}
+
+	for _, scope := range scopes {
+		if !validScope(scope) {
+			err := fmt.Errorf("unknown scope '%s' (available: %s)", scope, strings.Join(allScopes, ", "))
+			return Client{}, "", errWithExplanation(errExplanation, err)
+		}
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return Client{}, "", errWithExplanation(errExplanation, err)
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		return Client{}, "", errWithExplanation(errExplanation, err)
+	}
+
+	r := record{
+		Client: Client{
+			ID:        id,
+			Name:      name,
+			Scopes:    append([]string(nil), scopes...),
+			CreatedAt: time.Now(),
+		},
+		TokenHash: hashSecret(secret),
+	}
+
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	s.clients[id] = r
+	if err = s.save(); err != nil {
+		delete(s.clients, id)
+		return Client{}, "", errWithExplanation(errExplanation, err)
+	}
+
+	return r.Client, id + "." + secret, nil
+}
+
+// List возвращает всех клиентов (в том числе отозванных) в порядке создания.
+func (s *Store) List() []Client {
+	s.locker.RLock()
+	defer s.locker.RUnlock()
+
+	clients := make([]Client, 0, len(s.clients))
+	for _, r := range s.clients {
+		clients = append(clients, r.Client)
+	}
+
+	sort.Slice(clients, func(i, j int) bool { return clients[i].CreatedAt.Before(clients[j].CreatedAt) })
+	return clients
+}
+
+// Revoke отзывает токен клиента. Повторный отзыв не считается ошибкой.
+func (s *Store) Revoke(id string) (Client, error) {
+	errExplanation := "revoking API token error"
+
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	r, ok := s.clients[id]
+	if !ok {
+		return Client{}, errWithExplanation(errExplanation, ErrUnknownClient)
+	}
+
+	if r.RevokedAt == nil {
+		now := time.Now()
+		r.RevokedAt = &now
+		s.clients[id] = r
+
+		if err := s.save(); err != nil {
+			r.RevokedAt = nil
+			s.clients[id] = r
+			return Client{}, errWithExplanation(errExplanation, err)
+		}
+	}
+
+	return r.Client, nil
+}
+
+// Authenticate возвращает клиента, которому выдан token.
+func (s *Store) Authenticate(token string) (Client, error) {
+	if token == "" {
+		return Client{}, ErrNoToken
+	}
+
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return Client{}, ErrInvalidToken
+	}
+
+	s.locker.RLock()
+	r, ok := s.clients[parts[0]]
+	s.locker.RUnlock()
+
+	if !ok || subtle.ConstantTimeCompare([]byte(r.TokenHash), []byte(hashSecret(parts[1]))) != 1 {
+		return Client{}, ErrInvalidToken
+	}
+
+	if r.RevokedAt != nil {
+		return Client{}, ErrRevokedToken
+	}
+
+	return r.Client, nil
+}
+
+// save вызывается под s.locker.
+func (s *Store) save() error {
+	records := make([]record, 0, len(s.clients))
+	for _, r := range s.clients {
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].CreatedAt.Before(records[j].CreatedAt) })
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.WriteFile(s.path, data, 0600)
+}
+
+func validScope(scope string) bool {
+	for _, s := range allScopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func errWithExplanation(errExplanation string, err error) error {
+	return fmt.Errorf("%s: %w", errExplanation, err)
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStoreIssueAndAuthenticate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clients.json")
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, token, err := store.Issue("frontend", []string{SCOPE_REPORTS_READ, SCOPE_DASHAMAIL_READ})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !client.HasScope(SCOPE_REPORTS_READ) || client.HasScope(SCOPE_ADMIN) {
+		t.Errorf("client scopes %v", client.Scopes)
+	}
+
+	secret := strings.TrimPrefix(token, client.ID+".")
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"valid", token, nil},
+		{"empty", "", ErrNoToken},
+		{"without ID", secret, ErrInvalidToken},
+		{"wrong secret", client.ID + ".0000", ErrInvalidToken},
+		{"unknown client", "0000000000000000." + secret, ErrInvalidToken},
+	}
+
+	for _, test := range tests {
+		got, err := store.Authenticate(test.token)
+		if !errors.Is(err, test.err) || (err == nil && got.ID != client.ID) {
+			t.Errorf("%s: client %+v, error %v, want %v", test.name, got, err, test.err)
+		}
+	}
+
+	// после перезапуска клиент загружается из файла, а токен в файле не хранится
+	restored, err := NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := restored.Authenticate(token); err != nil || got.Name != "frontend" {
+		t.Errorf("restored client %+v, error %v", got, err)
+	}
+
+	if _, err = restored.Revoke(client.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = restored.Revoke(client.ID); err != nil {
+		t.Errorf("repeated revoke error %v", err)
+	}
+	if _, err = restored.Authenticate(token); !errors.Is(err, ErrRevokedToken) {
+		t.Errorf("revoked token error %v", err)
+	}
+	if _, err = restored.Revoke("unknown"); !errors.Is(err, ErrUnknownClient) {
+		t.Errorf("revoking unknown client error %v", err)
+	}
+}
+
+func TestStoreIssueValidation(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "clients.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		scopes []string
+		err    string
+	}{
+		{"", []string{SCOPE_ADMIN}, "client name must be set"},
+		{"site", nil, "at least one scope"},
+		{"site", []string{SCOPE_PUBLIC_LK, "public:everything"}, "unknown scope 'public:everything'"},
+	}
+
+	for _, test := range tests {
+		if _, _, err := store.Issue(test.name, test.scopes); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Issue(%q, %v) error %v, want %q", test.name, test.scopes, err, test.err)
+		}
+	}
+	if clients := store.List(); len(clients) != 0 {
+		t.Errorf("clients after invalid issues %+v", clients)
+	}
+}
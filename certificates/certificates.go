@@ -0,0 +1,107 @@
+package certificates
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lukasjarosch/go-docx"
+	"zo-backend/eventdate"
+)
+
+const (
+	NATIVE_RENDERER      = "native"
+	LIBREOFFICE_RENDERER = "libreoffice"
+)
+
+// CertificateRenderer конвертирует заполненный DOCX-шаблон сертификата в PDF.
+// Реализации не создают файлов рядом с шаблоном и могут безопасно вызываться из нескольких горутин одновременно.
+type CertificateRenderer interface {
+	Render(filledDOCX []byte) ([]byte, error)
+}
+
+// InitCertificateRenderer возвращает реализацию CertificateRenderer по ее названию.
+// Пустое название соответствует NATIVE_RENDERER (рендеринг в Go без внешних программ). libreOfficeTimeout ограничивает
+// время конвертации одного сертификата через LibreOffice (0 - DEFAULT_LIBREOFFICE_TIMEOUT).
+func InitCertificateRenderer(rendererType string, libreOfficeTimeout time.Duration) (CertificateRenderer, error) {
+	errExplanation := "can't init certificate renderer"
+
+	switch rendererType {
+	case "", NATIVE_RENDERER:
+		return NewNativeRenderer(), nil
+	case LIBREOFFICE_RENDERER:
+		r, err := NewLibreOfficeRenderer("", libreOfficeTimeout)
+		if err != nil {
+			return nil, errWithExplanation(errExplanation, err)
+		}
+		return r, nil
+	default:
+		err := fmt.Errorf("unknown renderer type '%s' (only '%s' and '%s' are available)", rendererType, NATIVE_RENDERER, LIBREOFFICE_RENDERER)
+		return nil, errWithExplanation(errExplanation, err)
+	}
+}
+
+// docxMutex сериализует работу с go-docx: библиотека нумерует фрагменты текста глобальным счетчиком и сбрасывает его
+// при каждом открытии документа, поэтому документы нельзя открывать и заполнять из нескольких горутин одновременно.
+var docxMutex sync.Mutex
+
+// FillTemplate подставляет значения в плейсхолдеры вида {ИМЯ} DOCX-шаблона и возвращает получившийся документ.
+func FillTemplate(templatePath string, placeholders docx.PlaceholderMap) ([]byte, error) {
+	errExplanation := "filling certificate template error"
+
+	docxMutex.Lock()
+	defer docxMutex.Unlock()
+
+	doc, err := docx.Open(templatePath)
+	if err != nil {
+		return nil, errWithExplanation(errExplanation, err)
+	}
+	defer doc.Close()
+
+	filled, err := fillDocument(doc, placeholders)
+	if err != nil {
+		return nil, errWithExplanation(errExplanation, err)
+	}
+
+	return filled, nil
+}
+
+func fillDocument(doc *docx.Document, placeholders docx.PlaceholderMap) ([]byte, error) {
+	err := doc.ReplaceAll(placeholders)
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := new(bytes.Buffer)
+	err = doc.Write(buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// sameEventDate сравнивает даты мероприятий, записанные в любом формате eventdate (пустые даты равны только друг другу).
+func sameEventDate(a, b string) bool {
+	a, b = strings.TrimSpace(a), strings.TrimSpace(b)
+	if a == "" || b == "" {
+		return a == b
+	}
+
+	dateA, err := eventdate.Parse(a)
+	if err != nil {
+		return false
+	}
+	dateB, err := eventdate.Parse(b)
+	if err != nil {
+		return false
+	}
+
+	return dateA.Date().Equal(dateB.Date())
+}
+
+func errWithExplanation(errExplanation string, err error) error {
+	return fmt.Errorf("%s: %+v", errExplanation, err)
+}
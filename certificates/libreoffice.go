@@ -0,0 +1,89 @@
+package certificates
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// DEFAULT_LIBREOFFICE_TIMEOUT - время, за которое LibreOffice должен сконвертировать один сертификат, если не задано другое.
+const DEFAULT_LIBREOFFICE_TIMEOUT = 60 * time.Second
+
+// LibreOfficeRenderer конвертирует сертификат через LibreOffice в headless-режиме. Каждый вызов работает в собственной
+// временной папке и с собственным профилем LibreOffice, поэтому параллельные конвертации не мешают друг другу.
+type LibreOfficeRenderer struct {
+	binary  string
+	timeout time.Duration
+}
+
+// NewLibreOfficeRenderer проверяет наличие исполняемого файла LibreOffice. Пустой binary - поиск soffice/libreoffice в $PATH.
+// Зависшая конвертация завершается через timeout (0 - DEFAULT_LIBREOFFICE_TIMEOUT).
+func NewLibreOfficeRenderer(binary string, timeout time.Duration) (*LibreOfficeRenderer, error) {
+	candidates := []string{binary}
+	if binary == "" {
+		candidates = []string{"soffice", "libreoffice"}
+	}
+	if timeout <= 0 {
+		timeout = DEFAULT_LIBREOFFICE_TIMEOUT
+	}
+
+	for _, candidate := range candidates {
+		if path, err := exec.LookPath(candidate); err == nil {
+			return &LibreOfficeRenderer{binary: path, timeout: timeout}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("LibreOffice executable not found (tried %v)", candidates)
+}
+
+func (r *LibreOfficeRenderer) Render(filledDOCX []byte) ([]byte, error) {
+	errExplanation := "LibreOffice rendering of certificate error"
+
+	dir, err := ioutil.TempDir("", "certificate-*")
+	if err != nil {
+		return nil, errWithExplanation(errExplanation, err)
+	}
+	defer os.RemoveAll(dir)
+
+	docxPath := filepath.Join(dir, "certificate.docx")
+	err = ioutil.WriteFile(docxPath, filledDOCX, 0644)
+	if err != nil {
+		return nil, errWithExplanation(errExplanation, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	/*/
+	 * Вывод LibreOffice пишется в файл, а не в pipe: после завершения soffice по таймауту его дочерние процессы могут
+	 * держать pipe открытым, и ожидание вывода зависло бы вместе с ними.
+	/*/
+	logFile, err := os.Create(filepath.Join(dir, "soffice.log"))
+	if err != nil {
+		return nil, errWithExplanation(errExplanation, err)
+	}
+	defer logFile.Close()
+
+	profile := "-env:UserInstallation=file://" + filepath.ToSlash(filepath.Join(dir, "profile"))
+	cmd := exec.CommandContext(ctx, r.binary, profile, "--headless", "--convert-to", "pdf", "--outdir", dir, docxPath)
+	cmd.Stdout, cmd.Stderr = logFile, logFile
+	err = cmd.Run()
+	output, _ := ioutil.ReadFile(logFile.Name())
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, errWithExplanation(errExplanation, fmt.Errorf("LibreOffice didn't finish in %v: %s", r.timeout, output))
+	}
+	if err != nil {
+		return nil, errWithExplanation(errExplanation, fmt.Errorf("%v: %s", err, output))
+	}
+
+	pdf, err := ioutil.ReadFile(filepath.Join(dir, "certificate.pdf"))
+	if err != nil {
+		return nil, errWithExplanation(errExplanation, fmt.Errorf("%v: %s", err, output))
+	}
+
+	return pdf, nil
+}
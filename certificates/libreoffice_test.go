@@ -0,0 +1,35 @@
+package certificates
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLibreOfficeRendererTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake LibreOffice is a shell script")
+	}
+
+	// дочерний sleep остается жить после завершения скрипта по таймауту и не должен задерживать Render
+	binary := filepath.Join(t.TempDir(), "soffice")
+	if err := ioutil.WriteFile(binary, []byte("#!/bin/sh\nsleep 10\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	renderer, err := NewLibreOfficeRenderer(binary, 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := time.Now()
+	if _, err = renderer.Render([]byte("docx")); err == nil || !strings.Contains(err.Error(), "didn't finish in 200ms") {
+		t.Errorf("error %v, want timeout", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("Render took %v", elapsed)
+	}
+}
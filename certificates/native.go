@@ -0,0 +1,511 @@
+package certificates
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-fonts/liberation/liberationsansbold"
+	"github.com/go-fonts/liberation/liberationsansbolditalic"
+	"github.com/go-fonts/liberation/liberationsansitalic"
+	"github.com/go-fonts/liberation/liberationsansregular"
+	"github.com/go-fonts/liberation/liberationserifbold"
+	"github.com/go-fonts/liberation/liberationserifbolditalic"
+	"github.com/go-fonts/liberation/liberationserifitalic"
+	"github.com/go-fonts/liberation/liberationserifregular"
+	"github.com/go-pdf/fpdf"
+)
+
+const (
+	nsW   = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+	nsWP  = "http://schemas.openxmlformats.org/drawingml/2006/wordprocessingDrawing"
+	nsA   = "http://schemas.openxmlformats.org/drawingml/2006/main"
+	nsMC  = "http://schemas.openxmlformats.org/markup-compatibility/2006"
+	nsR   = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+	nsWPS = "http://schemas.microsoft.com/office/word/2010/wordprocessingShape"
+
+	emuPerPt   = 12700. // 1 pt = 12700 EMU
+	twipsPerPt = 20.    // 1 pt = 20 twips
+	halfPtInPt = 2.     // размер шрифта в DOCX хранится в половинах пунктов
+
+	lineSpacing = 1.15 // межстрочный интервал относительно размера шрифта
+)
+
+// NativeRenderer рендерит сертификат в PDF средствами Go (fpdf), без Word, LibreOffice и промежуточных файлов.
+// Шаблоны сертификатов состоят из фоновой картинки и текстовых надписей, привязанных к абсолютным координатам на странице
+// (элементы wp:anchor), поэтому рендерер переносит на страницу PDF именно их: картинки - как есть, надписи - с учетом
+// размера и цвета шрифта, жирности, курсива и выравнивания.
+type NativeRenderer struct{}
+
+func NewNativeRenderer() *NativeRenderer {
+	return &NativeRenderer{}
+}
+
+type xmlNode struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Nodes   []xmlNode  `xml:",any"`
+	Text    string     `xml:",chardata"`
+}
+
+type docxPage struct {
+	Width, Height         float64
+	MarginLeft, MarginTop float64
+	DefaultFont           string
+	DefaultSize           float64
+}
+
+type docxAnchor struct {
+	Order               int
+	X, Y, Width, Height float64
+	ImageTarget         string
+	Paragraphs          []docxParagraph
+}
+
+type docxParagraph struct {
+	Text  string
+	Align string
+	Font  string
+	Size  float64
+	Style string
+	Color [3]int
+}
+
+func (r *NativeRenderer) Render(filledDOCX []byte) ([]byte, error) {
+	errExplanation := "native rendering of certificate error"
+
+	certificate, err := parseCertificate(filledDOCX)
+	if err != nil {
+		return nil, errWithExplanation(errExplanation, err)
+	}
+	page := certificate.page
+
+	pdf := fpdf.New("P", "pt", "A4", "")
+	pdf.SetMargins(0, 0, 0)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.SetCellMargin(0)
+	addLiberationFonts(pdf)
+	pdf.AddPageFormat("P", fpdf.SizeType{Wd: page.Width, Ht: page.Height})
+
+	for _, anchor := range certificate.anchors {
+		if anchor.ImageTarget != "" {
+			imagePath, err := certificate.imagePath(anchor.ImageTarget)
+			if err != nil {
+				return nil, errWithExplanation(errExplanation, err)
+			}
+
+			imageType := strings.TrimPrefix(path.Ext(imagePath), ".")
+			pdf.RegisterImageOptionsReader(imagePath, fpdf.ImageOptions{ImageType: imageType}, bytes.NewReader(certificate.files[imagePath]))
+			pdf.ImageOptions(imagePath, anchor.X, anchor.Y, anchor.Width, anchor.Height, false, fpdf.ImageOptions{ImageType: imageType}, 0, "")
+			continue
+		}
+
+		y := anchor.Y
+		for _, p := range anchor.Paragraphs {
+			pdf.SetFont(p.Font, p.Style, p.Size)
+			pdf.SetTextColor(p.Color[0], p.Color[1], p.Color[2])
+			pdf.SetXY(anchor.X, y)
+			if p.Text == "" {
+				y += p.Size * lineSpacing
+				continue
+			}
+
+			pdf.MultiCell(anchor.Width, p.Size*lineSpacing, p.Text, "", p.Align, false)
+			y = pdf.GetY()
+		}
+	}
+
+	buffer := new(bytes.Buffer)
+	if err = pdf.Output(buffer); err != nil {
+		return nil, errWithExplanation(errExplanation, err)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// docxCertificate - разобранный заполненный шаблон: страница, элементы в порядке отрисовки и файлы архива (картинки).
+type docxCertificate struct {
+	page          docxPage
+	anchors       []docxAnchor
+	files         map[string][]byte
+	relationships map[string]string
+}
+
+func parseCertificate(filledDOCX []byte) (*docxCertificate, error) {
+	zipReader, err := zip.NewReader(bytes.NewReader(filledDOCX), int64(len(filledDOCX)))
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]byte)
+	for _, file := range zipReader.File {
+		rc, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		files[file.Name], err = ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	document, err := parseXMLNode(files["word/document.xml"])
+	if err != nil {
+		return nil, fmt.Errorf("word/document.xml: %+v", err)
+	}
+
+	page := parsePage(document, files["word/styles.xml"])
+	anchors := parseAnchors(document, page)
+	if len(anchors) == 0 {
+		return nil, fmt.Errorf("template has no positioned pictures or text boxes")
+	}
+
+	relationships, err := parseRelationships(files["word/_rels/document.xml.rels"])
+	if err != nil {
+		return nil, fmt.Errorf("word/_rels/document.xml.rels: %+v", err)
+	}
+
+	return &docxCertificate{page: page, anchors: anchors, files: files, relationships: relationships}, nil
+}
+
+// imagePath возвращает путь картинки в архиве DOCX по ID связи из элемента a:blip.
+func (c *docxCertificate) imagePath(target string) (string, error) {
+	relationship, ok := c.relationships[target]
+	if !ok {
+		return "", fmt.Errorf("unknown image relationship %s", target)
+	}
+
+	return path.Join("word", relationship), nil
+}
+
+func parseXMLNode(data []byte) (*xmlNode, error) {
+	if data == nil {
+		return nil, fmt.Errorf("file not found in DOCX archive")
+	}
+
+	node := new(xmlNode)
+	if err := xml.Unmarshal(data, node); err != nil {
+		return nil, err
+	}
+
+	return node, nil
+}
+
+func parseRelationships(data []byte) (map[string]string, error) {
+	rels, err := parseXMLNode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	relationships := make(map[string]string)
+	for _, rel := range rels.Nodes {
+		relationships[rel.attr("", "Id")] = rel.attr("", "Target")
+	}
+
+	return relationships, nil
+}
+
+func parsePage(document *xmlNode, styles []byte) docxPage {
+	// значения по умолчанию для Word: A4 и поля по 2 см
+	page := docxPage{Width: 595.3, Height: 841.9, MarginLeft: 56.7, MarginTop: 56.7, DefaultFont: "Liberation Serif", DefaultSize: 12}
+
+	if pgSz := document.find(nsW, "pgSz"); pgSz != nil {
+		page.Width = twipsToPt(pgSz.attr(nsW, "w"), page.Width)
+		page.Height = twipsToPt(pgSz.attr(nsW, "h"), page.Height)
+	}
+
+	if pgMar := document.find(nsW, "pgMar"); pgMar != nil {
+		page.MarginLeft = twipsToPt(pgMar.attr(nsW, "left"), page.MarginLeft)
+		page.MarginTop = twipsToPt(pgMar.attr(nsW, "top"), page.MarginTop)
+	}
+
+	if stylesNode, err := parseXMLNode(styles); err == nil {
+		if rPrDefault := stylesNode.find(nsW, "rPrDefault"); rPrDefault != nil {
+			if rFonts := rPrDefault.find(nsW, "rFonts"); rFonts != nil && rFonts.attr(nsW, "ascii") != "" {
+				page.DefaultFont = rFonts.attr(nsW, "ascii")
+			}
+			if sz := rPrDefault.find(nsW, "sz"); sz != nil {
+				if size, err := strconv.ParseFloat(sz.attr(nsW, "val"), 64); err == nil {
+					page.DefaultSize = size / halfPtInPt
+				}
+			}
+		}
+	}
+
+	return page
+}
+
+// Собирает все привязанные к координатам элементы документа в порядке их отрисовки (снизу вверх по relativeHeight).
+// Содержимое mc:Fallback (VML-копии тех же надписей для старых версий Word) пропускается, иначе текст был бы нарисован дважды.
+func parseAnchors(document *xmlNode, page docxPage) []docxAnchor {
+	anchors := make([]docxAnchor, 0)
+
+	var walk func(node *xmlNode)
+	walk = func(node *xmlNode) {
+		switch {
+		case node.is(nsMC, "Fallback"):
+			return
+		case node.is(nsWP, "anchor"):
+			anchors = append(anchors, parseAnchor(node, page))
+			return
+		}
+
+		for i := range node.Nodes {
+			walk(&node.Nodes[i])
+		}
+	}
+	walk(document)
+
+	sort.SliceStable(anchors, func(i, j int) bool { return anchors[i].Order < anchors[j].Order })
+
+	return anchors
+}
+
+func parseAnchor(node *xmlNode, page docxPage) docxAnchor {
+	anchor := docxAnchor{}
+	anchor.Order, _ = strconv.Atoi(node.attr("", "relativeHeight"))
+
+	if positionH := node.child(nsWP, "positionH"); positionH != nil {
+		origin := page.MarginLeft
+		if positionH.attr("", "relativeFrom") == "page" {
+			origin = 0
+		}
+		anchor.X = origin + emuToPt(positionH.childText(nsWP, "posOffset"))
+	}
+
+	if positionV := node.child(nsWP, "positionV"); positionV != nil {
+		origin := page.MarginTop
+		if positionV.attr("", "relativeFrom") == "page" {
+			origin = 0
+		}
+		anchor.Y = origin + emuToPt(positionV.childText(nsWP, "posOffset"))
+	}
+
+	if extent := node.child(nsWP, "extent"); extent != nil {
+		anchor.Width = emuToPt(extent.attr("", "cx"))
+		anchor.Height = emuToPt(extent.attr("", "cy"))
+	}
+
+	if blip := node.find(nsA, "blip"); blip != nil {
+		anchor.ImageTarget = blip.attr(nsR, "embed")
+		return anchor
+	}
+
+	// внутренние отступы надписи (по умолчанию в Word 0.25 см по бокам и 0.13 см сверху и снизу)
+	if bodyPr := node.find(nsWPS, "bodyPr"); bodyPr != nil {
+		lIns, rIns, tIns := emuAttrToPt(bodyPr, "lIns", 91440), emuAttrToPt(bodyPr, "rIns", 91440), emuAttrToPt(bodyPr, "tIns", 45720)
+		anchor.X += lIns
+		anchor.Y += tIns
+		anchor.Width -= lIns + rIns
+	}
+
+	if txbxContent := node.find(nsW, "txbxContent"); txbxContent != nil {
+		for i := range txbxContent.Nodes {
+			if p := &txbxContent.Nodes[i]; p.is(nsW, "p") {
+				anchor.Paragraphs = append(anchor.Paragraphs, parseParagraph(p, page))
+			}
+		}
+	}
+
+	return anchor
+}
+
+// Параметры шрифта абзаца берутся из первого непустого фрагмента (w:r), т.к. в надписях шаблонов один фрагмент на абзац.
+func parseParagraph(node *xmlNode, page docxPage) docxParagraph {
+	p := docxParagraph{Align: "L", Font: page.DefaultFont, Size: page.DefaultSize}
+
+	if jc := node.find(nsW, "jc"); jc != nil {
+		switch jc.attr(nsW, "val") {
+		case "center":
+			p.Align = "C"
+		case "right", "end":
+			p.Align = "R"
+		case "both", "distribute":
+			p.Align = "J"
+		}
+	}
+
+	formatted := false
+	text := new(strings.Builder)
+	for i := range node.Nodes {
+		run := &node.Nodes[i]
+		if !run.is(nsW, "r") {
+			continue
+		}
+
+		runText := run.runText()
+		if runText == "" {
+			continue
+		}
+		text.WriteString(runText)
+
+		if rPr := run.child(nsW, "rPr"); rPr != nil && !formatted {
+			formatted = true
+			if rFonts := rPr.child(nsW, "rFonts"); rFonts != nil && rFonts.attr(nsW, "ascii") != "" {
+				p.Font = rFonts.attr(nsW, "ascii")
+			}
+			if sz := rPr.child(nsW, "sz"); sz != nil {
+				if size, err := strconv.ParseFloat(sz.attr(nsW, "val"), 64); err == nil {
+					p.Size = size / halfPtInPt
+				}
+			}
+			if color := rPr.child(nsW, "color"); color != nil {
+				p.Color = hexToRGB(color.attr(nsW, "val"))
+			}
+			if isOn(rPr.child(nsW, "b")) {
+				p.Style += "B"
+			}
+			if isOn(rPr.child(nsW, "i")) {
+				p.Style += "I"
+			}
+		}
+	}
+	p.Text = text.String()
+	p.Font = fontFamily(p.Font)
+
+	return p
+}
+
+func (n *xmlNode) runText() string {
+	text := new(strings.Builder)
+	for i := range n.Nodes {
+		switch {
+		case n.Nodes[i].is(nsW, "t"):
+			text.WriteString(n.Nodes[i].Text)
+		case n.Nodes[i].is(nsW, "tab"):
+			text.WriteString("\t")
+		case n.Nodes[i].is(nsW, "br"):
+			text.WriteString("\n")
+		}
+	}
+
+	return text.String()
+}
+
+func (n *xmlNode) is(space, local string) bool {
+	return n.XMLName.Space == space && n.XMLName.Local == local
+}
+
+func (n *xmlNode) attr(space, local string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Space == space && a.Name.Local == local {
+			return a.Value
+		}
+	}
+
+	return ""
+}
+
+func (n *xmlNode) child(space, local string) *xmlNode {
+	for i := range n.Nodes {
+		if n.Nodes[i].is(space, local) {
+			return &n.Nodes[i]
+		}
+	}
+
+	return nil
+}
+
+func (n *xmlNode) childText(space, local string) string {
+	if c := n.child(space, local); c != nil {
+		return strings.TrimSpace(c.Text)
+	}
+
+	return ""
+}
+
+// Поиск в глубину первого элемента с заданным именем (включая сам элемент).
+func (n *xmlNode) find(space, local string) *xmlNode {
+	if n.is(space, local) {
+		return n
+	}
+
+	for i := range n.Nodes {
+		if found := n.Nodes[i].find(space, local); found != nil {
+			return found
+		}
+	}
+
+	return nil
+}
+
+func isOn(toggle *xmlNode) bool {
+	if toggle == nil {
+		return false
+	}
+
+	switch toggle.attr(nsW, "val") {
+	case "0", "false", "off":
+		return false
+	default:
+		return true
+	}
+}
+
+// Сопоставление шрифтов шаблона со встроенными шрифтами Liberation (метрически совместимы с Arial и Times New Roman).
+func fontFamily(font string) string {
+	for _, sans := range []string{"Sans", "Arial", "Calibri", "Helvetica", "Verdana", "Tahoma"} {
+		if strings.Contains(font, sans) {
+			return "sans"
+		}
+	}
+
+	return "serif"
+}
+
+// Встроенные шрифты по семейству и начертанию (в обозначениях fpdf: "", "B", "I", "BI").
+var liberationFonts = map[string]map[string][]byte{
+	"serif": {"": liberationserifregular.TTF, "B": liberationserifbold.TTF, "I": liberationserifitalic.TTF, "BI": liberationserifbolditalic.TTF},
+	"sans":  {"": liberationsansregular.TTF, "B": liberationsansbold.TTF, "I": liberationsansitalic.TTF, "BI": liberationsansbolditalic.TTF},
+}
+
+func addLiberationFonts(pdf *fpdf.Fpdf) {
+	for family, styles := range liberationFonts {
+		for style, ttf := range styles {
+			pdf.AddUTF8FontFromBytes(family, style, ttf)
+		}
+	}
+}
+
+func hexToRGB(hex string) [3]int {
+	rgb := [3]int{}
+	if len(hex) != 6 {
+		return rgb // "auto" и некорректные значения - черный цвет
+	}
+
+	for i := range rgb {
+		c, _ := strconv.ParseInt(hex[2*i:2*i+2], 16, 64)
+		rgb[i] = int(c)
+	}
+
+	return rgb
+}
+
+func emuToPt(emu string) float64 {
+	v, _ := strconv.ParseFloat(emu, 64)
+	return v / emuPerPt
+}
+
+func emuAttrToPt(node *xmlNode, attrName string, defaultEMU float64) float64 {
+	if v, err := strconv.ParseFloat(node.attr("", attrName), 64); err == nil {
+		return v / emuPerPt
+	}
+
+	return defaultEMU / emuPerPt
+}
+
+func twipsToPt(twips string, defaultPt float64) float64 {
+	if v, err := strconv.ParseFloat(twips, 64); err == nil {
+		return v / twipsPerPt
+	}
+
+	return defaultPt
+}
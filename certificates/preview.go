@@ -0,0 +1,144 @@
+package certificates
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	"image/png"
+	"math"
+	"strings"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// PREVIEW_WIDTH - ширина PNG-превью сертификата в пикселях (высота - по пропорциям страницы шаблона).
+const PREVIEW_WIDTH = 1200
+
+// RenderPNG рисует заполненный DOCX-шаблон сертификата в PNG шириной width пикселей. Превью строится по тем же элементам
+// страницы и с теми же шрифтами, что и NativeRenderer, поэтому совпадает с PDF, который он создает; при рендеринге через
+// LibreOffice переносы строк в PDF могут немного отличаться.
+func RenderPNG(filledDOCX []byte, width int) ([]byte, error) {
+	errExplanation := "PNG rendering of certificate error"
+
+	certificate, err := parseCertificate(filledDOCX)
+	if err != nil {
+		return nil, errWithExplanation(errExplanation, err)
+	}
+
+	scale := float64(width) / certificate.page.Width
+	height := int(math.Round(certificate.page.Height * scale))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	for _, anchor := range certificate.anchors {
+		if anchor.ImageTarget != "" {
+			imagePath, err := certificate.imagePath(anchor.ImageTarget)
+			if err != nil {
+				return nil, errWithExplanation(errExplanation, err)
+			}
+
+			picture, _, err := image.Decode(bytes.NewReader(certificate.files[imagePath]))
+			if err != nil {
+				return nil, errWithExplanation(errExplanation, err)
+			}
+
+			rect := image.Rect(int(anchor.X*scale), int(anchor.Y*scale), int((anchor.X+anchor.Width)*scale), int((anchor.Y+anchor.Height)*scale))
+			draw.BiLinear.Scale(img, rect, picture, picture.Bounds(), draw.Over, nil)
+			continue
+		}
+
+		y := anchor.Y
+		for _, p := range anchor.Paragraphs {
+			if p.Text == "" {
+				y += p.Size * lineSpacing
+				continue
+			}
+
+			y, err = drawParagraph(img, p, anchor.X, y, anchor.Width, scale)
+			if err != nil {
+				return nil, errWithExplanation(errExplanation, err)
+			}
+		}
+	}
+
+	buffer := new(bytes.Buffer)
+	if err = png.Encode(buffer, img); err != nil {
+		return nil, errWithExplanation(errExplanation, err)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// drawParagraph рисует абзац надписи так же, как fpdf.MultiCell: строки высотой p.Size * lineSpacing с переносом по словам,
+// базовая линия - на 0.3 размера шрифта ниже середины строки. Возвращает координату под абзацем (в пунктах).
+func drawParagraph(img *image.RGBA, p docxParagraph, x, y, width, scale float64) (float64, error) {
+	ttf, err := opentype.Parse(liberationFonts[p.Font][p.Style])
+	if err != nil {
+		return y, err
+	}
+
+	face, err := opentype.NewFace(ttf, &opentype.FaceOptions{Size: p.Size * scale, DPI: 72, Hinting: font.HintingNone})
+	if err != nil {
+		return y, err
+	}
+	defer face.Close()
+
+	drawer := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(color.RGBA{R: uint8(p.Color[0]), G: uint8(p.Color[1]), B: uint8(p.Color[2]), A: 0xFF}),
+		Face: face,
+	}
+
+	lineHeight := p.Size * lineSpacing
+	for _, line := range wrapText(drawer, p.Text, width*scale) {
+		lineX := x * scale
+		switch p.Align {
+		case "C":
+			lineX += (width*scale - fixedToFloat(drawer.MeasureString(line))) / 2
+		case "R":
+			lineX += width*scale - fixedToFloat(drawer.MeasureString(line))
+		}
+
+		drawer.Dot = fixed.Point26_6{X: floatToFixed(lineX), Y: floatToFixed((y + lineHeight/2 + 0.3*p.Size) * scale)}
+		drawer.DrawString(line)
+		y += lineHeight
+	}
+
+	return y, nil
+}
+
+// wrapText разбивает текст на строки не шире width пикселей: по переводам строк, затем по пробелам. Слово длиннее
+// строки не разрывается.
+func wrapText(drawer *font.Drawer, text string, width float64) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+
+			if line != "" && fixedToFloat(drawer.MeasureString(candidate)) > width {
+				lines = append(lines, line)
+				candidate = word
+			}
+			line = candidate
+		}
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+func fixedToFloat(v fixed.Int26_6) float64 {
+	return float64(v) / 64
+}
+
+func floatToFixed(v float64) fixed.Int26_6 {
+	return fixed.Int26_6(math.Round(v * 64))
+}
@@ -0,0 +1,321 @@
+package certificates
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"zo-backend/atomicfile"
+)
+
+const (
+	STATUS_VALID   = "valid"
+	STATUS_REVOKED = "revoked"
+
+	serialSuffixBytes = 8 // случайная часть серийного номера - 64 бита
+)
+
+// Record - запись реестра выданных сертификатов. Данные сертификата сохраняются в том виде, в котором они напечатаны
+// в PDF, чтобы проверка по серийному номеру показывала то же, что видит владелец сертификата.
+type Record struct {
+	Serial        string    `json:"serial"`
+	Email         string    `json:"email"`
+	UserName      string    `json:"userName"`
+	EventName     string    `json:"eventName"`
+	EventDate     string    `json:"eventDate"`
+	NMO           string    `json:"nmo,omitempty"`
+	ZET           string    `json:"zet,omitempty"`
+	AcademicHours string    `json:"academicHours,omitempty"`
+	Link          string    `json:"link,omitempty"` // ссылка на файл сертификата в хранилище (та же, что записывается в книгу ДМ)
+	IssuedAt      time.Time `json:"issuedAt"`
+	Status        string    `json:"status"`
+
+	// заполняются при отзыве сертификата; отозванные сертификаты остаются в реестре как история выдачи
+	RevokedAt        *time.Time `json:"revokedAt,omitempty"`
+	RevocationReason string     `json:"revocationReason,omitempty"`
+	ReplacedBy       string     `json:"replacedBy,omitempty"` // серийный номер сертификата, выданного взамен отозванного
+}
+
+type registrySnapshot struct {
+	Sequence int               `json:"sequence"` // последний выданный порядковый номер
+	Records  map[string]Record `json:"records"`  // серийный номер -> запись
+}
+
+// Registry - реестр выданных сертификатов. Хранится в JSON-файле, поэтому переживает перезапуск сервера.
+type Registry struct {
+	path         string
+	sequencePath string // последний занятый порядковый номер (записывается при каждом Reserve, без перезаписи реестра)
+	snapshot     registrySnapshot
+	locker       sync.RWMutex
+}
+
+// NewRegistry загружает реестр из файла path (если файл уже есть).
+func NewRegistry(path string) (*Registry, error) {
+	errExplanation := "can't init certificates registry"
+
+	if path == "" {
+		return nil, errWithExplanation(errExplanation, fmt.Errorf("registry file path must be set"))
+	}
+
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, errWithExplanation(errExplanation, err)
+	}
+
+	r := &Registry{path: path, sequencePath: path + ".sequence"}
+
+	data, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, errWithExplanation(errExplanation, err)
+	default:
+		if err = json.Unmarshal(data, &r.snapshot); err != nil {
+			return nil, errWithExplanation(errExplanation, fmt.Errorf("can't read registry file %s: %+v", path, err))
+		}
+	}
+
+	if r.snapshot.Records == nil {
+		r.snapshot.Records = make(map[string]Record)
+	}
+
+	// номера, занятые после последней записи реестра, могли уже быть напечатаны на загруженных сертификатах
+	data, err = ioutil.ReadFile(r.sequencePath)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, errWithExplanation(errExplanation, err)
+	default:
+		sequence, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, errWithExplanation(errExplanation, fmt.Errorf("can't read sequence file %s: %+v", r.sequencePath, err))
+		}
+		if sequence > r.snapshot.Sequence {
+			r.snapshot.Sequence = sequence
+		}
+	}
+
+	return r, nil
+}
+
+// Reserve присваивает сертификату серийный номер вида ZO-2024-000001-3FA9C21B7D04E6A1 (год выдачи, порядковый номер и
+// 64-битный случайный суффикс, чтобы номера чужих сертификатов нельзя было подобрать перебором), который печатается на
+// сертификате. Порядковый номер занимается сразу и сохраняется в файл, чтобы после перезапуска сервера он не был выдан
+// повторно, но в реестр сертификат записывается только через IssueAll, после того как он доставлен владельцу.
+func (r *Registry) Reserve(record Record) (Record, error) {
+	errExplanation := "can't reserve certificate serial number"
+
+	suffix := make([]byte, serialSuffixBytes)
+	if _, err := rand.Read(suffix); err != nil {
+		return Record{}, errWithExplanation(errExplanation, err)
+	}
+
+	if record.IssuedAt.IsZero() {
+		record.IssuedAt = time.Now()
+	}
+	record.Email = strings.ToLower(record.Email)
+	record.Status = STATUS_VALID
+
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	sequence := r.snapshot.Sequence + 1
+	if err := atomicfile.WriteFile(r.sequencePath, []byte(strconv.Itoa(sequence)), 0600); err != nil {
+		return Record{}, errWithExplanation(errExplanation, err)
+	}
+
+	r.snapshot.Sequence = sequence
+	record.Serial = fmt.Sprintf("ZO-%d-%06d-%s", record.IssuedAt.Year(), sequence, strings.ToUpper(hex.EncodeToString(suffix)))
+
+	return record, nil
+}
+
+// IssueAll записывает в реестр сертификаты records с номерами из Reserve (одной записью файла на всю группу). Прежние
+// действующие сертификаты владельцев за те же мероприятия или загруженные по той же ссылке отзываются по причине reason,
+// т.к. новый сертификат их заменяет. Возвращает серийные номера отозванных сертификатов по серийному номеру заменившего их сертификата.
+func (r *Registry) IssueAll(records []Record, reason string) (map[string][]string, error) {
+	errExplanation := "can't issue certificates"
+
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	emails := make(map[string]bool, len(records))
+	for _, record := range records {
+		emails[record.Email] = true
+	}
+
+	// действующие сертификаты владельцев новых сертификатов (реестр просматривается один раз на всю группу)
+	snapshot := r.snapshot.clone()
+	valid := make(map[string][]string)
+	for serial, record := range snapshot.Records {
+		if record.Status == STATUS_VALID && emails[record.Email] {
+			valid[record.Email] = append(valid[record.Email], serial)
+		}
+	}
+
+	revokedAt := time.Now()
+	revoked := make(map[string][]string)
+	for _, record := range records {
+		for _, serial := range valid[record.Email] {
+			previous := snapshot.Records[serial]
+			sameLink := record.Link != "" && previous.Link == record.Link
+			if previous.Status != STATUS_VALID || !(sameRecordEvent(previous, record) || sameLink) {
+				continue
+			}
+
+			previous.Status = STATUS_REVOKED
+			previous.RevokedAt = &revokedAt
+			previous.RevocationReason = reason
+			previous.ReplacedBy = record.Serial
+			snapshot.Records[serial] = previous
+			revoked[record.Serial] = append(revoked[record.Serial], serial)
+		}
+
+		snapshot.Records[record.Serial] = record
+	}
+
+	for _, serials := range revoked {
+		sort.Strings(serials)
+	}
+
+	if err := r.save(snapshot); err != nil {
+		return nil, errWithExplanation(errExplanation, err)
+	}
+
+	r.snapshot = snapshot
+	return revoked, nil
+}
+
+// Find ищет сертификат по серийному номеру (без учета регистра и пробелов по краям).
+func (r *Registry) Find(serial string) (Record, bool) {
+	r.locker.RLock()
+	defer r.locker.RUnlock()
+
+	record, ok := r.snapshot.Records[strings.ToUpper(strings.TrimSpace(serial))]
+	return record, ok
+}
+
+// Revoke отзывает действующий сертификат serial по причине reason. Если взамен выдан новый сертификат, его серийный
+// номер передается в replacedBy.
+func (r *Registry) Revoke(serial, reason, replacedBy string) (Record, error) {
+	errExplanation := "can't revoke certificate"
+
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	record, ok := r.snapshot.Records[strings.ToUpper(strings.TrimSpace(serial))]
+	if !ok {
+		return Record{}, errWithExplanation(errExplanation, fmt.Errorf("certificate %s not found", serial))
+	} else if record.Status == STATUS_REVOKED {
+		return Record{}, errWithExplanation(errExplanation, fmt.Errorf("certificate %s is already revoked", serial))
+	}
+
+	revokedAt := time.Now()
+	record.Status = STATUS_REVOKED
+	record.RevokedAt = &revokedAt
+	record.RevocationReason = reason
+	record.ReplacedBy = replacedBy
+
+	snapshot := r.snapshot.clone()
+	snapshot.Records[record.Serial] = record
+	if err := r.save(snapshot); err != nil {
+		return Record{}, errWithExplanation(errExplanation, err)
+	}
+
+	r.snapshot = snapshot
+	return record, nil
+}
+
+// Valid возвращает действующие сертификаты пользователя email за мероприятие eventName от eventDate (дата - в любом
+// формате eventdate) по порядку выдачи.
+func (r *Registry) Valid(email, eventName, eventDate string) []Record {
+	valid := make([]Record, 0)
+	for _, record := range r.History(email) {
+		if record.Status == STATUS_VALID && sameRecordEvent(record, Record{EventName: eventName, EventDate: eventDate}) {
+			valid = append(valid, record)
+		}
+	}
+
+	return valid
+}
+
+// ValidByLink возвращает действующие сертификаты пользователя email, загруженные по ссылке link, по порядку выдачи.
+func (r *Registry) ValidByLink(email, link string) []Record {
+	valid := make([]Record, 0)
+	if link == "" {
+		return valid
+	}
+
+	for _, record := range r.History(email) {
+		if record.Status == STATUS_VALID && record.Link == link {
+			valid = append(valid, record)
+		}
+	}
+
+	return valid
+}
+
+// History возвращает все сертификаты пользователя email, в том числе отозванные, по порядку выдачи.
+func (r *Registry) History(email string) []Record {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	r.locker.RLock()
+	defer r.locker.RUnlock()
+
+	history := make([]Record, 0)
+	for _, record := range r.snapshot.Records {
+		if record.Email == email {
+			history = append(history, record)
+		}
+	}
+	sort.Slice(history, func(i, j int) bool { return history[i].IssuedAt.Before(history[j].IssuedAt) })
+
+	return history
+}
+
+// MaskUserName сокращает ФИО владельца сертификата до фамилии и инициала имени ("Иванов Иван Иванович" -> "Иванов И."),
+// чтобы публичная проверка сертификата не раскрывала полное имя.
+func MaskUserName(userName string) string {
+	words := strings.Fields(userName)
+	switch len(words) {
+	case 0:
+		return ""
+	case 1:
+		return words[0]
+	default:
+		return words[0] + " " + string([]rune(words[1])[:1]) + "."
+	}
+}
+
+// Сертификаты выданы за одно мероприятие, если совпадают названия (без учета регистра) и даты (в любом формате eventdate).
+func sameRecordEvent(a, b Record) bool {
+	return strings.EqualFold(strings.TrimSpace(a.EventName), strings.TrimSpace(b.EventName)) && sameEventDate(a.EventDate, b.EventDate)
+}
+
+// Записи реестра не меняются на месте: изменения вносятся в копию, которая заменяет реестр только после записи в файл.
+func (snapshot registrySnapshot) clone() registrySnapshot {
+	clone := registrySnapshot{Sequence: snapshot.Sequence, Records: make(map[string]Record, len(snapshot.Records)+1)}
+	for serial, record := range snapshot.Records {
+		clone.Records[serial] = record
+	}
+
+	return clone
+}
+
+func (r *Registry) save(snapshot registrySnapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	// в реестре ФИО, почты и коды НМО пользователей, поэтому файл доступен только владельцу
+	return atomicfile.WriteFile(r.path, data, 0600)
+}
@@ -0,0 +1,98 @@
+package certificates
+
+import (
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestRegistryReserveKeepsSequenceAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+
+	registry, err := NewRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := registry.Reserve(Record{Email: "Ivanov@example.com", UserName: "Иванов Иван Иванович"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^ZO-\d{4}-000001-[0-9A-F]{16}$`).MatchString(first.Serial) {
+		t.Fatalf("serial %q, want ZO-<year>-000001-<16 hex digits>", first.Serial)
+	}
+
+	// сертификат не записан в реестр (IssueAll не вызывался), но номер уже мог быть напечатан
+	restarted, err := NewRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := restarted.Reserve(Record{Email: "petrova@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^ZO-\d{4}-000002-`).MatchString(second.Serial) {
+		t.Errorf("serial after restart %q, want sequence number 000002", second.Serial)
+	}
+	if _, ok := restarted.Find(first.Serial); ok {
+		t.Errorf("reserved certificate %s is in registry before IssueAll", first.Serial)
+	}
+}
+
+func TestMaskUserName(t *testing.T) {
+	tests := []struct {
+		userName string
+		want     string
+	}{
+		{"Иванов Иван Иванович", "Иванов И."},
+		{"  Петрова   Анна ", "Петрова А."},
+		{"Сидоров", "Сидоров"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if got := MaskUserName(test.userName); got != test.want {
+			t.Errorf("MaskUserName(%q) = %q, want %q", test.userName, got, test.want)
+		}
+	}
+}
+
+func TestRegistryMatchesCertificatesByLink(t *testing.T) {
+	registry, err := NewRegistry(filepath.Join(t.TempDir(), "registry.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	link := "https://example.com/certificates/ivanov.pdf"
+	first, err := registry.Reserve(Record{Email: "ivanov@example.com", EventName: "Вебинар НМО (основной зал)", EventDate: "15.03.2024", Link: link})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = registry.IssueAll([]Record{first}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if valid := registry.ValidByLink("Ivanov@example.com", link); len(valid) != 1 || valid[0].Serial != first.Serial {
+		t.Errorf("valid by link %+v, want %s", valid, first.Serial)
+	}
+	if valid := registry.ValidByLink("ivanov@example.com", ""); len(valid) != 0 {
+		t.Errorf("valid by empty link %+v", valid)
+	}
+
+	// название мероприятия другое, но файл загружен по той же ссылке - прежний сертификат заменяется
+	second, err := registry.Reserve(Record{Email: "ivanov@example.com", EventName: "Вебинар НМО", EventDate: "15 марта 2024", Link: link})
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := registry.IssueAll([]Record{second}, "опечатка в ФИО")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serials := revoked[second.Serial]; len(serials) != 1 || serials[0] != first.Serial {
+		t.Errorf("revoked %v, want %s replaced by %s", revoked, first.Serial, second.Serial)
+	}
+	if valid := registry.ValidByLink("ivanov@example.com", link); len(valid) != 1 || valid[0].Serial != second.Serial {
+		t.Errorf("valid by link %+v, want %s", valid, second.Serial)
+	}
+}
@@ -0,0 +1,416 @@
+package certificates
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lukasjarosch/go-docx"
+	"zo-backend/atomicfile"
+	"zo-backend/eventdate"
+)
+
+const (
+	CATEGORY_ADULTS   = "adults"   // сертификаты НМО
+	CATEGORY_STUDENTS = "students" // сертификаты студентов, посещавших мероприятие очно
+)
+
+// RequiredPlaceholders - плейсхолдеры, без которых шаблон категории нельзя активировать.
+var RequiredPlaceholders = map[string][]string{
+	CATEGORY_ADULTS:   {"ИМЯ", "МЕРОПРИЯТИЕ", "ДАТА", "НМО", "ЗЕТ"},
+	CATEGORY_STUDENTS: {"ИМЯ", "МЕРОПРИЯТИЕ", "ДАТА", "АКАДЕМ"},
+}
+
+// Встроенные шаблоны, которые используются, пока для категории не активирован загруженный шаблон.
+var builtinTemplates = map[string]string{
+	CATEGORY_ADULTS:   "./__dev__certificates__/template_adults.docx",
+	CATEGORY_STUDENTS: "./__dev__certificates__/template_students.docx",
+}
+
+// Template - загруженная версия шаблона сертификата. Версии шаблона с одним названием нумеруются по порядку загрузки.
+type Template struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Category     string    `json:"category"`
+	Version      int       `json:"version"`
+	Placeholders []string  `json:"placeholders"`
+	Missing      []string  `json:"missingPlaceholders,omitempty"` // обязательные плейсхолдеры категории, которых нет в шаблоне
+	UploadedAt   time.Time `json:"uploadedAt"`
+}
+
+// Assignment - активный шаблон категории: для всех мероприятий (EventName и EventDate пустые) или для одного мероприятия.
+type Assignment struct {
+	TemplateID  string    `json:"templateID"`
+	Category    string    `json:"category"`
+	EventName   string    `json:"eventName,omitempty"`
+	EventDate   string    `json:"eventDate,omitempty"`
+	ActivatedAt time.Time `json:"activatedAt"`
+}
+
+type templatesIndex struct {
+	Sequence    int          `json:"sequence"`
+	Templates   []Template   `json:"templates"`
+	Assignments []Assignment `json:"assignments"`
+}
+
+// TemplateStore хранит загруженные шаблоны сертификатов в папке dir (файлы <id>.docx и индекс templates.json),
+// поэтому шаблоны и их назначения переживают перезапуск сервера.
+type TemplateStore struct {
+	dir    string
+	index  templatesIndex
+	locker sync.RWMutex
+}
+
+// NewTemplateStore загружает индекс шаблонов из папки dir (если он уже есть).
+func NewTemplateStore(dir string) (*TemplateStore, error) {
+	errExplanation := "can't init certificate templates store"
+
+	if dir == "" {
+		return nil, errWithExplanation(errExplanation, fmt.Errorf("templates directory must be set"))
+	}
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, errWithExplanation(errExplanation, err)
+	}
+
+	s := &TemplateStore{dir: dir}
+
+	data, err := ioutil.ReadFile(s.indexPath())
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, errWithExplanation(errExplanation, err)
+	default:
+		if err = json.Unmarshal(data, &s.index); err != nil {
+			return nil, errWithExplanation(errExplanation, fmt.Errorf("can't read templates index %s: %+v", s.indexPath(), err))
+		}
+	}
+
+	return s, nil
+}
+
+// Upload сохраняет новую версию шаблона name категории category. Шаблон без обязательных плейсхолдеров загружается
+// (его можно исправить и загрузить снова), но не может быть активирован.
+func (s *TemplateStore) Upload(name, category string, content []byte) (Template, error) {
+	errExplanation := "can't upload certificate template"
+
+	if _, ok := RequiredPlaceholders[category]; !ok {
+		return Template{}, errWithExplanation(errExplanation, fmt.Errorf("unknown category '%s' (only '%s' and '%s' are available)", category, CATEGORY_ADULTS, CATEGORY_STUDENTS))
+	}
+
+	placeholders, err := TemplatePlaceholders(content)
+	if err != nil {
+		return Template{}, errWithExplanation(errExplanation, err)
+	}
+
+	if err = checkTemplateRendering(content, placeholders); err != nil {
+		return Template{}, errWithExplanation(errExplanation, err)
+	}
+
+	template := Template{
+		Name:         name,
+		Category:     category,
+		Placeholders: placeholders,
+		Missing:      missingPlaceholders(category, placeholders),
+		UploadedAt:   time.Now(),
+	}
+
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	index := s.index
+	index.Sequence++
+	template.ID = fmt.Sprintf("tpl-%d", index.Sequence)
+	template.Version = 1
+	for _, t := range index.Templates {
+		if t.Name == name && t.Version >= template.Version {
+			template.Version = t.Version + 1
+		}
+	}
+	index.Templates = append(append([]Template(nil), index.Templates...), template)
+
+	if err = ioutil.WriteFile(s.templatePath(template.ID), content, 0644); err != nil {
+		return Template{}, errWithExplanation(errExplanation, err)
+	}
+	if err = s.save(index); err != nil {
+		return Template{}, errWithExplanation(errExplanation, err)
+	}
+
+	s.index = index
+	return template, nil
+}
+
+// List возвращает все версии шаблонов (по порядку загрузки) и назначения активных шаблонов.
+func (s *TemplateStore) List() ([]Template, []Assignment) {
+	s.locker.RLock()
+	defer s.locker.RUnlock()
+
+	return append([]Template{}, s.index.Templates...), append([]Assignment{}, s.index.Assignments...)
+}
+
+// Activate делает шаблон templateID активным шаблоном его категории для мероприятия eventName от eventDate или, если
+// мероприятие не указано, для всех мероприятий. Шаблон без обязательных плейсхолдеров категории активировать нельзя.
+func (s *TemplateStore) Activate(templateID, eventName, eventDate string) (Assignment, error) {
+	errExplanation := "can't activate certificate template"
+
+	if (eventName == "") != (eventDate == "") {
+		return Assignment{}, errWithExplanation(errExplanation, fmt.Errorf("event name and event date must be set together"))
+	}
+	if eventDate != "" {
+		if _, err := eventdate.Parse(eventDate); err != nil {
+			return Assignment{}, errWithExplanation(errExplanation, err)
+		}
+	}
+
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	template, ok := s.find(templateID)
+	if !ok {
+		return Assignment{}, errWithExplanation(errExplanation, fmt.Errorf("template %s not found", templateID))
+	} else if len(template.Missing) != 0 {
+		return Assignment{}, errWithExplanation(errExplanation, fmt.Errorf("template %s has no required placeholders %s",
+			templateID, strings.Join(wrapPlaceholders(template.Missing), ", ")))
+	}
+
+	assignment := Assignment{
+		TemplateID:  template.ID,
+		Category:    template.Category,
+		EventName:   strings.TrimSpace(eventName),
+		EventDate:   strings.TrimSpace(eventDate),
+		ActivatedAt: time.Now(),
+	}
+
+	// прежнее назначение категории для того же мероприятия заменяется
+	index := s.index
+	index.Assignments = make([]Assignment, 0, len(s.index.Assignments)+1)
+	for _, a := range s.index.Assignments {
+		if a.Category != assignment.Category || !sameEvent(a, assignment.EventName, assignment.EventDate) {
+			index.Assignments = append(index.Assignments, a)
+		}
+	}
+	index.Assignments = append(index.Assignments, assignment)
+
+	if err := s.save(index); err != nil {
+		return Assignment{}, errWithExplanation(errExplanation, err)
+	}
+
+	s.index = index
+	return assignment, nil
+}
+
+// Resolve возвращает путь к шаблону категории для мероприятия: шаблон мероприятия, иначе шаблон категории для всех
+// мероприятий, иначе встроенный шаблон из __dev__certificates__.
+func (s *TemplateStore) Resolve(category, eventName, eventDate string) (string, error) {
+	s.locker.RLock()
+	defer s.locker.RUnlock()
+
+	var templateID string
+	for _, a := range s.index.Assignments {
+		if a.Category != category {
+			continue
+		}
+		if a.EventName == "" && templateID == "" {
+			templateID = a.TemplateID
+		} else if a.EventName != "" && sameEvent(a, eventName, eventDate) {
+			templateID = a.TemplateID
+			break
+		}
+	}
+	if templateID != "" {
+		return s.templatePath(templateID), nil
+	}
+
+	path, ok := builtinTemplates[category]
+	if !ok {
+		return "", fmt.Errorf("unknown certificate category '%s'", category)
+	}
+
+	return path, nil
+}
+
+func (s *TemplateStore) find(templateID string) (Template, bool) {
+	for _, t := range s.index.Templates {
+		if t.ID == templateID {
+			return t, true
+		}
+	}
+
+	return Template{}, false
+}
+
+func (s *TemplateStore) indexPath() string {
+	return filepath.Join(s.dir, "templates.json")
+}
+
+func (s *TemplateStore) templatePath(templateID string) string {
+	return filepath.Join(s.dir, templateID+".docx")
+}
+
+func (s *TemplateStore) save(index templatesIndex) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.WriteFile(s.indexPath(), data, 0644)
+}
+
+// Мероприятие назначения совпадает, если совпадают названия (без учета регистра) и даты (в любом формате eventdate).
+func sameEvent(a Assignment, eventName, eventDate string) bool {
+	return strings.EqualFold(a.EventName, strings.TrimSpace(eventName)) && sameEventDate(a.EventDate, eventDate)
+}
+
+var placeholderRegexp = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// Открывающий тег абзаца (в том числе пустого <w:p/>), закрывающий тег и фрагмент текста w:t. Теги вроде <w:pPr> не
+// совпадают: после "w:p" должен идти пробел, ">" или "/>".
+var paragraphTokenRegexp = regexp.MustCompile(`<w:p(?:\s[^>]*)?/>|<w:p(?:\s[^>]*)?>|</w:p>|<w:t(?:\s[^>]*)?>([^<]*)</w:t>`)
+
+// TemplatePlaceholders проверяет, что content - DOCX-документ, в котором можно заменить плейсхолдеры, и возвращает
+// названия его плейсхолдеров вида {ИМЯ} (без скобок, по алфавиту). Текст фрагментов (w:t) склеивается в пределах абзаца
+// (w:p), т.к. Word может разбить плейсхолдер на несколько фрагментов, а go-docx заменяет плейсхолдеры тоже только внутри
+// абзаца. Абзацы надписей вложены в абзац, к которому привязана надпись, и собираются отдельно от него.
+func TemplatePlaceholders(content []byte) ([]string, error) {
+	docxMutex.Lock()
+	doc, err := docx.OpenBytes(content)
+	if err == nil {
+		doc.Close()
+	}
+	docxMutex.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("invalid DOCX template: %+v", err)
+	}
+
+	zipReader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DOCX template: %+v", err)
+	}
+
+	found := make(map[string]bool)
+	for _, file := range zipReader.File {
+		if file.Name != docx.DocumentXml && !docx.HeaderPathRegex.MatchString(file.Name) && !docx.FooterPathRegex.MatchString(file.Name) {
+			continue
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, paragraph := range paragraphsText(data) {
+			for _, match := range placeholderRegexp.FindAllStringSubmatch(paragraph, -1) {
+				found[strings.TrimSpace(match[1])] = true
+			}
+		}
+	}
+
+	placeholders := make([]string, 0, len(found))
+	for placeholder := range found {
+		placeholders = append(placeholders, placeholder)
+	}
+	sort.Strings(placeholders)
+
+	return placeholders, nil
+}
+
+// paragraphsText возвращает текст каждого абзаца XML-части документа data (без текста вложенных абзацев).
+func paragraphsText(data []byte) []string {
+	var (
+		paragraphs []string
+		open       []*strings.Builder
+	)
+
+	for _, match := range paragraphTokenRegexp.FindAllSubmatch(data, -1) {
+		token := string(match[0])
+		switch {
+		case strings.HasPrefix(token, "<w:t"):
+			if len(open) != 0 {
+				open[len(open)-1].Write(match[1])
+			}
+		case strings.HasSuffix(token, "/>"):
+		case token == "</w:p>":
+			if len(open) != 0 {
+				paragraphs = append(paragraphs, open[len(open)-1].String())
+				open = open[:len(open)-1]
+			}
+		default:
+			open = append(open, new(strings.Builder))
+		}
+	}
+
+	return paragraphs
+}
+
+// checkTemplateRendering заполняет плейсхолдеры шаблона content их названиями и рендерит его через NativeRenderer:
+// шаблон, из которого нельзя создать сертификат, не должен загружаться.
+func checkTemplateRendering(content []byte, placeholders []string) error {
+	sample := make(docx.PlaceholderMap, len(placeholders))
+	for _, placeholder := range placeholders {
+		sample[placeholder] = placeholder
+	}
+
+	filled, err := fillTemplateBytes(content, sample)
+	if err != nil {
+		return err
+	}
+
+	if _, err = NewNativeRenderer().Render(filled); err != nil {
+		return fmt.Errorf("template can't be rendered: %+v", err)
+	}
+
+	return nil
+}
+
+func missingPlaceholders(category string, placeholders []string) []string {
+	present := make(map[string]bool, len(placeholders))
+	for _, placeholder := range placeholders {
+		present[placeholder] = true
+	}
+
+	var missing []string
+	for _, required := range RequiredPlaceholders[category] {
+		if !present[required] {
+			missing = append(missing, required)
+		}
+	}
+
+	return missing
+}
+
+func wrapPlaceholders(placeholders []string) []string {
+	wrapped := make([]string, len(placeholders))
+	for i, placeholder := range placeholders {
+		wrapped[i] = "{" + placeholder + "}"
+	}
+
+	return wrapped
+}
+
+func fillTemplateBytes(content []byte, placeholders docx.PlaceholderMap) ([]byte, error) {
+	docxMutex.Lock()
+	defer docxMutex.Unlock()
+
+	doc, err := docx.OpenBytes(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DOCX template: %+v", err)
+	}
+	defer doc.Close()
+
+	return fillDocument(doc, placeholders)
+}
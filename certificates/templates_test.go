@@ -0,0 +1,113 @@
+package certificates
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const builtinAdultsTemplate = "../__dev__certificates__/template_adults.docx"
+
+// testTemplate возвращает встроенный шаблон, в котором word/document.xml заменен документом с телом body.
+func testTemplate(t *testing.T, body string) []byte {
+	t.Helper()
+
+	content, err := ioutil.ReadFile(builtinAdultsTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zipReader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buffer := new(bytes.Buffer)
+	zipWriter := zip.NewWriter(buffer)
+	for _, file := range zipReader.File {
+		data := []byte(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` + body + `</w:body></w:document>`)
+		if file.Name != "word/document.xml" {
+			rc, err := file.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err = ioutil.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		w, err := zipWriter.Create(file.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buffer.Bytes()
+}
+
+func TestTemplatePlaceholders(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			name: "split into runs",
+			body: `<w:p><w:pPr><w:jc w:val="center"/></w:pPr><w:r><w:t>{ИМ</w:t></w:r><w:r><w:t xml:space="preserve">Я} </w:t></w:r><w:r><w:t>{ДАТА}</w:t></w:r></w:p>`,
+			want: []string{"ДАТА", "ИМЯ"},
+		},
+		{
+			name: "split into paragraphs",
+			body: `<w:p><w:r><w:t>{ИМ</w:t></w:r></w:p><w:p/><w:p><w:r><w:t>Я}</w:t></w:r></w:p>`,
+			want: []string{},
+		},
+		{
+			name: "text box",
+			body: `<w:p><w:r><w:t>{МЕРО</w:t></w:r><w:r><w:drawing><w:txbxContent><w:p><w:r><w:t>{НМО}</w:t></w:r></w:p></w:txbxContent></w:drawing></w:r>` +
+				`<w:r><w:t>ПРИЯТИЕ}</w:t></w:r></w:p>`,
+			want: []string{"МЕРОПРИЯТИЕ", "НМО"},
+		},
+	}
+
+	for _, test := range tests {
+		placeholders, err := TemplatePlaceholders(testTemplate(t, test.body))
+		if err != nil || !reflect.DeepEqual(placeholders, test.want) {
+			t.Errorf("%s: placeholders %v, %v, want %v", test.name, placeholders, err, test.want)
+		}
+	}
+}
+
+func TestTemplateStoreUploadRendersTemplate(t *testing.T) {
+	store, err := NewTemplateStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(builtinAdultsTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if template, err := store.Upload("НМО 2024", CATEGORY_ADULTS, content); err != nil || len(template.Missing) != 0 {
+		t.Errorf("builtin template %+v, %v", template, err)
+	}
+
+	// все плейсхолдеры есть, но текст не привязан к странице, и NativeRenderer не может создать из шаблона сертификат
+	plain := testTemplate(t, `<w:p><w:r><w:t>{ИМЯ} {МЕРОПРИЯТИЕ} {ДАТА} {НМО} {ЗЕТ}</w:t></w:r></w:p>`)
+	if _, err = store.Upload("НМО 2024", CATEGORY_ADULTS, plain); err == nil || !strings.Contains(err.Error(), "can't be rendered") {
+		t.Errorf("plain template error %v", err)
+	}
+	if templates, _ := store.List(); len(templates) != 1 {
+		t.Errorf("templates %+v", templates)
+	}
+}
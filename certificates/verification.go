@@ -0,0 +1,230 @@
+package certificates
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"rsc.io/qr"
+)
+
+const (
+	qrRelationshipID = "rIdVerificationQR"
+	qrImagePath      = "word/media/verification_qr.png"
+
+	qrQuietZone   = 4  // белая рамка вокруг QR-кода в модулях (минимум по стандарту)
+	qrModulePixel = 10 // пикселей картинки на модуль QR-кода
+
+	verificationShare  = 0.12 // сторона QR-кода относительно высоты страницы
+	verificationMargin = 0.04 // отступ QR-кода от левого и нижнего краев страницы относительно высоты страницы
+	serialHeightShare  = 0.25 // высота надписи с серийным номером относительно стороны QR-кода
+
+	verificationOrder = 251700000 // relativeHeight выше, чем у надписей шаблонов, чтобы QR-код рисовался поверх фона
+)
+
+// AddVerification добавляет в заполненный DOCX-шаблон сертификата QR-код со ссылкой verifyURL и надпись с серийным
+// номером serial в левом нижнем углу страницы. QR-код и надпись привязываются к координатам страницы (wp:anchor), как
+// и остальные элементы шаблонов, поэтому их переносит в PDF любой CertificateRenderer.
+func AddVerification(filledDOCX []byte, serial, verifyURL string) ([]byte, error) {
+	errExplanation := "adding verification QR code to certificate error"
+
+	qrPNG, err := encodeQR(verifyURL)
+	if err != nil {
+		return nil, errWithExplanation(errExplanation, err)
+	}
+
+	zipReader, err := zip.NewReader(bytes.NewReader(filledDOCX), int64(len(filledDOCX)))
+	if err != nil {
+		return nil, errWithExplanation(errExplanation, err)
+	}
+
+	buffer := new(bytes.Buffer)
+	zipWriter := zip.NewWriter(buffer)
+	for _, file := range zipReader.File {
+		rc, err := file.Open()
+		if err != nil {
+			return nil, errWithExplanation(errExplanation, err)
+		}
+
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, errWithExplanation(errExplanation, err)
+		}
+
+		switch file.Name {
+		case "word/document.xml":
+			data, err = addVerificationAnchors(data, serial)
+		case "word/_rels/document.xml.rels":
+			data, err = insertBefore(data, "</Relationships>", fmt.Sprintf(
+				`<Relationship Id="%s" Type="%s/image" Target="%s"/>`, qrRelationshipID, nsR, strings.TrimPrefix(qrImagePath, "word/")))
+		case "[Content_Types].xml":
+			if !bytes.Contains(data, []byte(`Extension="png"`)) {
+				data, err = insertBefore(data, "</Types>", `<Default Extension="png" ContentType="image/png"/>`)
+			}
+		}
+		if err != nil {
+			return nil, errWithExplanation(errExplanation, fmt.Errorf("%s: %+v", file.Name, err))
+		}
+
+		if err = writeZipFile(zipWriter, file.Name, data); err != nil {
+			return nil, errWithExplanation(errExplanation, err)
+		}
+	}
+
+	if err = writeZipFile(zipWriter, qrImagePath, qrPNG); err != nil {
+		return nil, errWithExplanation(errExplanation, err)
+	}
+	if err = zipWriter.Close(); err != nil {
+		return nil, errWithExplanation(errExplanation, err)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// encodeQR рисует QR-код text в PNG (черные модули на белом фоне с рамкой qrQuietZone).
+func encodeQR(text string) ([]byte, error) {
+	code, err := qr.Encode(text, qr.M)
+	if err != nil {
+		return nil, err
+	}
+
+	side := (code.Size + 2*qrQuietZone) * qrModulePixel
+	img := image.NewGray(image.Rect(0, 0, side, side))
+	for y := 0; y < side; y++ {
+		for x := 0; x < side; x++ {
+			pixel := color.Gray{Y: 0xFF}
+			if code.Black(x/qrModulePixel-qrQuietZone, y/qrModulePixel-qrQuietZone) {
+				pixel = color.Gray{Y: 0x00}
+			}
+			img.SetGray(x, y, pixel)
+		}
+	}
+
+	buffer := new(bytes.Buffer)
+	if err = png.Encode(buffer, img); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// addVerificationAnchors дописывает QR-код и надпись с серийным номером в первый абзац документа (в шаблонах все
+// элементы привязаны к первому абзацу). Размеры и отступы считаются от высоты страницы, т.к. шаблоны сверстаны
+// на нестандартных листах.
+func addVerificationAnchors(document []byte, serial string) ([]byte, error) {
+	node, err := parseXMLNode(document)
+	if err != nil {
+		return nil, err
+	}
+
+	page := parsePage(node, nil)
+	side := page.Height * verificationShare
+	margin := page.Height * verificationMargin
+	x, y := margin, page.Height-margin-side*(1+serialHeightShare)
+	serialHeight := side * serialHeightShare
+
+	escapedSerial := new(bytes.Buffer)
+	if err = xml.EscapeText(escapedSerial, []byte("№ "+serial)); err != nil {
+		return nil, err
+	}
+
+	picture := fmt.Sprintf(`<w:r><w:drawing>%s<a:graphic xmlns:a="%s"><a:graphicData uri="http://schemas.openxmlformats.org/drawingml/2006/picture">`+
+		`<pic:pic xmlns:pic="http://schemas.openxmlformats.org/drawingml/2006/picture"><pic:nvPicPr><pic:cNvPr id="0" name="verification_qr.png"/><pic:cNvPicPr/></pic:nvPicPr>`+
+		`<pic:blipFill><a:blip r:embed="%s"/><a:stretch><a:fillRect/></a:stretch></pic:blipFill>`+
+		`<pic:spPr><a:xfrm><a:off x="0" y="0"/><a:ext cx="%s" cy="%s"/></a:xfrm><a:prstGeom prst="rect"><a:avLst/></a:prstGeom></pic:spPr></pic:pic>`+
+		`</a:graphicData></a:graphic></wp:anchor></w:drawing></w:r>`,
+		anchorStart(9001, "QR-код проверки сертификата", x, y, side, side, verificationOrder), nsA, qrRelationshipID, ptToEMU(side), ptToEMU(side))
+
+	// размер шрифта - половина высоты надписи (в DOCX - в половинах пунктов)
+	fontSize := strconv.Itoa(int(serialHeight / 2 * halfPtInPt))
+	caption := fmt.Sprintf(`<w:r><w:drawing>%s<a:graphic xmlns:a="%s"><a:graphicData uri="http://schemas.microsoft.com/office/word/2010/wordprocessingShape">`+
+		`<wps:wsp xmlns:wps="%s"><wps:cNvSpPr txBox="1"/><wps:spPr><a:xfrm><a:off x="0" y="0"/><a:ext cx="%s" cy="%s"/></a:xfrm><a:prstGeom prst="rect"><a:avLst/></a:prstGeom><a:noFill/><a:ln><a:noFill/></a:ln></wps:spPr>`+
+		`<wps:txbx><w:txbxContent><w:p><w:r><w:rPr><w:color w:val="000000"/><w:sz w:val="%s"/><w:szCs w:val="%s"/></w:rPr><w:t>%s</w:t></w:r></w:p></w:txbxContent></wps:txbx>`+
+		`<wps:bodyPr wrap="square" lIns="0" tIns="0" rIns="0" bIns="0"><a:noAutofit/></wps:bodyPr></wps:wsp></a:graphicData></a:graphic></wp:anchor></w:drawing></w:r>`,
+		anchorStart(9002, "Серийный номер сертификата", x, y+side, side*3, serialHeight, verificationOrder+1), nsA, nsWPS,
+		ptToEMU(side*3), ptToEMU(serialHeight), fontSize, fontSize, escapedSerial.String())
+
+	return insertIntoFirstParagraph(document, picture+caption)
+}
+
+// insertIntoFirstParagraph вставляет фрагменты w:r в начало первого абзаца тела документа (после свойств абзаца).
+// Новый абзац не добавляется, т.к. он сдвинул бы элементы шаблона, привязанные к абзацу.
+func insertIntoFirstParagraph(document []byte, runs string) ([]byte, error) {
+	body := bytes.Index(document, []byte("<w:body>"))
+	if body == -1 {
+		return nil, fmt.Errorf("<w:body> not found")
+	}
+
+	// первый элемент тела - абзац <w:p> или <w:p ...> (не <w:pPr>, <w:proofErr> и т.п.)
+	paragraph := -1
+	for i := body; i < len(document); i++ {
+		if bytes.HasPrefix(document[i:], []byte("<w:p>")) || bytes.HasPrefix(document[i:], []byte("<w:p ")) {
+			paragraph = i
+			break
+		}
+	}
+	if paragraph == -1 {
+		return nil, fmt.Errorf("document has no paragraphs")
+	}
+
+	i := paragraph + bytes.IndexByte(document[paragraph:], '>') + 1
+	switch {
+	case bytes.HasPrefix(document[i:], []byte("<w:pPr/>")):
+		i += len("<w:pPr/>")
+	case bytes.HasPrefix(document[i:], []byte("<w:pPr>")) || bytes.HasPrefix(document[i:], []byte("<w:pPr ")):
+		end := bytes.Index(document[i:], []byte("</w:pPr>"))
+		if end == -1 {
+			return nil, fmt.Errorf("</w:pPr> not found")
+		}
+		i += end + len("</w:pPr>")
+	}
+
+	result := make([]byte, 0, len(document)+len(runs))
+	result = append(result, document[:i]...)
+	result = append(result, runs...)
+	return append(result, document[i:]...), nil
+}
+
+// anchorStart - начало элемента wp:anchor, привязанного к координатам страницы (x, y, width и height - в пунктах).
+func anchorStart(id int, name string, x, y, width, height float64, order int) string {
+	return fmt.Sprintf(`<wp:anchor xmlns:wp="%s" distT="0" distB="0" distL="0" distR="0" simplePos="0" relativeHeight="%v" behindDoc="0" locked="1" layoutInCell="1" allowOverlap="1">`+
+		`<wp:simplePos x="0" y="0"/><wp:positionH relativeFrom="page"><wp:posOffset>%s</wp:posOffset></wp:positionH>`+
+		`<wp:positionV relativeFrom="page"><wp:posOffset>%s</wp:posOffset></wp:positionV><wp:extent cx="%s" cy="%s"/>`+
+		`<wp:effectExtent l="0" t="0" r="0" b="0"/><wp:wrapNone/><wp:docPr id="%v" name="%s"/><wp:cNvGraphicFramePr/>`,
+		nsWP, order, ptToEMU(x), ptToEMU(y), ptToEMU(width), ptToEMU(height), id, name)
+}
+
+func ptToEMU(pt float64) string {
+	return strconv.Itoa(int(pt * emuPerPt))
+}
+
+// insertBefore вставляет fragment перед первым вхождением marker.
+func insertBefore(data []byte, marker, fragment string) ([]byte, error) {
+	i := bytes.Index(data, []byte(marker))
+	if i == -1 {
+		return nil, fmt.Errorf("%s not found", marker)
+	}
+
+	result := make([]byte, 0, len(data)+len(fragment))
+	result = append(result, data[:i]...)
+	result = append(result, fragment...)
+	return append(result, data[i:]...), nil
+}
+
+func writeZipFile(zipWriter *zip.Writer, name string, data []byte) error {
+	w, err := zipWriter.Create(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,107 @@
+package dashamail
+
+// CampaignsService - методы campaigns.*.
+type CampaignsService struct {
+	client *Client
+}
+
+type Campaign struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	Status       string `json:"status"`
+	DeliveryTime string `json:"delivery_time"`
+
+	AnalyticsTag     string `json:"analytics_tag"`
+	AnalyticsSource  string `json:"analytics_source"`
+	AnalyticsMedium  string `json:"analytics_medium"`
+	AnalyticsContent string `json:"analytics_content"`
+	AnalyticsTerm    string `json:"analytics_term"`
+}
+
+// CampaignsFilter - фильтры campaigns.get. Start и End - даты в формате YYYY-MM-DD; для status="SENT" фильтр
+// применяется к delivery_time, причем день End в фильтр не входит.
+type CampaignsFilter struct {
+	Status string
+	Start  string
+	End    string
+}
+
+func (c *CampaignsService) Get(filter CampaignsFilter) ([]Campaign, error) {
+	params := map[string]interface{}{
+		"merge_json": 1, // любой int вернет данные массивов в виде JSON-представления
+	}
+	if filter.Status != "" {
+		params["status"] = filter.Status
+	}
+	if filter.Start != "" {
+		params["start"] = filter.Start
+	}
+	if filter.End != "" {
+		params["end"] = filter.End
+	}
+
+	campaigns := make([]Campaign, 0)
+	err := c.client.call("campaigns.get", params, &campaigns)
+	if err != nil {
+		return nil, err
+	}
+
+	return campaigns, nil
+}
+
+// ReportsService - методы reports.*.
+type ReportsService struct {
+	client *Client
+}
+
+// Summary - сводная статистика рассылки (reports.summary).
+type Summary struct {
+	Sent              int    `json:"sent"`
+	Clicked           int    `json:"clicked"`
+	Opened            int    `json:"opened"`
+	FirstSent         string `json:"first_sent"`
+	FirstOpen         string `json:"first_open"`
+	LastOpen          string `json:"last_open"`
+	FirstClick        string `json:"first_click"`
+	LastClick         string `json:"last_click"`
+	UniqueOpened      int    `json:"unique_opened"`
+	UniqueClicked     int    `json:"unique_clicked"`
+	Unsubscribed      int    `json:"unsubscribed"`
+	SpamComplained    int    `json:"complained"`
+	SpamBlocked       int    `json:"spam_blocked"`
+	SpamMarked        int    `json:"spam"`
+	MailSystemBlocked int    `json:"blk"`
+	Hard              int    `json:"hard"`
+	Soft              int    `json:"soft"`
+}
+
+func (r *ReportsService) Summary(campaignID int) (*Summary, error) {
+	summary := new(Summary)
+	err := r.client.call("reports.summary", map[string]interface{}{"campaign_id": campaignID}, summary)
+	if err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+// LinkClicks - переходы по одной ссылке рассылки (reports.clickstat).
+type LinkClicks struct {
+	Link         string `json:"link"`
+	Clicks       int    `json:"clicks"`
+	UniqueClicks int    `json:"unique_clicks"`
+}
+
+// ClickStat возвращает переходы по ссылкам рассылки. Если по ссылкам не переходили, DashaMail отвечает ошибкой
+// "нет данных при выводе" - тогда возвращается пустой список.
+func (r *ReportsService) ClickStat(campaignID int) ([]LinkClicks, error) {
+	links := make([]LinkClicks, 0)
+	err := r.client.call("reports.clickstat", map[string]interface{}{"campaign_id": campaignID}, &links)
+	if IsCode(err, ERR_NO_DATA) {
+		return []LinkClicks{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return links, nil
+}
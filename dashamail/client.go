@@ -0,0 +1,164 @@
+package dashamail
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+const DEFAULT_BASE_URL = "https://api.dashamail.com/"
+
+// Client - клиент API DashaMail. Методы сгруппированы так же, как в документации DashaMail (lists.*, campaigns.*, reports.*).
+// Клиент не хранит состояния между запросами, поэтому его можно использовать из нескольких горутин одновременно.
+type Client struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+
+	Lists     *ListsService
+	Campaigns *CampaignsService
+	Reports   *ReportsService
+}
+
+// NewClient создает клиент. Пустой baseURL соответствует DEFAULT_BASE_URL (другой URL нужен, например, для локальной
+// замены DashaMail в тестах), nil httpClient - http.DefaultClient.
+func NewClient(baseURL, apiKey string, httpClient *http.Client) *Client {
+	if baseURL == "" {
+		baseURL = DEFAULT_BASE_URL
+	}
+
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	c := &Client{baseURL: baseURL, apiKey: apiKey, httpClient: httpClient}
+	c.Lists = &ListsService{client: c}
+	c.Campaigns = &CampaignsService{client: c}
+	c.Reports = &ReportsService{client: c}
+
+	return c
+}
+
+type response struct {
+	Response struct {
+		Msg  Msg             `json:"msg"`
+		Data json.RawMessage `json:"data"`
+	} `json:"response"`
+}
+
+// Msg - служебная часть ответа DashaMail.
+type Msg struct {
+	ErrorCode int64  `json:"err_code"`
+	Text      string `json:"text"`
+	Type      string `json:"type"`
+}
+
+// call выполняет метод API и декодирует поле data ответа в result (если result не nil).
+// Любая ошибка возвращается в виде *CallError, в котором сохранены отправленные и полученные данные.
+func (c *Client) call(method string, params map[string]interface{}, result interface{}) error {
+	body := map[string]interface{}{"method": method, "api_key": c.apiKey}
+	for param, value := range params {
+		body[param] = value
+	}
+
+	callErr := &CallError{Method: method, Sent: maskedBody(body)}
+
+	sent, err := json.Marshal(body)
+	if err != nil {
+		callErr.Err = err
+		return callErr
+	}
+
+	request, err := http.NewRequest(http.MethodPost, c.baseURL, bytes.NewReader(sent))
+	if err != nil {
+		callErr.Err = err
+		return callErr
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		callErr.Err = err
+		return callErr
+	}
+	defer resp.Body.Close()
+
+	received, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		callErr.Err = err
+		return callErr
+	}
+	callErr.Received = received
+
+	if resp.StatusCode != http.StatusOK {
+		callErr.Err = fmt.Errorf("unexpected HTTP status %s", resp.Status)
+		return callErr
+	}
+
+	var r response
+	err = json.Unmarshal(received, &r)
+	if err != nil {
+		callErr.Err = fmt.Errorf("can't decode response: %+v", err)
+		return callErr
+	}
+
+	if err = r.Response.Msg.err(); err != nil {
+		callErr.Err = err
+		return callErr
+	}
+
+	if result == nil || emptyData(r.Response.Data) {
+		return nil
+	}
+
+	err = decodeWeakly(r.Response.Data, result)
+	if err != nil {
+		callErr.Err = fmt.Errorf("can't decode response data: %+v", err)
+		return callErr
+	}
+
+	return nil
+}
+
+// maskedBody возвращает тело запроса без ключа API: CallError.Sent попадает в логи и в ответы клиентам.
+func maskedBody(body map[string]interface{}) []byte {
+	masked := make(map[string]interface{}, len(body))
+	for param, value := range body {
+		masked[param] = value
+	}
+	masked["api_key"] = "***"
+
+	sent, _ := json.Marshal(masked)
+	return sent
+}
+
+// При отсутствии данных DashaMail присылает то null, то пустую строку.
+func emptyData(data json.RawMessage) bool {
+	d := string(bytes.TrimSpace(data))
+	return d == "" || d == "null" || d == `""`
+}
+
+// DashaMail возвращает одни и те же числовые поля то строками, то числами, поэтому данные декодируются
+// через mapstructure с приведением типов (по json-тегам).
+func decodeWeakly(data json.RawMessage, result interface{}) error {
+	var raw interface{}
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		WeaklyTypedInput: true,
+		TagName:          "json",
+		Result:           result,
+	})
+	if err != nil {
+		return err
+	}
+
+	return decoder.Decode(raw)
+}
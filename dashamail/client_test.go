@@ -0,0 +1,34 @@
+package dashamail
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCallErrorMasksAPIKey(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = string(body)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewClient(server.URL, "secret-key", nil)
+	err := client.call("lists.get", map[string]interface{}{"list_id": "90001"}, nil)
+
+	var callErr *CallError
+	if !errors.As(err, &callErr) {
+		t.Fatalf("error %v, want *CallError", err)
+	}
+	if !strings.Contains(received, "secret-key") {
+		t.Errorf("DashaMail got %s without API key", received)
+	}
+	if sent := string(callErr.Sent); strings.Contains(sent, "secret-key") || !strings.Contains(sent, `"api_key":"***"`) || !strings.Contains(sent, `"list_id":"90001"`) {
+		t.Errorf("sent data in error %s", sent)
+	}
+}
@@ -0,0 +1,337 @@
+// Package dashamailtest - локальная замена API DashaMail для тестов. Сервер эмулирует методы, которые использует
+// веб-сервис (lists.get, lists.get_members, lists.add_member, campaigns.get, reports.summary,
+// reports.clickstat), и хранит данные в памяти.
+package dashamailtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"zo-backend/dashamail"
+)
+
+// Fixture - начальные данные сервера.
+type Fixture struct {
+	Lists     []List                            `json:"lists"`
+	Campaigns []dashamail.Campaign              `json:"campaigns"`
+	Summaries map[string]dashamail.Summary      `json:"summaries"` // ключ - id рассылки
+	Clicks    map[string][]dashamail.LinkClicks `json:"clicks"`    // ключ - id рассылки
+}
+
+// List - адресная база. Fields - названия столбцов (ключ - системное название вида merge_1), Members - подписчики
+// в том виде, в котором их возвращает lists.get_members.
+type List struct {
+	ID      string             `json:"id"`
+	Name    string             `json:"name"`
+	Fields  map[string]string  `json:"fields"`
+	Members []dashamail.Member `json:"members"`
+}
+
+func LoadFixture(fileName string) (*Fixture, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var fixture Fixture
+	err = json.Unmarshal(data, &fixture)
+	if err != nil {
+		return nil, fmt.Errorf("can't decode DashaMail fixture %s: %+v", fileName, err)
+	}
+
+	return &fixture, nil
+}
+
+// Server - запущенный httptest-сервер. URL передается в dashamail.NewClient (или в $DASHAMAIL_URI).
+type Server struct {
+	*httptest.Server
+
+	apiKey  string
+	fixture Fixture
+	mu      sync.Mutex
+}
+
+// NewServer запускает сервер с копией данных fixture. Запросы с api_key, отличным от apiKey, завершаются ошибкой 1.
+func NewServer(apiKey string, fixture *Fixture) *Server {
+	s := &Server{apiKey: apiKey}
+	if fixture != nil {
+		data, _ := json.Marshal(fixture)
+		_ = json.Unmarshal(data, &s.fixture)
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Member возвращает текущие данные подписчика email адресной базы listID (nil, если подписчика нет).
+func (s *Server) Member(listID, email string) dashamail.Member {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := s.list(listID)
+	if list == nil {
+		return nil
+	}
+
+	i := memberIndex(list, email)
+	if i == -1 {
+		return nil
+	}
+
+	member := make(dashamail.Member, len(list.Members[i]))
+	for field, value := range list.Members[i] {
+		member[field] = value
+	}
+
+	return member
+}
+
+// Ошибка с кодом DashaMail (HTTP-статус при этом 200, как и у настоящего DashaMail).
+type apiError int64
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	var params map[string]interface{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if params["api_key"] != s.apiKey {
+		writeResponse(w, apiError(1), nil)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var data interface{}
+	method, _ := params["method"].(string)
+	switch method {
+	case "lists.get":
+		data, err = s.listsGet(params)
+	case "lists.get_members":
+		data, err = s.listsGetMembers(params)
+	case "lists.add_member":
+		err = s.listsAddMember(params)
+	case "campaigns.get":
+		data, err = s.campaignsGet(params)
+	case "reports.summary":
+		data, err = s.reportsSummary(params)
+	case "reports.clickstat":
+		data, err = s.reportsClickStat(params)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not emulated", method), http.StatusNotImplemented)
+		return
+	}
+
+	writeResponse(w, err, data)
+}
+
+func writeResponse(w http.ResponseWriter, err error, data interface{}) {
+	msg := map[string]interface{}{"err_code": 0, "text": "OK", "type": "message"}
+	if code, ok := err.(apiError); ok {
+		msg = map[string]interface{}{"err_code": int64(code), "text": fmt.Sprintf("error %v", int64(code)), "type": "error"}
+		data = nil
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if data == nil {
+		data = ""
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"response": map[string]interface{}{"msg": msg, "data": data},
+	})
+}
+
+func (e apiError) Error() string {
+	return fmt.Sprintf("DashaMail error %v", int64(e))
+}
+
+func (s *Server) list(listID string) *List {
+	for i := range s.fixture.Lists {
+		if s.fixture.Lists[i].ID == listID {
+			return &s.fixture.Lists[i]
+		}
+	}
+
+	return nil
+}
+
+func memberIndex(list *List, email string) int {
+	for i, member := range list.Members {
+		if strings.EqualFold(member.Email(), email) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (s *Server) listsGet(params map[string]interface{}) (interface{}, error) {
+	listID := param(params, "list_id")
+
+	lists := make([]map[string]interface{}, 0)
+	for _, list := range s.fixture.Lists {
+		if listID != "" && list.ID != listID {
+			continue
+		}
+
+		l := map[string]interface{}{"id": list.ID, "name": list.Name}
+		for field, title := range list.Fields {
+			description, _ := json.Marshal(map[string]string{"title": title, "type": "text"})
+			l[field] = string(description)
+		}
+		lists = append(lists, l)
+	}
+
+	if len(lists) == 0 {
+		if listID != "" {
+			return nil, apiError(dashamail.ERR_NO_SUCH_LIST)
+		}
+		return nil, apiError(dashamail.ERR_NO_DATA)
+	}
+
+	return lists, nil
+}
+
+func (s *Server) listsGetMembers(params map[string]interface{}) (interface{}, error) {
+	list := s.list(param(params, "list_id"))
+	if list == nil {
+		return nil, apiError(dashamail.ERR_NO_SUCH_LIST)
+	}
+
+	members := make([]dashamail.Member, 0)
+	email := param(params, "email")
+	for _, member := range list.Members {
+		if email == "" || strings.EqualFold(member.Email(), email) {
+			members = append(members, member)
+		}
+	}
+
+	offset, _ := strconv.Atoi(param(params, "offset"))
+	limit, _ := strconv.Atoi(param(params, "limit"))
+	if offset >= len(members) {
+		return nil, apiError(dashamail.ERR_NO_DATA)
+	}
+	members = members[offset:]
+	if limit > 0 && limit < len(members) {
+		members = members[:limit]
+	}
+
+	return members, nil
+}
+
+func (s *Server) listsAddMember(params map[string]interface{}) error {
+	list := s.list(param(params, "list_id"))
+	if list == nil {
+		return apiError(dashamail.ERR_NO_SUCH_LIST)
+	}
+
+	email := param(params, "email")
+	_, noCheck := params["no_check"]
+	if !noCheck && !strings.Contains(email, "@") {
+		return apiError(dashamail.ERR_INVALID_EMAIL)
+	}
+
+	i := memberIndex(list, email)
+	_, update := params["update"]
+	if i != -1 && !update {
+		return apiError(7)
+	}
+
+	if i == -1 {
+		list.Members = append(list.Members, dashamail.Member{"email": email, "state": "active"})
+		i = len(list.Members) - 1
+	}
+
+	for field := range params {
+		if !strings.HasPrefix(field, "merge_") {
+			continue
+		}
+		if _, ok := list.Fields[field]; !ok {
+			return apiError(3)
+		}
+		list.Members[i][field] = param(params, field) // DashaMail хранит значения всех столбцов строками
+	}
+
+	return nil
+}
+
+func (s *Server) campaignsGet(params map[string]interface{}) (interface{}, error) {
+	status := param(params, "status")
+	start, _ := time.Parse("2006-01-02", param(params, "start"))
+	end, _ := time.Parse("2006-01-02", param(params, "end"))
+
+	campaigns := make([]dashamail.Campaign, 0)
+	for _, campaign := range s.fixture.Campaigns {
+		if status != "" && campaign.Status != status {
+			continue
+		}
+
+		deliveryTime, err := time.Parse("2006-01-02 15:04:05", campaign.DeliveryTime)
+		if err != nil {
+			return nil, fmt.Errorf("invalid delivery_time of campaign %s in fixture: %+v", campaign.ID, err)
+		}
+		if (!start.IsZero() && deliveryTime.Before(start)) || (!end.IsZero() && !deliveryTime.Before(end)) {
+			continue
+		}
+		campaigns = append(campaigns, campaign)
+	}
+
+	if len(campaigns) == 0 {
+		return nil, apiError(dashamail.ERR_NO_DATA)
+	}
+
+	sort.Slice(campaigns, func(i, j int) bool { return campaigns[i].DeliveryTime < campaigns[j].DeliveryTime })
+	return campaigns, nil
+}
+
+func (s *Server) reportsSummary(params map[string]interface{}) (interface{}, error) {
+	summary, ok := s.fixture.Summaries[param(params, "campaign_id")]
+	if !ok {
+		return nil, apiError(dashamail.ERR_NO_SUCH_CAMPAIGN)
+	}
+
+	return summary, nil
+}
+
+func (s *Server) reportsClickStat(params map[string]interface{}) (interface{}, error) {
+	campaignID := param(params, "campaign_id")
+	if _, ok := s.fixture.Summaries[campaignID]; !ok {
+		return nil, apiError(dashamail.ERR_NO_SUCH_CAMPAIGN)
+	}
+
+	links := s.fixture.Clicks[campaignID]
+	if len(links) == 0 {
+		return nil, apiError(dashamail.ERR_NO_DATA)
+	}
+
+	return links, nil
+}
+
+// Параметры приходят в JSON то строками, то числами.
+func param(params map[string]interface{}, name string) string {
+	switch v := params[name].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
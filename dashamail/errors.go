@@ -0,0 +1,124 @@
+package dashamail
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Коды ошибок DashaMail, которые чаще всего приходится проверять через IsCode. Полный список - в errorMeanings.
+const (
+	ERR_NO_DATA            = 4
+	ERR_NO_SUCH_LIST       = 5
+	ERR_INVALID_EMAIL      = 6
+	ERR_NO_SUCH_SUBSCRIBER = 9
+	ERR_NO_SUCH_CAMPAIGN   = 22
+)
+
+var errorMeanings = map[int64]string{
+	1:  "неверный логин и(или) пароль",
+	2:  "ошибка при добавлении в базу",
+	3:  "заданы не все необходимые параметры",
+	4:  "нет данных при выводе",
+	5:  "у пользователя нет адресной базы с таким id",
+	6:  "некорректный email-адрес",
+	7:  "такой пользователь уже есть в этой адресной базе",
+	8:  "лимит по количеству активных подписчиков на тарифном плане клиента",
+	9:  "нет такого подписчика у клиента",
+	10: "пользователь уже отписан",
+	11: "нет данных для обновления подписчика",
+	12: "не заданы элементы списка",
+	13: "не задано время рассылки",
+	14: "не задан заголовок письма",
+	15: "не задано поле 'От Кого?'",
+	16: "не задан обратный адрес",
+	17: "не задана ни html, ни plain_text версия письма",
+	18: "нет ссылки отписаться (ссылки с id='unsub_link') в тексте рассылки",
+	19: "нет ссылки отписаться ('%ОТПИСАТЬСЯ%') в тексте рассылки",
+	20: "задан недопустимый статус рассылки",
+	21: "рассылка уже отправляется",
+	22: "у вас нет кампании с таким campaign_id",
+	23: "нет такого поля для сортировки",
+	24: "заданы недопустимые события для авторассылки",
+	25: "загружаемый файл уже существует",
+	26: "загружаемый файл больше 5 Мб",
+	27: "файл не найден",
+	28: "указанный шаблон не существует",
+	29: "определен одноразовый email-адрес",
+	30: "отправка рассылок заблокирована по подозрению в спаме",
+	31: "массив email-адресов пуст",
+	32: "нет корректных адресов для добавления",
+	33: "недопустимый формат файла",
+	34: "необходимо настроить собственный домен отправки",
+	35: "данный функционал недоступен на бесплатных тарифах и во время триального периода",
+	36: "ошибка при отправке письма",
+	37: "рассылка еще не прошла модерацию",
+	38: "недопустимый сегмент",
+	39: "нет папки с таким id",
+	40: "рассылка не находится в статусе 'PROCESSING' или 'SENT'",
+	41: "рассылка не отправляется в данный момент",
+	42: "у вас нет рассылки на паузе с таким campaign_id",
+	43: "пользователь в черном списке (двойная отписка)",
+	44: "пользователь в черном списке (нажатие 'ЭТО СПАМ')",
+	45: "пользователь в черном списке (ручное)",
+	46: "несуществующий email-адрес (находится в глобальном списке возвратов)",
+	47: "ваш IP-адрес не включен в список разрешенных",
+	48: "не удалось отправить письмо подтверждения для обратного адреса",
+	49: "такой адрес уже подтвержден",
+	50: "нельзя использовать одноразовые email в обратном адресе",
+	51: "использование обратного адреса на публичных доменах Mail.ru СТРОГО ЗАПРЕЩЕНО политикой DMARC данного почтового провайдера",
+	52: "email-адрес не подтвержден в качестве отправителя",
+	53: "недопустимое событие для webhook",
+	54: "некорректный домен, т.к. кириллические и другие национальные домены в качестве DKIM/SPF запрещены",
+	55: "данный домен находится в черном списке, его добавление запрещено",
+	56: "данный домен занят другим аккаунтом",
+}
+
+// Error - ошибка, которую вернул сам DashaMail (ненулевой err_code в ответе).
+type Error struct {
+	Code    int64
+	Text    string
+	Meaning string
+}
+
+func (e *Error) Error() string {
+	if e.Meaning == "" {
+		return fmt.Sprintf("DashaMail unknown error with code %v: %s", e.Code, e.Text)
+	}
+
+	return fmt.Sprintf("DashaMail error with code %v: %s {meaning %s}", e.Code, e.Text, e.Meaning)
+}
+
+func (m Msg) err() error {
+	if m.ErrorCode == 0 {
+		return nil
+	}
+
+	return &Error{Code: m.ErrorCode, Text: m.Text, Meaning: errorMeanings[m.ErrorCode]}
+}
+
+// CallError - любая ошибка вызова метода API (сетевая, ошибка декодирования или *Error). Хранит отправленные и
+// полученные данные для отладки.
+type CallError struct {
+	Method   string
+	Sent     []byte
+	Received []byte
+	Err      error
+}
+
+func (e *CallError) Error() string {
+	return fmt.Sprintf("DashaMail method %s: %v", e.Method, e.Err)
+}
+
+func (e *CallError) Unwrap() error {
+	return e.Err
+}
+
+func (e *CallError) ExchangeData() (sent, received []byte) {
+	return e.Sent, e.Received
+}
+
+// IsCode проверяет, что err - ошибка DashaMail с кодом code.
+func IsCode(err error, code int64) bool {
+	var dmErr *Error
+	return errors.As(err, &dmErr) && dmErr.Code == code
+}
@@ -0,0 +1,209 @@
+package dashamail
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// DEFAULT_PAGE_SIZE - размер страницы, которым GetAllMembers читает адресную базу.
+const DEFAULT_PAGE_SIZE = 10000
+
+// ListsService - методы lists.* (адресные базы, в веб-сервисе их также называют книгами).
+type ListsService struct {
+	client *Client
+}
+
+// List - адресная база. Fields - названия столбцов базы: ключ - системное название вида merge_1, значение - название,
+// которое задано в DashaMail (например, "основная_медицинская_специализация").
+type List struct {
+	ID     string
+	Name   string
+	Fields map[string]string
+}
+
+// Member - подписчик адресной базы в том виде, в котором его возвращает DashaMail (ключи - email, state, merge_1 и т.д.).
+type Member map[string]interface{}
+
+func (m Member) Email() string {
+	email, _ := m["email"].(string)
+	return email
+}
+
+// Get возвращает адресную базу listID или все адресные базы аккаунта, если listID пустой.
+func (l *ListsService) Get(listID string) ([]List, error) {
+	params := map[string]interface{}{
+		"merge_json": 1, // любой int вернет данные массивов в виде JSON-представления
+	}
+	if listID != "" {
+		params["list_id"] = listID
+	}
+
+	var data []map[string]interface{}
+	err := l.client.call("lists.get", params, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	lists := make([]List, 0, len(data))
+	for _, d := range data {
+		list := List{
+			ID:     fmt.Sprint(d["id"]),
+			Fields: make(map[string]string),
+		}
+		list.Name, _ = d["name"].(string)
+
+		for field, value := range d {
+			if strings.HasPrefix(field, "merge_") {
+				list.Fields[field] = fieldTitle(value)
+			}
+		}
+		lists = append(lists, list)
+	}
+
+	return lists, nil
+}
+
+// GetOne возвращает адресную базу listID и проверяет, что DashaMail вернул ровно одну базу.
+func (l *ListsService) GetOne(listID string) (*List, error) {
+	lists, err := l.Get(listID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = checkForOnlyOneElement(len(lists)); err != nil {
+		return nil, fmt.Errorf("list %s: %+v", listID, err)
+	}
+
+	return &lists[0], nil
+}
+
+// Описание столбца приходит JSON-строкой вида {"title": "...", "type": "..."}.
+func fieldTitle(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		var field struct {
+			Title string `json:"title"`
+		}
+		if err := json.Unmarshal([]byte(v), &field); err != nil {
+			return v
+		}
+		return field.Title
+	case map[string]interface{}:
+		title, _ := v["title"].(string)
+		return title
+	default:
+		return ""
+	}
+}
+
+// GetMembersOptions - фильтры lists.get_members. Нулевые значения не передаются в DashaMail.
+type GetMembersOptions struct {
+	Email  string
+	Limit  int
+	Offset int
+}
+
+// GetMembers возвращает одну страницу подписчиков адресной базы listID.
+func (l *ListsService) GetMembers(listID string, options GetMembersOptions) ([]Member, error) {
+	params := map[string]interface{}{"list_id": listID}
+	if options.Email != "" {
+		params["email"] = options.Email
+	}
+	if options.Limit != 0 {
+		params["limit"] = options.Limit
+	}
+	if options.Offset != 0 {
+		params["offset"] = options.Offset
+	}
+
+	var members []Member
+	err := l.client.call("lists.get_members", params, &members)
+	if err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// GetAllMembers читает адресную базу listID постранично (по pageSize подписчиков, 0 - DEFAULT_PAGE_SIZE).
+func (l *ListsService) GetAllMembers(listID string, pageSize int) ([]Member, error) {
+	if pageSize <= 0 {
+		pageSize = DEFAULT_PAGE_SIZE
+	}
+
+	members := make([]Member, 0)
+	for offset := 0; ; offset += pageSize {
+		page, err := l.GetMembers(listID, GetMembersOptions{Limit: pageSize, Offset: offset})
+		if err != nil {
+			// пустая страница после последней полной страницы - не ошибка
+			if offset != 0 && IsCode(err, ERR_NO_DATA) {
+				break
+			}
+			return nil, err
+		}
+
+		members = append(members, page...)
+		if len(page) < pageSize {
+			break
+		}
+	}
+
+	return members, nil
+}
+
+// GetMember возвращает подписчика с адресом email и проверяет, что DashaMail вернул ровно одного подписчика.
+func (l *ListsService) GetMember(listID, email string) (Member, error) {
+	members, err := l.GetMembers(listID, GetMembersOptions{Email: email})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = checkForOnlyOneElement(len(members)); err != nil {
+		return nil, fmt.Errorf("member %s of list %s: %+v", email, listID, err)
+	}
+
+	return members[0], nil
+}
+
+// AddMemberOptions - флаги lists.add_member.
+type AddMemberOptions struct {
+	Update  bool // перезаписать данные, если email уже есть в базе
+	NoCheck bool // добавить email без валидации
+}
+
+// AddMember добавляет подписчика в адресную базу listID. Ключи fields - системные названия столбцов вида merge_1.
+func (l *ListsService) AddMember(listID, email string, fields map[string]interface{}, options AddMemberOptions) error {
+	params := map[string]interface{}{
+		"list_id": listID,
+		"email":   email,
+	}
+	// DashaMail проверяет только наличие параметров update и no_check, а не их значения
+	if options.Update {
+		params["update"] = "update"
+	}
+	if options.NoCheck {
+		params["no_check"] = "no_check"
+	}
+
+	for field, value := range fields {
+		if !strings.HasPrefix(field, "merge_") {
+			return fmt.Errorf("DashaMail method lists.add_member: unknown field %s (only merge_* fields are available)", field)
+		}
+		params[field] = value
+	}
+
+	return l.client.call("lists.add_member", params, nil)
+}
+
+func checkForOnlyOneElement(n int) error {
+	if n == 0 {
+		return fmt.Errorf("DashaMail answered without an error but with nil data array")
+	}
+
+	if n > 1 {
+		return fmt.Errorf("DashaMail answered with %v elements in data array but only one element is expected", n)
+	}
+
+	return nil
+}
@@ -0,0 +1,184 @@
+package eventdate
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Location - часовой пояс мероприятий (Москва). В нем считаются даты, переданные с часовым поясом (например, даты Facecast в ISO).
+var Location = time.FixedZone("UTC+3", 3*60*60)
+
+var (
+	genitiveMonths   = []string{"января", "февраля", "марта", "апреля", "мая", "июня", "июля", "августа", "сентября", "октября", "ноября", "декабря"}
+	nominativeMonths = []string{"январь", "февраль", "март", "апрель", "май", "июнь", "июль", "август", "сентябрь", "октябрь", "ноябрь", "декабрь"}
+)
+
+// EventDate - дата мероприятия (и время, если оно было указано). Дата хранится без часового пояса (в UTC), как ее видят
+// участники мероприятия, а Raw - строка, из которой дата разобрана.
+type EventDate struct {
+	time.Time
+	HasTime bool
+	Raw     string
+}
+
+// Форматы, которые встречаются в книгах DashaMail и в запросах frontend:
+// "8 октября 2022", "08 октября 2022 г.", "8 октября 2022 года в 10.00", "15 03 2024", "15.03.2024 10:00", "15/03/2024".
+var textDate = regexp.MustCompile(`(?i)(\d{1,2})[\s./-]+(\p{L}+|\d{1,2})[\s./-]+(\d{4})(?:\s*(?:года|год|г\.?))?(?:\s*,)?(?:\s*(?:в\s*)?(\d{1,2})[.:](\d{2}))?`)
+
+var isoDate = regexp.MustCompile(`\d{4}-\d{2}-\d{2}(?:[T ]\d{2}:\d{2}(?::\d{2})?(?:Z|[+-]\d{2}:\d{2})?)?`)
+
+var isoLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// Parse разбирает дату мероприятия. Кроме даты в строке допускаются только пробелы по краям.
+func Parse(s string) (EventDate, error) {
+	raw := strings.TrimSpace(s)
+	if raw == "" {
+		return EventDate{}, fmt.Errorf("empty event date")
+	}
+
+	for _, layout := range isoLayouts {
+		if t, err := time.Parse(layout, raw); err == nil {
+			if layout == time.RFC3339 {
+				t = t.In(Location)
+			}
+			hasTime := layout != "2006-01-02"
+			return EventDate{Time: wallClock(t, hasTime), HasTime: hasTime, Raw: raw}, nil
+		}
+	}
+
+	loc := textDate.FindStringSubmatchIndex(raw)
+	if loc == nil || loc[0] != 0 || loc[1] != len(raw) {
+		return EventDate{}, fmt.Errorf("unknown event date format '%s' (should be like '8 октября 2022', '08.10.2022' or '2022-10-08')", raw)
+	}
+
+	return fromMatch(raw, textDate.FindStringSubmatch(raw))
+}
+
+// Find ищет дату мероприятия в произвольном тексте (например, в названии отчета "Отчёт 15.03.2024 10.00").
+func Find(s string) (EventDate, bool) {
+	// ISO проверяется первым, иначе в "2024-03-01" нашлась бы дата "03-01-...".
+	for _, match := range isoDate.FindAllString(s, -1) {
+		if date, err := Parse(match); err == nil {
+			return date, true
+		}
+	}
+
+	for _, match := range textDate.FindAllStringSubmatch(s, -1) {
+		if date, err := fromMatch(strings.TrimSpace(match[0]), match); err == nil {
+			return date, true
+		}
+	}
+
+	return EventDate{}, false
+}
+
+// FromTime возвращает дату мероприятия, которое проходит в момент t (без времени).
+func FromTime(t time.Time) EventDate {
+	date := EventDate{Time: wallClock(t.In(Location), false)}
+	date.Raw = date.Human()
+	return date
+}
+
+func fromMatch(raw string, match []string) (EventDate, error) {
+	day, _ := strconv.Atoi(match[1])
+	year, _ := strconv.Atoi(match[3])
+
+	month := monthNumber(match[2])
+	if month == 0 {
+		return EventDate{}, fmt.Errorf("unknown month '%s' in event date '%s'", match[2], raw)
+	}
+
+	date := EventDate{Time: time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC), Raw: raw}
+	if date.Day() != day || date.Month() != time.Month(month) {
+		return EventDate{}, fmt.Errorf("invalid day %v in event date '%s'", day, raw)
+	}
+
+	if match[4] != "" {
+		hour, _ := strconv.Atoi(match[4])
+		minute, _ := strconv.Atoi(match[5])
+		if hour > 23 || minute > 59 {
+			return EventDate{}, fmt.Errorf("invalid time in event date '%s'", raw)
+		}
+
+		date.Time = date.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+		date.HasTime = true
+	}
+
+	return date, nil
+}
+
+// monthNumber возвращает номер месяца (1-12) по его номеру, русскому названию (в родительном или именительном падеже)
+// или английскому названию; 0 - месяц не распознан.
+func monthNumber(month string) int {
+	if n, err := strconv.Atoi(month); err == nil {
+		if n >= 1 && n <= 12 {
+			return n
+		}
+		return 0
+	}
+
+	month = strings.ToLower(month)
+	for i := 0; i < 12; i++ {
+		if month == genitiveMonths[i] || month == nominativeMonths[i] || month == strings.ToLower(time.Month(i+1).String()) {
+			return i + 1
+		}
+	}
+
+	return 0
+}
+
+func wallClock(t time.Time, withTime bool) time.Time {
+	if !withTime {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
+
+// Date возвращает дату мероприятия без времени.
+func (d EventDate) Date() time.Time {
+	return wallClock(d.Time, false)
+}
+
+func (d EventDate) Quarter() int {
+	return QuarterOf(d.Time)
+}
+
+func (d EventDate) InYear(year int) bool {
+	return !d.IsZero() && d.Year() == year
+}
+
+func (d EventDate) InQuarter(year, quarter int) bool {
+	return d.InYear(year) && d.Quarter() == quarter
+}
+
+// MonthName возвращает название месяца в именительном падеже ("январь"), как в названиях папок хранилища.
+func (d EventDate) MonthName() string {
+	return nominativeMonths[d.Month()-1]
+}
+
+// Human возвращает дату в виде "8 октября 2022".
+func (d EventDate) Human() string {
+	return fmt.Sprintf("%d %s %d", d.Day(), genitiveMonths[d.Month()-1], d.Year())
+}
+
+func (d EventDate) ISO() string {
+	return d.Format("2006-01-02")
+}
+
+// String возвращает дату в том виде, в котором ее передали (или Human, если дата создана не из строки).
+func (d EventDate) String() string {
+	if d.Raw != "" {
+		return d.Raw
+	}
+
+	return d.Human()
+}
+
+// QuarterOf возвращает номер квартала (1-4) для момента t.
+func QuarterOf(t time.Time) int {
+	return (int(t.Month())-1)/3 + 1
+}
@@ -0,0 +1,75 @@
+package eventdate
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Time
+		hasTime bool
+		err     string
+	}{
+		{input: "8 октября 2022", want: time.Date(2022, 10, 8, 0, 0, 0, 0, time.UTC)},
+		{input: " 08 октября 2022 г. ", want: time.Date(2022, 10, 8, 0, 0, 0, 0, time.UTC)},
+		{input: "5 Января 2023 года", want: time.Date(2023, 1, 5, 0, 0, 0, 0, time.UTC)},
+		{input: "15 марта 2023 года в 10.00", want: time.Date(2023, 3, 15, 10, 0, 0, 0, time.UTC), hasTime: true},
+		{input: "1 march 2024", want: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{input: "15.03.2024 10:30", want: time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC), hasTime: true},
+		{input: "15 03 2024", want: time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{input: "15/03/2024", want: time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{input: "15-03-2024", want: time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{input: "2024-03-15", want: time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{input: "2024-03-15T10:00", want: time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC), hasTime: true},
+		// дата с часовым поясом переводится в московское время
+		{input: "2024-03-15T22:30:00Z", want: time.Date(2024, 3, 16, 1, 30, 0, 0, time.UTC), hasTime: true},
+		{input: "", err: "empty event date"},
+		{input: "скоро", err: "unknown event date format"},
+		{input: "Вебинар 15.03.2024", err: "unknown event date format"},
+		{input: "15 мартобря 2024", err: "unknown month"},
+		{input: "15.13.2024", err: "unknown month"},
+		{input: "31 февраля 2024", err: "invalid day"},
+		{input: "15.03.2024 25:00", err: "invalid time"},
+	}
+
+	for _, test := range tests {
+		date, err := Parse(test.input)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Parse(%q) error %v, want %q", test.input, err, test.err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Parse(%q) error %v", test.input, err)
+			continue
+		}
+		if !date.Time.Equal(test.want) || date.HasTime != test.hasTime || date.Raw != strings.TrimSpace(test.input) {
+			t.Errorf("Parse(%q) = %v (hasTime %v, raw %q), want %v (hasTime %v)", test.input, date.Time, date.HasTime, date.Raw, test.want, test.hasTime)
+		}
+	}
+}
+
+func TestHumanAndFind(t *testing.T) {
+	tests := []struct {
+		text  string
+		human string
+		found bool
+	}{
+		{text: "Отчёт 15.03.2024 10.00", human: "15 марта 2024", found: true},
+		{text: "Вебинар НМО 08 октября 2022 г.", human: "8 октября 2022", found: true},
+		{text: "Выгрузка 2024-03-01", human: "1 марта 2024", found: true},
+		{text: "Отчёт без даты", found: false},
+	}
+
+	for _, test := range tests {
+		date, found := Find(test.text)
+		if found != test.found || (found && date.Human() != test.human) {
+			t.Errorf("Find(%q) = %q, %v, want %q, %v", test.text, date.Human(), found, test.human, test.found)
+		}
+	}
+}
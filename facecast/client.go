@@ -0,0 +1,148 @@
+package facecast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const DEFAULT_BASE_URL = "https://facecast.net/api/"
+
+// Client - клиент API Facecast (v1). Клиент не хранит состояния между запросами, поэтому его можно использовать
+// из нескольких горутин одновременно.
+type Client struct {
+	baseURL    string
+	uid        string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// NewClient создает клиент. uid и apiKey - идентификатор и секретный ключ аккаунта Facecast. Пустой baseURL
+// соответствует DEFAULT_BASE_URL (другой URL нужен, например, для локальной замены Facecast в тестах),
+// nil httpClient - http.DefaultClient.
+func NewClient(baseURL, uid, apiKey string, httpClient *http.Client) *Client {
+	if baseURL == "" {
+		baseURL = DEFAULT_BASE_URL
+	}
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &Client{baseURL: baseURL, uid: uid, apiKey: apiKey, httpClient: httpClient}
+}
+
+// call выполняет метод API и декодирует ответ в result (если result не nil). Параметры передаются в строке запроса
+// для GET и в теле запроса (application/x-www-form-urlencoded) для POST.
+// Любая ошибка возвращается в виде *CallError, в котором сохранены отправленные и полученные данные.
+func (c *Client) call(httpMethod, method string, params url.Values, result interface{}) error {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("uid", c.uid)
+	params.Set("api_key", c.apiKey)
+
+	callErr := &CallError{Method: method, Sent: []byte(maskedParams(params))}
+
+	uri := c.baseURL + "v1/" + method
+	var body *strings.Reader
+	if httpMethod == http.MethodGet {
+		uri += "?" + params.Encode()
+		body = strings.NewReader("")
+	} else {
+		body = strings.NewReader(params.Encode())
+	}
+
+	request, err := http.NewRequest(httpMethod, uri, body)
+	if err != nil {
+		callErr.Err = err
+		return callErr
+	}
+	if httpMethod != http.MethodGet {
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		callErr.Err = err
+		return callErr
+	}
+	defer resp.Body.Close()
+
+	received, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		callErr.Err = err
+		return callErr
+	}
+	callErr.Received = received
+
+	if resp.StatusCode != http.StatusOK {
+		callErr.Err = fmt.Errorf("unexpected HTTP status %s", resp.Status)
+		return callErr
+	}
+
+	if err = responseErr(received); err != nil {
+		callErr.Err = err
+		return callErr
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	err = json.Unmarshal(received, result)
+	if err != nil {
+		callErr.Err = fmt.Errorf("can't decode response: %+v", err)
+		return callErr
+	}
+
+	if checker, ok := result.(resultChecker); ok {
+		if err = checker.err(); err != nil {
+			callErr.Err = err
+			return callErr
+		}
+	}
+
+	return nil
+}
+
+// resultChecker реализуют ответы методов, которые сообщают о неудаче не через {"error": "..."}, а полем результата.
+type resultChecker interface {
+	err() error
+}
+
+// Об ошибке Facecast сообщает объектом {"error": "..."} вместо ожидаемых данных (в том числе вместо массива).
+func responseErr(received []byte) error {
+	received = bytes.TrimSpace(received)
+	if len(received) == 0 || received[0] != '{' {
+		return nil
+	}
+
+	var r struct {
+		Error string `json:"error"`
+	}
+	_ = json.Unmarshal(received, &r)
+	if r.Error == "" {
+		return nil
+	}
+
+	return &Error{Text: r.Error}
+}
+
+// Секретный ключ не должен попадать в отладочные данные, которые уходят клиентам веб-сервиса.
+func maskedParams(params url.Values) string {
+	masked := url.Values{}
+	for param, values := range params {
+		masked[param] = values
+	}
+	masked.Set("api_key", "***")
+
+	return masked.Encode()
+}
@@ -0,0 +1,42 @@
+package facecast
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error - ошибка, которую вернул сам Facecast (ответ вида {"error": "..."} или неуспешный результат метода).
+type Error struct {
+	Text string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Facecast error: %s", e.Text)
+}
+
+// CallError - любая ошибка вызова метода API (сетевая, ошибка декодирования или *Error). Хранит отправленные и
+// полученные данные для отладки.
+type CallError struct {
+	Method   string
+	Sent     []byte
+	Received []byte
+	Err      error
+}
+
+func (e *CallError) Error() string {
+	return fmt.Sprintf("Facecast method %s: %v", e.Method, e.Err)
+}
+
+func (e *CallError) Unwrap() error {
+	return e.Err
+}
+
+func (e *CallError) ExchangeData() (sent, received []byte) {
+	return e.Sent, e.Received
+}
+
+// IsFacecastError проверяет, что err - ошибка, которую вернул сам Facecast, а не сетевая ошибка или ошибка декодирования.
+func IsFacecastError(err error) bool {
+	var fcErr *Error
+	return errors.As(err, &fcErr)
+}
@@ -0,0 +1,144 @@
+package facecast
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// Event - информация о мероприятии (get_event). Даты - в формате ISO 8601, длительность - в секундах.
+type Event struct {
+	Name           string `json:"name"`
+	Description    string `json:"description"`
+	PlanStartDate  string `json:"date_plan_start"`
+	StartDate      string `json:"date_real_start"`
+	EndDate        string `json:"date_real_end"`
+	Duration       int    `json:"duration_total"`
+	ViewersMax     int    `json:"viewers_max"`
+	TimeViewersMax string `json:"time_viewers_max"`
+	ViewersTotal   int    `json:"viewers_total"`
+}
+
+// Ticket - билет зрителя (get_event_tickets). У билетов, созданных через менеджер зрителей в ЛК Facecast, email пустой.
+type Ticket struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"fio"`
+	Email string `json:"email"`
+}
+
+// Key - ключ доступа к мероприятию (get_event_keys). Одиночные ключи не привязаны к билету (TicketID = 0).
+type Key struct {
+	TicketID int64  `json:"ticket_id"`
+	Key      string `json:"password"`
+}
+
+// VisitStats - поминутная статистика просмотров зрителя с ключом Key (get_visit_stats).
+type VisitStats struct {
+	Key     string   `json:"password"`
+	Minutes []Minute `json:"histogram"`
+}
+
+// Minute - минута мероприятия с номером Position (нумерация с 0) и просмотрами зрителя в эту минуту.
+type Minute struct {
+	Position int    `json:"position"`
+	Views    []View `json:"views"`
+}
+
+type View struct {
+	IsLive bool `json:"is_live"`
+}
+
+// Activity - окно контроля присутствия, показанное зрителю с ключом Key (get_user_activity_detailed_all).
+type Activity struct {
+	Key       string `json:"password"`
+	Confirmed int    `json:"confirmed"`
+}
+
+// NewKey - параметры insert_key.
+type NewKey struct {
+	Name        string
+	Email       string
+	Key         string
+	MultipleVPP bool // разрешить одновременный просмотр по ключу с нескольких устройств
+}
+
+func eventParams(eventCode string) url.Values {
+	params := url.Values{}
+	params.Set("event_code", eventCode)
+	return params
+}
+
+func (c *Client) GetEvent(eventCode string) (*Event, error) {
+	var event Event
+	err := c.call(http.MethodGet, "get_event", eventParams(eventCode), &event)
+	if err != nil {
+		return nil, err
+	}
+
+	return &event, nil
+}
+
+func (c *Client) GetEventTickets(eventCode string) ([]Ticket, error) {
+	tickets := make([]Ticket, 0)
+	err := c.call(http.MethodPost, "get_event_tickets", eventParams(eventCode), &tickets)
+	if err != nil {
+		return nil, err
+	}
+
+	return tickets, nil
+}
+
+func (c *Client) GetEventKeys(eventCode string) ([]Key, error) {
+	keys := make([]Key, 0)
+	err := c.call(http.MethodPost, "get_event_keys", eventParams(eventCode), &keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (c *Client) GetVisitStats(eventCode string) ([]VisitStats, error) {
+	stats := make([]VisitStats, 0)
+	err := c.call(http.MethodPost, "get_visit_stats", eventParams(eventCode), &stats)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+func (c *Client) GetUserActivityDetailedAll(eventCode string) ([]Activity, error) {
+	activities := make([]Activity, 0)
+	err := c.call(http.MethodPost, "get_user_activity_detailed_all", eventParams(eventCode), &activities)
+	if err != nil {
+		return nil, err
+	}
+
+	return activities, nil
+}
+
+// InsertKey добавляет зрителю ключ доступа к мероприятию. Ответ без success=true считается ошибкой Facecast.
+func (c *Client) InsertKey(eventCode string, key NewKey) error {
+	params := eventParams(eventCode)
+	params.Set("name", key.Name)
+	params.Set("email", key.Email)
+	params.Set("key", key.Key)
+	params.Set("multiple_vpp", "0")
+	if key.MultipleVPP {
+		params.Set("multiple_vpp", "1")
+	}
+
+	return c.call(http.MethodPost, "insert_key", params, &successResponse{})
+}
+
+type successResponse struct {
+	Success bool `json:"success"`
+}
+
+func (r *successResponse) err() error {
+	if !r.Success {
+		return &Error{Text: "not success response"}
+	}
+
+	return nil
+}
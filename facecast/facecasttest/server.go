@@ -0,0 +1,152 @@
+// Package facecasttest - локальная замена API Facecast для тестов. Сервер эмулирует методы, которые использует
+// веб-сервис (get_event, get_event_tickets, get_event_keys, get_visit_stats, get_user_activity_detailed_all, insert_key),
+// и хранит данные в памяти.
+package facecasttest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"zo-backend/facecast"
+)
+
+// Fixture - начальные данные сервера. Ключ Events - код мероприятия (event_code).
+type Fixture struct {
+	Events map[string]Event `json:"events"`
+}
+
+type Event struct {
+	Info       facecast.Event        `json:"info"`
+	Tickets    []facecast.Ticket     `json:"tickets"`
+	Keys       []facecast.Key        `json:"keys"`
+	VisitStats []facecast.VisitStats `json:"visitStats"`
+	Activity   []facecast.Activity   `json:"activity"`
+}
+
+func LoadFixture(fileName string) (*Fixture, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var fixture Fixture
+	err = json.Unmarshal(data, &fixture)
+	if err != nil {
+		return nil, fmt.Errorf("can't decode Facecast fixture %s: %+v", fileName, err)
+	}
+
+	return &fixture, nil
+}
+
+// Server - запущенный httptest-сервер. URL передается в facecast.NewClient (или в $FACECAST_URI).
+type Server struct {
+	*httptest.Server
+
+	uid     string
+	apiKey  string
+	fixture Fixture
+	mu      sync.Mutex
+}
+
+// NewServer запускает сервер с копией данных fixture. Запросы с другими uid и api_key завершаются ошибкой авторизации.
+func NewServer(uid, apiKey string, fixture *Fixture) *Server {
+	s := &Server{uid: uid, apiKey: apiKey}
+	if fixture != nil {
+		data, _ := json.Marshal(fixture)
+		_ = json.Unmarshal(data, &s.fixture)
+	}
+	if s.fixture.Events == nil {
+		s.fixture.Events = make(map[string]Event)
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Keys возвращает текущие ключи мероприятия eventCode (в том числе добавленные через insert_key).
+func (s *Server) Keys(eventCode string) []facecast.Key {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]facecast.Key(nil), s.fixture.Events[eventCode].Keys...)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.Form.Get("uid") != s.uid || r.Form.Get("api_key") != s.apiKey {
+		writeError(w, "authorization failed")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	eventCode := r.Form.Get("event_code")
+	event, ok := s.fixture.Events[eventCode]
+	if !ok {
+		writeError(w, fmt.Sprintf("event %s not found", eventCode))
+		return
+	}
+
+	method := strings.TrimPrefix(r.URL.Path, "/v1/")
+	if (method == "get_event") != (r.Method == http.MethodGet) {
+		http.Error(w, fmt.Sprintf("method %s is not available via %s", method, r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var data interface{}
+	switch method {
+	case "get_event":
+		data = event.Info
+	case "get_event_tickets":
+		data = event.Tickets
+	case "get_event_keys":
+		data = event.Keys
+	case "get_visit_stats":
+		data = event.VisitStats
+	case "get_user_activity_detailed_all":
+		data = event.Activity
+	case "insert_key":
+		if r.Form.Get("key") == "" || r.Form.Get("email") == "" {
+			writeError(w, "key and email are required")
+			return
+		}
+
+		ticketID := int64(1)
+		for _, t := range event.Tickets {
+			if t.ID >= ticketID {
+				ticketID = t.ID + 1
+			}
+		}
+		event.Tickets = append(event.Tickets, facecast.Ticket{ID: ticketID, Name: r.Form.Get("name"), Email: r.Form.Get("email")})
+		event.Keys = append(event.Keys, facecast.Key{TicketID: ticketID, Key: r.Form.Get("key")})
+		s.fixture.Events[eventCode] = event
+
+		data = map[string]bool{"success": true}
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not emulated", method), http.StatusNotImplemented)
+		return
+	}
+
+	writeJSON(w, data)
+}
+
+// Facecast сообщает об ошибках со статусом 200 и объектом {"error": "..."} в теле ответа.
+func writeError(w http.ResponseWriter, text string) {
+	writeJSON(w, map[string]string{"error": text})
+}
+
+func writeJSON(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(data)
+}
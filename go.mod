@@ -6,6 +6,8 @@ require (
 	github.com/benoitmasson/plotters/piechart v1.2.0
 	github.com/dchest/siphash v1.2.3
 	github.com/go-chi/chi v1.5.4
+	github.com/go-fonts/liberation v0.2.0
+	github.com/go-pdf/fpdf v0.6.0
 	github.com/gorilla/websocket v1.5.0
 	github.com/joho/godotenv v1.4.0
 	github.com/jordan-wright/unindexed v0.0.0-20181209214434-78fa79113c0f
@@ -14,15 +16,15 @@ require (
 	github.com/nikitaksv/yandex-disk-sdk-go v1.0.3
 	github.com/wcharczuk/go-chart/v2 v2.1.0
 	github.com/xuri/excelize/v2 v2.6.1
+	golang.org/x/image v0.0.0-20220902085622-e7cb96979f69
 	gonum.org/v1/plot v0.12.0
+	rsc.io/qr v0.2.0
 )
 
 require (
 	git.sr.ht/~sbinet/gg v0.3.1 // indirect
 	github.com/ajstarks/svgo v0.0.0-20211024235047-1546f124cd8b // indirect
-	github.com/go-fonts/liberation v0.2.0 // indirect
 	github.com/go-latex/latex v0.0.0-20210823091927-c0d11ff05a81 // indirect
-	github.com/go-pdf/fpdf v0.6.0 // indirect
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
 	github.com/mohae/deepcopy v0.0.0-20170929034955-c48cc78d4826 // indirect
 	github.com/richardlehane/mscfb v1.0.4 // indirect
@@ -30,7 +32,6 @@ require (
 	github.com/xuri/efp v0.0.0-20220603152613-6918739fd470 // indirect
 	github.com/xuri/nfp v0.0.0-20220409054826-5e722a1d9e22 // indirect
 	golang.org/x/crypto v0.0.0-20220817201139-bc19a97f63c8 // indirect
-	golang.org/x/image v0.0.0-20220902085622-e7cb96979f69 // indirect
 	golang.org/x/net v0.0.0-20220812174116-3211cb980234 // indirect
 	golang.org/x/text v0.3.7 // indirect
 )
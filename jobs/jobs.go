@@ -0,0 +1,367 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"zo-backend/atomicfile"
+)
+
+const (
+	STATUS_QUEUED     = "queued"
+	STATUS_PROCESSING = "processing"
+	STATUS_DONE       = "done"
+	STATUS_ERROR      = "error"
+	STATUS_CANCELLED  = "cancelled"
+)
+
+// ErrCancelled возвращает RunFunc, которая прервалась из-за отмены задачи.
+var ErrCancelled = errors.New("the job was cancelled")
+
+// Job - состояние фоновой задачи. Именно в таком виде задача отдается клиентам и хранится на диске.
+type Job struct {
+	ID        string      `json:"id"`
+	APIMethod string      `json:"apiMethod"`
+	OwnerID   string      `json:"ownerID,omitempty"` // ID клиента API, поставившего задачу (пустой - задача самого сервера)
+	Status    string      `json:"status"`
+	Message   string      `json:"message,omitempty"`
+	Result    interface{} `json:"result,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	CreatedAt time.Time   `json:"createdAt"`
+	UpdatedAt time.Time   `json:"updatedAt"`
+
+	CancelRequested bool `json:"cancelRequested,omitempty"` // выполняющуюся задачу попросили отменить
+}
+
+func (j Job) Finished() bool {
+	return j.Status == STATUS_DONE || j.Status == STATUS_ERROR || j.Status == STATUS_CANCELLED
+}
+
+// Progress - текущий этап выполнения задачи, который воркер обновляет во время работы.
+type Progress struct {
+	message string
+	locker  sync.RWMutex
+}
+
+func (p *Progress) Set(message string) {
+	p.locker.Lock()
+	p.message = message
+	p.locker.Unlock()
+}
+
+func (p *Progress) Get() string {
+	p.locker.RLock()
+	defer p.locker.RUnlock()
+	return p.message
+}
+
+// RunFunc выполняет задачу, записывая текущий этап выполнения в progress. При отмене задачи ctx отменяется: API-методы
+// пишут в DashaMail и хранилище и не могут прерваться на середине записи, поэтому они проверяют ctx между группами
+// операций и возвращают ErrCancelled (вместе с результатом уже выполненной части, если он есть).
+type RunFunc func(ctx context.Context, progress *Progress) (interface{}, error)
+
+type entry struct {
+	job      Job
+	run      RunFunc
+	progress *Progress
+	done     chan struct{}
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+func newEntry(job Job, run RunFunc) *entry {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &entry{job: job, run: run, progress: new(Progress), done: make(chan struct{}), ctx: ctx, cancel: cancel}
+}
+
+// Manager выполняет задачи в пуле воркеров и сохраняет каждую задачу в отдельный JSON-файл папки dir, поэтому
+// результаты завершенных задач переживают перезапуск сервера. Задачи, которые на момент остановки сервера еще
+// выполнялись или стояли в очереди, после перезапуска помечаются как завершенные с ошибкой.
+type Manager struct {
+	dir       string
+	retention time.Duration
+	queue     chan *entry
+	entries   map[string]*entry
+	locker    sync.RWMutex
+}
+
+func NewManager(dir string, workers int, retention time.Duration) (*Manager, error) {
+	errExplanation := "can't init jobs manager"
+
+	if workers < 1 {
+		return nil, errWithExplanation(errExplanation, fmt.Errorf("need at least one worker (got %v)", workers))
+	}
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, errWithExplanation(errExplanation, err)
+	}
+
+	m := &Manager{
+		dir:       dir,
+		retention: retention,
+		queue:     make(chan *entry, 1000),
+		entries:   make(map[string]*entry),
+	}
+
+	err = m.load()
+	if err != nil {
+		return nil, errWithExplanation(errExplanation, err)
+	}
+
+	for i := 0; i < workers; i++ {
+		go m.work()
+	}
+
+	return m, nil
+}
+
+// Submit ставит задачу клиента API ownerID в очередь и сразу возвращает ее состояние с присвоенным ID.
+func (m *Manager) Submit(apiMethod, ownerID string, run RunFunc) (Job, error) {
+	errExplanation := "submitting job error"
+
+	id, err := newID()
+	if err != nil {
+		return Job{}, errWithExplanation(errExplanation, err)
+	}
+
+	now := time.Now()
+	e := newEntry(Job{
+		ID:        id,
+		APIMethod: apiMethod,
+		OwnerID:   ownerID,
+		Status:    STATUS_QUEUED,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, run)
+
+	// копия состояния снимается под блокировкой: после отправки в очередь задачу меняет воркер
+	m.locker.Lock()
+	m.removeExpired()
+	m.entries[id] = e
+	job := e.job
+	err = m.save(job)
+	m.locker.Unlock()
+	if err != nil {
+		return Job{}, errWithExplanation(errExplanation, err)
+	}
+
+	select {
+	case m.queue <- e:
+	default:
+		m.finish(e, STATUS_ERROR, nil, fmt.Errorf("jobs queue is full"))
+		return Job{}, errWithExplanation(errExplanation, fmt.Errorf("jobs queue is full (try again later)"))
+	}
+
+	return job, nil
+}
+
+func (m *Manager) Get(id string) (Job, error) {
+	m.locker.RLock()
+	defer m.locker.RUnlock()
+
+	e, ok := m.entries[id]
+	if !ok {
+		return Job{}, fmt.Errorf("unknown job '%s'", id)
+	}
+
+	job := e.job
+	if job.Status == STATUS_PROCESSING {
+		job.Message = e.progress.Get()
+	}
+
+	return job, nil
+}
+
+// Done возвращает канал, который закрывается при завершении задачи (успешном, с ошибкой или отмене).
+func (m *Manager) Done(id string) (<-chan struct{}, error) {
+	m.locker.RLock()
+	defer m.locker.RUnlock()
+
+	e, ok := m.entries[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown job '%s'", id)
+	}
+
+	return e.done, nil
+}
+
+// Cancel отменяет задачу. Задача из очереди сразу завершается со статусом cancelled. У выполняющейся задачи отменяется
+// контекст RunFunc, а статус cancelled она получает, когда RunFunc прервется (до этого у задачи выставлен
+// CancelRequested). Завершенную задачу отменить нельзя.
+func (m *Manager) Cancel(id string) (Job, error) {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	e, ok := m.entries[id]
+	if !ok {
+		return Job{}, fmt.Errorf("unknown job '%s'", id)
+	}
+
+	if e.job.Status == STATUS_PROCESSING {
+		e.cancel()
+		e.job.CancelRequested = true
+		e.job.UpdatedAt = time.Now()
+		_ = m.save(e.job)
+
+		job := e.job
+		job.Message = e.progress.Get()
+		return job, nil
+	} else if !m.finishLocked(e, STATUS_CANCELLED, nil, nil) {
+		return Job{}, fmt.Errorf("job '%s' is already finished with status '%s'", id, e.job.Status)
+	}
+
+	return e.job, nil
+}
+
+func (m *Manager) work() {
+	for e := range m.queue {
+		m.locker.Lock()
+		if e.job.Finished() { // задачу отменили, пока она стояла в очереди
+			m.locker.Unlock()
+			continue
+		}
+		e.job.Status = STATUS_PROCESSING
+		e.job.UpdatedAt = time.Now()
+		_ = m.save(e.job)
+		m.locker.Unlock()
+
+		result, err := m.runSafely(e)
+		switch {
+		case err != nil && e.ctx.Err() != nil:
+			// задача прервалась из-за отмены; результат выполненной до отмены части сохраняется
+			m.finish(e, STATUS_CANCELLED, result, err)
+		case err != nil:
+			m.finish(e, STATUS_ERROR, nil, err)
+		default:
+			m.finish(e, STATUS_DONE, result, nil)
+		}
+	}
+}
+
+func (m *Manager) runSafely(e *entry) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+
+	return e.run(e.ctx, e.progress)
+}
+
+// Переводит задачу в конечный статус. Возвращает false, если задача уже была завершена.
+func (m *Manager) finish(e *entry, status string, result interface{}, err error) bool {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	return m.finishLocked(e, status, result, err)
+}
+
+// То же, что finish, но вызывается под m.locker.
+func (m *Manager) finishLocked(e *entry, status string, result interface{}, err error) bool {
+	if e.job.Finished() {
+		return false
+	}
+
+	e.job.Status = status
+	e.job.Message = e.progress.Get()
+	e.job.Result = result
+	e.job.UpdatedAt = time.Now()
+	if err != nil {
+		e.job.Error = err.Error()
+	}
+	_ = m.save(e.job)
+	close(e.done)
+	e.cancel()
+
+	return true
+}
+
+func (m *Manager) load() error {
+	files, err := ioutil.ReadDir(m.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(m.dir, file.Name()))
+		if err != nil {
+			return err
+		}
+
+		var job Job
+		if err = json.Unmarshal(data, &job); err != nil {
+			return fmt.Errorf("can't read job file %s: %+v", file.Name(), err)
+		}
+
+		if !job.Finished() {
+			job.Status = STATUS_ERROR
+			job.Error = "the job was interrupted by the server restart"
+			job.UpdatedAt = time.Now()
+			if err = m.save(job); err != nil {
+				return err
+			}
+		}
+
+		e := newEntry(job, nil)
+		close(e.done)
+		e.cancel()
+		m.entries[job.ID] = e
+	}
+
+	m.removeExpired()
+
+	return nil
+}
+
+// Удаляет завершенные задачи старше retention (нулевой retention - хранить бессрочно). Вызывается под m.locker.
+func (m *Manager) removeExpired() {
+	if m.retention == 0 {
+		return
+	}
+
+	for id, e := range m.entries {
+		if e.job.Finished() && time.Since(e.job.UpdatedAt) > m.retention {
+			delete(m.entries, id)
+			_ = os.Remove(m.path(id))
+		}
+	}
+}
+
+func (m *Manager) save(job Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.WriteFile(m.path(job.ID), data, 0644)
+}
+
+func (m *Manager) path(id string) string {
+	return filepath.Join(m.dir, id+".json")
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func errWithExplanation(errExplanation string, err error) error {
+	return fmt.Errorf("%s: %+v", errExplanation, err)
+}
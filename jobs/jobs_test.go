@@ -0,0 +1,152 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestManagerCancelAndRestart(t *testing.T) {
+	dir := t.TempDir()
+	manager, err := NewManager(dir, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// единственный воркер занят первой задачей, вторая ждет в очереди
+	release := make(chan struct{})
+	started := make(chan struct{})
+	processing, err := manager.Submit("createCertificates", "app", func(ctx context.Context, progress *Progress) (interface{}, error) {
+		progress.Set("uploading certificates")
+		close(started)
+		<-release
+		// как API-методы: отмена проверяется между группами операций, уже выполненная часть возвращается
+		if ctx.Err() != nil {
+			return "partial result", ErrCancelled
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	queued, err := manager.Submit("sendDataToDashaMail", "app", func(context.Context, *Progress) (interface{}, error) {
+		t.Error("cancelled job was run")
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("cancel", func(t *testing.T) {
+		job, err := manager.Cancel(processing.ID)
+		if err != nil || job.Status != STATUS_PROCESSING || !job.CancelRequested || job.Message != "uploading certificates" {
+			t.Errorf("cancelling processing job: %+v, %v", job, err)
+		}
+
+		job, err = manager.Cancel(queued.ID)
+		if err != nil || job.Status != STATUS_CANCELLED {
+			t.Fatalf("cancelling queued job: %+v, %v", job, err)
+		}
+		if _, err := manager.Cancel(queued.ID); err == nil || !strings.Contains(err.Error(), "already finished") {
+			t.Errorf("cancelling cancelled job: %v", err)
+		}
+	})
+
+	t.Run("restart", func(t *testing.T) {
+		pending, err := manager.Submit("getCertificatesInfo", "app", func(context.Context, *Progress) (interface{}, error) { return nil, nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// новый менеджер на той же папке - как после перезапуска сервера, пока задачи еще не завершены
+		restarted, err := NewManager(dir, 1, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, id := range []string{processing.ID, pending.ID} {
+			if job, err := restarted.Get(id); err != nil || job.Status != STATUS_ERROR || !strings.Contains(job.Error, "server restart") {
+				t.Errorf("job %s after restart: %+v, %v", id, job, err)
+			}
+		}
+		if job, _ := restarted.Get(queued.ID); job.Status != STATUS_CANCELLED || job.OwnerID != "app" {
+			t.Errorf("cancelled job after restart: %+v", job)
+		}
+	})
+
+	t.Run("interrupted", func(t *testing.T) {
+		close(release)
+
+		done, err := manager.Done(processing.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		<-done
+
+		if job, _ := manager.Get(processing.ID); job.Status != STATUS_CANCELLED || job.Result != "partial result" {
+			t.Errorf("interrupted job %+v", job)
+		}
+	})
+}
+
+func TestManagerStatuses(t *testing.T) {
+	manager, err := NewManager(t.TempDir(), 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		run        RunFunc
+		wantStatus string
+		wantResult interface{}
+		wantError  string
+	}{
+		{
+			name:       "done",
+			run:        func(context.Context, *Progress) (interface{}, error) { return "report.xlsx", nil },
+			wantStatus: STATUS_DONE,
+			wantResult: "report.xlsx",
+		},
+		{
+			name:       "error",
+			run:        func(context.Context, *Progress) (interface{}, error) { return "ignored", errors.New("DM book not found") },
+			wantStatus: STATUS_ERROR,
+			wantError:  "DM book not found",
+		},
+		{
+			name:       "panic",
+			run:        func(context.Context, *Progress) (interface{}, error) { panic("nil map") },
+			wantStatus: STATUS_ERROR,
+			wantError:  "job panicked: nil map",
+		},
+	}
+
+	for _, test := range tests {
+		submitted, err := manager.Submit(test.name, "app", test.run)
+		if err != nil || submitted.Status != STATUS_QUEUED || submitted.OwnerID != "app" {
+			t.Fatalf("%s: submitted %+v, %v", test.name, submitted, err)
+		}
+
+		done, err := manager.Done(submitted.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		<-done
+
+		job, err := manager.Get(submitted.ID)
+		if err != nil || job.Status != test.wantStatus || job.Result != test.wantResult || job.Error != test.wantError {
+			t.Errorf("%s: job %+v, %v", test.name, job, err)
+		}
+	}
+
+	if _, err := manager.Get("unknown"); err == nil {
+		t.Error("got unknown job")
+	}
+	if _, err := NewManager(t.TempDir(), 0, 0); err == nil {
+		t.Error("manager without workers")
+	}
+}
@@ -0,0 +1,69 @@
+package points
+
+import "fmt"
+
+// Certificate - требования к посещению мероприятия, при выполнении которых зритель с кодом НМО получает сертификат.
+type Certificate struct {
+	MinWatchShare            float64 `json:"minWatchShare"`            // минимальная доля просмотренных минут (по умолчанию 0.5)
+	MinConfirmedWindowsShare float64 `json:"minConfirmedWindowsShare"` // минимальная доля подтвержденных окон присутствия (по умолчанию 0.5)
+	CountRecording           bool    `json:"countRecording"`           // засчитывать ли минуты записи (по умолчанию - только прямой эфир)
+}
+
+// Требования для мероприятий, тип которых не определен по названию видео, и для полей, которых нет в файле правил.
+var defaultCertificate = Certificate{MinWatchShare: 0.5, MinConfirmedWindowsShare: 0.5}
+
+// Eligibility - результат проверки посещения мероприятия для выдачи сертификата НМО.
+type Eligibility struct {
+	EventType    string   `json:"eventType,omitempty"`
+	Eligible     bool     `json:"eligible"`
+	WatchShare   float64  `json:"watchShare"`   // доля засчитанных минут
+	WindowsShare float64  `json:"windowsShare"` // доля подтвержденных окон присутствия (1, если окна не показывались)
+	Reasons      []string `json:"reasons,omitempty"`
+}
+
+// Eligibility проверяет, выполнил ли зритель мероприятия videoName продолжительностью duration минут требования для
+// сертификата НМО: посмотрел minutesOnline минут в прямом эфире и minutesOffline - в записи, подтвердил confirmedWindows
+// из allWindows показанных окон присутствия. Если окна зрителю не показывались, проверяется только доля минут.
+func (r Rules) Eligibility(videoName string, duration, minutesOnline, minutesOffline, confirmedWindows, allWindows int) Eligibility {
+	t, ok := r.EventType(videoName)
+	if !ok {
+		t.Certificate = defaultCertificate
+	}
+	requirements := t.Certificate
+
+	eligibility := Eligibility{EventType: t.Name, WindowsShare: 1}
+
+	minutes := minutesOnline
+	if requirements.CountRecording {
+		minutes += minutesOffline
+	}
+	if duration > 0 {
+		eligibility.WatchShare = float64(minutes) / float64(duration)
+	}
+	if allWindows > 0 {
+		eligibility.WindowsShare = float64(confirmedWindows) / float64(allWindows)
+	}
+
+	switch {
+	case minutesOnline+minutesOffline == 0:
+		eligibility.Reasons = append(eligibility.Reasons, "не смотрел мероприятие")
+	case minutes == 0:
+		eligibility.Reasons = append(eligibility.Reasons, "смотрел только запись, а засчитывается только прямой эфир")
+	case duration <= 0:
+		eligibility.Reasons = append(eligibility.Reasons, "неизвестна продолжительность мероприятия")
+	case eligibility.WatchShare < requirements.MinWatchShare:
+		eligibility.Reasons = append(eligibility.Reasons, fmt.Sprintf("просмотрено %s мероприятия, требуется не меньше %s",
+			percent(eligibility.WatchShare), percent(requirements.MinWatchShare)))
+	}
+	if eligibility.WindowsShare < requirements.MinConfirmedWindowsShare {
+		eligibility.Reasons = append(eligibility.Reasons, fmt.Sprintf("подтверждено %v из %v окон присутствия, требуется не меньше %s",
+			confirmedWindows, allWindows, percent(requirements.MinConfirmedWindowsShare)))
+	}
+
+	eligibility.Eligible = len(eligibility.Reasons) == 0
+	return eligibility
+}
+
+func percent(share float64) string {
+	return fmt.Sprintf("%.0f%%", share*100)
+}
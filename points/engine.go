@@ -0,0 +1,89 @@
+package points
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Engine хранит действующие правила начисления баллов ЗО и перечитывает их из файла path при его изменении.
+// Если файла нет, действуют правила по умолчанию; если новая версия файла содержит ошибку, остаются прежние правила.
+type Engine struct {
+	path   string
+	data   []byte
+	rules  Rules
+	locker sync.RWMutex
+}
+
+func NewEngine(path string) (*Engine, error) {
+	e := &Engine{path: path, rules: DefaultRules()}
+
+	if _, err := e.Reload(); err != nil {
+		return nil, errWithExplanation("can't init points rules", err)
+	}
+
+	return e, nil
+}
+
+// Rules возвращает снимок действующих правил. Снимок не меняется при перезагрузке файла, поэтому один отчет
+// считается по одним правилам целиком.
+func (e *Engine) Rules() Rules {
+	e.locker.RLock()
+	defer e.locker.RUnlock()
+
+	return e.rules
+}
+
+// Reload перечитывает файл правил и возвращает true, если правила изменились.
+func (e *Engine) Reload() (bool, error) {
+	if e.path == "" {
+		return false, nil
+	}
+
+	data, err := ioutil.ReadFile(e.path)
+	switch {
+	case os.IsNotExist(err):
+		data = nil // файл удален - возвращаемся к правилам по умолчанию
+	case err != nil:
+		return false, err
+	}
+
+	e.locker.Lock()
+	defer e.locker.Unlock()
+
+	if bytes.Equal(data, e.data) && (data == nil) == (e.data == nil) {
+		return false, nil
+	}
+
+	rules := DefaultRules()
+	if data != nil {
+		if rules, err = ParseRules(data); err != nil {
+			return false, fmt.Errorf("invalid points rules file %s: %+v", e.path, err)
+		}
+	}
+
+	e.data = data
+	e.rules = rules
+	return true, nil
+}
+
+// Watch проверяет файл правил каждые interval и перезагружает его при изменении (нулевой interval - без перезагрузки).
+func (e *Engine) Watch(interval time.Duration) {
+	if interval <= 0 || e.path == "" {
+		return
+	}
+
+	go func() {
+		for range time.Tick(interval) {
+			if changed, err := e.Reload(); err != nil {
+				log.Println(err)
+			} else if changed {
+				log.Printf("points rules reloaded from %s\n", e.path)
+			}
+		}
+	}()
+}
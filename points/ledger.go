@@ -0,0 +1,173 @@
+package points
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"zo-backend/atomicfile"
+)
+
+// Entry - баллы пользователя за одно мероприятие (одна книга DashaMail). Значения хранятся в том виде,
+// в котором они записаны в DashaMail, чтобы getUserPoints считал баллы так же, как при чтении книг напрямую.
+type Entry struct {
+	BookID      string `json:"bookID"`
+	EventDate   string `json:"eventDate,omitempty"`
+	EventName   string `json:"eventName,omitempty"`
+	NMO         string `json:"nmo,omitempty"`
+	ZET         string `json:"zet,omitempty"`
+	Certificate string `json:"certificate,omitempty"`
+
+	PointsZOView     string `json:"pointsZOView,omitempty"`
+	PointsZOQuestion string `json:"pointsZOQuestion,omitempty"`
+	PointsZOPoll     string `json:"pointsZOPoll,omitempty"`
+}
+
+type ledgerSnapshot struct {
+	SyncedAt time.Time          `json:"syncedAt"`
+	Books    int                `json:"books"`
+	Entries  map[string][]Entry `json:"entries"` // email (в нижнем регистре) -> баллы по мероприятиям
+}
+
+// Ledger - локальный реестр баллов пользователей, который целиком пересобирается синхронизацией со всеми книгами DashaMail
+// и сохраняется в JSON-файл, поэтому переживает перезапуск сервера.
+type Ledger struct {
+	path     string
+	snapshot ledgerSnapshot
+	locker   sync.RWMutex
+}
+
+// NewLedger загружает реестр из файла path (если файл уже есть).
+func NewLedger(path string) (*Ledger, error) {
+	errExplanation := "can't init points ledger"
+
+	if path == "" {
+		return nil, errWithExplanation(errExplanation, fmt.Errorf("ledger file path must be set"))
+	}
+
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, errWithExplanation(errExplanation, err)
+	}
+
+	l := &Ledger{path: path}
+
+	data, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, errWithExplanation(errExplanation, err)
+	default:
+		if err = json.Unmarshal(data, &l.snapshot); err != nil {
+			return nil, errWithExplanation(errExplanation, fmt.Errorf("can't read ledger file %s: %+v", path, err))
+		}
+	}
+
+	if l.snapshot.Entries == nil {
+		l.snapshot.Entries = make(map[string][]Entry)
+	}
+
+	return l, nil
+}
+
+// Synced сообщает, была ли хотя бы одна синхронизация. До первой синхронизации реестр пуст и не может отвечать на запросы.
+func (l *Ledger) Synced() bool {
+	return !l.SyncedAt().IsZero()
+}
+
+func (l *Ledger) SyncedAt() time.Time {
+	l.locker.RLock()
+	defer l.locker.RUnlock()
+
+	return l.snapshot.SyncedAt
+}
+
+// Entries возвращает баллы пользователя email по всем мероприятиям.
+func (l *Ledger) Entries(email string) []Entry {
+	l.locker.RLock()
+	defer l.locker.RUnlock()
+
+	return append([]Entry(nil), l.snapshot.Entries[strings.ToLower(email)]...)
+}
+
+// Stats возвращает время последней синхронизации, количество прочитанных книг и пользователей с баллами.
+func (l *Ledger) Stats() (syncedAt time.Time, books, users int) {
+	l.locker.RLock()
+	defer l.locker.RUnlock()
+
+	return l.snapshot.SyncedAt, l.snapshot.Books, len(l.snapshot.Entries)
+}
+
+// Replace заменяет содержимое реестра результатом синхронизации books книг.
+func (l *Ledger) Replace(entries map[string][]Entry, books int, syncedAt time.Time) error {
+	snapshot := ledgerSnapshot{SyncedAt: syncedAt, Books: books, Entries: make(map[string][]Entry, len(entries))}
+	for email, userEntries := range entries {
+		email = strings.ToLower(email)
+		snapshot.Entries[email] = append(snapshot.Entries[email], userEntries...)
+	}
+
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	if err := l.save(snapshot); err != nil {
+		return errWithExplanation("can't save points ledger", err)
+	}
+
+	l.snapshot = snapshot
+	return nil
+}
+
+// UpdateBook заменяет записи книги bookID у пользователей из entries (email -> записи книги) без полной синхронизации,
+// чтобы данные, только что записанные в DashaMail, сразу были видны в реестре. Пустой список удаляет запись книги у пользователя.
+func (l *Ledger) UpdateBook(bookID string, entries map[string][]Entry) error {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	snapshot := ledgerSnapshot{SyncedAt: l.snapshot.SyncedAt, Books: l.snapshot.Books, Entries: make(map[string][]Entry, len(l.snapshot.Entries))}
+	for email, userEntries := range l.snapshot.Entries {
+		snapshot.Entries[email] = userEntries
+	}
+
+	for email, bookEntries := range entries {
+		email = strings.ToLower(email)
+
+		userEntries := make([]Entry, 0, len(snapshot.Entries[email])+len(bookEntries))
+		for _, entry := range snapshot.Entries[email] {
+			if entry.BookID != bookID {
+				userEntries = append(userEntries, entry)
+			}
+		}
+		userEntries = append(userEntries, bookEntries...)
+
+		if len(userEntries) == 0 {
+			delete(snapshot.Entries, email)
+		} else {
+			snapshot.Entries[email] = userEntries
+		}
+	}
+
+	if err := l.save(snapshot); err != nil {
+		return errWithExplanation("can't save points ledger", err)
+	}
+
+	l.snapshot = snapshot
+	return nil
+}
+
+func (l *Ledger) save(snapshot ledgerSnapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	// в реестре почты и баллы пользователей, поэтому файл доступен только владельцу
+	return atomicfile.WriteFile(l.path, data, 0600)
+}
+
+func errWithExplanation(errExplanation string, err error) error {
+	return fmt.Errorf("%s: %w", errExplanation, err)
+}
@@ -0,0 +1,171 @@
+package points
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Правила по умолчанию (те же баллы и порог, что были зашиты в код до появления файла правил).
+//
+//go:embed default_rules.json
+var defaultRules []byte
+
+// EventType - тип мероприятия и правила начисления баллов ЗО за его просмотр.
+type EventType struct {
+	Name            string   `json:"name"`
+	Patterns        []string `json:"patterns"`        // регулярные выражения для названия видео в Facecast (совпадение с названием целиком)
+	MaxPoints       int      `json:"maxPoints"`       // баллы за полный просмотр
+	MinWatchShare   float64  `json:"minWatchShare"`   // минимальная доля просмотренных минут, ниже которой баллы не начисляются (по умолчанию 0.1)
+	LiveWeight      float64  `json:"liveWeight"`      // вес минуты прямого эфира (по умолчанию 1)
+	RecordingWeight float64  `json:"recordingWeight"` // вес минуты записи (по умолчанию 1)
+	ExpiryDays      int      `json:"expiryDays"`      // срок действия баллов в днях (0 - бессрочно)
+
+	Certificate Certificate `json:"certificate"` // требования к посещению для сертификата НМО
+
+	patterns []*regexp.Regexp
+}
+
+// UnmarshalJSON заполняет значения по умолчанию для полей, которых нет в файле правил.
+func (t *EventType) UnmarshalJSON(data []byte) error {
+	type plain EventType
+	p := plain{MinWatchShare: 0.1, LiveWeight: 1, RecordingWeight: 1, Certificate: defaultCertificate}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+
+	*t = EventType(p)
+	return nil
+}
+
+func (t EventType) Match(videoName string) bool {
+	for _, pattern := range t.patterns {
+		if pattern.MatchString(videoName) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Rules - набор типов мероприятий. Тип выбирается по первому совпавшему шаблону в порядке следования в файле.
+type Rules struct {
+	EventTypes []EventType `json:"eventTypes"`
+}
+
+// ParseRules читает правила из JSON и проверяет их.
+func ParseRules(data []byte) (Rules, error) {
+	var rules Rules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return Rules{}, err
+	}
+
+	if err := rules.compile(); err != nil {
+		return Rules{}, err
+	}
+
+	return rules, nil
+}
+
+func DefaultRules() Rules {
+	rules, err := ParseRules(defaultRules)
+	if err != nil {
+		panic(fmt.Sprintf("invalid default points rules: %+v", err))
+	}
+
+	return rules
+}
+
+func (r *Rules) compile() error {
+	if len(r.EventTypes) == 0 {
+		return fmt.Errorf("at least one event type is required")
+	}
+
+	for i := range r.EventTypes {
+		t := &r.EventTypes[i]
+
+		switch {
+		case t.Name == "":
+			return fmt.Errorf("event type #%v: name must be set", i+1)
+		case len(t.Patterns) == 0:
+			return fmt.Errorf("event type '%s': at least one pattern is required", t.Name)
+		case t.MaxPoints < 0:
+			return fmt.Errorf("event type '%s': maxPoints can't be negative", t.Name)
+		case t.MinWatchShare < 0 || t.MinWatchShare > 1:
+			return fmt.Errorf("event type '%s': minWatchShare must be between 0 and 1", t.Name)
+		case t.LiveWeight < 0 || t.RecordingWeight < 0:
+			return fmt.Errorf("event type '%s': weights can't be negative", t.Name)
+		case t.ExpiryDays < 0:
+			return fmt.Errorf("event type '%s': expiryDays can't be negative", t.Name)
+		case t.Certificate.MinWatchShare < 0 || t.Certificate.MinWatchShare > 1:
+			return fmt.Errorf("event type '%s': certificate minWatchShare must be between 0 and 1", t.Name)
+		case t.Certificate.MinConfirmedWindowsShare < 0 || t.Certificate.MinConfirmedWindowsShare > 1:
+			return fmt.Errorf("event type '%s': certificate minConfirmedWindowsShare must be between 0 and 1", t.Name)
+		}
+
+		t.patterns = make([]*regexp.Regexp, 0, len(t.Patterns))
+		for _, pattern := range t.Patterns {
+			re, err := regexp.Compile("^(?:" + pattern + ")$")
+			if err != nil {
+				return fmt.Errorf("event type '%s': invalid pattern '%s': %+v", t.Name, pattern, err)
+			}
+			t.patterns = append(t.patterns, re)
+		}
+	}
+
+	return nil
+}
+
+// EventType возвращает тип мероприятия по названию видео в Facecast.
+func (r Rules) EventType(videoName string) (EventType, bool) {
+	videoName = strings.TrimSpace(videoName)
+	for _, t := range r.EventTypes {
+		if t.Match(videoName) {
+			return t, true
+		}
+	}
+
+	return EventType{}, false
+}
+
+// Award - баллы ЗО, которые зритель получает за просмотр мероприятия.
+type Award struct {
+	EventType  string     `json:"eventType,omitempty"`
+	MaxPoints  int        `json:"maxPoints"`
+	WatchShare float64    `json:"watchShare"` // доля просмотренных минут (прямой эфир и запись без учета весов)
+	Points     int        `json:"points"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+}
+
+// Award считает баллы зрителя за мероприятие videoName продолжительностью duration минут, если он посмотрел minutesOnline
+// минут в прямом эфире и minutesOffline - в записи. earnedAt - дата начисления баллов, от которой отсчитывается срок их действия.
+func (r Rules) Award(videoName string, duration, minutesOnline, minutesOffline int, earnedAt time.Time) Award {
+	t, ok := r.EventType(videoName)
+	if !ok || duration <= 0 {
+		return Award{EventType: t.Name, MaxPoints: t.MaxPoints}
+	}
+
+	award := Award{
+		EventType:  t.Name,
+		MaxPoints:  t.MaxPoints,
+		WatchShare: float64(minutesOnline+minutesOffline) / float64(duration),
+	}
+
+	if award.WatchShare < t.MinWatchShare {
+		return award
+	}
+
+	weightedShare := (float64(minutesOnline)*t.LiveWeight + float64(minutesOffline)*t.RecordingWeight) / float64(duration)
+	award.Points = int(math.Round(math.Min(weightedShare, 1) * float64(t.MaxPoints)))
+
+	if award.Points > 0 && t.ExpiryDays > 0 && !earnedAt.IsZero() {
+		expiresAt := earnedAt.AddDate(0, 0, t.ExpiryDays)
+		award.ExpiresAt = &expiresAt
+	}
+
+	return award
+}
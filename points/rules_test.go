@@ -0,0 +1,106 @@
+package points
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testRules(t *testing.T) Rules {
+	t.Helper()
+
+	rules, err := ParseRules([]byte(`{"eventTypes": [
+		{"name": "Вебинар", "patterns": ["Вебинар( НМО)?"], "maxPoints": 20},
+		{"name": "Школа", "patterns": ["Школа .*"], "maxPoints": 40, "minWatchShare": 0.25, "recordingWeight": 0.5, "expiryDays": 365,
+			"certificate": {"minWatchShare": 0.7, "countRecording": true}}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rules
+}
+
+func TestRulesAward(t *testing.T) {
+	rules := testRules(t)
+	earnedAt := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+	expiresAt := time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name                      string
+		videoName                 string
+		duration, online, offline int
+		wantType                  string
+		wantPoints                int
+		wantExpiresAt             *time.Time
+	}{
+		{name: "full live", videoName: "Вебинар НМО", duration: 60, online: 60, wantType: "Вебинар", wantPoints: 20},
+		{name: "live and recording", videoName: " Вебинар ", duration: 60, online: 15, offline: 15, wantType: "Вебинар", wantPoints: 10},
+		{name: "more than duration", videoName: "Вебинар", duration: 60, online: 90, wantType: "Вебинар", wantPoints: 20},
+		{name: "below min share", videoName: "Вебинар", duration: 60, online: 5, wantType: "Вебинар", wantPoints: 0},
+		{name: "recording weight", videoName: "Школа кардиологии", duration: 100, online: 50, offline: 50, wantType: "Школа", wantPoints: 30, wantExpiresAt: &expiresAt},
+		{name: "below custom min share", videoName: "Школа кардиологии", duration: 100, online: 20, wantType: "Школа", wantPoints: 0},
+		{name: "unknown duration", videoName: "Вебинар", duration: 0, online: 60, wantType: "Вебинар", wantPoints: 0},
+		{name: "unknown event type", videoName: "Круглый стол", duration: 60, online: 60, wantType: "", wantPoints: 0},
+	}
+
+	for _, test := range tests {
+		award := rules.Award(test.videoName, test.duration, test.online, test.offline, earnedAt)
+		if award.EventType != test.wantType || award.Points != test.wantPoints || !reflect.DeepEqual(award.ExpiresAt, test.wantExpiresAt) {
+			t.Errorf("%s: award %+v, want %v points of '%s' (expires at %v)", test.name, award, test.wantPoints, test.wantType, test.wantExpiresAt)
+		}
+	}
+}
+
+func TestRulesEligibility(t *testing.T) {
+	rules := testRules(t)
+
+	tests := []struct {
+		name                      string
+		videoName                 string
+		duration, online, offline int
+		confirmed, windows        int
+		wantEligible              bool
+		wantReason                string
+	}{
+		{name: "half live", videoName: "Вебинар", duration: 60, online: 30, wantEligible: true},
+		{name: "not watched", videoName: "Вебинар", duration: 60, wantReason: "не смотрел"},
+		{name: "only recording", videoName: "Вебинар", duration: 60, offline: 60, wantReason: "только запись"},
+		{name: "too little", videoName: "Вебинар", duration: 60, online: 20, wantReason: "просмотрено 33% мероприятия, требуется не меньше 50%"},
+		{name: "unknown duration", videoName: "Вебинар", online: 20, wantReason: "неизвестна продолжительность"},
+		{name: "windows confirmed", videoName: "Вебинар", duration: 60, online: 60, confirmed: 2, windows: 4, wantEligible: true},
+		{name: "windows not confirmed", videoName: "Вебинар", duration: 60, online: 60, confirmed: 1, windows: 4, wantReason: "подтверждено 1 из 4 окон"},
+		{name: "recording counted", videoName: "Школа кардиологии", duration: 100, online: 40, offline: 30, wantEligible: true},
+		{name: "custom min share", videoName: "Школа кардиологии", duration: 100, online: 40, offline: 20, wantReason: "требуется не меньше 70%"},
+		{name: "default requirements", videoName: "Круглый стол", duration: 60, online: 30, wantEligible: true},
+	}
+
+	for _, test := range tests {
+		eligibility := rules.Eligibility(test.videoName, test.duration, test.online, test.offline, test.confirmed, test.windows)
+		if eligibility.Eligible != test.wantEligible || (test.wantReason == "") != (len(eligibility.Reasons) == 0) ||
+			(test.wantReason != "" && !strings.Contains(strings.Join(eligibility.Reasons, "; "), test.wantReason)) {
+			t.Errorf("%s: eligibility %+v, want eligible %v (reason %q)", test.name, eligibility, test.wantEligible, test.wantReason)
+		}
+	}
+}
+
+func TestParseRulesErrors(t *testing.T) {
+	tests := []struct {
+		rules string
+		err   string
+	}{
+		{`{"eventTypes": []}`, "at least one event type"},
+		{`{"eventTypes": [{"patterns": ["Вебинар"]}]}`, "name must be set"},
+		{`{"eventTypes": [{"name": "Вебинар"}]}`, "at least one pattern"},
+		{`{"eventTypes": [{"name": "Вебинар", "patterns": ["("]}]}`, "invalid pattern"},
+		{`{"eventTypes": [{"name": "Вебинар", "patterns": ["Вебинар"], "minWatchShare": 2}]}`, "minWatchShare must be between 0 and 1"},
+		{`{"eventTypes": [{"name": "Вебинар", "patterns": ["Вебинар"], "certificate": {"minConfirmedWindowsShare": -1}}]}`, "minConfirmedWindowsShare"},
+	}
+
+	for _, test := range tests {
+		if _, err := ParseRules([]byte(test.rules)); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("ParseRules(%s) error %v, want %q", test.rules, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,423 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/wcharczuk/go-chart/v2/drawing"
+	excel "github.com/xuri/excelize/v2"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+
+	"zo-backend/eventdate"
+)
+
+// CampaignsTotals - суммарная статистика группы рассылок.
+type CampaignsTotals struct {
+	Campaigns int
+
+	Sent          int
+	Opened        int
+	UniqueOpened  int
+	Clicked       int
+	UniqueClicked int
+	Unsubscribed  int
+}
+
+func (t *CampaignsTotals) Add(campaign CampaignReport) {
+	t.Campaigns++
+	t.Sent += campaign.Sent
+	t.Opened += campaign.Opened
+	t.UniqueOpened += campaign.UniqueOpened
+	t.Clicked += campaign.Clicked
+	t.UniqueClicked += campaign.UniqueClicked
+	t.Unsubscribed += campaign.Unsubscribed
+}
+
+// OpenRate и ClickRate считаются так же, как для одной рассылки.
+func (t CampaignsTotals) OpenRate() float64 {
+	return CampaignReport{Sent: t.Sent, UniqueOpened: t.UniqueOpened}.OpenRate()
+}
+
+func (t CampaignsTotals) ClickRate() float64 {
+	return CampaignReport{Sent: t.Sent, UniqueClicked: t.UniqueClicked}.ClickRate()
+}
+
+// CampaignsPeriodRow - рассылки за период (неделю, месяц или весь отчет), источник строки CampaignsPeriodSchema.
+// Даты - в формате '2006-01-02', EndDate входит в период.
+type CampaignsPeriodRow struct {
+	Period    string
+	StartDate string
+	EndDate   string
+	CampaignsTotals
+}
+
+// CampaignsComparisonRow - источник строки CampaignsComparisonSchema.
+type CampaignsComparisonRow struct {
+	Metric   string
+	Current  float64
+	Previous float64
+}
+
+// Change - изменение относительно предыдущего периода (0, если в предыдущем периоде показатель был нулевым).
+func (r CampaignsComparisonRow) Change() float64 {
+	if r.Previous == 0 {
+		return 0
+	}
+
+	return (r.Current - r.Previous) / r.Previous
+}
+
+// CampaignsAnalytics - динамика рассылок за период отчета по неделям и месяцам и сравнение с предыдущим периодом той же длины.
+type CampaignsAnalytics struct {
+	Weeks    []CampaignsPeriodRow
+	Months   []CampaignsPeriodRow
+	Current  CampaignsPeriodRow
+	Previous CampaignsPeriodRow
+}
+
+// PreviousCampaignsPeriod возвращает период той же длины, что и период с startDate по endDate (включительно),
+// который заканчивается накануне startDate.
+func PreviousCampaignsPeriod(startDate, endDate string) (string, string, error) {
+	start, end, err := parseCampaignsPeriod(startDate, endDate)
+	if err != nil {
+		return "", "", err
+	}
+
+	days := int(end.Sub(start).Hours()/24) + 1
+	previousEnd := start.AddDate(0, 0, -1)
+	previousStart := previousEnd.AddDate(0, 0, -(days - 1))
+
+	return previousStart.Format("2006-01-02"), previousEnd.Format("2006-01-02"), nil
+}
+
+// CampaignsReportPeriod возвращает период отчета по датам отправки рассылок (false, если ни одна дата не разобрана).
+func CampaignsReportPeriod(campaigns []CampaignReport) (string, string, bool) {
+	var start, end time.Time
+	for _, campaign := range campaigns {
+		date, err := campaignDate(campaign)
+		if err != nil {
+			continue
+		}
+
+		if start.IsZero() || date.Before(start) {
+			start = date
+		}
+		if end.IsZero() || date.After(end) {
+			end = date
+		}
+	}
+
+	if start.IsZero() {
+		return "", "", false
+	}
+
+	return start.Format("2006-01-02"), end.Format("2006-01-02"), true
+}
+
+// NewCampaignsAnalytics группирует рассылки периода с startDate по endDate по неделям (с понедельника) и месяцам и
+// сравнивает их с рассылками previous предыдущего периода (PreviousCampaignsPeriod). Первая и последняя неделя (месяц)
+// обрезаются по границам периода, периоды без рассылок остаются в отчете с нулями.
+func NewCampaignsAnalytics(campaigns, previous []CampaignReport, startDate, endDate string) (*CampaignsAnalytics, error) {
+	start, end, err := parseCampaignsPeriod(startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	previousStartDate, previousEndDate, err := PreviousCampaignsPeriod(startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	analytics := &CampaignsAnalytics{
+		Current:  CampaignsPeriodRow{Period: "Текущий период", StartDate: startDate, EndDate: endDate},
+		Previous: CampaignsPeriodRow{Period: "Предыдущий период", StartDate: previousStartDate, EndDate: previousEndDate},
+	}
+
+	for bucket := start; !bucket.After(end); {
+		// неделя - с понедельника по воскресенье
+		next := bucket.AddDate(0, 0, 7-(int(bucket.Weekday())+6)%7)
+		year, week := bucket.ISOWeek()
+		analytics.Weeks = append(analytics.Weeks, campaignsPeriodRow(fmt.Sprintf("%d-W%02d", year, week), bucket, next, end))
+		bucket = next
+	}
+
+	for bucket := start; !bucket.After(end); {
+		next := time.Date(bucket.Year(), bucket.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		month := fmt.Sprintf("%s %d", eventdate.FromTime(bucket).MonthName(), bucket.Year())
+		analytics.Months = append(analytics.Months, campaignsPeriodRow(month, bucket, next, end))
+		bucket = next
+	}
+
+	for _, campaign := range campaigns {
+		date, err := campaignDate(campaign)
+		if err != nil || date.Before(start) || date.After(end) {
+			continue
+		}
+
+		analytics.Current.Add(campaign)
+		for i := range analytics.Weeks {
+			if analytics.Weeks[i].contains(date) {
+				analytics.Weeks[i].Add(campaign)
+			}
+		}
+		for i := range analytics.Months {
+			if analytics.Months[i].contains(date) {
+				analytics.Months[i].Add(campaign)
+			}
+		}
+	}
+
+	for _, campaign := range previous {
+		analytics.Previous.Add(campaign)
+	}
+
+	return analytics, nil
+}
+
+// Comparison возвращает строки сравнения текущего периода с предыдущим. Доли - в процентах.
+func (a *CampaignsAnalytics) Comparison() []CampaignsComparisonRow {
+	current, previous := a.Current.CampaignsTotals, a.Previous.CampaignsTotals
+	percent := func(rate float64) float64 { return math.Round(rate*10000) / 100 }
+
+	return []CampaignsComparisonRow{
+		{Metric: "Рассылок", Current: float64(current.Campaigns), Previous: float64(previous.Campaigns)},
+		{Metric: "Отправлено", Current: float64(current.Sent), Previous: float64(previous.Sent)},
+		{Metric: "Уникальных открытий", Current: float64(current.UniqueOpened), Previous: float64(previous.UniqueOpened)},
+		{Metric: "Открываемость, %", Current: percent(current.OpenRate()), Previous: percent(previous.OpenRate())},
+		{Metric: "Уникальных переходов", Current: float64(current.UniqueClicked), Previous: float64(previous.UniqueClicked)},
+		{Metric: "Кликабельность, %", Current: percent(current.ClickRate()), Previous: percent(previous.ClickRate())},
+		{Metric: "Отписалось", Current: float64(current.Unsubscribed), Previous: float64(previous.Unsubscribed)},
+	}
+}
+
+// BuildCampaignsAnalyticsTables возвращает таблицы листов "По неделям", "По месяцам" и "Сравнение". На листе сравнения
+// под показателями - строки текущего и предыдущего периодов с датами.
+func BuildCampaignsAnalyticsTables(analytics *CampaignsAnalytics) ([]ReportTable, error) {
+	weeks := ReportTable{Sheet: "По неделям", Schema: CampaignsPeriodSchema}
+	months := ReportTable{Sheet: "По месяцам", Schema: CampaignsPeriodSchema}
+	comparison := ReportTable{Sheet: "Сравнение", Schema: CampaignsComparisonSchema}
+	periods := ReportTable{Sheet: "Сравнение", Schema: CampaignsPeriodSchema}
+
+	for _, group := range []struct {
+		table   *ReportTable
+		sources []interface{}
+	}{
+		{table: &weeks, sources: periodRowsSources(analytics.Weeks)},
+		{table: &months, sources: periodRowsSources(analytics.Months)},
+		{table: &comparison, sources: comparisonRowsSources(analytics.Comparison())},
+		{table: &periods, sources: []interface{}{analytics.Current, analytics.Previous}},
+	} {
+		for _, source := range group.sources {
+			row, err := group.table.Schema.Row(source)
+			if err != nil {
+				return nil, err
+			}
+			group.table.Rows = append(group.table.Rows, row)
+		}
+	}
+
+	return []ReportTable{weeks, months, comparison, periods}, nil
+}
+
+// PlotCampaignsCharts добавляет лист "Графики" с динамикой открываемости и кликабельности по неделям и сравнением
+// с предыдущим периодом.
+func PlotCampaignsCharts(f *excel.File, analytics *CampaignsAnalytics, debug *ServerDebug) error {
+	debug.SetDebugLastStage("PlotCampaignsCharts -> ")
+
+	var err error
+	defer debug.DeleteDebugLastStage(&err)
+
+	const (
+		RATES_TREND_CHART      = "campaignsRatesTrend.jpeg"
+		RATES_COMPARISON_CHART = "campaignsRatesComparison.jpeg"
+	)
+
+	f.NewSheet("Графики")
+
+	trend, err := initCampaignsTrendChart(analytics.Weeks)
+	if err != nil {
+		return err
+	}
+	if err = addChartPicture(f, trend, 20*vg.Centimeter, 15*vg.Centimeter, RATES_TREND_CHART, "A1"); err != nil {
+		return err
+	}
+
+	comparison, err := initCampaignsComparisonChart(analytics)
+	if err != nil {
+		return err
+	}
+	if err = addChartPicture(f, comparison, 15*vg.Centimeter, 15*vg.Centimeter, RATES_COMPARISON_CHART, "M1"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func initCampaignsTrendChart(weeks []CampaignsPeriodRow) (*plot.Plot, error) {
+	p := plot.New()
+	p.Legend.Top = true
+	p.Legend.TextStyle.Font.Size = 4 * vg.Millimeter
+	p.Title.TextStyle.Font.Size = 8 * vg.Millimeter
+	p.Title.Padding = 8 * vg.Millimeter
+	p.Title.Text = "\nОткрываемость и кликабельность по неделям" // доп. строка как отступ, как в графиках вебинара
+	p.X.Tick.Marker = plot.TimeTicks{Format: "02.01"}
+	p.X.Label.Text = "начало недели\n "
+	p.X.Label.TextStyle.Font.Size = 5 * vg.Millimeter
+	p.Y.Label.Text = "\n%"
+	p.Y.Label.TextStyle.Font.Size = 5 * vg.Millimeter
+	p.Y.Min = 0
+	p.Add(plotter.NewGrid())
+
+	openRates := make(plotter.XYs, 0, len(weeks))
+	clickRates := make(plotter.XYs, 0, len(weeks))
+	for _, week := range weeks {
+		start, _ := time.Parse("2006-01-02", week.StartDate)
+		openRates = append(openRates, plotter.XY{X: float64(start.Unix()), Y: week.OpenRate() * 100})
+		clickRates = append(clickRates, plotter.XY{X: float64(start.Unix()), Y: week.ClickRate() * 100})
+	}
+
+	for i, series := range []struct {
+		label  string
+		values plotter.XYs
+	}{
+		{label: "открываемость", values: openRates},
+		{label: "кликабельность", values: clickRates},
+	} {
+		line, points, err := plotter.NewLinePoints(series.values)
+		if err != nil {
+			return nil, err
+		}
+		line.LineStyle.Width = 0.5 * vg.Millimeter
+		line.LineStyle.Color = campaignsChartColors[i]
+		points.Color = campaignsChartColors[i]
+
+		p.Legend.Add(series.label, line, points)
+		p.Add(line, points)
+	}
+
+	return p, nil
+}
+
+func initCampaignsComparisonChart(analytics *CampaignsAnalytics) (*plot.Plot, error) {
+	p := plot.New()
+	p.Legend.Top = true
+	p.Legend.TextStyle.Font.Size = 4 * vg.Millimeter
+	p.Title.TextStyle.Font.Size = 8 * vg.Millimeter
+	p.Title.Padding = 8 * vg.Millimeter
+	p.Title.Text = "\nСравнение с предыдущим периодом"
+	p.Y.Label.Text = "\n%"
+	p.Y.Label.TextStyle.Font.Size = 5 * vg.Millimeter
+	p.Add(plotter.NewGrid())
+	p.NominalX("открываемость", "кликабельность")
+
+	barWidth := 2 * vg.Centimeter
+	for i, period := range []CampaignsPeriodRow{analytics.Current, analytics.Previous} {
+		bars, err := plotter.NewBarChart(plotter.Values{period.OpenRate() * 100, period.ClickRate() * 100}, barWidth)
+		if err != nil {
+			return nil, err
+		}
+		bars.LineStyle.Width = 0
+		bars.Color = campaignsChartColors[i]
+		bars.Offset = vg.Length(2*i-1) * barWidth / 2
+
+		p.Legend.Add(fmt.Sprintf("%s - %s", period.StartDate, period.EndDate), bars)
+		p.Add(bars)
+	}
+
+	return p, nil
+}
+
+var campaignsChartColors = []drawing.Color{
+	{R: 100, G: 149, B: 237, A: 255}, /*синий*/
+	{R: 144, G: 238, B: 144, A: 255}, /*зеленый*/
+}
+
+func addChartPicture(f *excel.File, p *plot.Plot, width, height vg.Length, plotName, cell string) error {
+	return addScaledChartPicture(f, p, width, height, plotName, cell, `{"x_scale": 0.7,"y_scale": 0.7}`)
+}
+
+// addScaledChartPicture рисует график в памяти (формат - по расширению plotName) и добавляет его на лист "Графики".
+// Файлы не создаются, поэтому отчеты, которые строятся одновременно в фоновых задачах, не мешают друг другу.
+func addScaledChartPicture(f *excel.File, p *plot.Plot, width, height vg.Length, plotName, cell, pictureFormat string) error {
+	extension := filepath.Ext(plotName)
+	writer, err := p.WriterTo(width, height, strings.TrimPrefix(extension, "."))
+	if err != nil {
+		return fmt.Errorf("error with chart %s: %+v", plotName, err)
+	}
+
+	picture := new(bytes.Buffer)
+	if _, err = writer.WriteTo(picture); err != nil {
+		return fmt.Errorf("error with chart %s: %+v", plotName, err)
+	}
+
+	if err = f.AddPictureFromBytes("Графики", cell, pictureFormat, strings.TrimSuffix(plotName, extension), extension, picture.Bytes()); err != nil {
+		return fmt.Errorf("can't add chart %s to excel report: %+v", plotName, err)
+	}
+
+	return nil
+}
+
+func campaignsPeriodRow(period string, start, next, end time.Time) CampaignsPeriodRow {
+	last := next.AddDate(0, 0, -1)
+	if last.After(end) {
+		last = end
+	}
+
+	return CampaignsPeriodRow{Period: period, StartDate: start.Format("2006-01-02"), EndDate: last.Format("2006-01-02")}
+}
+
+func (r CampaignsPeriodRow) contains(date time.Time) bool {
+	day := date.Format("2006-01-02")
+	return day >= r.StartDate && day <= r.EndDate
+}
+
+func periodRowsSources(rows []CampaignsPeriodRow) []interface{} {
+	sources := make([]interface{}, len(rows))
+	for i, row := range rows {
+		sources[i] = row
+	}
+
+	return sources
+}
+
+func comparisonRowsSources(rows []CampaignsComparisonRow) []interface{} {
+	sources := make([]interface{}, len(rows))
+	for i, row := range rows {
+		sources[i] = row
+	}
+
+	return sources
+}
+
+func campaignDate(campaign CampaignReport) (time.Time, error) {
+	date, err := time.Parse("2006-01-02 15:04:05", campaign.Date)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC), nil
+}
+
+func parseCampaignsPeriod(startDate, endDate string) (time.Time, time.Time, error) {
+	start, err := time.Parse("2006-01-02", startDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("error startDate format (need 'YYYY-MM-DD')")
+	}
+
+	end, err := time.Parse("2006-01-02", endDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("error endDate format (need 'YYYY-MM-DD')")
+	}
+
+	if end.Before(start) {
+		return time.Time{}, time.Time{}, fmt.Errorf("endDate %s is before startDate %s", endDate, startDate)
+	}
+
+	return start, end, nil
+}
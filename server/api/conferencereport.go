@@ -0,0 +1,317 @@
+package api
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	excel "github.com/xuri/excelize/v2"
+
+	"zo-backend/eventdate"
+	"zo-backend/points"
+)
+
+// BuildConferenceReport сводит отчеты по залам конференции (reports[i] - отчет по вебинару eventIDs[i]) в один отчет.
+// Минуты залов переводятся в минуты конференции, которые отсчитываются от начала самой ранней трансляции, поэтому
+// зритель, переходивший из зала в зал, попадает в отчет один раз, а минута, просмотренная сразу в нескольких залах,
+// засчитывается один раз. Баллы ЗО пересчитываются по правилам rules от продолжительности всей конференции.
+func BuildConferenceReport(eventIDs []string, reports []*GetReportServerResponse, rules points.Rules) *GetReportServerResponse {
+	type hall struct {
+		eventID string
+		report  *GetReportServerResponse
+		start   eventdate.EventDate
+		offset  int // минута конференции, предшествующая первой минуте зала
+	}
+
+	halls := make([]hall, len(reports))
+	for i, report := range reports {
+		// минуты ФК отсчитываются от фактического начала трансляции, плановое начало - если трансляция не начиналась
+		start, err := eventdate.Parse(report.EventInfo.StartDate)
+		if err != nil {
+			start, _ = eventdate.Parse(report.EventInfo.PlanStartDate)
+		}
+		halls[i] = hall{eventID: eventIDs[i], report: report, start: start}
+	}
+	sort.SliceStable(halls, func(i, j int) bool {
+		if halls[i].start.IsZero() || halls[j].start.IsZero() {
+			return !halls[i].start.IsZero() && halls[j].start.IsZero()
+		}
+		return halls[i].start.Before(halls[j].start.Time)
+	})
+
+	conference := &GetReportServerResponse{
+		UsersInfo: make(map[string]UserInfo),
+		Halls:     make([]ConferenceHallInfo, len(halls)),
+	}
+	conferenceStart := halls[0].start
+
+	// минуты каждого зрителя в каждом зале (индекс - номер зала в halls), чтобы затем определить зал каждой минуты
+	hallsOnline := make(map[string][]map[int]bool)
+	hallsOffline := make(map[string][]map[int]bool)
+
+	for i := range halls {
+		h := &halls[i]
+		if !h.start.IsZero() && !conferenceStart.IsZero() {
+			h.offset = int(h.start.Sub(conferenceStart.Time).Minutes())
+		}
+
+		info := h.report.EventInfo
+		conference.Halls[i] = ConferenceHallInfo{
+			EventID:     h.eventID,
+			VideoName:   info.VideoName,
+			StartDate:   info.StartDate,
+			FirstMinute: h.offset + 1,
+			Duration:    info.Duration,
+			Viewers:     info.ViewersTotal,
+		}
+		if h.offset+info.Duration > conference.EventInfo.Duration {
+			conference.EventInfo.Duration = h.offset + info.Duration
+		}
+
+		for email, user := range h.report.UsersInfo {
+			email = strings.ToLower(email)
+			minutesOnline := shiftMinutes(user.MinutesOnline, h.offset)
+			minutesOffline := shiftMinutes(user.MinutesOffline, h.offset)
+
+			merged, ok := conference.UsersInfo[email]
+			if !ok {
+				// данные из ДМ одинаковы во всех залах, поэтому берутся из первого зала зрителя
+				merged = user
+				merged.Key, merged.EventID = "", ""
+				merged.MinutesOnline, merged.MinutesOffline = nil, nil
+				merged.AllWindows, merged.Windows = 0, 0
+
+				hallsOnline[email] = make([]map[int]bool, len(halls))
+				hallsOffline[email] = make([]map[int]bool, len(halls))
+			}
+
+			merged.Key = appendDistinct(merged.Key, user.Key)
+			merged.EventID = appendDistinct(merged.EventID, h.eventID)
+			merged.AllWindows += user.AllWindows
+			merged.Windows += user.Windows
+			AppendMinutesIfMissing(&merged.MinutesOnline, minutesOnline...)
+			AppendMinutesIfMissing(&merged.MinutesOffline, minutesOffline...)
+			hallsOnline[email][i] = minutesSet(minutesOnline)
+			hallsOffline[email][i] = minutesSet(minutesOffline)
+
+			conference.UsersInfo[email] = merged
+		}
+	}
+
+	pointsVideoName := halls[0].report.EventInfo.VideoName // тип мероприятия для баллов ЗО - по первому залу
+	onlineViewers := make(map[int]int)
+	for email, user := range conference.UsersInfo {
+		FilterMinutesOffline(&user.MinutesOffline, user.MinutesOnline...) // минута, просмотренная онлайн хотя бы в одном зале, - онлайн
+
+		user.MinutesViewedOnline = len(user.MinutesOnline)
+		user.FirstMinuteOnline, user.LastMinuteOnline = minutesBounds(user.MinutesOnline)
+		user.MinutesViewedOffline = len(user.MinutesOffline)
+		user.FirstMinuteOffline, user.LastMinuteOffline = minutesBounds(user.MinutesOffline)
+		user.ViewRegime = GetViewRegime(user.MinutesViewedOnline, user.MinutesViewedOffline)
+		user.PointsZOView = rules.Award(pointsVideoName, conference.EventInfo.Duration, user.MinutesViewedOnline, user.MinutesViewedOffline, time.Time{}).Points
+
+		/*/
+		 * Каждая минута засчитывается одному залу: минута онлайн - первому залу, где ее смотрели онлайн, минута в записи -
+		 * первому залу, где ее смотрели в записи (залы упорядочены по началу трансляции).
+		/*/
+		user.HallMinutes = nil
+		for _, minutes := range []struct {
+			minutes []int
+			halls   []map[int]bool
+		}{
+			{minutes: user.MinutesOnline, halls: hallsOnline[email]},
+			{minutes: user.MinutesOffline, halls: hallsOffline[email]},
+		} {
+			for _, minute := range minutes.minutes {
+				for i, hallMinutes := range minutes.halls {
+					if hallMinutes[minute] {
+						if user.HallMinutes == nil {
+							user.HallMinutes = make(map[string][]int)
+						}
+						user.HallMinutes[halls[i].eventID] = append(user.HallMinutes[halls[i].eventID], minute)
+						conference.Halls[i].MinutesViewed++
+						break
+					}
+				}
+			}
+		}
+		for _, minutes := range user.HallMinutes {
+			sort.Ints(minutes)
+		}
+
+		for _, minute := range user.MinutesOnline {
+			onlineViewers[minute]++
+		}
+		if user.ViewRegime != "" {
+			conference.EventInfo.ViewersTotal++
+		}
+
+		conference.UsersInfo[email] = user
+	}
+
+	/*/
+	 * Данные конференции: названия залов, плановое и фактическое начало самой ранней трансляции, окончание самой поздней,
+	 * максимум зрителей онлайн в одну минуту конференции.
+	/*/
+	var (
+		names []string
+		end   eventdate.EventDate
+	)
+	for _, h := range halls {
+		if h.report.EventInfo.VideoName != "" && !containsString(names, h.report.EventInfo.VideoName) {
+			names = append(names, h.report.EventInfo.VideoName)
+		}
+		if date, err := eventdate.Parse(h.report.EventInfo.EndDate); err == nil && date.After(end.Time) {
+			end = date
+			conference.EventInfo.EndDate = h.report.EventInfo.EndDate
+		}
+	}
+
+	info := &conference.EventInfo
+	info.VideoName = strings.Join(names, " / ")
+	info.Description = halls[0].report.EventInfo.Description
+	info.PlanStartDate = halls[0].report.EventInfo.PlanStartDate
+	info.StartDate = halls[0].report.EventInfo.StartDate
+	maxMinute := 0
+	for minute, viewers := range onlineViewers {
+		if viewers > info.ViewersMax || (viewers == info.ViewersMax && minute < maxMinute) {
+			info.ViewersMax, maxMinute = viewers, minute
+		}
+	}
+	if maxMinute > 0 && !conferenceStart.IsZero() {
+		info.TimeViewersMax = conferenceStart.Add(time.Duration(maxMinute-1) * time.Minute).Format("02.01.2006 15:04")
+	}
+	info.ReportTime = TimeToHuman(time.Now())
+
+	conference.ReportName = "Отчёт по конференции " + strings.Replace(info.PlanStartDate, ":", ".", -1)
+
+	return conference
+}
+
+// BuildConferenceReportTables возвращает таблицы залов сводного отчета: залы и минуты каждого зрителя по залам
+// (зрители - по email, залы - по началу трансляции). Для отчета по одному вебинару таблиц нет.
+func BuildConferenceReportTables(report *GetReportServerResponse) ([]ReportTable, error) {
+	if len(report.Halls) == 0 {
+		return nil, nil
+	}
+
+	halls := ReportTable{Sheet: "Залы", Schema: ConferenceHallsSchema}
+	for _, hall := range report.Halls {
+		row, err := ConferenceHallsSchema.Row(hall)
+		if err != nil {
+			return nil, err
+		}
+		halls.Rows = append(halls.Rows, row)
+	}
+
+	emails := make([]string, 0, len(report.UsersInfo))
+	for email := range report.UsersInfo {
+		emails = append(emails, email)
+	}
+	sort.Strings(emails)
+
+	minutes := ReportTable{Sheet: "Минуты по залам", Schema: ConferenceHallMinutesSchema}
+	for _, email := range emails {
+		user := report.UsersInfo[email]
+		for _, hall := range report.Halls {
+			if len(user.HallMinutes[hall.EventID]) == 0 {
+				continue
+			}
+
+			row, err := ConferenceHallMinutesSchema.Row(ConferenceHallMinutesRow{
+				Name:      user.Name,
+				Email:     user.Email,
+				EventID:   hall.EventID,
+				VideoName: hall.VideoName,
+				Minutes:   user.HallMinutes[hall.EventID],
+			})
+			if err != nil {
+				return nil, err
+			}
+			minutes.Rows = append(minutes.Rows, row)
+		}
+	}
+
+	return []ReportTable{halls, minutes}, nil
+}
+
+// WriteExcelConferenceHalls добавляет в excel-отчет по вебинару листы залов, если отчет сводный.
+func WriteExcelConferenceHalls(f *excel.File, report *GetReportServerResponse, debug *ServerDebug) error {
+	debug.SetDebugLastStage("WriteExcelConferenceHalls")
+
+	tables, err := BuildConferenceReportTables(report)
+	if err != nil {
+		return err
+	}
+
+	return WriteExcelReportTables(f, tables)
+}
+
+// FormatExcelConferenceHalls выравнивает столбцы листов залов и задает форматы ячеек.
+func FormatExcelConferenceHalls(f *excel.File, report *GetReportServerResponse, debug *ServerDebug) error {
+	debug.SetDebugLastStage("FormatExcelConferenceHalls")
+
+	tables, err := BuildConferenceReportTables(report)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		if err = AutoResizeColumns(f, table.Sheet, debug); err != nil {
+			return err
+		}
+	}
+
+	return FormatExcelReportTables(f, tables)
+}
+
+// shiftMinutes переводит минуты зала в минуты конференции.
+func shiftMinutes(minutes []int, offset int) []int {
+	shifted := make([]int, len(minutes))
+	for i, minute := range minutes {
+		shifted[i] = minute + offset
+	}
+
+	return shifted
+}
+
+func minutesSet(minutes []int) map[int]bool {
+	set := make(map[int]bool, len(minutes))
+	for _, minute := range minutes {
+		set[minute] = true
+	}
+
+	return set
+}
+
+// minutesBounds возвращает первую и последнюю минуты отсортированного списка (нули для пустого списка).
+func minutesBounds(minutes []int) (int, int) {
+	if len(minutes) == 0 {
+		return 0, 0
+	}
+
+	return minutes[0], minutes[len(minutes)-1]
+}
+
+// appendDistinct дописывает value в список через запятую, если его там еще нет.
+func appendDistinct(list, value string) string {
+	if value == "" {
+		return list
+	} else if list == "" {
+		return value
+	} else if containsString(strings.Split(list, ", "), value) {
+		return list
+	}
+
+	return list + ", " + value
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/benoitmasson/plotters/piechart"
 	"github.com/mitchellh/mapstructure"
@@ -12,7 +13,6 @@ import (
 	"gonum.org/v1/plot/vg"
 	"image/color"
 	"math"
-	"os"
 	"reflect"
 	"sort"
 	"strconv"
@@ -64,7 +64,22 @@ func (sd *ServerDebug) SetDebugData(lastSentData, lastResponseData *[]byte) {
 	sd.LastResponseData = *lastResponseData
 }
 
-func getErrorMessage(debug *ServerDebug) string {
+// exchangeError - ошибка клиента внешнего API (например, dashamail.CallError), хранящая отправленные и полученные данные запроса.
+type exchangeError interface {
+	error
+	ExchangeData() (sent, received []byte)
+}
+
+// SetDebugDataFromError переносит в debug данные неудачного запроса, если err (или вложенная в нее ошибка) их хранит.
+func (sd *ServerDebug) SetDebugDataFromError(err error) {
+	var exErr exchangeError
+	if errors.As(err, &exErr) {
+		sent, received := exErr.ExchangeData()
+		sd.SetDebugData(&sent, &received)
+	}
+}
+
+func GetErrorMessage(debug *ServerDebug) string {
 	errorMessage := ""
 
 	if debug.ExecutionStages != "" {
@@ -96,21 +111,6 @@ func getErrorMessage(debug *ServerDebug) string {
 	return errorMessage
 }
 
-func GetEventMaxPoints(videoName string) int {
-	switch videoName {
-	case "Вебинар", "Вебинар НМО", "Интерактивная школа", "Интерактивная школа НМО":
-		return 20
-	case "Круглый стол", "Круглый стол НМО", "Медицинский тренинг", "Медицинский тренинг НМО":
-		return 30
-	case "Конференция межрегиональная", "Конференция межрегиональная НМО":
-		return 40
-	case "Конференция ЗО", "Конференция ЗО НМО", "Конференция НАСИБ", "Конференция НАСИБ НМО":
-		return 50
-	default:
-		return 0
-	}
-}
-
 func AppendMinutesIfMissing(slice *[]int, elems ...int) bool {
 	changed := false
 	defer func() {
@@ -194,27 +194,18 @@ func GetViewRegime(minutesViewedOnline, minutesViewedOffline int) string {
 	}
 }
 
-func GetPointsZOView(eventMaxPoints, duration, minutesViewed int) float64 {
-	if minPart := float64(minutesViewed) / float64(duration); minPart < 0.1 {
-		return 0
-	} else {
-		return math.Round(minPart * float64(eventMaxPoints))
-	}
-}
-
+// WriteExcelWebinarData записывает в excel-отчет строки, подготовленные frontend, и собирает данные для графиков.
+// Столбцы для графиков находятся по схемам WebinarEventSchema и WebinarUsersSchema.
 func WriteExcelWebinarData(f *excel.File, reportData []interface{}, debug *ServerDebug) (map[string]int, map[string]int, map[int]struct{ Online, Offline, Total int }, error) {
 	debug.SetDebugLastStage("WriteExcelWebinarData")
 
-	G2 := int(reportData[1].([]interface{})[6].(float64)) // клетка G2 - продолжительность эфира
-	viewingRegimes, specialisations, minutesDistribution := GetPlottingVariables(G2)
+	eventRow, _ := reportData[1].([]interface{})
+	duration, _ := WebinarEventSchema.Value(eventRow, WEBINAR_COLUMN_DURATION).(float64) // продолжительность эфира
+	viewingRegimes, specialisations, minutesDistribution := GetPlottingVariables(int(duration))
 	for rowNum, row := range reportData {
 		line := row.([]interface{})
 		if rowNum > 2 { // пропускаем заголовок excel-отчета
-			AddViewerRegime(viewingRegimes, line[21].(string))                             // столбец V - режим просмотра
-			AddViewerSpecialisation(specialisations, line[19].(string), line[21].(string)) // столбец T - специализация и столбец V - режим просмотра
-			minutesOnline, _ := line[10].([]interface{})                                   // столбец K - просмотренные минуты онлайн
-			minutesOffline, _ := line[14].([]interface{})                                  // столбец O - просмотренные минуты офлайн
-			AddViewerMinutes(minutesDistribution, minutesOnline, minutesOffline)
+			AddWebinarChartsRow(line, viewingRegimes, specialisations, minutesDistribution)
 		}
 
 		err := f.SetSheetRow("Отчёт", "A"+strconv.Itoa(rowNum+1), &line)
@@ -227,6 +218,71 @@ func WriteExcelWebinarData(f *excel.File, reportData []interface{}, debug *Serve
 	return *viewingRegimes, *specialisations, *minutesDistribution, nil
 }
 
+// WriteExcelWebinarReport записывает в excel-отчет данные, собранные getWebinarReportInfo, и собирает данные для графиков.
+func WriteExcelWebinarReport(f *excel.File, eventID string, report *GetReportServerResponse, debug *ServerDebug) (map[string]int, map[string]int, map[int]struct{ Online, Offline, Total int }, error) {
+	debug.SetDebugLastStage("WriteExcelWebinarReport")
+
+	eventTable, usersTable, err := BuildWebinarReportTables(eventID, report)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	err = WebinarEventSchema.WriteRows(f, "Отчёт", 1, append([][]interface{}{WebinarEventSchema.Headers()}, eventTable.Rows...))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	viewingRegimes, specialisations, minutesDistribution := GetPlottingVariables(report.EventInfo.Duration)
+	for _, row := range usersTable.Rows {
+		AddWebinarChartsRow(row, viewingRegimes, specialisations, minutesDistribution)
+	}
+
+	err = WebinarUsersSchema.WriteRows(f, "Отчёт", 3, append([][]interface{}{WebinarUsersSchema.Headers()}, usersTable.Rows...))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return *viewingRegimes, *specialisations, *minutesDistribution, nil
+}
+
+// BuildWebinarReportTables строит по схемам строку мероприятия и строки зрителей. Зрители упорядочены по email,
+// чтобы повторно построенный отчет не отличался от предыдущего.
+func BuildWebinarReportTables(eventID string, report *GetReportServerResponse) (ReportTable, ReportTable, error) {
+	eventRow, err := WebinarEventSchema.Row(WebinarEventRow{EventID: eventID, FacecastEventInfoResponse: report.EventInfo})
+	if err != nil {
+		return ReportTable{}, ReportTable{}, err
+	}
+
+	emails := make([]string, 0, len(report.UsersInfo))
+	for email := range report.UsersInfo {
+		emails = append(emails, email)
+	}
+	sort.Strings(emails)
+
+	users := ReportTable{Schema: WebinarUsersSchema}
+	for _, email := range emails {
+		row, err := WebinarUsersSchema.Row(report.UsersInfo[email])
+		if err != nil {
+			return ReportTable{}, ReportTable{}, err
+		}
+		users.Rows = append(users.Rows, row)
+	}
+
+	return ReportTable{Schema: WebinarEventSchema, Rows: [][]interface{}{eventRow}}, users, nil
+}
+
+// AddWebinarChartsRow добавляет зрителя (строку WebinarUsersSchema) в данные графиков отчета по вебинару.
+func AddWebinarChartsRow(row []interface{}, viewingRegimes, specialisations *map[string]int, minutesDistribution *map[int]struct{ Online, Offline, Total int }) {
+	regime, _ := WebinarUsersSchema.Value(row, WEBINAR_COLUMN_VIEW_REGIME).(string)
+	specialisation, _ := WebinarUsersSchema.Value(row, WEBINAR_COLUMN_SPECIALIZATION).(string)
+	minutesOnline := ToMinutes(WebinarUsersSchema.Value(row, WEBINAR_COLUMN_MINUTES_ONLINE))
+	minutesOffline := ToMinutes(WebinarUsersSchema.Value(row, WEBINAR_COLUMN_MINUTES_OFFLINE))
+
+	AddViewerRegime(viewingRegimes, regime)
+	AddViewerSpecialisation(specialisations, specialisation, regime)
+	AddViewerMinutes(minutesDistribution, minutesOnline, minutesOffline)
+}
+
 func GetPlottingVariables(eventDuration int) (*map[string]int, *map[string]int, *map[int]struct{ Online, Offline, Total int }) {
 	viewingRegimes := map[string]int{
 		"в эфире":            0,
@@ -265,9 +321,8 @@ func AddViewerSpecialisation(plotData *map[string]int, specialisation, regime st
 	}
 }
 
-func AddViewerMinutes(plotData *map[int]struct{ Online, Offline, Total int }, minutesOnline, minutesOffline []interface{}) {
-	for _, _minute := range minutesOnline {
-		minute := int(_minute.(float64))
+func AddViewerMinutes(plotData *map[int]struct{ Online, Offline, Total int }, minutesOnline, minutesOffline []int) {
+	for _, minute := range minutesOnline {
 		(*plotData)[minute] = struct{ Online, Offline, Total int }{
 			Online:  (*plotData)[minute].Online + 1,
 			Offline: (*plotData)[minute].Offline,
@@ -275,8 +330,7 @@ func AddViewerMinutes(plotData *map[int]struct{ Online, Offline, Total int }, mi
 		}
 	}
 
-	for _, _minute := range minutesOffline {
-		minute := int(_minute.(float64))
+	for _, minute := range minutesOffline {
 		(*plotData)[minute] = struct{ Online, Offline, Total int }{
 			Online:  (*plotData)[minute].Online,
 			Offline: (*plotData)[minute].Offline + 1,
@@ -329,22 +383,7 @@ func PlotPieChart(f *excel.File, plotName string, plotData map[string]int, debug
 		p.Add(pie)
 	}
 
-	if err := p.Save(15*vg.Centimeter, 20*vg.Centimeter, plotName); err != nil {
-		err = fmt.Errorf("error with chart %s: %+v", plotName, err)
-		return err
-	}
-
-	if err := f.AddPicture("Графики", plotCell, plotName, `{"x_scale": 0.565,"y_scale": 0.565}`); err != nil {
-		err = fmt.Errorf("can't add chart %s to excel report: %+v", plotName, err)
-		return err
-	}
-
-	if err := os.Remove(plotName); err != nil {
-		err = fmt.Errorf("can't remove chart %s after importing to excel report: %+v", plotName, err)
-		return err
-	}
-
-	return nil
+	return addScaledChartPicture(f, p, 15*vg.Centimeter, 20*vg.Centimeter, plotName, plotCell, `{"x_scale": 0.565,"y_scale": 0.565}`)
 }
 
 func InitPieChart(plotName string, plotData map[string]int) (*plot.Plot, []byte, struct{ Total, OffsetValue float64 }, string) {
@@ -455,21 +494,7 @@ func PlotAreaChart(f *excel.File, plotName string, plotData map[int]struct{ Onli
 		p.Add(line)
 	}
 
-	if err := p.Save(20*vg.Centimeter, 15*vg.Centimeter, plotName); err != nil {
-		return err
-	}
-
-	if err := f.AddPicture("Графики", "M1", plotName, `{"x_scale": 0.7,"y_scale": 0.7}`); err != nil {
-		err = fmt.Errorf("can't add chart %s to excel report: %+v", plotName, err)
-		return err
-	}
-
-	if err := os.Remove(plotName); err != nil {
-		err = fmt.Errorf("can't remove chart %s after importing to excel report: %+v", plotName, err)
-		return err
-	}
-
-	return nil
+	return addChartPicture(f, p, 20*vg.Centimeter, 15*vg.Centimeter, plotName, "M1")
 }
 
 func InitAreaChart(plotData map[int]struct{ Online, Offline, Total int }) (*plot.Plot, []struct {
@@ -544,6 +569,229 @@ func GetAreaChartLine(colorRGBANum int, series plotter.XYs) (*plotter.Line, erro
 	return line, nil
 }
 
+// DecodeCampaignsReport возвращает отчет по рассылкам, если reportData - рассылки в формате getCampaignsReportInfo
+// (а не строки, подготовленные frontend).
+func DecodeCampaignsReport(reportData []interface{}) ([]CampaignReport, bool) {
+	for _, row := range reportData {
+		if _, ok := row.(map[string]interface{}); !ok {
+			return nil, false
+		}
+	}
+
+	data, err := json.Marshal(reportData)
+	if err != nil {
+		return nil, false
+	}
+
+	var campaigns []CampaignReport
+	if err = json.Unmarshal(data, &campaigns); err != nil {
+		return nil, false
+	}
+
+	return campaigns, true
+}
+
+// WriteExcelCampaignsReport записывает отчет по рассылкам по схеме CampaignsSchema, на листы "Ссылки" и "UTM" -
+// переходы по ссылкам (CampaignLinksSchema) и рассылки, сгруппированные по UTM-меткам (CampaignsUTMSchema), а если
+// задан analytics - еще и динамику по неделям и месяцам, сравнение с предыдущим периодом и графики.
+func WriteExcelCampaignsReport(f *excel.File, campaigns []CampaignReport, analytics *CampaignsAnalytics, debug *ServerDebug) error {
+	debug.SetDebugLastStage("WriteExcelCampaignsReport")
+
+	tables, err := BuildCampaignsReportTables(campaigns, analytics)
+	if err != nil {
+		return err
+	}
+
+	if err = WriteExcelReportTables(f, tables); err != nil {
+		return err
+	}
+
+	if analytics != nil {
+		return PlotCampaignsCharts(f, analytics, debug)
+	}
+
+	return nil
+}
+
+// FormatExcelCampaignsReport настраивает ширину столбцов и форматы ячеек листов отчета по рассылкам. Лист "Отчёт"
+// к этому моменту уже выровнен через AutoResizeColumns.
+func FormatExcelCampaignsReport(f *excel.File, campaigns []CampaignReport, analytics *CampaignsAnalytics, debug *ServerDebug) error {
+	debug.SetDebugLastStage("FormatExcelCampaignsReport")
+
+	tables, err := BuildCampaignsReportTables(campaigns, analytics)
+	if err != nil {
+		return err
+	}
+
+	resized := map[string]bool{"Отчёт": true}
+	for _, table := range tables {
+		if sheet := table.Sheet; sheet != "" && !resized[sheet] {
+			if err = AutoResizeColumns(f, sheet, debug); err != nil {
+				return err
+			}
+			resized[sheet] = true
+		}
+	}
+
+	return FormatExcelReportTables(f, tables)
+}
+
+// WriteExcelReportTables записывает таблицы на их листы (как WriteReport в XLSX, но в обычную модель листа, чтобы
+// потом можно было выровнять столбцы и добавить графики). Таблицы одного листа пишутся друг под другом.
+func WriteExcelReportTables(f *excel.File, tables []ReportTable) error {
+	for _, table := range tables {
+		if sheet := table.Sheet; sheet != "" && f.GetSheetIndex(sheet) == -1 {
+			f.NewSheet(sheet)
+		}
+	}
+
+	return forEachExcelTable(tables, func(sheet string, firstRow int, table ReportTable) error {
+		return table.Schema.WriteRows(f, sheet, firstRow, append([][]interface{}{table.Schema.Headers()}, table.Rows...))
+	})
+}
+
+// FormatExcelReportTables применяет форматы схем к таблицам, записанным WriteExcelReportTables.
+func FormatExcelReportTables(f *excel.File, tables []ReportTable) error {
+	return forEachExcelTable(tables, func(sheet string, firstRow int, table ReportTable) error {
+		return table.Schema.ApplyFormats(f, sheet, firstRow+1, firstRow+len(table.Rows))
+	})
+}
+
+// forEachExcelTable вызывает fn для каждой таблицы с ее листом и номером строки заголовков (с единицы).
+func forEachExcelTable(tables []ReportTable, fn func(sheet string, firstRow int, table ReportTable) error) error {
+	nextRows := make(map[string]int)
+	for _, table := range tables {
+		sheet := table.Sheet
+		if sheet == "" {
+			sheet = "Отчёт"
+		}
+		if nextRows[sheet] == 0 {
+			nextRows[sheet] = 1
+		}
+
+		if err := fn(sheet, nextRows[sheet], table); err != nil {
+			return err
+		}
+		nextRows[sheet] += 1 + len(table.Rows)
+	}
+
+	return nil
+}
+
+// BuildCampaignsReportTables возвращает таблицы отчета по рассылкам: переходы по ссылкам, группировку по UTM-меткам,
+// таблицы analytics (если он задан) и последней - основную таблицу рассылок.
+func BuildCampaignsReportTables(campaigns []CampaignReport, analytics *CampaignsAnalytics) ([]ReportTable, error) {
+	links, err := BuildCampaignLinksTable(campaigns)
+	if err != nil {
+		return nil, err
+	}
+
+	utm, err := BuildCampaignsUTMTable(campaigns)
+	if err != nil {
+		return nil, err
+	}
+
+	tables := []ReportTable{links, utm}
+	if analytics != nil {
+		analyticsTables, err := BuildCampaignsAnalyticsTables(analytics)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, analyticsTables...)
+	}
+
+	main, err := BuildCampaignsReportTable(campaigns)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(tables, main), nil
+}
+
+func BuildCampaignsReportTable(campaigns []CampaignReport) (ReportTable, error) {
+	table := ReportTable{Schema: CampaignsSchema}
+	for _, campaign := range campaigns {
+		row, err := CampaignsSchema.Row(campaign)
+		if err != nil {
+			return ReportTable{}, err
+		}
+		table.Rows = append(table.Rows, row)
+	}
+
+	return table, nil
+}
+
+// BuildCampaignLinksTable возвращает переходы по ссылкам рассылок (рассылки - в порядке campaigns, ссылки рассылки -
+// по убыванию переходов).
+func BuildCampaignLinksTable(campaigns []CampaignReport) (ReportTable, error) {
+	table := ReportTable{Sheet: "Ссылки", Schema: CampaignLinksSchema}
+	for _, campaign := range campaigns {
+		links := make([]CampaignLinkReport, len(campaign.Links))
+		copy(links, campaign.Links)
+		sort.SliceStable(links, func(i, j int) bool { return links[i].Clicks > links[j].Clicks })
+
+		campaignClicks := 0
+		for _, link := range links {
+			campaignClicks += link.Clicks
+		}
+
+		for _, link := range links {
+			row, err := CampaignLinksSchema.Row(CampaignLinkRow{
+				Date:               campaign.Date,
+				Name:               campaign.Name,
+				TagUTM:             campaign.TagUTM,
+				CampaignLinkReport: link,
+				CampaignClicks:     campaignClicks,
+			})
+			if err != nil {
+				return ReportTable{}, err
+			}
+			table.Rows = append(table.Rows, row)
+		}
+	}
+
+	return table, nil
+}
+
+// BuildCampaignsUTMTable группирует рассылки по utm_source, utm_medium и utm_campaign. Группы идут по убыванию
+// уникальных переходов, чтобы первыми были каналы, которые приводят больше всего переходов.
+func BuildCampaignsUTMTable(campaigns []CampaignReport) (ReportTable, error) {
+	type utmKey struct{ source, medium, tag string }
+
+	groups := make(map[utmKey]*CampaignsUTMRow)
+	keys := make([]utmKey, 0)
+	for _, campaign := range campaigns {
+		key := utmKey{campaign.SourceUTM, campaign.MediumUTM, campaign.TagUTM}
+		group, ok := groups[key]
+		if !ok {
+			group = &CampaignsUTMRow{SourceUTM: key.source, MediumUTM: key.medium, TagUTM: key.tag}
+			groups[key] = group
+			keys = append(keys, key)
+		}
+
+		group.Add(campaign)
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool {
+		a, b := groups[keys[i]], groups[keys[j]]
+		if a.UniqueClicked != b.UniqueClicked {
+			return a.UniqueClicked > b.UniqueClicked
+		}
+		return a.Sent > b.Sent
+	})
+
+	table := ReportTable{Sheet: "UTM", Schema: CampaignsUTMSchema}
+	for _, key := range keys {
+		row, err := CampaignsUTMSchema.Row(groups[key])
+		if err != nil {
+			return ReportTable{}, err
+		}
+		table.Rows = append(table.Rows, row)
+	}
+
+	return table, nil
+}
+
 func WriteExcelCampaignsData(f *excel.File, reportData []interface{}, debug *ServerDebug) error {
 	debug.SetDebugLastStage("WriteExcelCampaignsData")
 
@@ -681,13 +929,6 @@ func LogWebSocketError(err error) {
 //	return pswd
 //}
 
-func UnmarshalResponseData(response []byte) DashaMailResponseStruct {
-	var data DashaMailResponse
-	_ = json.Unmarshal(response, &data)
-
-	return data.Response
-}
-
 func DecodeToStruct(i interface{}, data map[string]interface{}, debug *ServerDebug) (interface{}, error) {
 	debug.SetDebugLastStage("DecodeToStruct")
 
@@ -711,143 +952,3 @@ func DecodeToStruct(i interface{}, data map[string]interface{}, debug *ServerDeb
 
 	return result, nil
 }
-
-func (d DashaMailResponseData) CheckForOnlyOneElement(debug *ServerDebug) error {
-	debug.SetDebugLastStage("CheckForOnlyOneElement")
-
-	if len(d) == 0 {
-		return fmt.Errorf("DashaMail answered without an error but with nil data array")
-	}
-
-	if len(d) > 1 {
-		return fmt.Errorf("DashaMail answered with %v elements in data array but only one element is expected (%+v)", len(d), d)
-	}
-
-	return nil
-}
-
-func (m DashaMailResponseMsg) CheckForError(debug *ServerDebug) error {
-	debug.SetDebugLastStage("CheckForError")
-
-	meaning := ""
-	switch m.ErrorCode {
-	case 0:
-		return nil
-	case 1:
-		meaning = "неверный логин и(или) пароль"
-	case 2:
-		meaning = "ошибка при добавлении в базу"
-	case 3:
-		meaning = "заданы не все необходимые параметры"
-	case 4:
-		meaning = "нет данных при выводе"
-	case 5:
-		meaning = "у пользователя нет адресной базы с таким id"
-	case 6:
-		meaning = "некорректный email-адрес"
-	case 7:
-		meaning = "такой пользователь уже есть в этой адресной базе"
-	case 8:
-		meaning = "лимит по количеству активных подписчиков на тарифном плане клиента"
-	case 9:
-		meaning = "нет такого подписчика у клиента"
-	case 10:
-		meaning = "пользователь уже отписан"
-	case 11:
-		meaning = "нет данных для обновления подписчика"
-	case 12:
-		meaning = "не заданы элементы списка"
-	case 13:
-		meaning = "не задано время рассылки"
-	case 14:
-		meaning = "не задан заголовок письма"
-	case 15:
-		meaning = "не задано поле 'От Кого?'"
-	case 16:
-		meaning = "не задан обратный адрес"
-	case 17:
-		meaning = "не задана ни html, ни plain_text версия письма"
-	case 18:
-		meaning = "нет ссылки отписаться (ссылки с id='unsub_link') в тексте рассылки"
-	case 19:
-		meaning = "нет ссылки отписаться ('%ОТПИСАТЬСЯ%') в тексте рассылки"
-	case 20:
-		meaning = "задан недопустимый статус рассылки"
-	case 21:
-		meaning = "рассылка уже отправляется"
-	case 22:
-		meaning = "у вас нет кампании с таким campaign_id"
-	case 23:
-		meaning = "нет такого поля для сортировки"
-	case 24:
-		meaning = "заданы недопустимые события для авторассылки"
-	case 25:
-		meaning = "загружаемый файл уже существует"
-	case 26:
-		meaning = "загружаемый файл больше 5 Мб"
-	case 27:
-		meaning = "файл не найден"
-	case 28:
-		meaning = "указанный шаблон не существует"
-	case 29:
-		meaning = "определен одноразовый email-адрес"
-	case 30:
-		meaning = "отправка рассылок заблокирована по подозрению в спаме"
-	case 31:
-		meaning = "массив email-адресов пуст"
-	case 32:
-		meaning = "нет корректных адресов для добавления"
-	case 33:
-		meaning = "недопустимый формат файла"
-	case 34:
-		meaning = "необходимо настроить собственный домен отправки"
-	case 35:
-		meaning = "данный функционал недоступен на бесплатных тарифах и во время триального периода"
-	case 36:
-		meaning = "ошибка при отправке письма"
-	case 37:
-		meaning = "рассылка еще не прошла модерацию"
-	case 38:
-		meaning = "недопустимый сегмент"
-	case 39:
-		meaning = "нет папки с таким id"
-	case 40:
-		meaning = "рассылка не находится в статусе 'PROCESSING' или 'SENT'"
-	case 41:
-		meaning = "рассылка не отправляется в данный момент"
-	case 42:
-		meaning = "у вас нет рассылки на паузе с таким campaign_id"
-	case 43:
-		meaning = "пользователь в черном списке (двойная отписка)"
-	case 44:
-		meaning = "пользователь в черном списке (нажатие 'ЭТО СПАМ')"
-	case 45:
-		meaning = "пользователь в черном списке (ручное)"
-	case 46:
-		meaning = "несуществующий email-адрес (находится в глобальном списке возвратов)"
-	case 47:
-		meaning = "ваш IP-адрес не включен в список разрешенных"
-	case 48:
-		meaning = "не удалось отправить письмо подтверждения для обратного адреса"
-	case 49:
-		meaning = "такой адрес уже подтвержден"
-	case 50:
-		meaning = "нельзя использовать одноразовые email в обратном адресе"
-	case 51:
-		meaning = "использование обратного адреса на публичных доменах Mail.ru СТРОГО ЗАПРЕЩЕНО политикой DMARC данного почтового провайдера"
-	case 52:
-		meaning = "email-адрес не подтвержден в качестве отправителя"
-	case 53:
-		meaning = "недопустимое событие для webhook"
-	case 54:
-		meaning = "некорректный домен, т.к. кириллические и другие национальные домены в качестве DKIM/SPF запрещены"
-	case 55:
-		meaning = "данный домен находится в черном списке, его добавление запрещено"
-	case 56:
-		meaning = "данный домен занят другим аккаунтом"
-	default:
-		return fmt.Errorf("DashaMail unknown error: %+v", m)
-	}
-
-	return fmt.Errorf("DashaMail error with code %v: %s {meaning %s}", m.ErrorCode, m.Text, meaning)
-}
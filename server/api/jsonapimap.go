@@ -5,6 +5,10 @@ import (
 	"time"
 
 	"github.com/gorilla/websocket"
+	"zo-backend/auth"
+	"zo-backend/certificates"
+	"zo-backend/jobs"
+	"zo-backend/points"
 )
 
 const (
@@ -29,24 +33,6 @@ type ServerDebug struct {
 	LastSentData     []byte
 }
 
-type ServerWebinar struct {
-	DeletionDate    time.Time // храним 7 дней
-	PersonalPhrases string
-	Users           ServerUsers
-}
-
-type ServerUsers struct {
-	Info              []ServerUser
-	PreviousQueryTime *time.Time
-}
-
-type ServerUser struct {
-	Email    string
-	Name     string
-	Key      string
-	WayToAdd string
-}
-
 type ErrChan struct {
 	Chan        chan error
 	OpenedState bool
@@ -70,78 +56,6 @@ type SyncMap struct {
 	Locker sync.RWMutex
 }
 
-type DashaMailColumnTitle struct {
-	Title string `json:"title"`
-}
-
-type DashaMailRequest struct {
-	Method     string `json:"method"`
-	APIKey     string `json:"api_key"`
-	Email      string `json:"email,omitempty"`
-	BookID     string `json:"list_id,omitempty"`
-	NoCheck    string `json:"no_check,omitempty"`
-	Update     string `json:"update,omitempty"`
-	CampaignID int    `json:"campaign_id,omitempty"`
-	Status     string `json:"status"`
-	StartDate  string `json:"start,omitempty"`
-	EndDate    string `json:"end,omitempty"`
-	Limit      int64  `json:"limit"`
-	JSONFormat int64  `json:"merge_json,omitempty"`
-
-	Field1  interface{} `json:"merge_1,omitempty"`
-	Field2  interface{} `json:"merge_2,omitempty"`
-	Field3  interface{} `json:"merge_3,omitempty"`
-	Field4  interface{} `json:"merge_4,omitempty"`
-	Field5  interface{} `json:"merge_5,omitempty"`
-	Field6  interface{} `json:"merge_6,omitempty"`
-	Field7  interface{} `json:"merge_7,omitempty"`
-	Field8  interface{} `json:"merge_8,omitempty"`
-	Field9  interface{} `json:"merge_9,omitempty"`
-	Field10 interface{} `json:"merge_10,omitempty"`
-	Field11 interface{} `json:"merge_11,omitempty"`
-	Field12 interface{} `json:"merge_12,omitempty"`
-	Field13 interface{} `json:"merge_13,omitempty"`
-	Field14 interface{} `json:"merge_14,omitempty"`
-	Field15 interface{} `json:"merge_15,omitempty"`
-	Field16 interface{} `json:"merge_16,omitempty"`
-	Field17 interface{} `json:"merge_17,omitempty"`
-	Field18 interface{} `json:"merge_18,omitempty"`
-	Field19 interface{} `json:"merge_19,omitempty"`
-	Field20 interface{} `json:"merge_20,omitempty"`
-	Field21 interface{} `json:"merge_21,omitempty"`
-	Field22 interface{} `json:"merge_22,omitempty"`
-	Field23 interface{} `json:"merge_23,omitempty"`
-	Field24 interface{} `json:"merge_24,omitempty"`
-	Field25 interface{} `json:"merge_25,omitempty"`
-	Field26 interface{} `json:"merge_26,omitempty"`
-	Field27 interface{} `json:"merge_27,omitempty"`
-	Field28 interface{} `json:"merge_28,omitempty"`
-	Field29 interface{} `json:"merge_29,omitempty"`
-	Field30 interface{} `json:"merge_30,omitempty"`
-	Field31 interface{} `json:"merge_31,omitempty"`
-	Field32 interface{} `json:"merge_32,omitempty"`
-	Field33 interface{} `json:"merge_33,omitempty"`
-	Field34 interface{} `json:"merge_34,omitempty"`
-	Field35 interface{} `json:"merge_35,omitempty"`
-}
-
-type DashaMailResponse struct {
-	Response DashaMailResponseStruct `json:"response"`
-}
-
-type DashaMailResponseStruct struct {
-	Msg  DashaMailResponseMsg  `json:"msg"`
-	Data DashaMailResponseData `json:"data"`
-}
-
-type DashaMailResponseData []map[string]interface{}
-
-type DashaMailResponseMsg struct {
-	ErrorCode int64  `json:"err_code"`
-	Text      string `json:"text"`
-	Type      string `json:"type"`
-}
-
 type DashaMailUpdateInfo struct {
 	WindowsShowed    interface{} `mapstructure:"окон_показано,omitempty"`
 	WindowsConfirmed interface{} `mapstructure:"окон_подтверждено,omitempty"`
@@ -177,13 +91,23 @@ type DashaMailUpdateInfo struct {
 	Link interface{} `mapstructure:"link,omitempty"`
 }
 
-type YaDiskLoadedFileInfo struct {
-	Link  string `json:"link,omitempty"`
-	Error error  `json:"error,omitempty"`
+// LoadedCertificateInfo - сертификат, загруженный в хранилище.
+type LoadedCertificateInfo struct {
+	Link   string `json:"link"`
+	Serial string `json:"serial,omitempty"`
+}
+
+// UnloadedCertificateInfo - сертификат, созданный локально, но не загруженный в хранилище. Файл такого сертификата не
+// сохраняется (его номера нет в реестре, поэтому загруженный вручную сертификат не прошел бы проверку): чтобы выдать
+// сертификат, его нужно создать заново.
+type UnloadedCertificateInfo struct {
+	Serial string `json:"serial,omitempty"` // номер, напечатанный на сертификате (в реестр не записан, т.к. сертификат не доставлен)
+	Error  string `json:"error"`
 }
 
-type FacecastErrorResponse struct {
-	Error string `json:"error"`
+type LoadedFileInfo struct {
+	Link  string `json:"link,omitempty"`
+	Error error  `json:"error,omitempty"`
 }
 
 type FacecastLoginServerResponse struct {
@@ -191,6 +115,32 @@ type FacecastLoginServerResponse struct {
 	PersonalPhrases string `json:"personalPhrases,omitempty"`
 }
 
+// IssuedAPIClientServerResponse - новый клиент API. Token возвращается только при выдаче и больше нигде не хранится.
+type IssuedAPIClientServerResponse struct {
+	auth.Client
+	Token string `json:"token"`
+}
+
+// CertificateTemplatesServerResponse - загруженные шаблоны сертификатов и назначения активных шаблонов.
+type CertificateTemplatesServerResponse struct {
+	Templates   []certificates.Template   `json:"templates"`
+	Assignments []certificates.Assignment `json:"assignments"`
+}
+
+// PreviewPointsServerResponse - баллы ЗО, которые зритель получит за мероприятие по действующим правилам.
+type PreviewPointsServerResponse struct {
+	VideoName string `json:"videoName"`
+	Duration  int    `json:"duration"`
+	points.Award
+}
+
+// PointsLedgerServerResponse - состояние реестра баллов после синхронизации.
+type PointsLedgerServerResponse struct {
+	SyncedAt string `json:"syncedAt"`
+	Books    int    `json:"books"` // прочитано книг DashaMail
+	Users    int    `json:"users"` // пользователей с баллами
+}
+
 type UserInfo struct {
 	Message              string `json:"message"`
 	Name                 string `json:"fio,omitempty"`
@@ -218,36 +168,8 @@ type UserInfo struct {
 	Own                  string `json:"own,omitempty"`
 	ViewRegime           string `json:"viewRegime,omitempty"`
 	PointsZOView         int    `json:"pointsZOView"`
-}
-
-type FacecastTicketResponse struct {
-	Name     string `json:"fio"`
-	Email    string `json:"email"`
-	TicketID int64  `json:"id"`
-}
-
-type FacecastKeyResponse struct {
-	TicketID int64  `json:"ticket_id"`
-	Key      string `json:"password"`
-}
-
-type FacecastMinutesResponse struct {
-	Key     string           `json:"password"`
-	Minutes []FacecastMinute `json:"histogram"`
-}
-
-type FacecastMinute struct {
-	Position int           `json:"position"`
-	Views    []interface{} `json:"views"`
-}
 
-type FacecastWindowsResponse struct {
-	Confirmed int    `json:"confirmed"`
-	Key       string `json:"password"`
-}
-
-type FacecastInsertKeyResponse struct {
-	Success bool `json:"success"`
+	HallMinutes map[string][]int `json:"hallMinutes,omitempty"` // сводный отчет по залам: минуты конференции по eventID залов
 }
 
 type GetUserPointsServerResponse struct {
@@ -268,10 +190,54 @@ type UserPointsInfo struct {
 	PointsZOPoll     string `json:"points_zo_poll,omitempty"`
 }
 
+// GetUserPointsHistoryServerResponse - баллы НМО и ЗО пользователя за период с разбивкой по периодам и типам мероприятий.
+type GetUserPointsHistoryServerResponse struct {
+	StartDate     string                  `json:"startDate,omitempty"`
+	EndDate       string                  `json:"endDate,omitempty"`
+	GroupBy       string                  `json:"groupBy"`
+	Total         PointsTotals            `json:"total"`
+	Periods       []PointsPeriodTotals    `json:"periods"`
+	EventTypes    []PointsEventTypeTotals `json:"eventTypes"`
+	Events        []PointsHistoryEvent    `json:"events"`
+	UndatedEvents int                     `json:"undatedEvents,omitempty"` // мероприятия с нераспознанной датой (в периоды не попадают)
+}
+
+type PointsTotals struct {
+	ZET        int `json:"zet"`       // ЗЕТ за мероприятия с кодом НМО
+	NMOEvents  int `json:"nmoEvents"` // мероприятия с кодом НМО
+	ZO         int `json:"zo"`        // все баллы ЗО
+	ZOView     int `json:"zoView"`
+	ZOQuestion int `json:"zoQuestion"`
+	ZOPoll     int `json:"zoPoll"`
+}
+
+type PointsPeriodTotals struct {
+	Period    string `json:"period"` // "2024", "2024-Q1" или "2024-03"
+	StartDate string `json:"startDate"`
+	EndDate   string `json:"endDate"`
+	PointsTotals
+}
+
+type PointsEventTypeTotals struct {
+	EventType string `json:"eventType"`
+	PointsTotals
+}
+
+type PointsHistoryEvent struct {
+	EventDate   string `json:"eventDate"` // в формате '2006-01-02'
+	EventName   string `json:"eventName,omitempty"`
+	EventType   string `json:"eventType"`
+	NMO         string `json:"nmo,omitempty"`
+	Certificate string `json:"certificate,omitempty"`
+	PointsTotals
+}
+
 type GetCertificatesInfoServerResponse struct {
 	EventName string                             `json:"eventName,omitempty"`
 	EventDate string                             `json:"eventDate,omitempty"`
 	UsersInfo map[string]CertificatePersonalInfo `json:"usersInfo,omitempty"`
+
+	Eligibility map[string]points.Eligibility `json:"eligibility,omitempty"` // проверка посещения зрителей с кодом НМО по email (если указаны трансляции)
 }
 
 type CertificatePersonalInfo struct {
@@ -281,6 +247,41 @@ type CertificatePersonalInfo struct {
 	AcademicHours string `json:"academicHours,omitempty"`
 }
 
+// PreviewCertificateServerResponse - пробный сертификат, который не загружается в хранилище и не записывается в реестр.
+type PreviewCertificateServerResponse struct {
+	Email    string `json:"email,omitempty"` // пусто, если сертификат создан по данным образца
+	Category string `json:"category"`
+	Serial   string `json:"serial"` // номер-заглушка, напечатанный на сертификате
+	PDF      string `json:"pdf"`    // base64
+	PNG      string `json:"png"`    // base64
+}
+
+// CertificatesRevisionServerResponse - результат отзыва или перевыпуска сертификатов по email пользователей.
+type CertificatesRevisionServerResponse struct {
+	Users map[string]CertificateRevision `json:"users"`
+}
+
+type CertificateRevision struct {
+	RevokedSerials []string `json:"revokedSerials,omitempty"`
+	Serial         string   `json:"serial,omitempty"` // серийный номер нового сертификата (только при перевыпуске)
+	Link           string   `json:"link,omitempty"`   // ссылка на новый сертификат, записанная в книгу ДМ
+	Error          string   `json:"error,omitempty"`
+}
+
+// VerifyCertificateServerResponse - данные сертификата для публичной проверки (без email и кода НМО владельца).
+type VerifyCertificateServerResponse struct {
+	Serial    string `json:"serial"`
+	UserName  string `json:"userName"`
+	EventName string `json:"eventName"`
+	EventDate string `json:"eventDate"`
+	IssuedAt  string `json:"issuedAt"`
+	Status    string `json:"status"`
+	Valid     bool   `json:"valid"`
+
+	RevokedAt  string `json:"revokedAt,omitempty"`
+	ReplacedBy string `json:"replacedBy,omitempty"` // серийный номер сертификата, выданного взамен отозванного
+}
+
 type GetUserServerResponse struct {
 	Message             string `json:"message"`
 	Status              int    `json:"status,omitempty"`
@@ -314,6 +315,58 @@ type GetReportServerResponse struct {
 	ReportName string                    `json:"reportName"`
 	EventInfo  FacecastEventInfoResponse `json:"eventInfo,omitempty"`
 	UsersInfo  map[string]UserInfo       `json:"usersInfo,omitempty"`
+	Halls      []ConferenceHallInfo      `json:"halls,omitempty"` // только в сводном отчете по залам конференции
+}
+
+// ConferenceHallInfo - зал конференции (отдельная трансляция ФК) в сводном отчете. Минуты сводного отчета отсчитываются
+// от начала самой ранней трансляции, FirstMinute - минута конференции, на которую пришлась первая минута зала.
+type ConferenceHallInfo struct {
+	EventID       string `json:"eventID"`
+	VideoName     string `json:"name,omitempty"`
+	StartDate     string `json:"date_real_start,omitempty"`
+	FirstMinute   int    `json:"firstMinute"`
+	Duration      int    `json:"duration"`
+	Viewers       int    `json:"viewers"`
+	MinutesViewed int    `json:"minutesViewed"` // минуты зрителей, засчитанные залу
+}
+
+// GetSeriesReportServerResponse - отчет по серии вебинаров (например, по занятиям "Интерактивной школы"). Занятия идут
+// по плановой дате начала, зрители - по убыванию числа посещенных занятий.
+type GetSeriesReportServerResponse struct {
+	ReportName string              `json:"reportName"`
+	Sessions   []SeriesSessionInfo `json:"sessions"`
+	Users      []SeriesUserInfo    `json:"users,omitempty"`
+}
+
+// SeriesSessionInfo - итоги одного занятия серии. Зритель занятия - пользователь, который смотрел его онлайн или в записи.
+type SeriesSessionInfo struct {
+	EventID         string  `json:"eventID"`
+	VideoName       string  `json:"name,omitempty"`
+	PlanStartDate   string  `json:"date_plan_start,omitempty"`
+	Duration        int     `json:"duration"`
+	Viewers         int     `json:"viewers"`
+	ViewersOnline   int     `json:"viewersOnline"`   // смотрели хотя бы минуту онлайн
+	ViewersOffline  int     `json:"viewersOffline"`  // смотрели только в записи
+	NewViewers      int     `json:"newViewers"`      // впервые смотрели занятие серии
+	RetainedViewers int     `json:"retainedViewers"` // смотрели и предыдущее занятие
+	Retention       float64 `json:"retention"`       // доля зрителей предыдущего занятия, которые смотрели и это
+	PointsZOView    int     `json:"pointsZOView"`
+}
+
+// SeriesUserInfo - посещаемость серии одним зрителем. MinutesBySession - минуты просмотра (онлайн и в записи) каждого
+// занятия в порядке Sessions, номера занятий - с единицы.
+type SeriesUserInfo struct {
+	Email                string `json:"email"`
+	Name                 string `json:"fio,omitempty"`
+	Specialization       string `json:"specialization,omitempty"`
+	Region               string `json:"region,omitempty"`
+	Sessions             int    `json:"sessions"`
+	FirstSession         int    `json:"firstSession"`
+	LastSession          int    `json:"lastSession"`
+	MinutesViewedOnline  int    `json:"minutesViewedOnline"`
+	MinutesViewedOffline int    `json:"minutesViewedOffline"`
+	PointsZOView         int    `json:"pointsZOView"`
+	MinutesBySession     []int  `json:"minutesBySession"`
 }
 
 type CampaignReport struct {
@@ -343,36 +396,15 @@ type CampaignReport struct {
 	MailSystemBlocked int    `json:"mailSystemBlocked,omitempty"`
 	Hard              int    `json:"hard,omitempty"`
 	Soft              int    `json:"soft,omitempty"`
+
+	Links []CampaignLinkReport `json:"links,omitempty"`
 }
 
-type DashaMailCampaignReport struct {
-	Date string `mapstructure:"delivery_time"`
-	Name string `mapstructure:"name"`
-	ID   string `mapstructure:"id"`
-
-	TagUTM     string `mapstructure:"analytics_tag"`
-	SourceUTM  string `mapstructure:"analytics_source"`
-	MediumUTM  string `mapstructure:"analytics_medium"`
-	ContentUTM string `mapstructure:"analytics_content"`
-	TermUTM    string `mapstructure:"analytics_term"`
-
-	Sent              string `json:"sent"`
-	Clicked           string `json:"clicked"`
-	Opened            string `json:"opened"`
-	FirstSent         string `json:"first_sent"`
-	FirstOpen         string `json:"first_open"`
-	LastOpen          string `json:"last_open"`
-	FirstClick        string `json:"first_click"`
-	LastClick         string `json:"last_click"`
-	UniqueOpened      string `json:"unique_opened"`
-	UniqueClicked     string `json:"unique_clicked"`
-	Unsubscribed      string `json:"unsubscribed"`
-	SpamComplained    string `json:"complained"`
-	SpamBlocked       string `json:"spam_blocked"`
-	SpamMarked        string `json:"spam"`
-	MailSystemBlocked string `json:"blk"`
-	Hard              string `json:"hard"`
-	Soft              string `json:"soft"`
+// CampaignLinkReport - переходы по одной ссылке рассылки.
+type CampaignLinkReport struct {
+	Link         string `json:"link"`
+	Clicks       int    `json:"clicks"`
+	UniqueClicks int    `json:"uniqueClicks"`
 }
 
 type FacecastEventInfoResponse struct {
@@ -411,6 +443,12 @@ type WebSocketMessageRequest struct {
 type WebSocketWaiterResponse struct {
 	Status  string `json:"status"`
 	Message string `json:"message"`
+
+	// OnMessage получает новые сообщения о ходе выполнения. Методы пишут их из нескольких горутин, а читает их тикер
+	// WebSocket или задача, поэтому сообщения хранятся в jobs.Progress под блокировкой, а поле Message заполняется только
+	// в копии ответа, которую отправляет тикер.
+	OnMessage func(message string) `json:"-"`
+	Cancelled func() bool          `json:"-"` // если задан, сообщает, что фоновую задачу отменили (долгие методы проверяют его между группами операций)
 }
 
 type WebSocketWaiter struct {
@@ -418,4 +456,5 @@ type WebSocketWaiter struct {
 	Done     chan struct{}
 	Ticker   *time.Ticker
 	Response *WebSocketWaiterResponse
+	Progress *jobs.Progress // сообщения, которые методы передают через Response.OnMessage
 }
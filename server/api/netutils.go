@@ -7,7 +7,6 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
-	"strings"
 
 	"github.com/gorilla/websocket"
 )
@@ -19,7 +18,7 @@ func SendServerResponse(w interface{}, response interface{}, debug *ServerDebug)
 
 	if fmt.Sprintf("%T", w) == "*middleware.compressResponseWriter" {
 		if debug != nil && debug.Error != nil {
-			response := ErrorMessageServerResponse{Message: getErrorMessage(debug)}
+			response := ErrorMessageServerResponse{Message: GetErrorMessage(debug)}
 			JsonResponse(w.(http.ResponseWriter), response, http.StatusBadRequest)
 		} else {
 			JsonResponse(w.(http.ResponseWriter), response, http.StatusOK)
@@ -28,7 +27,7 @@ func SendServerResponse(w interface{}, response interface{}, debug *ServerDebug)
 
 	if fmt.Sprintf("%T", w) == "*websocket.Conn" {
 		if debug != nil && debug.Error != nil {
-			response := ErrorMessageServerResponse{Message: getErrorMessage(debug)}
+			response := ErrorMessageServerResponse{Message: GetErrorMessage(debug)}
 			err := w.(*websocket.Conn).WriteJSON(response) // send new message to the WebSocket channel
 			LogWebSocketError(err)
 		} else {
@@ -126,10 +125,6 @@ func DoRequestPOST(uri string, jsonBytes []byte, debug *ServerDebug) ([]byte, er
 	}
 
 	request.Header.Set("Content-Type", "application/json")
-	// выглядит, как костыль; на досуге подумать об изменениях
-	if strings.Contains(uri, "facecast") {
-		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	}
 
 	response, err = httpRequest(request, debug)
 	if err != nil {
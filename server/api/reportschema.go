@@ -0,0 +1,505 @@
+package api
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	excel "github.com/xuri/excelize/v2"
+)
+
+// ColumnType - тип значений столбца отчета, от которого зависят преобразование значения и формат ячейки.
+type ColumnType string
+
+const (
+	TEXT_COLUMN    ColumnType = "text"
+	INTEGER_COLUMN ColumnType = "integer"
+	NUMBER_COLUMN  ColumnType = "number"
+	MINUTES_COLUMN ColumnType = "minutes" // список минут ([]int), записывается строкой "1, 2, 3"
+)
+
+// ReportColumn - описание столбца отчета. Field - название поля (или метода без аргументов) структуры-источника строки.
+type ReportColumn struct {
+	Key          string
+	Header       string
+	Type         ColumnType
+	Width        float64 // 0 - ширина по содержимому (AutoResizeColumns)
+	NumberFormat string  // формат excel для числовых столбцов, например "0.00%"
+	Field        string
+}
+
+// ReportSchema - упорядоченный набор столбцов отчета. Порядок столбцов в схеме - порядок столбцов в файле,
+// поэтому столбцы добавляются, переименовываются и переставляются только здесь.
+type ReportSchema struct {
+	Columns []ReportColumn
+}
+
+// Ключи столбцов, по которым собираются данные для графиков отчета по вебинару
+const (
+	WEBINAR_COLUMN_DURATION        = "duration"
+	WEBINAR_COLUMN_MINUTES_ONLINE  = "minutesOnline"
+	WEBINAR_COLUMN_MINUTES_OFFLINE = "minutesOffline"
+	WEBINAR_COLUMN_SPECIALIZATION  = "specialization"
+	WEBINAR_COLUMN_VIEW_REGIME     = "viewRegime"
+)
+
+/*/
+ * Схемы отчета по вебинару: первая строка листа - заголовок мероприятия, вторая - данные мероприятия, третья - заголовок
+ * зрителей, дальше - зрители. Отчеты, строки которых готовит frontend (reportData), используют те же позиции столбцов
+ * продолжительности, минут, специальности и режима просмотра, поэтому при перестановке этих столбцов нужно обновить и frontend.
+/*/
+
+// WebinarEventSchema - строка мероприятия, источник - WebinarEventRow.
+var WebinarEventSchema = ReportSchema{Columns: []ReportColumn{
+	{Key: "eventID", Header: "Код трансляции", Type: TEXT_COLUMN, Field: "EventID"},
+	{Key: "name", Header: "Название", Type: TEXT_COLUMN, Field: "VideoName"},
+	{Key: "description", Header: "Описание", Type: TEXT_COLUMN, Field: "Description"},
+	{Key: "planStartDate", Header: "Запланированное начало", Type: TEXT_COLUMN, Field: "PlanStartDate"},
+	{Key: "startDate", Header: "Начало", Type: TEXT_COLUMN, Field: "StartDate"},
+	{Key: "endDate", Header: "Окончание", Type: TEXT_COLUMN, Field: "EndDate"},
+	{Key: WEBINAR_COLUMN_DURATION, Header: "Продолжительность, мин", Type: INTEGER_COLUMN, Field: "Duration"},
+	{Key: "viewersMax", Header: "Макс. зрителей одновременно", Type: INTEGER_COLUMN, Field: "ViewersMax"},
+	{Key: "timeViewersMax", Header: "Время макс. зрителей", Type: TEXT_COLUMN, Field: "TimeViewersMax"},
+	{Key: "viewersTotal", Header: "Всего зрителей", Type: INTEGER_COLUMN, Field: "ViewersTotal"},
+	{Key: "reportTime", Header: "Время построения отчета", Type: TEXT_COLUMN, Field: "ReportTime"},
+}}
+
+// WebinarEventRow - источник строки WebinarEventSchema.
+type WebinarEventRow struct {
+	EventID string
+	FacecastEventInfoResponse
+}
+
+// WebinarUsersSchema - строки зрителей, источник - UserInfo.
+var WebinarUsersSchema = ReportSchema{Columns: []ReportColumn{
+	{Key: "name", Header: "ФИО", Type: TEXT_COLUMN, Field: "Name"},
+	{Key: "email", Header: "Email", Type: TEXT_COLUMN, Field: "Email"},
+	{Key: "key", Header: "Ключ", Type: TEXT_COLUMN, Field: "Key"},
+	{Key: "citizenship", Header: "Гражданство", Type: TEXT_COLUMN, Field: "Citizenship"},
+	{Key: "district", Header: "Федеральный округ", Type: TEXT_COLUMN, Field: "District"},
+	{Key: "region", Header: "Регион", Type: TEXT_COLUMN, Field: "Region"},
+	{Key: "city", Header: "Город", Type: TEXT_COLUMN, Field: "City"},
+	{Key: "minutesViewedOnline", Header: "Минут онлайн", Type: INTEGER_COLUMN, Field: "MinutesViewedOnline"},
+	{Key: "firstMinuteOnline", Header: "Первая минута онлайн", Type: INTEGER_COLUMN, Field: "FirstMinuteOnline"},
+	{Key: "lastMinuteOnline", Header: "Последняя минута онлайн", Type: INTEGER_COLUMN, Field: "LastMinuteOnline"},
+	{Key: WEBINAR_COLUMN_MINUTES_ONLINE, Header: "Минуты онлайн", Type: MINUTES_COLUMN, Width: 40, Field: "MinutesOnline"},
+	{Key: "minutesViewedOffline", Header: "Минут в записи", Type: INTEGER_COLUMN, Field: "MinutesViewedOffline"},
+	{Key: "firstMinuteOffline", Header: "Первая минута в записи", Type: INTEGER_COLUMN, Field: "FirstMinuteOffline"},
+	{Key: "lastMinuteOffline", Header: "Последняя минута в записи", Type: INTEGER_COLUMN, Field: "LastMinuteOffline"},
+	{Key: WEBINAR_COLUMN_MINUTES_OFFLINE, Header: "Минуты в записи", Type: MINUTES_COLUMN, Width: 40, Field: "MinutesOffline"},
+	{Key: "confirmedWindows", Header: "Подтверждено окон", Type: INTEGER_COLUMN, Field: "Windows"},
+	{Key: "allWindows", Header: "Всего окон", Type: INTEGER_COLUMN, Field: "AllWindows"},
+	{Key: "position", Header: "Должность", Type: TEXT_COLUMN, Field: "Position"},
+	{Key: "own", Header: "Место работы", Type: TEXT_COLUMN, Field: "Own"},
+	{Key: WEBINAR_COLUMN_SPECIALIZATION, Header: "Специальность", Type: TEXT_COLUMN, Field: "Specialization"},
+	{Key: "specializationExtra", Header: "Доп. специальность", Type: TEXT_COLUMN, Field: "SpecializationExtra"},
+	{Key: WEBINAR_COLUMN_VIEW_REGIME, Header: "Режим просмотра", Type: TEXT_COLUMN, Field: "ViewRegime"},
+	{Key: "pointsZOView", Header: "Баллы ЗО за просмотр", Type: INTEGER_COLUMN, Field: "PointsZOView"},
+	{Key: "wayToAdd", Header: "Способ добавления", Type: TEXT_COLUMN, Field: "WayToAdd"},
+	{Key: "message", Header: "Ошибка", Type: TEXT_COLUMN, Field: "Message"},
+}}
+
+// CampaignsSchema - отчет по рассылкам, источник - CampaignReport.
+var CampaignsSchema = ReportSchema{Columns: []ReportColumn{
+	{Key: "date", Header: "Дата", Type: TEXT_COLUMN, Field: "Date"},
+	{Key: "name", Header: "Название", Type: TEXT_COLUMN, Width: 60, Field: "Name"},
+	{Key: "tagUTM", Header: "utm_campaign", Type: TEXT_COLUMN, Field: "TagUTM"},
+	{Key: "sourceUTM", Header: "utm_source", Type: TEXT_COLUMN, Field: "SourceUTM"},
+	{Key: "mediumUTM", Header: "utm_medium", Type: TEXT_COLUMN, Field: "MediumUTM"},
+	{Key: "contentUTM", Header: "utm_content", Type: TEXT_COLUMN, Field: "ContentUTM"},
+	{Key: "termUTM", Header: "utm_term", Type: TEXT_COLUMN, Field: "TermUTM"},
+	{Key: "sent", Header: "Отправлено", Type: INTEGER_COLUMN, Field: "Sent"},
+	{Key: "opened", Header: "Открыто", Type: INTEGER_COLUMN, Field: "Opened"},
+	{Key: "uniqueOpened", Header: "Уникальных открытий", Type: INTEGER_COLUMN, Field: "UniqueOpened"},
+	{Key: "openRate", Header: "Открываемость", Type: NUMBER_COLUMN, NumberFormat: "0.00%", Field: "OpenRate"},
+	{Key: "clicked", Header: "Переходов", Type: INTEGER_COLUMN, Field: "Clicked"},
+	{Key: "uniqueClicked", Header: "Уникальных переходов", Type: INTEGER_COLUMN, Field: "UniqueClicked"},
+	{Key: "clickRate", Header: "Кликабельность", Type: NUMBER_COLUMN, NumberFormat: "0.00%", Field: "ClickRate"},
+	{Key: "firstSent", Header: "Первая отправка", Type: TEXT_COLUMN, Field: "FirstSent"},
+	{Key: "firstOpen", Header: "Первое открытие", Type: TEXT_COLUMN, Field: "FirstOpen"},
+	{Key: "lastOpen", Header: "Последнее открытие", Type: TEXT_COLUMN, Field: "LastOpen"},
+	{Key: "firstClick", Header: "Первый переход", Type: TEXT_COLUMN, Field: "FirstClick"},
+	{Key: "lastClick", Header: "Последний переход", Type: TEXT_COLUMN, Field: "LastClick"},
+	{Key: "unsubscribed", Header: "Отписалось", Type: INTEGER_COLUMN, Field: "Unsubscribed"},
+	{Key: "spamComplained", Header: "Жалоб на спам", Type: INTEGER_COLUMN, Field: "SpamComplained"},
+	{Key: "spamBlocked", Header: "Заблокировано как спам", Type: INTEGER_COLUMN, Field: "SpamBlocked"},
+	{Key: "spamMarked", Header: "Помечено как спам", Type: INTEGER_COLUMN, Field: "SpamMarked"},
+	{Key: "mailSystemBlocked", Header: "Заблокировано почтовой системой", Type: INTEGER_COLUMN, Field: "MailSystemBlocked"},
+	{Key: "hard", Header: "Hard bounce", Type: INTEGER_COLUMN, Field: "Hard"},
+	{Key: "soft", Header: "Soft bounce", Type: INTEGER_COLUMN, Field: "Soft"},
+}}
+
+// CampaignLinksSchema - переходы по ссылкам рассылок (лист "Ссылки"), источник - CampaignLinkRow.
+var CampaignLinksSchema = ReportSchema{Columns: []ReportColumn{
+	{Key: "date", Header: "Дата", Type: TEXT_COLUMN, Field: "Date"},
+	{Key: "name", Header: "Рассылка", Type: TEXT_COLUMN, Width: 60, Field: "Name"},
+	{Key: "tagUTM", Header: "utm_campaign", Type: TEXT_COLUMN, Field: "TagUTM"},
+	{Key: "link", Header: "Ссылка", Type: TEXT_COLUMN, Width: 80, Field: "Link"},
+	{Key: "clicks", Header: "Переходов", Type: INTEGER_COLUMN, Field: "Clicks"},
+	{Key: "uniqueClicks", Header: "Уникальных переходов", Type: INTEGER_COLUMN, Field: "UniqueClicks"},
+	{Key: "clickShare", Header: "Доля переходов рассылки", Type: NUMBER_COLUMN, NumberFormat: "0.00%", Field: "ClickShare"},
+}}
+
+// CampaignLinkRow - источник строки CampaignLinksSchema.
+type CampaignLinkRow struct {
+	Date   string
+	Name   string
+	TagUTM string
+	CampaignLinkReport
+	CampaignClicks int // все переходы рассылки
+}
+
+// ClickShare - доля ссылки в переходах рассылки.
+func (r CampaignLinkRow) ClickShare() float64 {
+	if r.CampaignClicks == 0 {
+		return 0
+	}
+
+	return float64(r.Clicks) / float64(r.CampaignClicks)
+}
+
+// CampaignsUTMSchema - рассылки, сгруппированные по UTM-меткам (лист "UTM"), источник - CampaignsUTMRow.
+var CampaignsUTMSchema = ReportSchema{Columns: []ReportColumn{
+	{Key: "sourceUTM", Header: "utm_source", Type: TEXT_COLUMN, Field: "SourceUTM"},
+	{Key: "mediumUTM", Header: "utm_medium", Type: TEXT_COLUMN, Field: "MediumUTM"},
+	{Key: "tagUTM", Header: "utm_campaign", Type: TEXT_COLUMN, Field: "TagUTM"},
+	{Key: "campaigns", Header: "Рассылок", Type: INTEGER_COLUMN, Field: "Campaigns"},
+	{Key: "sent", Header: "Отправлено", Type: INTEGER_COLUMN, Field: "Sent"},
+	{Key: "opened", Header: "Открыто", Type: INTEGER_COLUMN, Field: "Opened"},
+	{Key: "uniqueOpened", Header: "Уникальных открытий", Type: INTEGER_COLUMN, Field: "UniqueOpened"},
+	{Key: "openRate", Header: "Открываемость", Type: NUMBER_COLUMN, NumberFormat: "0.00%", Field: "OpenRate"},
+	{Key: "clicked", Header: "Переходов", Type: INTEGER_COLUMN, Field: "Clicked"},
+	{Key: "uniqueClicked", Header: "Уникальных переходов", Type: INTEGER_COLUMN, Field: "UniqueClicked"},
+	{Key: "clickRate", Header: "Кликабельность", Type: NUMBER_COLUMN, NumberFormat: "0.00%", Field: "ClickRate"},
+	{Key: "unsubscribed", Header: "Отписалось", Type: INTEGER_COLUMN, Field: "Unsubscribed"},
+}}
+
+// CampaignsUTMRow - источник строки CampaignsUTMSchema.
+type CampaignsUTMRow struct {
+	SourceUTM string
+	MediumUTM string
+	TagUTM    string
+	CampaignsTotals
+}
+
+// CampaignsPeriodSchema - рассылки по неделям или месяцам (листы "По неделям" и "По месяцам"), источник - CampaignsPeriodRow.
+var CampaignsPeriodSchema = ReportSchema{Columns: []ReportColumn{
+	{Key: "period", Header: "Период", Type: TEXT_COLUMN, Field: "Period"},
+	{Key: "startDate", Header: "Начало", Type: TEXT_COLUMN, Field: "StartDate"},
+	{Key: "endDate", Header: "Окончание", Type: TEXT_COLUMN, Field: "EndDate"},
+	{Key: "campaigns", Header: "Рассылок", Type: INTEGER_COLUMN, Field: "Campaigns"},
+	{Key: "sent", Header: "Отправлено", Type: INTEGER_COLUMN, Field: "Sent"},
+	{Key: "uniqueOpened", Header: "Уникальных открытий", Type: INTEGER_COLUMN, Field: "UniqueOpened"},
+	{Key: "openRate", Header: "Открываемость", Type: NUMBER_COLUMN, NumberFormat: "0.00%", Field: "OpenRate"},
+	{Key: "uniqueClicked", Header: "Уникальных переходов", Type: INTEGER_COLUMN, Field: "UniqueClicked"},
+	{Key: "clickRate", Header: "Кликабельность", Type: NUMBER_COLUMN, NumberFormat: "0.00%", Field: "ClickRate"},
+	{Key: "unsubscribed", Header: "Отписалось", Type: INTEGER_COLUMN, Field: "Unsubscribed"},
+}}
+
+// CampaignsComparisonSchema - сравнение с предыдущим периодом той же длины (лист "Сравнение"), источник -
+// CampaignsComparisonRow. Доли в этой таблице записываются в процентах, а изменение - относительно предыдущего периода.
+var CampaignsComparisonSchema = ReportSchema{Columns: []ReportColumn{
+	{Key: "metric", Header: "Показатель", Type: TEXT_COLUMN, Field: "Metric"},
+	{Key: "current", Header: "Текущий период", Type: NUMBER_COLUMN, Field: "Current"},
+	{Key: "previous", Header: "Предыдущий период", Type: NUMBER_COLUMN, Field: "Previous"},
+	{Key: "change", Header: "Изменение", Type: NUMBER_COLUMN, NumberFormat: "0.00%", Field: "Change"},
+}}
+
+// SeriesSessionsSchema - занятия серии вебинаров (лист "Отчёт"), источник - SeriesSessionRow.
+var SeriesSessionsSchema = ReportSchema{Columns: []ReportColumn{
+	{Key: "number", Header: "№", Type: INTEGER_COLUMN, Field: "Number"},
+	{Key: "eventID", Header: "Код трансляции", Type: TEXT_COLUMN, Field: "EventID"},
+	{Key: "name", Header: "Название", Type: TEXT_COLUMN, Width: 50, Field: "VideoName"},
+	{Key: "planStartDate", Header: "Запланированное начало", Type: TEXT_COLUMN, Field: "PlanStartDate"},
+	{Key: "duration", Header: "Продолжительность, мин", Type: INTEGER_COLUMN, Field: "Duration"},
+	{Key: "viewers", Header: "Зрителей", Type: INTEGER_COLUMN, Field: "Viewers"},
+	{Key: "viewersOnline", Header: "Смотрели онлайн", Type: INTEGER_COLUMN, Field: "ViewersOnline"},
+	{Key: "viewersOffline", Header: "Смотрели только в записи", Type: INTEGER_COLUMN, Field: "ViewersOffline"},
+	{Key: "newViewers", Header: "Новых зрителей", Type: INTEGER_COLUMN, Field: "NewViewers"},
+	{Key: "retainedViewers", Header: "Смотрели предыдущее занятие", Type: INTEGER_COLUMN, Field: "RetainedViewers"},
+	{Key: "retention", Header: "Удержание", Type: NUMBER_COLUMN, NumberFormat: "0.00%", Field: "Retention"},
+	{Key: "pointsZOView", Header: "Баллы ЗО за просмотр", Type: INTEGER_COLUMN, Field: "PointsZOView"},
+}}
+
+// SeriesSessionRow - источник строки SeriesSessionsSchema.
+type SeriesSessionRow struct {
+	Number int
+	SeriesSessionInfo
+}
+
+// SeriesUsersSchema - посещаемость серии зрителями (лист "Зрители"), источник - SeriesUserRow.
+var SeriesUsersSchema = ReportSchema{Columns: []ReportColumn{
+	{Key: "name", Header: "ФИО", Type: TEXT_COLUMN, Field: "Name"},
+	{Key: "email", Header: "Email", Type: TEXT_COLUMN, Field: "Email"},
+	{Key: "specialization", Header: "Специальность", Type: TEXT_COLUMN, Field: "Specialization"},
+	{Key: "region", Header: "Регион", Type: TEXT_COLUMN, Field: "Region"},
+	{Key: "sessions", Header: "Посещено занятий", Type: INTEGER_COLUMN, Field: "Sessions"},
+	{Key: "attendance", Header: "Посещаемость", Type: NUMBER_COLUMN, NumberFormat: "0.00%", Field: "Attendance"},
+	{Key: "firstSession", Header: "Первое занятие", Type: INTEGER_COLUMN, Field: "FirstSession"},
+	{Key: "lastSession", Header: "Последнее занятие", Type: INTEGER_COLUMN, Field: "LastSession"},
+	{Key: "minutesViewedOnline", Header: "Минут онлайн", Type: INTEGER_COLUMN, Field: "MinutesViewedOnline"},
+	{Key: "minutesViewedOffline", Header: "Минут в записи", Type: INTEGER_COLUMN, Field: "MinutesViewedOffline"},
+	{Key: "pointsZOView", Header: "Баллы ЗО за просмотр", Type: INTEGER_COLUMN, Field: "PointsZOView"},
+}}
+
+// SeriesUserRow - источник строки SeriesUsersSchema.
+type SeriesUserRow struct {
+	SeriesUserInfo
+	SessionsTotal int
+}
+
+// Attendance - доля посещенных занятий серии.
+func (r SeriesUserRow) Attendance() float64 {
+	if r.SessionsTotal == 0 {
+		return 0
+	}
+
+	return float64(r.Sessions) / float64(r.SessionsTotal)
+}
+
+// SeriesAttendanceSchema - минуты просмотра каждого занятия каждым зрителем (лист "Посещаемость"). Столбцы занятий
+// зависят от серии, поэтому схема строится по занятиям, а строки - по SeriesUserInfo.MinutesBySession.
+func SeriesAttendanceSchema(sessions []SeriesSessionInfo) ReportSchema {
+	schema := ReportSchema{Columns: []ReportColumn{
+		{Key: "name", Header: "ФИО", Type: TEXT_COLUMN, Field: "Name"},
+		{Key: "email", Header: "Email", Type: TEXT_COLUMN, Field: "Email"},
+	}}
+	for i, session := range sessions {
+		schema.Columns = append(schema.Columns, ReportColumn{
+			Key:    "session" + strconv.Itoa(i+1),
+			Header: fmt.Sprintf("%d. %s", i+1, session.PlanStartDate),
+			Type:   INTEGER_COLUMN,
+		})
+	}
+
+	return schema
+}
+
+// ConferenceHallsSchema - залы сводного отчета по конференции (лист "Залы"), источник - ConferenceHallInfo.
+var ConferenceHallsSchema = ReportSchema{Columns: []ReportColumn{
+	{Key: "eventID", Header: "Код трансляции", Type: TEXT_COLUMN, Field: "EventID"},
+	{Key: "name", Header: "Название", Type: TEXT_COLUMN, Width: 50, Field: "VideoName"},
+	{Key: "startDate", Header: "Начало", Type: TEXT_COLUMN, Field: "StartDate"},
+	{Key: "firstMinute", Header: "Первая минута конференции", Type: INTEGER_COLUMN, Field: "FirstMinute"},
+	{Key: "duration", Header: "Продолжительность, мин", Type: INTEGER_COLUMN, Field: "Duration"},
+	{Key: "viewers", Header: "Зрителей", Type: INTEGER_COLUMN, Field: "Viewers"},
+	{Key: "minutesViewed", Header: "Засчитано минут", Type: INTEGER_COLUMN, Field: "MinutesViewed"},
+}}
+
+// ConferenceHallMinutesSchema - минуты зрителей по залам (лист "Минуты по залам"), источник - ConferenceHallMinutesRow.
+var ConferenceHallMinutesSchema = ReportSchema{Columns: []ReportColumn{
+	{Key: "name", Header: "ФИО", Type: TEXT_COLUMN, Field: "Name"},
+	{Key: "email", Header: "Email", Type: TEXT_COLUMN, Field: "Email"},
+	{Key: "eventID", Header: "Код трансляции", Type: TEXT_COLUMN, Field: "EventID"},
+	{Key: "hall", Header: "Зал", Type: TEXT_COLUMN, Field: "VideoName"},
+	{Key: "minutesViewed", Header: "Минут", Type: INTEGER_COLUMN, Field: "MinutesViewed"},
+	{Key: "minutes", Header: "Минуты конференции", Type: MINUTES_COLUMN, Width: 40, Field: "Minutes"},
+}}
+
+// ConferenceHallMinutesRow - источник строки ConferenceHallMinutesSchema: минуты конференции, засчитанные зрителю в зале.
+type ConferenceHallMinutesRow struct {
+	Name      string
+	Email     string
+	EventID   string
+	VideoName string
+	Minutes   []int
+}
+
+func (r ConferenceHallMinutesRow) MinutesViewed() int {
+	return len(r.Minutes)
+}
+
+func (c CampaignReport) OpenRate() float64 {
+	if c.Sent == 0 {
+		return 0
+	}
+
+	return float64(c.UniqueOpened) / float64(c.Sent)
+}
+
+func (c CampaignReport) ClickRate() float64 {
+	if c.Sent == 0 {
+		return 0
+	}
+
+	return float64(c.UniqueClicked) / float64(c.Sent)
+}
+
+// Index возвращает номер столбца key (с нуля) или -1, если столбца нет.
+func (rs ReportSchema) Index(key string) int {
+	for i, column := range rs.Columns {
+		if column.Key == key {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Value возвращает значение столбца key в строке row (nil, если столбца нет или строка короче).
+func (rs ReportSchema) Value(row []interface{}, key string) interface{} {
+	if i := rs.Index(key); i >= 0 && i < len(row) {
+		return row[i]
+	}
+
+	return nil
+}
+
+func (rs ReportSchema) Headers() []interface{} {
+	headers := make([]interface{}, len(rs.Columns))
+	for i, column := range rs.Columns {
+		headers[i] = column.Header
+	}
+
+	return headers
+}
+
+// Row строит строку отчета из структуры source (или указателя на нее), приводя значения к типам столбцов.
+// Значения столбцов MINUTES_COLUMN остаются списками []int, в текст их переводит FormatValue.
+func (rs ReportSchema) Row(source interface{}) ([]interface{}, error) {
+	v := reflect.ValueOf(source)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("report row source must be a struct (got %T)", source)
+	}
+
+	row := make([]interface{}, len(rs.Columns))
+	for i, column := range rs.Columns {
+		var value reflect.Value
+		if field := v.FieldByName(column.Field); field.IsValid() {
+			value = field
+		} else if method := v.MethodByName(column.Field); method.IsValid() && method.Type().NumIn() == 0 && method.Type().NumOut() == 1 {
+			value = method.Call(nil)[0]
+		} else {
+			return nil, fmt.Errorf("column '%s': %T has no field or method '%s'", column.Key, source, column.Field)
+		}
+
+		row[i] = column.convert(value.Interface())
+	}
+
+	return row, nil
+}
+
+// FormatValue возвращает текстовое представление значения столбца (для CSV и для списков минут в excel-отчете).
+func (rc ReportColumn) FormatValue(value interface{}) string {
+	switch rc.Type {
+	case MINUTES_COLUMN:
+		minutes := ToMinutes(value)
+		parts := make([]string, len(minutes))
+		for i, minute := range minutes {
+			parts[i] = strconv.Itoa(minute)
+		}
+		return strings.Join(parts, ", ")
+	case NUMBER_COLUMN:
+		if number, ok := value.(float64); ok {
+			return strconv.FormatFloat(number, 'f', -1, 64)
+		}
+	}
+
+	if value == nil {
+		return ""
+	}
+
+	return fmt.Sprint(value)
+}
+
+func (rc ReportColumn) convert(value interface{}) interface{} {
+	switch rc.Type {
+	case INTEGER_COLUMN:
+		if number, ok := value.(int); ok {
+			return number
+		}
+		number, _ := strconv.Atoi(fmt.Sprint(value))
+		return number
+	case NUMBER_COLUMN:
+		if number, ok := value.(float64); ok {
+			return number
+		}
+		number, _ := strconv.ParseFloat(fmt.Sprint(value), 64)
+		return number
+	case MINUTES_COLUMN:
+		return ToMinutes(value)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// ToMinutes приводит список минут к []int. Строки отчета, подготовленные frontend, содержат минуты в виде []interface{} из JSON.
+func ToMinutes(value interface{}) []int {
+	switch minutes := value.(type) {
+	case []int:
+		return minutes
+	case []interface{}:
+		result := make([]int, 0, len(minutes))
+		for _, minute := range minutes {
+			if m, ok := minute.(float64); ok {
+				result = append(result, int(m))
+			}
+		}
+		return result
+	default:
+		return nil
+	}
+}
+
+// WriteRows записывает строки rows на лист sheetName начиная со строки firstRow (с единицы): списки минут
+// записываются текстом, а числовые значения - числами.
+func (rs ReportSchema) WriteRows(f *excel.File, sheetName string, firstRow int, rows [][]interface{}) error {
+	for rowNum, row := range rows {
+		cells := make([]interface{}, len(row))
+		for i, value := range row {
+			if i < len(rs.Columns) && rs.Columns[i].Type == MINUTES_COLUMN {
+				cells[i] = rs.Columns[i].FormatValue(value)
+			} else {
+				cells[i] = value
+			}
+		}
+
+		err := f.SetSheetRow(sheetName, "A"+strconv.Itoa(firstRow+rowNum), &cells)
+		if err != nil {
+			return fmt.Errorf("%+v (rowNum: %v row: %+v)", err, firstRow+rowNum, row)
+		}
+	}
+
+	return nil
+}
+
+// ApplyFormats задает ширину столбцов и форматы ячеек в строках с firstRow по lastRow. Вызывается после AutoResizeColumns,
+// чтобы ширина из схемы заменяла ширину по содержимому.
+func (rs ReportSchema) ApplyFormats(f *excel.File, sheetName string, firstRow, lastRow int) error {
+	for i, column := range rs.Columns {
+		colName, err := excel.ColumnNumberToName(i + 1)
+		if err != nil {
+			return err
+		}
+
+		if column.Width > 0 {
+			if err = f.SetColWidth(sheetName, colName, colName, column.Width); err != nil {
+				return err
+			}
+		}
+
+		if column.NumberFormat == "" || lastRow < firstRow {
+			continue
+		}
+
+		numberFormat := column.NumberFormat
+		styleID, err := f.NewStyle(&excel.Style{
+			Alignment:    &excel.Alignment{Horizontal: "left", Vertical: "center"},
+			CustomNumFmt: &numberFormat,
+		})
+		if err != nil {
+			return err
+		}
+
+		err = f.SetCellStyle(sheetName, colName+strconv.Itoa(firstRow), colName+strconv.Itoa(lastRow), styleID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,238 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+
+	excel "github.com/xuri/excelize/v2"
+)
+
+// Форматы выгрузки отчетов
+const (
+	XLSX_FORMAT   = "xlsx"
+	CSV_FORMAT    = "csv"
+	NDJSON_FORMAT = "ndjson"
+)
+
+var reportContentTypes = map[string]string{
+	XLSX_FORMAT:   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	CSV_FORMAT:    "text/csv; charset=utf-8",
+	NDJSON_FORMAT: "application/x-ndjson",
+}
+
+// ReportTable - строки отчета, построенные по схеме Schema (без строки заголовков). Sheet - лист XLSX, на который
+// пишется таблица (по умолчанию - "Отчёт").
+type ReportTable struct {
+	Sheet  string
+	Schema ReportSchema
+	Rows   [][]interface{}
+}
+
+// NegotiateReportFormat выбирает формат выгрузки: параметр format важнее заголовка Accept, по умолчанию - XLSX.
+func NegotiateReportFormat(format, accept string) (string, error) {
+	if format != "" {
+		format = strings.ToLower(format)
+		if _, ok := reportContentTypes[format]; !ok {
+			return "", fmt.Errorf("unknown report format '%s' (available: %s, %s, %s)", format, XLSX_FORMAT, CSV_FORMAT, NDJSON_FORMAT)
+		}
+		return format, nil
+	}
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		for f, contentType := range reportContentTypes {
+			if ct, _, _ := mime.ParseMediaType(contentType); ct == mediaType {
+				return f, nil
+			}
+		}
+	}
+
+	return XLSX_FORMAT, nil
+}
+
+func ReportContentType(format string) string {
+	return reportContentTypes[format]
+}
+
+// WriteReport записывает отчет в w в формате format. В XLSX таблицы одного листа пишутся друг под другом (каждая - со
+// своими заголовками), а в CSV и NDJSON - только последняя, основная таблица отчета.
+func WriteReport(w io.Writer, format string, tables ...ReportTable) error {
+	if len(tables) == 0 {
+		return fmt.Errorf("report has no tables")
+	}
+
+	switch format {
+	case XLSX_FORMAT:
+		return writeReportXLSX(w, tables)
+	case CSV_FORMAT:
+		return writeReportCSV(w, tables[len(tables)-1])
+	case NDJSON_FORMAT:
+		return writeReportNDJSON(w, tables[len(tables)-1])
+	default:
+		return fmt.Errorf("unknown report format '%s'", format)
+	}
+}
+
+// XLSX собирается через StreamWriter, поэтому строки не хранятся в модели листа целиком, а файл не сохраняется на диск.
+func writeReportXLSX(w io.Writer, tables []ReportTable) error {
+	f := excel.NewFile()
+	defer f.Close()
+
+	// лист "Отчёт" - первый, остальные листы идут в порядке первого упоминания в tables
+	f.SetSheetName("Sheet1", "Отчёт")
+	sheets := []string{"Отчёт"}
+	sheetTables := make(map[string][]ReportTable)
+	for _, table := range tables {
+		sheet := table.Sheet
+		if sheet == "" {
+			sheet = "Отчёт"
+		}
+
+		if _, ok := sheetTables[sheet]; !ok && sheet != "Отчёт" {
+			f.NewSheet(sheet)
+			sheets = append(sheets, sheet)
+		}
+		sheetTables[sheet] = append(sheetTables[sheet], table)
+	}
+
+	for _, sheet := range sheets {
+		if err := writeSheetXLSX(f, sheet, sheetTables[sheet]); err != nil {
+			return err
+		}
+	}
+
+	return f.Write(w)
+}
+
+func writeSheetXLSX(f *excel.File, sheet string, tables []ReportTable) error {
+	sw, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		return err
+	}
+
+	if len(tables) == 0 {
+		return sw.Flush()
+	}
+
+	// ширина столбцов задается до записи строк и берется из основной (последней) таблицы листа
+	main := tables[len(tables)-1].Schema
+	for i, column := range main.Columns {
+		if column.Width > 0 {
+			if err = sw.SetColWidth(i+1, i+1, column.Width); err != nil {
+				return err
+			}
+		}
+	}
+
+	rowNum := 1
+	for _, table := range tables {
+		styles := make([]int, len(table.Schema.Columns))
+		for i, column := range table.Schema.Columns {
+			if column.NumberFormat == "" {
+				continue
+			}
+
+			numberFormat := column.NumberFormat
+			if styles[i], err = f.NewStyle(&excel.Style{CustomNumFmt: &numberFormat}); err != nil {
+				return err
+			}
+		}
+
+		if err = sw.SetRow("A"+strconv.Itoa(rowNum), table.Schema.Headers()); err != nil {
+			return err
+		}
+		rowNum++
+
+		for _, row := range table.Rows {
+			cells := make([]interface{}, len(row))
+			for i, value := range row {
+				switch {
+				case i >= len(table.Schema.Columns):
+					cells[i] = value
+				case table.Schema.Columns[i].Type == MINUTES_COLUMN:
+					cells[i] = table.Schema.Columns[i].FormatValue(value)
+				case styles[i] != 0:
+					cells[i] = excel.Cell{StyleID: styles[i], Value: value}
+				default:
+					cells[i] = value
+				}
+			}
+
+			if err = sw.SetRow("A"+strconv.Itoa(rowNum), cells); err != nil {
+				return fmt.Errorf("%+v (sheet: %s rowNum: %v row: %+v)", err, sheet, rowNum, row)
+			}
+			rowNum++
+		}
+	}
+
+	return sw.Flush()
+}
+
+func writeReportCSV(w io.Writer, table ReportTable) error {
+	cw := csv.NewWriter(w)
+
+	headers := make([]string, len(table.Schema.Columns))
+	for i, column := range table.Schema.Columns {
+		headers[i] = column.Header
+	}
+	if err := cw.Write(headers); err != nil {
+		return err
+	}
+
+	for _, row := range table.Rows {
+		record := make([]string, len(table.Schema.Columns))
+		for i, column := range table.Schema.Columns {
+			if i < len(row) {
+				record[i] = escapeCSVFormula(column.FormatValue(row[i]))
+			}
+		}
+
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// escapeCSVFormula экранирует значения, которые табличные редакторы при открытии CSV выполнили бы как формулу (начинаются
+// с =, +, - или @): перед ними ставится апостроф. Числа (в том числе отрицательные) не меняются.
+func escapeCSVFormula(value string) string {
+	if value == "" || !strings.ContainsRune("=+-@", rune(value[0])) {
+		return value
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return value
+	}
+
+	return "'" + value
+}
+
+// В NDJSON каждая строка - JSON-объект с ключами столбцов схемы.
+func writeReportNDJSON(w io.Writer, table ReportTable) error {
+	encoder := json.NewEncoder(w)
+	for _, row := range table.Rows {
+		object := make(map[string]interface{}, len(table.Schema.Columns))
+		for i, column := range table.Schema.Columns {
+			if i < len(row) {
+				object[column.Key] = row[i]
+			}
+		}
+
+		if err := encoder.Encode(object); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
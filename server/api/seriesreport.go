@@ -0,0 +1,309 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/wcharczuk/go-chart/v2/drawing"
+	excel "github.com/xuri/excelize/v2"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+
+	"zo-backend/eventdate"
+)
+
+// BuildSeriesReport собирает отчет по серии из отчетов по вебинарам (report[i] - отчет по eventIDs[i]). Занятия
+// сортируются по плановой дате начала, занятия без даты остаются в исходном порядке после занятий с датой.
+func BuildSeriesReport(eventIDs []string, reports []*GetReportServerResponse) *GetSeriesReportServerResponse {
+	type session struct {
+		eventID string
+		report  *GetReportServerResponse
+		date    eventdate.EventDate
+	}
+
+	sessions := make([]session, len(reports))
+	for i, report := range reports {
+		date, _ := eventdate.Parse(report.EventInfo.PlanStartDate)
+		sessions[i] = session{eventID: eventIDs[i], report: report, date: date}
+	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		if sessions[i].date.IsZero() || sessions[j].date.IsZero() {
+			return !sessions[i].date.IsZero() && sessions[j].date.IsZero()
+		}
+		return sessions[i].date.Before(sessions[j].date.Time)
+	})
+
+	series := &GetSeriesReportServerResponse{Sessions: make([]SeriesSessionInfo, len(sessions))}
+	users := make(map[string]*SeriesUserInfo)
+	previousViewers := make(map[string]bool)
+
+	for i, s := range sessions {
+		info := SeriesSessionInfo{
+			EventID:       s.eventID,
+			VideoName:     s.report.EventInfo.VideoName,
+			PlanStartDate: s.report.EventInfo.PlanStartDate,
+			Duration:      s.report.EventInfo.Duration,
+		}
+
+		viewers := make(map[string]bool)
+		for email, user := range s.report.UsersInfo {
+			if user.ViewRegime == "" { // получил ключ, но не смотрел
+				continue
+			}
+			email = strings.ToLower(email)
+			viewers[email] = true
+
+			info.Viewers++
+			if user.MinutesViewedOnline > 0 {
+				info.ViewersOnline++
+			} else {
+				info.ViewersOffline++
+			}
+			if previousViewers[email] {
+				info.RetainedViewers++
+			}
+			info.PointsZOView += user.PointsZOView
+
+			seriesUser, ok := users[email]
+			if !ok {
+				info.NewViewers++
+				seriesUser = &SeriesUserInfo{Email: email, FirstSession: i + 1, MinutesBySession: make([]int, len(sessions))}
+				users[email] = seriesUser
+			}
+
+			// данные из ДМ берутся из последнего занятия, где они есть
+			if user.Name != "" {
+				seriesUser.Name = user.Name
+			}
+			if user.Specialization != "" {
+				seriesUser.Specialization = user.Specialization
+			}
+			if user.Region != "" {
+				seriesUser.Region = user.Region
+			}
+
+			seriesUser.Sessions++
+			seriesUser.LastSession = i + 1
+			seriesUser.MinutesViewedOnline += user.MinutesViewedOnline
+			seriesUser.MinutesViewedOffline += user.MinutesViewedOffline
+			seriesUser.PointsZOView += user.PointsZOView
+			seriesUser.MinutesBySession[i] = user.MinutesViewedOnline + user.MinutesViewedOffline
+		}
+
+		if i > 0 && len(previousViewers) > 0 {
+			info.Retention = float64(info.RetainedViewers) / float64(len(previousViewers))
+		}
+
+		series.Sessions[i] = info
+		previousViewers = viewers
+	}
+
+	for _, user := range users {
+		series.Users = append(series.Users, *user)
+	}
+	sort.Slice(series.Users, func(i, j int) bool {
+		if series.Users[i].Sessions != series.Users[j].Sessions {
+			return series.Users[i].Sessions > series.Users[j].Sessions
+		}
+		return series.Users[i].Email < series.Users[j].Email
+	})
+
+	if len(sessions) > 0 {
+		first, last := sessions[0].date, sessions[len(sessions)-1].date
+		if !first.IsZero() && !last.IsZero() {
+			series.ReportName = fmt.Sprintf("Отчёт по серии %s - %s", first.Format("02.01.2006"), last.Format("02.01.2006"))
+		} else {
+			series.ReportName = "Отчёт по серии " + sessions[0].eventID
+		}
+	}
+
+	return series
+}
+
+// BuildSeriesReportTables возвращает таблицы отчета по серии: зрителей, посещаемость по занятиям и последней -
+// основную таблицу занятий.
+func BuildSeriesReportTables(series *GetSeriesReportServerResponse) ([]ReportTable, error) {
+	users := ReportTable{Sheet: "Зрители", Schema: SeriesUsersSchema}
+	attendance := ReportTable{Sheet: "Посещаемость", Schema: SeriesAttendanceSchema(series.Sessions)}
+	for _, user := range series.Users {
+		row, err := SeriesUsersSchema.Row(SeriesUserRow{SeriesUserInfo: user, SessionsTotal: len(series.Sessions)})
+		if err != nil {
+			return nil, err
+		}
+		users.Rows = append(users.Rows, row)
+
+		attendanceRow := []interface{}{user.Name, user.Email}
+		for _, minutes := range user.MinutesBySession {
+			attendanceRow = append(attendanceRow, minutes)
+		}
+		attendance.Rows = append(attendance.Rows, attendanceRow)
+	}
+
+	sessions := ReportTable{Schema: SeriesSessionsSchema}
+	for i, session := range series.Sessions {
+		row, err := SeriesSessionsSchema.Row(SeriesSessionRow{Number: i + 1, SeriesSessionInfo: session})
+		if err != nil {
+			return nil, err
+		}
+		sessions.Rows = append(sessions.Rows, row)
+	}
+
+	return []ReportTable{users, attendance, sessions}, nil
+}
+
+// WriteExcelSeriesReport записывает отчет по серии: занятия на лист "Отчёт", зрителей и посещаемость - на свои листы,
+// графики - на лист "Графики".
+func WriteExcelSeriesReport(f *excel.File, series *GetSeriesReportServerResponse, debug *ServerDebug) error {
+	debug.SetDebugLastStage("WriteExcelSeriesReport")
+
+	tables, err := BuildSeriesReportTables(series)
+	if err != nil {
+		return err
+	}
+
+	if err = WriteExcelReportTables(f, tables); err != nil {
+		return err
+	}
+
+	return PlotSeriesCharts(f, series, debug)
+}
+
+// FormatExcelSeriesReport выравнивает столбцы листов отчета по серии и задает форматы ячеек.
+func FormatExcelSeriesReport(f *excel.File, series *GetSeriesReportServerResponse, debug *ServerDebug) error {
+	debug.SetDebugLastStage("FormatExcelSeriesReport")
+
+	tables, err := BuildSeriesReportTables(series)
+	if err != nil {
+		return err
+	}
+
+	for _, sheet := range []string{"Отчёт", "Зрители", "Посещаемость"} {
+		if err = AutoResizeColumns(f, sheet, debug); err != nil {
+			return err
+		}
+	}
+
+	return FormatExcelReportTables(f, tables)
+}
+
+// PlotSeriesCharts добавляет лист "Графики" с динамикой зрителей по занятиям и распределением зрителей по числу
+// посещенных занятий.
+func PlotSeriesCharts(f *excel.File, series *GetSeriesReportServerResponse, debug *ServerDebug) error {
+	debug.SetDebugLastStage("PlotSeriesCharts -> ")
+
+	var err error
+	defer debug.DeleteDebugLastStage(&err)
+
+	const (
+		SESSIONS_TREND_CHART = "seriesSessionsTrend.jpeg"
+		ATTENDANCE_HISTOGRAM = "seriesAttendance.jpeg"
+	)
+
+	f.NewSheet("Графики")
+
+	trend, err := initSeriesTrendChart(series.Sessions)
+	if err != nil {
+		return err
+	}
+	if err = addChartPicture(f, trend, 20*vg.Centimeter, 15*vg.Centimeter, SESSIONS_TREND_CHART, "A1"); err != nil {
+		return err
+	}
+
+	attendance, err := initSeriesAttendanceChart(series)
+	if err != nil {
+		return err
+	}
+	if err = addChartPicture(f, attendance, 15*vg.Centimeter, 15*vg.Centimeter, ATTENDANCE_HISTOGRAM, "M1"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func initSeriesTrendChart(sessions []SeriesSessionInfo) (*plot.Plot, error) {
+	p := plot.New()
+	p.Legend.Top = true
+	p.Legend.TextStyle.Font.Size = 4 * vg.Millimeter
+	p.Title.TextStyle.Font.Size = 8 * vg.Millimeter
+	p.Title.Padding = 8 * vg.Millimeter
+	p.Title.Text = "\nЗрители по занятиям" // доп. строка как отступ, как в графиках вебинара
+	p.X.Label.Text = "занятие\n "
+	p.X.Label.TextStyle.Font.Size = 5 * vg.Millimeter
+	p.Y.Label.Text = "\nчисло зрителей"
+	p.Y.Label.TextStyle.Font.Size = 5 * vg.Millimeter
+	p.Y.Min = 0
+	p.Add(plotter.NewGrid())
+
+	ticks := make([]plot.Tick, len(sessions))
+	viewers := make(plotter.XYs, len(sessions))
+	retained := make(plotter.XYs, len(sessions))
+	newViewers := make(plotter.XYs, len(sessions))
+	for i, session := range sessions {
+		x := float64(i + 1)
+		ticks[i] = plot.Tick{Value: x, Label: fmt.Sprint(i + 1)}
+		viewers[i] = plotter.XY{X: x, Y: float64(session.Viewers)}
+		retained[i] = plotter.XY{X: x, Y: float64(session.RetainedViewers)}
+		newViewers[i] = plotter.XY{X: x, Y: float64(session.NewViewers)}
+	}
+	p.X.Tick.Marker = plot.ConstantTicks(ticks)
+
+	for i, series := range []struct {
+		label  string
+		values plotter.XYs
+	}{
+		{label: "все зрители", values: viewers},
+		{label: "смотрели предыдущее занятие", values: retained},
+		{label: "новые зрители", values: newViewers},
+	} {
+		line, points, err := plotter.NewLinePoints(series.values)
+		if err != nil {
+			return nil, err
+		}
+		line.LineStyle.Width = 0.5 * vg.Millimeter
+		line.LineStyle.Color = seriesChartColors[i]
+		points.Color = seriesChartColors[i]
+
+		p.Legend.Add(series.label, line, points)
+		p.Add(line, points)
+	}
+
+	return p, nil
+}
+
+func initSeriesAttendanceChart(series *GetSeriesReportServerResponse) (*plot.Plot, error) {
+	p := plot.New()
+	p.Title.TextStyle.Font.Size = 8 * vg.Millimeter
+	p.Title.Padding = 8 * vg.Millimeter
+	p.Title.Text = "\nПосещено занятий"
+	p.Y.Label.Text = "\nчисло зрителей"
+	p.Y.Label.TextStyle.Font.Size = 5 * vg.Millimeter
+	p.Add(plotter.NewGrid())
+
+	counts := make(plotter.Values, len(series.Sessions))
+	names := make([]string, len(series.Sessions))
+	for i := range names {
+		names[i] = fmt.Sprint(i + 1)
+	}
+	for _, user := range series.Users {
+		counts[user.Sessions-1]++
+	}
+	p.NominalX(names...)
+
+	bars, err := plotter.NewBarChart(counts, 1*vg.Centimeter)
+	if err != nil {
+		return nil, err
+	}
+	bars.LineStyle.Width = 0
+	bars.Color = seriesChartColors[0]
+	p.Add(bars)
+
+	return p, nil
+}
+
+var seriesChartColors = []drawing.Color{
+	{R: 100, G: 149, B: 237, A: 255}, /*синий*/
+	{R: 144, G: 238, B: 144, A: 255}, /*зеленый*/
+	{R: 255, G: 165, B: 0, A: 255},   /*оранжевый*/
+}
@@ -1,8 +1,10 @@
 package v1
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"fmt"
 	"github.com/go-chi/chi"
@@ -10,20 +12,46 @@ import (
 	"github.com/joho/godotenv"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"zo-backend/auth"
+	"zo-backend/certificates"
+	"zo-backend/dashamail"
+	"zo-backend/facecast"
+	"zo-backend/jobs"
+	"zo-backend/points"
 	. "zo-backend/server/api"
+	"zo-backend/storage"
+	"zo-backend/webinars"
 )
 
 type ServerApi struct {
-	appToken string
+	appToken   string
+	apiClients *auth.Store
 
 	yaDiskAcc    ServerAccInfo
 	dashaMailAcc ServerAccInfo
 	facecastAcc  ServerAccInfo
 
-	webinars   *map[string]ServerWebinar
-	wsInfoChan chan interface{}
+	dashaMail *dashamail.Client
+	facecast  *facecast.Client
+
+	certificateRenderer certificates.CertificateRenderer
+	jobsManager         *jobs.Manager
+	artifactStore       storage.ArtifactStore
+	folderLayouts       storage.FolderLayouts
+
+	webinarStore webinars.WebinarStore
+	pointsRules  *points.Engine
+	pointsLedger *points.Ledger
+	ledgerSync   sync.Mutex // синхронизации реестра баллов не выполняются параллельно
+	wsInfoChan   chan interface{}
+
+	certificateTemplates  *certificates.TemplateStore
+	certificatesRegistry  *certificates.Registry
+	certificatesVerifyURL string // адрес проверки сертификата, к которому дописывается серийный номер (для QR-кода)
 }
 
 func (s *ServerApi) Init() (string, error) {
@@ -42,15 +70,80 @@ func (s *ServerApi) Init() (string, error) {
 		return "", err
 	}
 
-	s.dashaMailAcc.URI = "https://api.dashamail.com/"
-	s.facecastAcc.URI = "https://facecast.net/api/"
-
-	w := make(map[string]ServerWebinar)
-	s.webinars = &w
+	err = s.initServices()
+	if err != nil {
+		return "", err
+	}
 
 	return port, nil
 }
 
+// Клиенты DashaMail и Facecast, генератор сертификатов, менеджер задач и хранилище файлов настраиваются переменными
+// окружения. Учетные данные DashaMail и Facecast к этому моменту уже должны быть заданы.
+func (s *ServerApi) initServices() error {
+	var err error
+
+	s.dashaMailAcc.URI = os.Getenv("DASHAMAIL_URI") // пустой URI - адрес API DashaMail по умолчанию
+	s.dashaMail = dashamail.NewClient(s.dashaMailAcc.URI, s.dashaMailAcc.ApiKey, nil)
+	s.facecastAcc.URI = os.Getenv("FACECAST_URI") // пустой URI - адрес API Facecast по умолчанию
+	s.facecast = facecast.NewClient(s.facecastAcc.URI, s.facecastAcc.ApiKey, s.facecastAcc.ApiSecret, nil)
+
+	// зависшая конвертация через LibreOffice завершается через $LIBREOFFICE_TIMEOUT (по умолчанию 60s)
+	var libreOfficeTimeout time.Duration
+	if t := os.Getenv("LIBREOFFICE_TIMEOUT"); t != "" {
+		if libreOfficeTimeout, err = time.ParseDuration(t); err != nil {
+			return fmt.Errorf("$LIBREOFFICE_TIMEOUT must be a duration (e.g. 60s)")
+		}
+	}
+
+	s.certificateRenderer, err = certificates.InitCertificateRenderer(os.Getenv("CERTIFICATE_RENDERER"), libreOfficeTimeout)
+	if err != nil {
+		return err
+	}
+
+	err = s.initJobsManager()
+	if err != nil {
+		return err
+	}
+
+	err = s.initArtifactStore()
+	if err != nil {
+		return err
+	}
+
+	err = s.initWebinarStore()
+	if err != nil {
+		return err
+	}
+
+	err = s.initAPIClients()
+	if err != nil {
+		return err
+	}
+
+	err = s.initPointsRules()
+	if err != nil {
+		return err
+	}
+
+	err = s.initPointsLedger()
+	if err != nil {
+		return err
+	}
+
+	err = s.initCertificateTemplates()
+	if err != nil {
+		return err
+	}
+
+	err = s.initCertificatesRegistry()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (s *ServerApi) initServerApiParams() error {
 	initParam := func(param *string, paramName string) error {
 		*param = os.Getenv(paramName)
@@ -92,10 +185,6 @@ func (s *ServerApi) initServerApiParams() error {
 		}
 	}
 
-	if err := initParam(&s.yaDiskAcc.ApiKey, "YANDEX_API_KEY"); err != nil {
-		return err
-	}
-
 	if err := initParam(&s.dashaMailAcc.ApiKey, "DASHAMAIL_API_KEY"); err != nil {
 		return err
 	}
@@ -111,6 +200,175 @@ func (s *ServerApi) initServerApiParams() error {
 	return nil
 }
 
+// Задачи хранятся в папке $JOBS_DIR (по умолчанию __jobs__) и выполняются в $JOBS_WORKERS воркерах (по умолчанию 2).
+// Завершенные задачи хранятся 7 дней, как и данные вебинаров.
+func (s *ServerApi) initJobsManager() error {
+	dir := os.Getenv("JOBS_DIR")
+	if dir == "" {
+		dir = "__jobs__"
+	}
+
+	workers := 2
+	if w := os.Getenv("JOBS_WORKERS"); w != "" {
+		var err error
+		if workers, err = strconv.Atoi(w); err != nil {
+			return fmt.Errorf("$JOBS_WORKERS must be an integer")
+		}
+	}
+
+	var err error
+	s.jobsManager, err = jobs.NewManager(dir, workers, 7*24*time.Hour)
+	return err
+}
+
+// Хранилище сертификатов и отчетов задается переменной $STORAGE_BACKEND (по умолчанию Яндекс.Диск), а шаблоны папок
+// можно переопределить переменными $STORAGE_LAYOUT_CERTIFICATES, $STORAGE_LAYOUT_WEBINAR_REPORTS и $STORAGE_LAYOUT_CAMPAIGNS_REPORTS.
+func (s *ServerApi) initArtifactStore() error {
+	storeType := os.Getenv("STORAGE_BACKEND")
+	if storeType == "" || storeType == storage.YANDEX_STORE {
+		s.yaDiskAcc.ApiKey = os.Getenv("YANDEX_API_KEY")
+		if s.yaDiskAcc.ApiKey == "" {
+			return fmt.Errorf("$YANDEX_API_KEY must be set")
+		}
+	}
+
+	var err error
+	s.artifactStore, err = storage.InitArtifactStore(storeType, storage.StoreConfig{
+		YandexApiKey:   s.yaDiskAcc.ApiKey,
+		LocalDir:       os.Getenv("STORAGE_LOCAL_DIR"),
+		WebDAVURI:      os.Getenv("WEBDAV_URI"),
+		WebDAVUser:     os.Getenv("WEBDAV_USER"),
+		WebDAVPassword: os.Getenv("WEBDAV_PASSWORD"),
+		PublicURL:      os.Getenv("STORAGE_PUBLIC_URL"),
+	})
+	if err != nil {
+		return err
+	}
+
+	s.folderLayouts, err = storage.InitFolderLayouts(map[string]string{
+		storage.CERTIFICATES_ARTIFACT:     os.Getenv("STORAGE_LAYOUT_CERTIFICATES"),
+		storage.WEBINAR_REPORT_ARTIFACT:   os.Getenv("STORAGE_LAYOUT_WEBINAR_REPORTS"),
+		storage.CAMPAIGNS_REPORT_ARTIFACT: os.Getenv("STORAGE_LAYOUT_CAMPAIGNS_REPORTS"),
+	})
+	return err
+}
+
+// Данные вебинаров (зрители с ключами Facecast и персональные фразы) сохраняются в файл $WEBINARS_FILE
+// (по умолчанию __webinars__.json), поэтому переживают перезапуск сервера.
+func (s *ServerApi) initWebinarStore() error {
+	path := os.Getenv("WEBINARS_FILE")
+	if path == "" {
+		path = "__webinars__.json"
+	}
+
+	var err error
+	s.webinarStore, err = webinars.NewFileStore(path)
+	return err
+}
+
+// Клиенты API и хеши их токенов хранятся в файле $AUTH_CLIENTS_FILE (по умолчанию __clients__.json).
+func (s *ServerApi) initAPIClients() error {
+	path := os.Getenv("AUTH_CLIENTS_FILE")
+	if path == "" {
+		path = "__clients__.json"
+	}
+
+	var err error
+	s.apiClients, err = auth.NewStore(path)
+	return err
+}
+
+// Правила начисления баллов ЗО читаются из файла $POINTS_RULES_FILE (по умолчанию points_rules.json, а без файла действуют
+// правила по умолчанию) и перечитываются при изменении файла раз в $POINTS_RULES_RELOAD_INTERVAL (по умолчанию 30s, 0 - без перезагрузки).
+func (s *ServerApi) initPointsRules() error {
+	path := os.Getenv("POINTS_RULES_FILE")
+	if path == "" {
+		path = "points_rules.json"
+	}
+
+	interval := 30 * time.Second
+	if i := os.Getenv("POINTS_RULES_RELOAD_INTERVAL"); i != "" {
+		var err error
+		if interval, err = time.ParseDuration(i); err != nil {
+			return fmt.Errorf("$POINTS_RULES_RELOAD_INTERVAL must be a duration (e.g. 30s)")
+		}
+	}
+
+	var err error
+	if s.pointsRules, err = points.NewEngine(path); err != nil {
+		return err
+	}
+
+	s.pointsRules.Watch(interval)
+	return nil
+}
+
+// Реестр баллов пользователей хранится в файле $POINTS_LEDGER_FILE (по умолчанию __points_ledger__.json) и синхронизируется
+// со всеми книгами DashaMail фоновой задачей раз в $POINTS_LEDGER_SYNC_INTERVAL (по умолчанию 24h, 0 - только по запросу).
+func (s *ServerApi) initPointsLedger() error {
+	path := os.Getenv("POINTS_LEDGER_FILE")
+	if path == "" {
+		path = "__points_ledger__.json"
+	}
+
+	interval := 24 * time.Hour
+	if i := os.Getenv("POINTS_LEDGER_SYNC_INTERVAL"); i != "" {
+		var err error
+		if interval, err = time.ParseDuration(i); err != nil {
+			return fmt.Errorf("$POINTS_LEDGER_SYNC_INTERVAL must be a duration (e.g. 24h)")
+		}
+	}
+
+	var err error
+	if s.pointsLedger, err = points.NewLedger(path); err != nil {
+		return err
+	}
+
+	if interval > 0 {
+		go s.schedulePointsLedgerSync(interval)
+	}
+
+	return nil
+}
+
+// Загруженные шаблоны сертификатов хранятся в папке $CERTIFICATE_TEMPLATES_DIR (по умолчанию __certificate_templates__).
+func (s *ServerApi) initCertificateTemplates() error {
+	dir := os.Getenv("CERTIFICATE_TEMPLATES_DIR")
+	if dir == "" {
+		dir = "__certificate_templates__"
+	}
+
+	var err error
+	if s.certificateTemplates, err = certificates.NewTemplateStore(dir); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Реестр выданных сертификатов хранится в файле $CERTIFICATES_REGISTRY_FILE (по умолчанию __certificates_registry__.json).
+// QR-код сертификата ведет на $CERTIFICATES_VERIFY_URL + серийный номер (публичный адрес GET /certificates/verify/{serial}
+// этого веб-сервиса). Без адреса сервер запускается, но сертификаты не создаются (см. checkCertificatesVerifyURL): QR-коды
+// печатаются на сертификатах и не должны вести на localhost.
+func (s *ServerApi) initCertificatesRegistry() error {
+	path := os.Getenv("CERTIFICATES_REGISTRY_FILE")
+	if path == "" {
+		path = "__certificates_registry__.json"
+	}
+
+	s.certificatesVerifyURL = os.Getenv("CERTIFICATES_VERIFY_URL")
+	if s.certificatesVerifyURL == "" {
+		fmt.Println(fmt.Errorf("+++++++ $CERTIFICATES_VERIFY_URL IS NOT SET, CERTIFICATES CAN'T BE CREATED +++++++"))
+	}
+
+	var err error
+	if s.certificatesRegistry, err = certificates.NewRegistry(path); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // UnknownEndpoint returns a personalized JSON message.
 func (s *ServerApi) UnknownEndpoint(w http.ResponseWriter, r *http.Request) {
 	unknown := chi.URLParam(r, "unknown")
@@ -141,48 +399,81 @@ func (s *ServerApi) GetUserPoints(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (s *ServerApi) GetUserPointsHistory(w http.ResponseWriter, r *http.Request) {
+	if email := r.URL.Query().Get("email"); email == "" {
+		err := getInvalidFieldError("email", "string")
+		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else if period, err := getPointsHistoryPeriod(r.URL.Query()); err != nil {
+		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else {
+		response, debug := s.getUserPointsHistory(email, period)
+		SendServerResponse(w, response, debug)
+	}
+}
+
 func (s *ServerApi) GetWebinarReportInfo(w http.ResponseWriter, r *http.Request) {
-	if eventID := r.URL.Query().Get("eventID"); eventID == "" {
-		err := getInvalidFieldError("eventID", "string")
+	if eventIDs, err := getWebinarEventIDs(r.URL.Query()); err != nil {
 		SendServerResponse(w, nil, &ServerDebug{Error: err})
 	} else {
-		response, debug := s.getWebinarReportInfo(eventID, nil)
+		response, debug := s.getWebinarReportInfo(eventIDs, nil)
 		SendServerResponse(w, response, debug)
 	}
 }
 
 func (s *ServerApi) GetCampaignsReportInfo(w http.ResponseWriter, r *http.Request) {
-	startDate := r.URL.Query().Get("start_date")
-	endDate := r.URL.Query().Get("end_date")
+	if startDate, endDate, err := getCampaignsPeriod(r.URL.Query()); err != nil {
+		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else {
+		response, debug := s.getCampaignsReportInfo(startDate, endDate, nil)
+		SendServerResponse(w, response, debug)
+	}
+}
+
+// GetSeriesReportInfo строит отчет по серии вебинаров; eventIDs - коды трансляций через запятую.
+func (s *ServerApi) GetSeriesReportInfo(w http.ResponseWriter, r *http.Request) {
+	if eventIDs, err := getEventIDs(r.URL.Query()); err != nil {
+		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else {
+		response, debug := s.getSeriesReportInfo(eventIDs, nil)
+		SendServerResponse(w, response, debug)
+	}
+}
 
-	/*/
-	 * Либо оба параметра - непустые строки нужного формата, либо оба - пустые строки.
-	 * В последнем случае endDate - текущая дата, а startDate - дата за 30 дней до текущей даты.
-	/*/
-	if startDate == "" && endDate == "" {
-		now := time.Now().UTC()
-		now = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
-		endDate = now.Format("2006-01-02")
-		startDate = now.Add(-30 * 24 * time.Hour).Format("2006-01-02")
+// DownloadWebinarReport отдает отчет по вебинару файлом (XLSX, CSV или NDJSON) без сохранения на диск и загрузки в хранилище.
+func (s *ServerApi) DownloadWebinarReport(w http.ResponseWriter, r *http.Request) {
+	if eventIDs, err := getWebinarEventIDs(r.URL.Query()); err != nil {
+		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else if format, err := NegotiateReportFormat(r.URL.Query().Get("format"), r.Header.Get("Accept")); err != nil {
+		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else if report, debug := s.getWebinarReportInfo(eventIDs, nil); debug != nil && debug.Error != nil {
+		SendServerResponse(w, nil, debug)
+	} else if eventTable, usersTable, err := BuildWebinarReportTables(strings.Join(eventIDs, ", "), report); err != nil {
+		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else if hallsTables, err := BuildConferenceReportTables(report); err != nil {
+		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else {
+		sendReportFile(w, report.ReportName, format, append(hallsTables, eventTable, usersTable)...)
 	}
+}
 
-	if startDate == "" && endDate != "" {
-		err := getInvalidFieldError("startDate", "string")
+// DownloadCampaignsReport отдает отчет по рассылкам файлом (XLSX, CSV или NDJSON) без сохранения на диск и загрузки в хранилище.
+func (s *ServerApi) DownloadCampaignsReport(w http.ResponseWriter, r *http.Request) {
+	if startDate, endDate, err := getCampaignsPeriod(r.URL.Query()); err != nil {
 		SendServerResponse(w, nil, &ServerDebug{Error: err})
-	} else if startDate != "" && endDate == "" {
-		err := getInvalidFieldError("endDate", "string")
+	} else if format, err := NegotiateReportFormat(r.URL.Query().Get("format"), r.Header.Get("Accept")); err != nil {
 		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else if tables, debug := s.getCampaignsReportTables(startDate, endDate); debug != nil && debug.Error != nil {
+		SendServerResponse(w, nil, debug)
 	} else {
-		response, debug := s.getCampaignsReportInfo(startDate, endDate, nil)
-		SendServerResponse(w, response, debug)
+		sendReportFile(w, fmt.Sprintf("Отчёт по рассылкам %s - %s", startDate, endDate), format, tables...)
 	}
 }
 
 func (s *ServerApi) FacecastLogin(w http.ResponseWriter, r *http.Request) {
 	// вначале проверка актуальности данных для PERSONAL_PHRASES
-	updatePersonalPhrasesDates(s.webinars)
-
-	if body, err := ReadRequestBody(r.Body); err != nil {
+	if err := s.webinarStore.DeleteExpired(time.Now()); err != nil {
+		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else if body, err := ReadRequestBody(r.Body); err != nil {
 		err := getBodyReadingError(err)
 		SendServerResponse(w, nil, &ServerDebug{Error: err})
 	} else if eventID, ok := body["eventID"].(string); !ok || eventID == "" {
@@ -193,13 +484,13 @@ func (s *ServerApi) FacecastLogin(w http.ResponseWriter, r *http.Request) {
 			if pp, ok := personalPhrases.(string); !ok || pp == "" {
 				err := getInvalidFieldError("personalPhrases", "string", body["personalPhrases"])
 				SendServerResponse(w, nil, &ServerDebug{Error: err})
+			} else if webinar, err := s.webinarStore.Update(eventID, func(webinar *webinars.Webinar) {
+				webinar.DeletionDate = time.Now().Add(7 * 24 * time.Hour)
+				webinar.PersonalPhrases = pp
+			}); err != nil {
+				SendServerResponse(w, nil, &ServerDebug{Error: err})
 			} else {
-				(*s.webinars)[eventID] = ServerWebinar{
-					DeletionDate:    time.Now().Add(7 * 24 * time.Hour),
-					PersonalPhrases: pp,
-					Users:           (*s.webinars)[eventID].Users,
-				}
-				message := fmt.Sprintf("updated personal phrases for eventID %v: %+v", eventID, (*s.webinars)[eventID].PersonalPhrases)
+				message := fmt.Sprintf("updated personal phrases for eventID %v: %+v", eventID, webinar.PersonalPhrases)
 				response := map[string]string{"message": message}
 				SendServerResponse(w, response, nil)
 			}
@@ -238,14 +529,10 @@ func (s *ServerApi) CreateWebinarReport(w http.ResponseWriter, r *http.Request)
 	if body, err := ReadRequestBody(r.Body); err != nil {
 		err := getBodyReadingError(err)
 		SendServerResponse(w, nil, &ServerDebug{Error: err})
-	} else if reportName, ok := body["reportName"].(string); !ok || reportName == "" {
-		err := getInvalidFieldError("reportName", "string", body["reportName"])
-		SendServerResponse(w, nil, &ServerDebug{Error: err})
-	} else if reportData, ok := body["reportData"].([]interface{}); !ok || reportData == nil {
-		err := getInvalidFieldError("reportData", "[]interface{}", body["reportData"])
+	} else if eventIDs, reportName, reportData, err := validateWebinarReportRequest(body); err != nil {
 		SendServerResponse(w, nil, &ServerDebug{Error: err})
 	} else {
-		debug := s.createWebinarReport(reportName, reportData, nil)
+		debug := s.createWebinarReport(eventIDs, reportName, reportData, nil)
 		SendServerResponse(w, nil, debug)
 	}
 }
@@ -261,11 +548,44 @@ func (s *ServerApi) CreateCampaignsReport(w http.ResponseWriter, r *http.Request
 		err := getInvalidFieldError("reportData", "[]interface{}", body["reportData"])
 		SendServerResponse(w, nil, &ServerDebug{Error: err})
 	} else {
-		debug := s.createCampaignsReport(reportName, reportData, nil)
+		// период отчета необязателен
+		startDate, _ := body["start_date"].(string)
+		endDate, _ := body["end_date"].(string)
+
+		debug := s.createCampaignsReport(reportName, reportData, startDate, endDate, nil)
 		SendServerResponse(w, nil, debug)
 	}
 }
 
+func (s *ServerApi) CreateSeriesReport(w http.ResponseWriter, r *http.Request) {
+	if body, err := ReadRequestBody(r.Body); err != nil {
+		err := getBodyReadingError(err)
+		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else if eventIDs, reportName, err := validateSeriesReportRequest(body); err != nil {
+		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else {
+		debug := s.createSeriesReport(eventIDs, reportName, nil)
+		SendServerResponse(w, nil, debug)
+	}
+}
+
+func (s *ServerApi) PreviewPoints(w http.ResponseWriter, r *http.Request) {
+	if body, err := ReadRequestBody(r.Body); err != nil {
+		err := getBodyReadingError(err)
+		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else if req, err := validatePointsPreviewRequest(body); err != nil {
+		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else {
+		response, debug := s.previewPoints(req)
+		SendServerResponse(w, response, debug)
+	}
+}
+
+func (s *ServerApi) SyncPointsLedger(w http.ResponseWriter, r *http.Request) {
+	response, debug := s.syncPointsLedger(nil)
+	SendServerResponse(w, response, debug)
+}
+
 func (s *ServerApi) SendDataToDashaMail(w http.ResponseWriter, r *http.Request) {
 	if body, err := ReadRequestBody(r.Body); err != nil {
 		err := getBodyReadingError(err)
@@ -282,6 +602,134 @@ func (s *ServerApi) SendDataToDashaMail(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+func (s *ServerApi) SubmitJob(w http.ResponseWriter, r *http.Request) {
+	if body, err := ReadRequestBody(r.Body); err != nil {
+		err := getBodyReadingError(err)
+		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else if apiMethod, ok := body["apiMethod"].(string); !ok || apiMethod == "" {
+		err := getInvalidFieldError("apiMethod", "string", body["apiMethod"])
+		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else if err := checkScope(r.Context(), apiMethodRequiredScopes(apiMethod, jobData(body))...); err != nil {
+		sendAuthError(w, http.StatusForbidden, err)
+	} else {
+		response, debug := s.submitJob(contextAPIClient(r.Context()).ID, apiMethod, body["data"])
+		SendServerResponse(w, response, debug)
+	}
+}
+
+func (s *ServerApi) GetJob(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "jobID")
+	if err := checkScope(r.Context(), s.jobScopes(jobID)...); err != nil {
+		sendAuthError(w, http.StatusForbidden, err)
+	} else {
+		response, debug := s.getJob(jobID, contextAPIClient(r.Context()))
+		SendServerResponse(w, response, debug)
+	}
+}
+
+func (s *ServerApi) CancelJob(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "jobID")
+	if err := checkScope(r.Context(), s.jobScopes(jobID)...); err != nil {
+		sendAuthError(w, http.StatusForbidden, err)
+	} else {
+		response, debug := s.cancelJob(jobID, contextAPIClient(r.Context()))
+		SendServerResponse(w, response, debug)
+	}
+}
+
+// VerifyCertificate - публичная проверка сертификата по серийному номеру (ссылка из QR-кода сертификата), без токена.
+func (s *ServerApi) VerifyCertificate(w http.ResponseWriter, r *http.Request) {
+	response, debug := s.verifyCertificate(chi.URLParam(r, "serial"))
+	SendServerResponse(w, response, debug)
+}
+
+func (s *ServerApi) GetCertificateTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, assignments := s.certificateTemplates.List()
+	SendServerResponse(w, CertificateTemplatesServerResponse{Templates: templates, Assignments: assignments}, nil)
+}
+
+// UploadCertificateTemplate загружает новую версию шаблона сертификата (DOCX-файл передается в base64).
+func (s *ServerApi) UploadCertificateTemplate(w http.ResponseWriter, r *http.Request) {
+	if body, err := ReadRequestBody(r.Body); err != nil {
+		err := getBodyReadingError(err)
+		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else if name, ok := body["name"].(string); !ok || name == "" {
+		err := getInvalidFieldError("name", "string", body["name"])
+		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else if category, ok := body["category"].(string); !ok || category == "" {
+		err := getInvalidFieldError("category", "string", body["category"])
+		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else if content, ok := body["content"].(string); !ok || content == "" {
+		err := getInvalidFieldError("content", "base64 string")
+		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else if docx, err := base64.StdEncoding.DecodeString(content); err != nil {
+		err := getInvalidFieldError("content", "base64 string")
+		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else if template, err := s.certificateTemplates.Upload(name, category, docx); err != nil {
+		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else {
+		SendServerResponse(w, template, nil)
+	}
+}
+
+// ActivateCertificateTemplate назначает шаблон активным для его категории: для всех мероприятий или, если переданы
+// eventName и eventDate, для одного мероприятия.
+func (s *ServerApi) ActivateCertificateTemplate(w http.ResponseWriter, r *http.Request) {
+	if body, err := ReadRequestBody(r.Body); err != nil {
+		err := getBodyReadingError(err)
+		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else if eventName, ok := body["eventName"].(string); !ok && body["eventName"] != nil {
+		err := getInvalidFieldError("eventName", "string", body["eventName"])
+		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else if eventDate, ok := body["eventDate"].(string); !ok && body["eventDate"] != nil {
+		err := getInvalidFieldError("eventDate", "string", body["eventDate"])
+		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else if assignment, err := s.certificateTemplates.Activate(chi.URLParam(r, "templateID"), eventName, eventDate); err != nil {
+		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else {
+		SendServerResponse(w, assignment, nil)
+	}
+}
+
+// GetCertificatesHistory возвращает все сертификаты пользователя из реестра, в том числе отозванные.
+func (s *ServerApi) GetCertificatesHistory(w http.ResponseWriter, r *http.Request) {
+	if email := r.URL.Query().Get("email"); email == "" {
+		err := getInvalidFieldError("email", "string")
+		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else {
+		SendServerResponse(w, s.certificatesRegistry.History(email), nil)
+	}
+}
+
+func (s *ServerApi) GetAPIClients(w http.ResponseWriter, r *http.Request) {
+	SendServerResponse(w, s.apiClients.List(), nil)
+}
+
+func (s *ServerApi) IssueAPIClient(w http.ResponseWriter, r *http.Request) {
+	if body, err := ReadRequestBody(r.Body); err != nil {
+		err := getBodyReadingError(err)
+		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else if name, ok := body["name"].(string); !ok || name == "" {
+		err := getInvalidFieldError("name", "string", body["name"])
+		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else if scopes, ok := toStringSlice(body["scopes"]); !ok || len(scopes) == 0 {
+		err := getInvalidFieldError("scopes", "[]string", body["scopes"])
+		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else if client, token, err := s.apiClients.Issue(name, scopes); err != nil {
+		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else {
+		SendServerResponse(w, IssuedAPIClientServerResponse{Client: client, Token: token}, nil)
+	}
+}
+
+func (s *ServerApi) RevokeAPIClient(w http.ResponseWriter, r *http.Request) {
+	if client, err := s.apiClients.Revoke(chi.URLParam(r, "clientID")); err != nil {
+		SendServerResponse(w, nil, &ServerDebug{Error: err})
+	} else {
+		SendServerResponse(w, client, nil)
+	}
+}
+
 func (s *ServerApi) HandleWebSocketConnections(w http.ResponseWriter, r *http.Request) {
 	ws, err := (&websocket.Upgrader{
 		CheckOrigin: func(r *http.Request) bool { return true },
@@ -293,11 +741,13 @@ func (s *ServerApi) HandleWebSocketConnections(w http.ResponseWriter, r *http.Re
 
 	var response interface{}
 	debug := &ServerDebug{}
+	progress := new(jobs.Progress)
 	wsWaiter := &WebSocketWaiter{
 		Chan:     ws,
 		Done:     make(chan struct{}),
 		Ticker:   time.NewTicker(3 * time.Second), // частота комментариев, направляемых на frontend
-		Response: &WebSocketWaiterResponse{Status: "processing"},
+		Response: &WebSocketWaiterResponse{Status: "processing", OnMessage: progress.Set},
+		Progress: progress,
 	}
 
 	defer func() {
@@ -316,34 +766,72 @@ func (s *ServerApi) HandleWebSocketConnections(w http.ResponseWriter, r *http.Re
 	}
 
 	go waitingForServerValidAnswer(wsWaiter)
-	validateData := func(msgData interface{}) (map[string]interface{}, bool) {
-		data, ok := msgData.(map[string]interface{})
-		return data, ok
+
+	// токен проверен при апгрейде соединения, здесь проверяются только права на конкретный метод
+	if err = checkScope(r.Context(), s.messageScopes(msg)...); err != nil {
+		debug.Error = err
+		return
 	}
 
 	switch msg.APIMethod {
-	case "getWebinarReportInfo":
+	case "submitJob":
 		if data, ok := validateData(msg.Data); !ok {
-			debug.Error = getDataValidFormatError("{'eventID': 'string'}")
-		} else if eventID, ok := data["eventID"].(string); !ok || eventID == "" {
-			debug.Error = getInvalidFieldError("eventID", "string", data["eventID"])
+			debug.Error = getDataValidFormatError("{'apiMethod': 'string', 'data': 'interface{}'}")
+		} else if apiMethod, ok := data["apiMethod"].(string); !ok || apiMethod == "" {
+			debug.Error = getInvalidFieldError("apiMethod", "string", data["apiMethod"])
 		} else {
-			response, debug = s.getWebinarReportInfo(eventID, wsWaiter.Response)
+			response, debug = s.submitJob(contextAPIClient(r.Context()).ID, apiMethod, data["data"])
 		}
 
-	case "createWebinarReport":
+	case "subscribeJob":
 		if data, ok := validateData(msg.Data); !ok {
-			debug.Error = getDataValidFormatError("{'reportName': 'string', 'reportData': '[]interface{}'}")
-		} else if reportName, ok := data["reportName"].(string); !ok || reportName == "" {
-			debug.Error = getInvalidFieldError("reportName", "string", data["reportName"])
-		} else if reportData, ok := data["reportData"].([]interface{}); !ok || reportData == nil {
-			debug.Error = getInvalidFieldError("reportData", "[]interface{}", data["reportData"])
+			debug.Error = getDataValidFormatError("{'jobID': 'string'}")
+		} else if jobID, ok := data["jobID"].(string); !ok || jobID == "" {
+			debug.Error = getInvalidFieldError("jobID", "string", data["jobID"])
 		} else {
-			debug = s.createWebinarReport(reportName, reportData, wsWaiter.Response)
+			response, debug = s.subscribeJob(jobID, contextAPIClient(r.Context()), wsWaiter.Response)
 		}
 
-	case "getCampaignsReportInfo":
+	case "cancelJob":
 		if data, ok := validateData(msg.Data); !ok {
+			debug.Error = getDataValidFormatError("{'jobID': 'string'}")
+		} else if jobID, ok := data["jobID"].(string); !ok || jobID == "" {
+			debug.Error = getInvalidFieldError("jobID", "string", data["jobID"])
+		} else {
+			response, debug = s.cancelJob(jobID, contextAPIClient(r.Context()))
+		}
+
+	default:
+		response, debug = s.handleAPIMethod(msg.APIMethod, msg.Data, wsWaiter.Response)
+	}
+}
+
+// handleAPIMethod выполняет метод API, доступный через WebSocket (и через фоновые задачи), по его названию.
+func (s *ServerApi) handleAPIMethod(apiMethod string, msgData interface{}, wsWaiterResp *WebSocketWaiterResponse) (interface{}, *ServerDebug) {
+	var response interface{}
+	debug := &ServerDebug{}
+
+	switch apiMethod {
+	case "getWebinarReportInfo":
+		if data, ok := validateData(msgData); !ok {
+			debug.Error = getDataValidFormatError("{'eventID': 'string'} or {'eventIDs': '[]string'}")
+		} else if eventIDs, err := webinarEventIDs(data); err != nil {
+			debug.Error = err
+		} else {
+			response, debug = s.getWebinarReportInfo(eventIDs, wsWaiterResp)
+		}
+
+	case "createWebinarReport":
+		if data, ok := validateData(msgData); !ok {
+			debug.Error = getDataValidFormatError("{'eventID': 'string', 'reportName': 'string'}, {'eventIDs': '[]string', 'reportName': 'string'} or {'reportName': 'string', 'reportData': '[]interface{}'}")
+		} else if eventIDs, reportName, reportData, err := validateWebinarReportRequest(data); err != nil {
+			debug.Error = err
+		} else {
+			debug = s.createWebinarReport(eventIDs, reportName, reportData, wsWaiterResp)
+		}
+
+	case "getCampaignsReportInfo":
+		if data, ok := validateData(msgData); !ok {
 			debug.Error = getDataValidFormatError("{'start_date': 'YYYY-MM-DD', 'end_date': 'YYYY-MM-DD'}")
 		} else {
 			var startDate, endDate string
@@ -370,57 +858,122 @@ func (s *ServerApi) HandleWebSocketConnections(w http.ResponseWriter, r *http.Re
 			}
 
 			if debug.Error == nil {
-				response, debug = s.getCampaignsReportInfo(startDate, endDate, wsWaiter.Response)
+				response, debug = s.getCampaignsReportInfo(startDate, endDate, wsWaiterResp)
 			}
 		}
 
 	case "createCampaignsReport":
-		if data, ok := validateData(msg.Data); !ok {
+		if data, ok := validateData(msgData); !ok {
 			debug.Error = getDataValidFormatError("{'reportName': 'string', 'reportData': '[]interface{}'}")
 		} else if reportName, ok := data["reportName"].(string); !ok || reportName == "" {
 			debug.Error = getInvalidFieldError("reportName", "string", data["reportName"])
 		} else if reportData, ok := data["reportData"].([]interface{}); !ok || reportData == nil {
 			debug.Error = getInvalidFieldError("reportData", "[]interface{}", data["reportData"])
 		} else {
-			debug = s.createCampaignsReport(reportName, reportData, wsWaiter.Response)
+			startDate, _ := data["start_date"].(string)
+			endDate, _ := data["end_date"].(string)
+			debug = s.createCampaignsReport(reportName, reportData, startDate, endDate, wsWaiterResp)
+		}
+
+	case "getSeriesReportInfo":
+		if data, ok := validateData(msgData); !ok {
+			debug.Error = getDataValidFormatError("{'eventIDs': '[]string'}")
+		} else if eventIDs, _, err := validateSeriesReportRequest(data); err != nil {
+			debug.Error = err
+		} else {
+			response, debug = s.getSeriesReportInfo(eventIDs, wsWaiterResp)
+		}
+
+	case "createSeriesReport":
+		if data, ok := validateData(msgData); !ok {
+			debug.Error = getDataValidFormatError("{'eventIDs': '[]string', 'reportName': 'string'}")
+		} else if eventIDs, reportName, err := validateSeriesReportRequest(data); err != nil {
+			debug.Error = err
+		} else {
+			debug = s.createSeriesReport(eventIDs, reportName, wsWaiterResp)
 		}
 
 	case "getCertificatesInfo":
-		if data, ok := validateData(msg.Data); !ok {
-			debug.Error = getDataValidFormatError("{'bookID': 'string'}")
+		if data, ok := validateData(msgData); !ok {
+			debug.Error = getDataValidFormatError("{'bookID': 'string', 'eventID': 'string'}")
 		} else if bookID, ok := data["bookID"].(string); !ok || bookID == "" {
 			debug.Error = getInvalidFieldError("bookID", "string", data["bookID"])
+		} else if eventIDs, err := certificatesEventIDs(data); err != nil {
+			debug.Error = err
 		} else {
-			response, debug = s.getCertificatesInfo(bookID, wsWaiter.Response)
+			response, debug = s.getCertificatesInfo(bookID, eventIDs, wsWaiterResp)
 		}
 
 	case "createCertificates":
-		if data, ok := validateData(msg.Data); !ok {
-			debug.Error = getDataValidFormatError("{'eventName': 'string', 'eventDate': 'string', 'usersInfo': 'map[string]interface{}'}")
+		if data, ok := validateData(msgData); !ok {
+			debug.Error = getDataValidFormatError("{'eventName': 'string', 'eventDate': 'string', 'usersInfo': 'map[string]interface{}', 'eventID': 'string', 'bookID': 'string'}")
 		} else if eventName, ok := data["eventName"].(string); !ok || eventName == "" {
 			debug.Error = getInvalidFieldError("eventName", "string", data["eventName"])
 		} else if eventDate, ok := data["eventDate"].(string); !ok || eventDate == "" {
 			debug.Error = getInvalidFieldError("eventDate", "string", data["eventDate"])
 		} else if usersInfo, ok := data["usersInfo"].(map[string]interface{}); !ok || usersInfo == nil {
 			debug.Error = getInvalidFieldError("usersInfo", "map[string]interface{}", data["usersInfo"])
+		} else if _, ok := data["bookID"].(string); !ok && data["bookID"] != nil {
+			debug.Error = getInvalidFieldError("bookID", "string", data["bookID"])
+		} else if eventIDs, err := certificatesEventIDs(data); err != nil {
+			debug.Error = err
+		} else {
+			response, debug = s.createCertificates(data, eventIDs, wsWaiterResp)
+		}
+
+	case "previewCertificate":
+		if data, ok := validateData(msgData); !ok {
+			debug.Error = getDataValidFormatError("{'eventName': 'string', 'eventDate': 'string', 'usersInfo': 'map[string]interface{}', 'email': 'string', 'category': 'string'}")
+		} else if eventName, ok := data["eventName"].(string); !ok || eventName == "" {
+			debug.Error = getInvalidFieldError("eventName", "string", data["eventName"])
+		} else if eventDate, ok := data["eventDate"].(string); !ok || eventDate == "" {
+			debug.Error = getInvalidFieldError("eventDate", "string", data["eventDate"])
+		} else if _, ok := data["usersInfo"].(map[string]interface{}); !ok && data["usersInfo"] != nil {
+			debug.Error = getInvalidFieldError("usersInfo", "map[string]interface{}", data["usersInfo"])
+		} else if _, ok := data["email"].(string); !ok && data["email"] != nil {
+			debug.Error = getInvalidFieldError("email", "string", data["email"])
+		} else if _, ok := data["category"].(string); !ok && data["category"] != nil {
+			debug.Error = getInvalidFieldError("category", "string", data["category"])
+		} else {
+			response, debug = s.previewCertificate(data, wsWaiterResp)
+		}
+
+	case "reissueCertificates", "revokeCertificates":
+		if data, ok := validateData(msgData); !ok {
+			debug.Error = getDataValidFormatError("{'bookID': 'string', 'emails': '[]string', 'reason': 'string', 'eventID': 'string'}")
+		} else if bookID, ok := data["bookID"].(string); !ok || bookID == "" {
+			debug.Error = getInvalidFieldError("bookID", "string", data["bookID"])
+		} else if emails, err := certificatesEmails(data); err != nil {
+			debug.Error = err
+		} else if reason, ok := data["reason"].(string); !ok || strings.TrimSpace(reason) == "" {
+			debug.Error = getInvalidFieldError("reason", "string", data["reason"])
+		} else if eventIDs, err := certificatesEventIDs(data); err != nil {
+			debug.Error = err
+		} else if apiMethod == "reissueCertificates" {
+			response, debug = s.reissueCertificates(bookID, emails, eventIDs, strings.TrimSpace(reason), wsWaiterResp)
 		} else {
-			response, debug = s.createCertificates(data, wsWaiter.Response)
+			response, debug = s.revokeCertificates(bookID, emails, strings.TrimSpace(reason), wsWaiterResp)
 		}
 
+	case "syncPointsLedger":
+		response, debug = s.syncPointsLedger(wsWaiterResp)
+
 	case "sendDataToDashaMail":
-		if data, ok := validateData(msg.Data); !ok {
+		if data, ok := validateData(msgData); !ok {
 			debug.Error = getDataValidFormatError("{'bookID': 'string', 'infoDM': 'map[string]interface{}'}")
 		} else if bookID, ok := data["bookID"].(string); !ok || bookID == "" {
 			debug.Error = getInvalidFieldError("bookID", "string", data["bookID"])
 		} else if infoDM, ok := data["infoDM"].(map[string]interface{}); !ok || infoDM == nil {
 			debug.Error = getInvalidFieldError("infoDM", "map[string]interface{}", data["infoDM"])
 		} else {
-			debug = s.sendDataToDashaMail(bookID, infoDM, wsWaiter.Response)
+			debug = s.sendDataToDashaMail(bookID, infoDM, wsWaiterResp)
 		}
 
 	default:
-		debug.Error = fmt.Errorf("unknown API method '%v'", msg.APIMethod)
+		debug.Error = fmt.Errorf("unknown API method '%v'", apiMethod)
 	}
+
+	return response, debug
 }
 
 // EnableCORSRequests is an example middleware handler that enables CORS headers.
@@ -431,7 +984,7 @@ func (s *ServerApi) EnableCORSRequests(next http.Handler) http.Handler {
 		headers.Add("Vary", "Origin")
 		headers.Add("Vary", "Access-Control-Request-Method")
 		headers.Add("Vary", "Access-Control-Request-Headers")
-		headers.Add("Access-Control-Allow-Headers", "Content-Type, Origin, Accept, token")
+		headers.Add("Access-Control-Allow-Headers", "Content-Type, Origin, Accept, Authorization")
 		headers.Add("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
 
 		if r.Method == "OPTIONS" {
@@ -442,39 +995,42 @@ func (s *ServerApi) EnableCORSRequests(next http.Handler) http.Handler {
 	})
 }
 
-// EnableAuthentication is an example middleware handler that checks for a
-// hardcoded bearer appToken. This can be used to verify session cookies, JWTs
-// and more.
-func (s *ServerApi) EnableAuthentication(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		requireAuthentication := []string{} // add methods that require authentication here
-		endpoint := strings.Split(strings.Split(r.URL.Path, "/api/v")[1], "/")[1]
-
-		for _, authEndpoint := range requireAuthentication {
-			if endpoint == authEndpoint {
-				// make sure an Authorization header was provided
-				appToken := r.Header.Get("Authorization")
+// EnableAuthentication проверяет токен клиента API (заголовок "Authorization: Bearer <token>") и наличие у клиента
+// права scope. Пустой scope - достаточно действительного токена (права проверяются обработчиком). Для WEBSOCKET-запросов
+// токен можно передать в параметре строки "token", т.к. браузеры не позволяют задать заголовки при открытии соединения.
+func (s *ServerApi) EnableAuthentication(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if token == "" && websocket.IsWebSocketUpgrade(r) {
+				token = r.URL.Query().Get("token")
+			}
 
-				if appToken == "" {
-					http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-					return
-				}
+			client, err := s.authenticate(token)
+			if err != nil {
+				sendAuthError(w, http.StatusUnauthorized, err)
+				return
+			}
 
-				/*/
-				 * This is where appToken validation would be done.
-				 * For this boilerplate, we just check and make sure the appToken matches a hardcoded string.
-				/*/
-				appToken = strings.TrimPrefix(appToken, "Bearer ")
-				if appToken != s.appToken {
-					http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-					return
-				}
+			ctx := context.WithValue(r.Context(), apiClientContextKey{}, client)
+			if err = checkScope(ctx, scope); err != nil {
+				sendAuthError(w, http.StatusForbidden, err)
+				return
 			}
-		}
 
-		// assuming that passed, we can execute the authenticated handler
-		next.ServeHTTP(w, r)
-	})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// authenticate возвращает клиента API по токену. $APP_TOKEN - служебный токен со всеми правами, через него выдаются
+// первые токены клиентов.
+func (s *ServerApi) authenticate(token string) (auth.Client, error) {
+	if token != "" && hmac.Equal([]byte(token), []byte(s.appToken)) {
+		return auth.Client{ID: "app", Name: "APP_TOKEN", Scopes: auth.AllScopes()}, nil
+	}
+
+	return s.apiClients.Authenticate(token)
 }
 
 type Handler struct {
@@ -487,27 +1043,54 @@ func NewRouter() (Handler, error) {
 	s := new(ServerApi)
 	port, err := s.Init()
 
+	return Handler{port, s.routes()}, err
+}
+
+func (s *ServerApi) routes() http.Handler {
 	r := chi.NewRouter()
-	r.Use(s.EnableCORSRequests) //, s.EnableAuthentication)
+	r.Use(s.EnableCORSRequests)
+
+	// права, необходимые для вызова API-метода
+	scope := func(apiMethod string) func(http.Handler) http.Handler {
+		return s.EnableAuthentication(apiMethodScopes[apiMethod])
+	}
 
 	// register the API routes
 	// GET requests
 	r.Get("/{unknown}", s.UnknownEndpoint)
-	r.Get("/getUserLK", s.GetUserLK)
-	r.Get("/getUserPoints", s.GetUserPoints)
-	r.Get("/getWebinarReportInfo", s.GetWebinarReportInfo)
-	r.Get("/getCampaignsReportInfo", s.GetCampaignsReportInfo)
+	r.With(scope("getUserLK")).Get("/getUserLK", s.GetUserLK)
+	r.With(scope("getUserPoints")).Get("/getUserPoints", s.GetUserPoints)
+	r.With(scope("getUserPointsHistory")).Get("/getUserPointsHistory", s.GetUserPointsHistory)
+	r.With(scope("getWebinarReportInfo")).Get("/getWebinarReportInfo", s.GetWebinarReportInfo)
+	r.With(scope("getCampaignsReportInfo")).Get("/getCampaignsReportInfo", s.GetCampaignsReportInfo)
+	r.With(scope("downloadWebinarReport")).Get("/downloadWebinarReport", s.DownloadWebinarReport)
+	r.With(scope("downloadCampaignsReport")).Get("/downloadCampaignsReport", s.DownloadCampaignsReport)
+	r.With(scope("getSeriesReportInfo")).Get("/getSeriesReportInfo", s.GetSeriesReportInfo)
+	r.With(s.EnableAuthentication("")).Get("/jobs/{jobID}", s.GetJob)
+	r.Get("/certificates/verify/{serial}", s.VerifyCertificate)
+	r.With(scope("getCertificateTemplates")).Get("/certificates/templates", s.GetCertificateTemplates)
+	r.With(scope("getCertificatesHistory")).Get("/certificates/history", s.GetCertificatesHistory)
+	r.With(s.EnableAuthentication(auth.SCOPE_ADMIN)).Get("/admin/clients", s.GetAPIClients)
 
 	// POST requests
 	r.Post("/{unknown}", s.UnknownEndpoint)
-	r.Post("/facecastLogin", s.FacecastLogin)
-	r.Post("/getDashaMailData", s.GetDashaMailData)
-	r.Post("/createWebinarReport", s.CreateWebinarReport)
-	r.Post("/createCampaignsReport", s.CreateCampaignsReport)
-	r.Post("/sendDataToDashaMail", s.SendDataToDashaMail)
+	r.With(scope("facecastLogin")).Post("/facecastLogin", s.FacecastLogin)
+	r.With(scope("getDashaMailData")).Post("/getDashaMailData", s.GetDashaMailData)
+	r.With(scope("createWebinarReport")).Post("/createWebinarReport", s.CreateWebinarReport)
+	r.With(scope("createCampaignsReport")).Post("/createCampaignsReport", s.CreateCampaignsReport)
+	r.With(scope("createSeriesReport")).Post("/createSeriesReport", s.CreateSeriesReport)
+	r.With(scope("sendDataToDashaMail")).Post("/sendDataToDashaMail", s.SendDataToDashaMail)
+	r.With(scope("previewPoints")).Post("/previewPoints", s.PreviewPoints)
+	r.With(scope("syncPointsLedger")).Post("/syncPointsLedger", s.SyncPointsLedger)
+	r.With(scope("uploadCertificateTemplate")).Post("/certificates/templates", s.UploadCertificateTemplate)
+	r.With(scope("activateCertificateTemplate")).Post("/certificates/templates/{templateID}/activate", s.ActivateCertificateTemplate)
+	r.With(s.EnableAuthentication("")).Post("/jobs", s.SubmitJob)
+	r.With(s.EnableAuthentication("")).Post("/jobs/{jobID}/cancel", s.CancelJob)
+	r.With(s.EnableAuthentication(auth.SCOPE_ADMIN)).Post("/admin/clients", s.IssueAPIClient)
+	r.With(s.EnableAuthentication(auth.SCOPE_ADMIN)).Post("/admin/clients/{clientID}/revoke", s.RevokeAPIClient)
 
 	// WebSocket connections
-	r.HandleFunc("/websocket", s.HandleWebSocketConnections)
+	r.With(s.EnableAuthentication("")).HandleFunc("/websocket", s.HandleWebSocketConnections)
 
-	return Handler{port, r}, err
+	return r
 }
@@ -1,18 +1,26 @@
 package v1
 
 import (
+	"bytes"
+	"context"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"html"
-	"os"
-	"path/filepath"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode"
 
 	"github.com/dchest/siphash"
+	"zo-backend/auth"
+	"zo-backend/eventdate"
+	"zo-backend/jobs"
+	"zo-backend/points"
 	. "zo-backend/server/api"
 )
 
@@ -31,12 +39,430 @@ func getDataValidFormatError(dataValidFormat string) error {
 	return fmt.Errorf("check data valid format (should be %s)", dataValidFormat)
 }
 
-// Добавляет API-ключ и формирует JSON из данных для запроса.
-func (s *ServerApi) getJSONBytes(d DashaMailRequest) []byte {
-	d.APIKey = s.dashaMailAcc.ApiKey
-	jsonData, _ := json.Marshal(d)
+// Права, необходимые для API-методов. Одни и те же права проверяются для REST-запросов, WEBSOCKET-сообщений и фоновых задач.
+var apiMethodScopes = map[string]string{
+	"getUserLK":               auth.SCOPE_PUBLIC_LK,
+	"getUserPoints":           auth.SCOPE_PUBLIC_LK,
+	"getUserPointsHistory":    auth.SCOPE_PUBLIC_LK,
+	"facecastLogin":           auth.SCOPE_PUBLIC_FACECAST,
+	"getWebinarReportInfo":    auth.SCOPE_REPORTS_READ,
+	"getCampaignsReportInfo":  auth.SCOPE_REPORTS_READ,
+	"downloadWebinarReport":   auth.SCOPE_REPORTS_READ,
+	"downloadCampaignsReport": auth.SCOPE_REPORTS_READ,
+	"previewPoints":           auth.SCOPE_REPORTS_READ,
+	"getSeriesReportInfo":     auth.SCOPE_REPORTS_READ,
+	"createWebinarReport":     auth.SCOPE_REPORTS_WRITE,
+	"createCampaignsReport":   auth.SCOPE_REPORTS_WRITE,
+	"createSeriesReport":      auth.SCOPE_REPORTS_WRITE,
+	"getDashaMailData":        auth.SCOPE_DASHAMAIL_READ,
+	"syncPointsLedger":        auth.SCOPE_DASHAMAIL_READ,
+	"getCertificatesInfo":     auth.SCOPE_DASHAMAIL_READ,
+	"sendDataToDashaMail":     auth.SCOPE_DASHAMAIL_WRITE,
+	"createCertificates":      auth.SCOPE_CERTIFICATES_WRITE,
+	"previewCertificate":      auth.SCOPE_CERTIFICATES_WRITE,
+	"reissueCertificates":     auth.SCOPE_CERTIFICATES_WRITE,
+	"revokeCertificates":      auth.SCOPE_CERTIFICATES_WRITE,
+
+	"getCertificateTemplates":     auth.SCOPE_CERTIFICATES_WRITE,
+	"uploadCertificateTemplate":   auth.SCOPE_CERTIFICATES_WRITE,
+	"activateCertificateTemplate": auth.SCOPE_CERTIFICATES_WRITE,
+	"getCertificatesHistory":      auth.SCOPE_CERTIFICATES_WRITE,
+}
+
+// apiMethodRequiredScopes возвращает права, необходимые для вызова API-метода с параметрами data: право из
+// apiMethodScopes и, если метод пишет в книгу DashaMail, право dashamail:write.
+func apiMethodRequiredScopes(apiMethod string, data map[string]interface{}) []string {
+	scopes := []string{apiMethodScopes[apiMethod]}
+
+	switch apiMethod {
+	case "reissueCertificates", "revokeCertificates":
+		scopes = append(scopes, auth.SCOPE_DASHAMAIL_WRITE)
+	case "createCertificates":
+		// ссылки на сертификаты записываются в книгу, только если она передана
+		if bookID, _ := data["bookID"].(string); bookID != "" {
+			scopes = append(scopes, auth.SCOPE_DASHAMAIL_WRITE)
+		}
+	}
+
+	return scopes
+}
+
+type apiClientContextKey struct{}
+
+// checkScope проверяет, что у клиента API из контекста запроса есть все права scopes (пустой scope доступен всем клиентам).
+func checkScope(ctx context.Context, scopes ...string) error {
+	client, ok := ctx.Value(apiClientContextKey{}).(auth.Client)
+	if !ok {
+		return fmt.Errorf("unauthorized: %v", auth.ErrNoToken)
+	}
+
+	for _, scope := range scopes {
+		if scope != "" && !client.HasScope(scope) {
+			return fmt.Errorf("forbidden: API client '%s' has no scope '%s'", client.Name, scope)
+		}
+	}
+
+	return nil
+}
+
+// contextAPIClient возвращает клиента API из контекста запроса (пустого клиента, если запрос без токена).
+func contextAPIClient(ctx context.Context) auth.Client {
+	client, _ := ctx.Value(apiClientContextKey{}).(auth.Client)
+	return client
+}
+
+// sendAuthError отправляет ошибку авторизации с кодом 401 или 403 в том же формате, что и остальные ошибки.
+func sendAuthError(w http.ResponseWriter, status int, err error) {
+	message := err.Error()
+	if status == http.StatusUnauthorized {
+		message = "unauthorized: " + message
+	}
+
+	JsonResponse(w, ErrorMessageServerResponse{Message: message}, status)
+}
+
+// jobScopes возвращает права, необходимые для работы с задачей jobID. Для несуществующей задачи права не нужны:
+// обработчик вернет ошибку поиска задачи.
+func (s *ServerApi) jobScopes(jobID string) []string {
+	job, err := s.jobsManager.Get(jobID)
+	if err != nil {
+		return nil
+	}
+
+	return apiMethodRequiredScopes(job.APIMethod, nil)
+}
+
+// jobData возвращает параметры API-метода из запроса submitJob (поле "data").
+func jobData(request map[string]interface{}) map[string]interface{} {
+	data, _ := validateData(request["data"])
+	return data
+}
+
+// messageScopes возвращает права, необходимые для обработки WEBSOCKET-сообщения.
+func (s *ServerApi) messageScopes(msg WebSocketMessageRequest) []string {
+	data, _ := validateData(msg.Data)
+
+	switch msg.APIMethod {
+	case "submitJob":
+		apiMethod, _ := data["apiMethod"].(string)
+		return apiMethodRequiredScopes(apiMethod, jobData(data))
+	case "subscribeJob", "cancelJob":
+		jobID, _ := data["jobID"].(string)
+		return s.jobScopes(jobID)
+	default:
+		return apiMethodRequiredScopes(msg.APIMethod, data)
+	}
+}
+
+func toStringSlice(value interface{}) ([]string, bool) {
+	values, ok := value.([]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		str, ok := v.(string)
+		if !ok {
+			return nil, false
+		}
+		result = append(result, str)
+	}
+
+	return result, true
+}
+
+// validateWebinarReportRequest проверяет параметры createWebinarReport: либо трансляции (см. webinarEventIDs) и
+// необязательный reportName, либо reportName и строки reportData, подготовленные frontend.
+func validateWebinarReportRequest(data map[string]interface{}) (eventIDs []string, reportName string, reportData []interface{}, err error) {
+	_, withEventID := data["eventID"]
+	_, withEventIDs := data["eventIDs"]
+	if withEventID || withEventIDs {
+		if eventIDs, err = webinarEventIDs(data); err != nil {
+			return nil, "", nil, err
+		}
+		if _, ok := data["reportName"]; ok {
+			if reportName, ok = data["reportName"].(string); !ok {
+				return nil, "", nil, getInvalidFieldError("reportName", "string", data["reportName"])
+			}
+		}
+		return eventIDs, reportName, nil, nil
+	}
+
+	if reportName, ok := data["reportName"].(string); !ok || reportName == "" {
+		return nil, "", nil, getInvalidFieldError("reportName", "string", data["reportName"])
+	} else if reportData, ok := data["reportData"].([]interface{}); !ok || reportData == nil {
+		return nil, "", nil, getInvalidFieldError("reportData", "[]interface{}", data["reportData"])
+	} else {
+		return nil, reportName, reportData, nil
+	}
+}
+
+// webinarEventIDs читает трансляции отчета по вебинару: eventID или, для сводного отчета по залам конференции, eventIDs.
+func webinarEventIDs(data map[string]interface{}) ([]string, error) {
+	if _, ok := data["eventIDs"]; ok {
+		eventIDs, ok := toStringSlice(data["eventIDs"])
+		if !ok {
+			return nil, getInvalidFieldError("eventIDs", "[]string", data["eventIDs"])
+		} else if err := validateEventIDs(eventIDs); err != nil {
+			return nil, err
+		}
+		return eventIDs, nil
+	}
+
+	if eventID, ok := data["eventID"].(string); !ok || eventID == "" {
+		return nil, getInvalidFieldError("eventID", "string", data["eventID"])
+	} else {
+		return []string{eventID}, nil
+	}
+}
+
+// certificatesEventIDs читает необязательные трансляции мероприятия для проверки посещения в getCertificatesInfo
+// (eventID или eventIDs, см. webinarEventIDs). Без трансляций посещение не проверяется.
+func certificatesEventIDs(data map[string]interface{}) ([]string, error) {
+	_, withEventID := data["eventID"]
+	_, withEventIDs := data["eventIDs"]
+	if !withEventID && !withEventIDs {
+		return nil, nil
+	}
+
+	return webinarEventIDs(data)
+}
+
+// certificatesEmails читает пользователей, сертификаты которых отзываются или перевыпускаются: email или emails
+// (без учета регистра, без повторов).
+func certificatesEmails(data map[string]interface{}) ([]string, error) {
+	var emails []string
+	if _, ok := data["emails"]; ok {
+		if emails, ok = toStringSlice(data["emails"]); !ok || len(emails) == 0 {
+			return nil, getInvalidFieldError("emails", "[]string", data["emails"])
+		}
+	} else if email, ok := data["email"].(string); !ok || email == "" {
+		return nil, getInvalidFieldError("email", "string", data["email"])
+	} else {
+		emails = []string{email}
+	}
+
+	seen := make(map[string]bool, len(emails))
+	result := make([]string, 0, len(emails))
+	for _, email := range emails {
+		email = strings.ToLower(strings.TrimSpace(email))
+		if email == "" {
+			return nil, getInvalidFieldError("emails", "[]string of non-empty strings", data["emails"])
+		} else if !seen[email] {
+			seen[email] = true
+			result = append(result, email)
+		}
+	}
+
+	return result, nil
+}
+
+// MAX_REPORT_EVENTS - максимальное число трансляций в отчете по серии или в сводном отчете по залам (каждая трансляция -
+// отдельный отчет по вебинару).
+const MAX_REPORT_EVENTS = 50
+
+// validateEventIDs проверяет список трансляций отчета: непустые неповторяющиеся eventID, не больше MAX_REPORT_EVENTS.
+func validateEventIDs(eventIDs []string) error {
+	if len(eventIDs) == 0 || len(eventIDs) > MAX_REPORT_EVENTS {
+		return fmt.Errorf("report should contain from 1 to %v events (got %v)", MAX_REPORT_EVENTS, len(eventIDs))
+	}
+
+	seen := make(map[string]bool, len(eventIDs))
+	for _, eventID := range eventIDs {
+		if eventID == "" {
+			return getInvalidFieldError("eventIDs", "[]string of non-empty strings", eventIDs)
+		} else if seen[eventID] {
+			return fmt.Errorf("event %s is repeated in the report", eventID)
+		}
+		seen[eventID] = true
+	}
+
+	return nil
+}
+
+// getEventIDs читает список трансляций из параметра запроса eventIDs (коды через запятую).
+func getEventIDs(query url.Values) ([]string, error) {
+	eventIDs := query.Get("eventIDs")
+	if eventIDs == "" {
+		return nil, getInvalidFieldError("eventIDs", "string")
+	}
+
+	ids := strings.Split(eventIDs, ",")
+	if err := validateEventIDs(ids); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// getWebinarEventIDs читает трансляции отчета по вебинару из параметров запроса: eventID или eventIDs (сводный отчет).
+func getWebinarEventIDs(query url.Values) ([]string, error) {
+	if query.Get("eventIDs") != "" {
+		return getEventIDs(query)
+	} else if eventID := query.Get("eventID"); eventID == "" {
+		return nil, getInvalidFieldError("eventID", "string")
+	} else {
+		return []string{eventID}, nil
+	}
+}
+
+// validateSeriesReportRequest проверяет параметры createSeriesReport: список eventIDs и необязательный reportName.
+func validateSeriesReportRequest(data map[string]interface{}) (eventIDs []string, reportName string, err error) {
+	eventIDs, ok := toStringSlice(data["eventIDs"])
+	if !ok {
+		return nil, "", getInvalidFieldError("eventIDs", "[]string", data["eventIDs"])
+	} else if err = validateEventIDs(eventIDs); err != nil {
+		return nil, "", err
+	}
+
+	if _, ok = data["reportName"]; ok {
+		if reportName, ok = data["reportName"].(string); !ok {
+			return nil, "", getInvalidFieldError("reportName", "string", data["reportName"])
+		}
+	}
+
+	return eventIDs, reportName, nil
+}
+
+// pointsPreviewRequest - параметры previewPoints: мероприятие (eventID или videoName с duration) и просмотр зрителя.
+type pointsPreviewRequest struct {
+	eventID        string
+	videoName      string
+	duration       int
+	minutesOnline  int
+	minutesOffline int
+	earnedAt       time.Time
+}
+
+// validatePointsPreviewRequest проверяет параметры previewPoints. Если передан eventID, название видео и продолжительность
+// берутся из Facecast, иначе videoName и duration обязательны. Минуты просмотра по умолчанию равны 0, а дата начисления - текущая.
+func validatePointsPreviewRequest(data map[string]interface{}) (pointsPreviewRequest, error) {
+	var req pointsPreviewRequest
+
+	minutes := func(fieldName string) (int, error) {
+		value, ok := data[fieldName]
+		if !ok {
+			return 0, nil
+		}
+		if m, ok := value.(float64); !ok || m < 0 || m != float64(int(m)) {
+			return 0, getInvalidFieldError(fieldName, "non-negative integer", value)
+		} else {
+			return int(m), nil
+		}
+	}
+
+	if _, ok := data["eventID"]; ok {
+		if req.eventID, ok = data["eventID"].(string); !ok || req.eventID == "" {
+			return req, getInvalidFieldError("eventID", "string", data["eventID"])
+		}
+	} else if videoName, ok := data["videoName"].(string); !ok || videoName == "" {
+		return req, getInvalidFieldError("videoName", "string", data["videoName"])
+	} else if duration, ok := data["duration"].(float64); !ok || duration <= 0 || duration != float64(int(duration)) {
+		return req, getInvalidFieldError("duration", "positive integer", data["duration"])
+	} else {
+		req.videoName = videoName
+		req.duration = int(duration)
+	}
+
+	var err error
+	if req.minutesOnline, err = minutes("minutesViewedOnline"); err != nil {
+		return req, err
+	}
+	if req.minutesOffline, err = minutes("minutesViewedOffline"); err != nil {
+		return req, err
+	}
+
+	req.earnedAt = time.Now()
+	if _, ok := data["date"]; ok {
+		if date, ok := data["date"].(string); !ok {
+			return req, getInvalidFieldError("date", "format string 'YYYY-MM-DD'", data["date"])
+		} else if req.earnedAt, err = time.Parse("2006-01-02", date); err != nil {
+			return req, getInvalidFieldError("date", "format string 'YYYY-MM-DD'", data["date"])
+		}
+	}
+
+	return req, nil
+}
+
+// getCampaignsPeriod читает период отчета по рассылкам: либо оба параметра - непустые строки нужного формата, либо оба - пустые
+// строки. В последнем случае endDate - текущая дата, а startDate - дата за 30 дней до текущей даты.
+func getCampaignsPeriod(query url.Values) (string, string, error) {
+	startDate := query.Get("start_date")
+	endDate := query.Get("end_date")
+
+	if startDate == "" && endDate == "" {
+		now := time.Now().UTC()
+		now = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		endDate = now.Format("2006-01-02")
+		startDate = now.Add(-30 * 24 * time.Hour).Format("2006-01-02")
+	}
+
+	if startDate == "" && endDate != "" {
+		return "", "", getInvalidFieldError("startDate", "string")
+	} else if startDate != "" && endDate == "" {
+		return "", "", getInvalidFieldError("endDate", "string")
+	}
+
+	return startDate, endDate, nil
+}
+
+// sanitizeReportName превращает название отчета, переданное клиентом, в имя файла: символы, недопустимые в именах файлов
+// (в том числе разделители пути), заменяются на "_", поэтому отчет не может быть сохранен за пределами своей папки.
+func sanitizeReportName(reportName string) (string, error) {
+	sanitized := strings.TrimSpace(strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || unicode.IsControl(r) {
+			return '_'
+		}
+		return r
+	}, reportName))
+
+	if strings.Trim(sanitized, ".") == "" {
+		return "", fmt.Errorf("invalid report name '%s'", reportName)
+	}
+
+	return sanitized, nil
+}
+
+// sendReportFile отдает отчет файлом fileName. XLSX сначала собирается в памяти (excelize все равно держит файл в памяти
+// целиком до записи), поэтому ошибку построения можно вернуть клиенту в формате JSON. CSV и NDJSON пишутся в ответ по мере
+// построения, и ошибку записи уже нельзя вернуть клиенту - она только выводится в лог.
+func sendReportFile(w http.ResponseWriter, fileName, format string, tables ...ReportTable) {
+	setHeaders := func() {
+		w.Header().Set("Content-Type", ReportContentType(format))
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName + "." + format}))
+	}
+
+	if format == XLSX_FORMAT {
+		var buf bytes.Buffer
+		if err := WriteReport(&buf, format, tables...); err != nil {
+			err = fmt.Errorf("can't create a report file %s.%s: %+v", fileName, format, err)
+			SendServerResponse(w, nil, &ServerDebug{Error: err})
+			return
+		}
+
+		setHeaders()
+		w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+		if _, err := buf.WriteTo(w); err != nil {
+			fmt.Println(fmt.Errorf("+++++++ CAN'T SEND A REPORT FILE %s.%s: %+v +++++++", fileName, format, err))
+		}
+		return
+	}
+
+	setHeaders()
+	if err := WriteReport(w, format, tables...); err != nil {
+		fmt.Println(fmt.Errorf("+++++++ CAN'T SEND A REPORT FILE %s.%s: %+v +++++++", fileName, format, err))
+	}
+}
 
-	return jsonData
+// checkCancelled возвращает jobs.ErrCancelled, если фоновую задачу, в которой выполняется метод, отменили. Методы
+// проверяют отмену перед каждой группой операций, чтобы не прерывать запись в DashaMail и хранилище на середине.
+func checkCancelled(wsWaiterResp *WebSocketWaiterResponse) error {
+	if wsWaiterResp != nil && wsWaiterResp.Cancelled != nil && wsWaiterResp.Cancelled() {
+		return jobs.ErrCancelled
+	}
+
+	return nil
 }
 
 func waitingForServerValidAnswer(wsWaiter *WebSocketWaiter) {
@@ -45,17 +471,24 @@ func waitingForServerValidAnswer(wsWaiter *WebSocketWaiter) {
 		case <-wsWaiter.Done:
 			return
 		case <-wsWaiter.Ticker.C:
-			SendServerResponse(wsWaiter.Chan, wsWaiter.Response, nil)
+			SendServerResponse(wsWaiter.Chan, WebSocketWaiterResponse{Status: wsWaiter.Response.Status, Message: wsWaiter.Progress.Get()}, nil)
 		}
 	}
 }
 
+// setNewWSWaiterMessage передает сообщение о ходе выполнения через OnMessage. Поле Message напрямую не пишется: его
+// одновременно читал бы тикер WebSocket.
 func setNewWSWaiterMessage(wsWaiterResp *WebSocketWaiterResponse, message string) {
-	if wsWaiterResp != nil {
-		wsWaiterResp.Message = message
+	if wsWaiterResp != nil && wsWaiterResp.OnMessage != nil {
+		wsWaiterResp.OnMessage(message)
 	}
 }
 
+func validateData(msgData interface{}) (map[string]interface{}, bool) {
+	data, ok := msgData.(map[string]interface{})
+	return data, ok
+}
+
 func setServerApiUserFields(userDM map[string]interface{}, titles *map[string]string, debug *ServerDebug) *GetUserServerResponse {
 	debug.SetDebugLastStage("setServerApiUserFields")
 	wg := new(sync.WaitGroup)
@@ -161,79 +594,333 @@ func setStatusExplain(status string) int {
 	}
 }
 
-func getPointZOTimeFrames(pointsType string) (int, string) {
+// getPointZOTimeFrames возвращает текущие год и квартал, за которые считаются баллы ЗО. Для баллов НМО сумма за год и квартал
+// не считается (нулевой год не совпадает ни с одной датой мероприятия).
+func getPointZOTimeFrames(pointsType string) (int, int) {
 	if pointsType == "ZO" {
-		now := time.Now()
-		return getQuarter(now.Month().String()), strconv.Itoa(now.Year())
+		now := time.Now().In(eventdate.Location)
+		return now.Year(), eventdate.QuarterOf(now)
 	} else {
-		return 0, ""
+		return 0, 0
 	}
 }
 
-func getQuarter(month string) int {
-	switch month {
-	case "января", "January", "февраля", "February", "марта", "March":
-		return 1
-	case "апреля", "April", "мая", "May", "июня", "June":
-		return 2
-	case "июля", "July", "августа", "August", "сентября", "September":
-		return 3
-	case "октября", "October", "ноября", "November", "декабря", "December":
-		return 4
-	default:
-		return -1
+// pointsEntry возвращает запись реестра баллов, если у пользователя есть баллы НМО или ЗО за мероприятие книги bookID.
+func pointsEntry(bookID string, info GetUserServerResponse) (points.Entry, bool) {
+	if !correctPoints(info.NMO) && !correctPoints(info.PointsZOView) && !correctPoints(info.PointsZOQuestion) && !correctPoints(info.PointsZOPoll) {
+		return points.Entry{}, false
 	}
+
+	return points.Entry{
+		BookID:           bookID,
+		EventDate:        info.EventDate,
+		EventName:        info.EventName,
+		NMO:              info.NMO,
+		ZET:              info.ZET,
+		Certificate:      info.Certificate,
+		PointsZOView:     info.PointsZOView,
+		PointsZOQuestion: info.PointsZOQuestion,
+		PointsZOPoll:     info.PointsZOPoll,
+	}, true
 }
 
-func correctPoints(points string) bool {
-	if points != "" && points != "0" {
-		return true
-	} else {
-		return false
+// ledgerUserData переводит записи реестра в тот же вид, что и данные книг DashaMail (bookID -> данные пользователя).
+func ledgerUserData(entries []points.Entry) *map[string]GetUserServerResponse {
+	data := make(map[string]GetUserServerResponse, len(entries))
+	for _, entry := range entries {
+		data[entry.BookID] = GetUserServerResponse{
+			EventDate:        entry.EventDate,
+			EventName:        entry.EventName,
+			NMO:              entry.NMO,
+			ZET:              entry.ZET,
+			Certificate:      entry.Certificate,
+			PointsZOView:     entry.PointsZOView,
+			PointsZOQuestion: entry.PointsZOQuestion,
+			PointsZOPoll:     entry.PointsZOPoll,
+		}
 	}
+
+	return &data
+}
+
+// Разбивка истории баллов по периодам
+const (
+	GROUP_BY_YEAR    = "year"
+	GROUP_BY_QUARTER = "quarter"
+	GROUP_BY_MONTH   = "month"
+)
+
+// Максимальное количество периодов разбивки в истории баллов (100 лет по месяцам)
+const MAX_POINTS_HISTORY_PERIODS = 1200
+
+// pointsHistoryPeriod - период истории баллов [start, end) (нулевые границы - без ограничения) и разбивка по периодам.
+type pointsHistoryPeriod struct {
+	start   time.Time
+	end     time.Time
+	groupBy string
 }
 
-func dateInQuarter(date, nowYear string, nowQuarter int) bool {
-	splt := strings.Split(date, " ")
-	if len(splt) > 1 && splt[1] != "" {
-		month := splt[1]
-		if getQuarter(month) == nowQuarter && dateInYear(date, nowYear) {
-			return true
+// getPointsHistoryPeriod читает период истории баллов: год (year), квартал года (year и quarter) или произвольный диапазон
+// дат (start_date и end_date включительно, любая из границ может отсутствовать). Без параметров - вся история.
+func getPointsHistoryPeriod(query url.Values) (pointsHistoryPeriod, error) {
+	period := pointsHistoryPeriod{groupBy: GROUP_BY_YEAR}
+
+	if groupBy := query.Get("groupBy"); groupBy != "" {
+		if groupBy != GROUP_BY_YEAR && groupBy != GROUP_BY_QUARTER && groupBy != GROUP_BY_MONTH {
+			return period, getInvalidFieldError("groupBy", fmt.Sprintf("'%s', '%s' or '%s'", GROUP_BY_YEAR, GROUP_BY_QUARTER, GROUP_BY_MONTH), groupBy)
 		}
+		period.groupBy = groupBy
 	}
 
-	return false
-}
+	yearParam, quarterParam := query.Get("year"), query.Get("quarter")
+	startParam, endParam := query.Get("start_date"), query.Get("end_date")
+
+	switch {
+	case yearParam != "" && (startParam != "" || endParam != ""):
+		return period, fmt.Errorf("'year' can't be used together with 'start_date' and 'end_date'")
+
+	case yearParam != "":
+		year, err := strconv.Atoi(yearParam)
+		if err != nil || year < 1900 {
+			return period, getInvalidFieldError("year", "year like '2024'", yearParam)
+		}
+
+		period.start = time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+		period.end = period.start.AddDate(1, 0, 0)
+
+		if quarterParam != "" {
+			quarter, err := strconv.Atoi(quarterParam)
+			if err != nil || quarter < 1 || quarter > 4 {
+				return period, getInvalidFieldError("quarter", "number from 1 to 4", quarterParam)
+			}
 
-func dateInYear(date string, nowYear string) bool {
-	splt := strings.Split(date, " ")
-	if len(splt) > 2 && splt[2] != "" {
-		year := splt[2]
-		if year == nowYear {
-			return true
+			period.start = period.start.AddDate(0, 3*(quarter-1), 0)
+			period.end = period.start.AddDate(0, 3, 0)
+		}
+
+	case quarterParam != "":
+		return period, getInvalidFieldError("year", "year like '2024' (required with 'quarter')")
+
+	default:
+		var err error
+		if startParam != "" {
+			if period.start, err = time.Parse("2006-01-02", startParam); err != nil {
+				return period, getInvalidFieldError("start_date", "format string 'YYYY-MM-DD'", startParam)
+			}
+		}
+		if endParam != "" {
+			if period.end, err = time.Parse("2006-01-02", endParam); err != nil {
+				return period, getInvalidFieldError("end_date", "format string 'YYYY-MM-DD'", endParam)
+			}
+			period.end = period.end.AddDate(0, 0, 1)
+		}
+		if !period.start.IsZero() && !period.end.IsZero() && !period.start.Before(period.end) {
+			return period, fmt.Errorf("'start_date' must not be after 'end_date'")
+		}
+		if !period.start.IsZero() && !period.end.IsZero() {
+			if err = period.checkBucketsCount(period.start, period.end.AddDate(0, 0, -1)); err != nil {
+				return period, err
+			}
 		}
 	}
 
-	return false
+	return period, nil
 }
 
-func updatePersonalPhrasesDates(webinars *map[string]ServerWebinar) {
-	wg := new(sync.WaitGroup)
-	mu := new(sync.Mutex)
+func (p pointsHistoryPeriod) contains(date time.Time) bool {
+	return (p.start.IsZero() || !date.Before(p.start)) && (p.end.IsZero() || date.Before(p.end))
+}
 
-	wg.Add(len(*webinars))
-	for eventID, webinar := range *webinars {
-		go func(eventID string, webinar ServerWebinar) {
-			defer wg.Done()
+// bucketStart возвращает начало периода разбивки, в который попадает date.
+func (p pointsHistoryPeriod) bucketStart(date time.Time) time.Time {
+	switch p.groupBy {
+	case GROUP_BY_MONTH:
+		return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case GROUP_BY_QUARTER:
+		return time.Date(date.Year(), date.Month()-(date.Month()-1)%3, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(date.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+}
 
-			if time.Now().After(webinar.DeletionDate) {
-				mu.Lock()
-				delete(*webinars, eventID)
-				mu.Unlock()
-			}
-		}(eventID, webinar)
+func (p pointsHistoryPeriod) nextBucket(bucket time.Time) time.Time {
+	switch p.groupBy {
+	case GROUP_BY_MONTH:
+		return bucket.AddDate(0, 1, 0)
+	case GROUP_BY_QUARTER:
+		return bucket.AddDate(0, 3, 0)
+	default:
+		return bucket.AddDate(1, 0, 0)
+	}
+}
+
+// checkBucketsCount проверяет, что от first до last (включительно) не больше MAX_POINTS_HISTORY_PERIODS периодов разбивки.
+func (p pointsHistoryPeriod) checkBucketsCount(first, last time.Time) error {
+	step := 12
+	switch p.groupBy {
+	case GROUP_BY_MONTH:
+		step = 1
+	case GROUP_BY_QUARTER:
+		step = 3
+	}
+
+	bucket := p.bucketStart(first)
+	months := (last.Year()-bucket.Year())*12 + int(last.Month()) - int(bucket.Month())
+	if count := months/step + 1; count > MAX_POINTS_HISTORY_PERIODS {
+		return fmt.Errorf("points history can't contain more than %d periods (%d periods grouped by %s requested), choose a shorter period or a larger 'groupBy'",
+			MAX_POINTS_HISTORY_PERIODS, count, p.groupBy)
+	}
+
+	return nil
+}
+
+func (p pointsHistoryPeriod) bucketName(bucket time.Time) string {
+	switch p.groupBy {
+	case GROUP_BY_MONTH:
+		return bucket.Format("2006-01")
+	case GROUP_BY_QUARTER:
+		return fmt.Sprintf("%d-Q%d", bucket.Year(), (int(bucket.Month())-1)/3+1)
+	default:
+		return strconv.Itoa(bucket.Year())
+	}
+}
+
+func addPointsTotals(t *PointsTotals, other PointsTotals) {
+	t.ZET += other.ZET
+	t.NMOEvents += other.NMOEvents
+	t.ZO += other.ZO
+	t.ZOView += other.ZOView
+	t.ZOQuestion += other.ZOQuestion
+	t.ZOPoll += other.ZOPoll
+}
+
+// buildPointsHistory собирает историю баллов из данных книг ДМ (bookID -> данные пользователя). Тип мероприятия определяется
+// по его названию правилами начисления баллов ЗО, а мероприятия, не подходящие ни под один тип, попадают в тип "Другое".
+func buildPointsHistory(data map[string]GetUserServerResponse, rules points.Rules, period pointsHistoryPeriod) (*GetUserPointsHistoryServerResponse, error) {
+	history := GetUserPointsHistoryServerResponse{
+		GroupBy:    period.groupBy,
+		Periods:    make([]PointsPeriodTotals, 0),
+		EventTypes: make([]PointsEventTypeTotals, 0),
+		Events:     make([]PointsHistoryEvent, 0),
+	}
+
+	type datedEvent struct {
+		date  time.Time
+		event PointsHistoryEvent
+	}
+	events := make([]datedEvent, 0, len(data))
+
+	for _, info := range data {
+		var totals PointsTotals
+		if correctPoints(info.NMO) {
+			totals.NMOEvents = 1
+			totals.ZET, _ = strconv.Atoi(info.ZET)
+		}
+		totals.ZOView, _ = strconv.Atoi(info.PointsZOView)
+		totals.ZOQuestion, _ = strconv.Atoi(info.PointsZOQuestion)
+		totals.ZOPoll, _ = strconv.Atoi(info.PointsZOPoll)
+		totals.ZO = totals.ZOView + totals.ZOQuestion + totals.ZOPoll
+
+		if totals.NMOEvents == 0 && totals.ZO == 0 {
+			continue
+		}
+
+		eventDate, err := eventdate.Parse(info.EventDate)
+		if err != nil {
+			history.UndatedEvents++
+			continue
+		}
+		date := eventDate.Date()
+		if !period.contains(date) {
+			continue
+		}
+
+		eventType := "Другое"
+		if t, ok := rules.EventType(info.EventName); ok {
+			eventType = t.Name
+		}
+
+		events = append(events, datedEvent{date: date, event: PointsHistoryEvent{
+			EventDate:    date.Format("2006-01-02"),
+			EventName:    info.EventName,
+			EventType:    eventType,
+			NMO:          info.NMO,
+			Certificate:  info.Certificate,
+			PointsTotals: totals,
+		}})
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].date.Equal(events[j].date) {
+			return events[i].date.Before(events[j].date)
+		}
+		return events[i].event.EventName < events[j].event.EventName
+	})
+
+	/*/
+	 * Периоды разбивки идут подряд от начала запрошенного периода (или от первого мероприятия, если начало не задано)
+	 * до его конца (или до последнего мероприятия), включая периоды без баллов, чтобы frontend мог строить по ним графики.
+	/*/
+	first, last := period.start, period.end.AddDate(0, 0, -1)
+	if len(events) > 0 {
+		if first.IsZero() {
+			first = events[0].date
+		}
+		if period.end.IsZero() {
+			last = events[len(events)-1].date
+		}
+	}
+	periods := make(map[string]int)
+	if !first.IsZero() && !period.end.IsZero() || len(events) > 0 {
+		// без одной из границ период определяется датами мероприятий, поэтому количество периодов проверяется и здесь
+		if err := period.checkBucketsCount(first, last); err != nil {
+			return nil, err
+		}
+
+		for bucket := period.bucketStart(first); !bucket.After(last); bucket = period.nextBucket(bucket) {
+			periods[period.bucketName(bucket)] = len(history.Periods)
+			history.Periods = append(history.Periods, PointsPeriodTotals{
+				Period:    period.bucketName(bucket),
+				StartDate: bucket.Format("2006-01-02"),
+				EndDate:   period.nextBucket(bucket).AddDate(0, 0, -1).Format("2006-01-02"),
+			})
+		}
+	}
+
+	eventTypes := make(map[string]int)
+	for _, e := range events {
+		addPointsTotals(&history.Total, e.event.PointsTotals)
+		history.Events = append(history.Events, e.event)
+
+		if i, ok := periods[period.bucketName(period.bucketStart(e.date))]; ok {
+			addPointsTotals(&history.Periods[i].PointsTotals, e.event.PointsTotals)
+		}
+
+		i, ok := eventTypes[e.event.EventType]
+		if !ok {
+			i = len(history.EventTypes)
+			eventTypes[e.event.EventType] = i
+			history.EventTypes = append(history.EventTypes, PointsEventTypeTotals{EventType: e.event.EventType})
+		}
+		addPointsTotals(&history.EventTypes[i].PointsTotals, e.event.PointsTotals)
+	}
+
+	if !period.start.IsZero() {
+		history.StartDate = period.start.Format("2006-01-02")
+	}
+	if !period.end.IsZero() {
+		history.EndDate = period.end.AddDate(0, 0, -1).Format("2006-01-02")
+	}
+
+	return &history, nil
+}
+
+func correctPoints(points string) bool {
+	if points != "" && points != "0" {
+		return true
+	} else {
+		return false
 	}
-	wg.Wait()
 }
 
 // Инициализация указателя на структуру ErrChan{}.
@@ -278,6 +965,14 @@ func calcGoNum(goNum *GoNum, errChan *ErrChan) {
 	}
 }
 
+// Сообщение о ходе выполнения группы горутин вида "<action>: 3 done, 7 left" (счетчик читается под блокировкой, т.к.
+// сообщение формируется в горутинах, пока остальные горутины его увеличивают).
+func goNumProgress(goNum *GoNum, action string) string {
+	goNum.Locker.Lock()
+	defer goNum.Locker.Unlock()
+	return fmt.Sprintf("%s: %v done, %v left", action, goNum.Counter, goNum.Num-goNum.Counter)
+}
+
 func initSyncArray() *SyncArray {
 	return &SyncArray{
 		Array: make([]interface{}, 0),
@@ -458,6 +1153,35 @@ func setGeneralCertificatesInfo(certificatesInfo *GetCertificatesInfoServerRespo
 	}
 }
 
+// certificateFileName - имя PDF-файла сертификата пользователя (локально и в хранилище).
+func certificateFileName(email string) string {
+	return fmt.Sprintf("Сертификат НМО для %s.pdf", email)
+}
+
+func newCertificatesRevisionResponse(emails []string) *CertificatesRevisionServerResponse {
+	response := &CertificatesRevisionServerResponse{Users: make(map[string]CertificateRevision, len(emails))}
+	for _, email := range emails {
+		response.Users[email] = CertificateRevision{}
+	}
+
+	return response
+}
+
+// checkCertificatesVerifyURL возвращает ошибку, если не задан адрес проверки сертификатов для QR-кода.
+func (s *ServerApi) checkCertificatesVerifyURL() error {
+	if s.certificatesVerifyURL == "" {
+		return fmt.Errorf("certificates can't be created while $CERTIFICATES_VERIFY_URL is not set (it's the public address of GET /certificates/verify/ for QR codes)")
+	}
+
+	return nil
+}
+
+func setRevisionError(response *CertificatesRevisionServerResponse, email string, err error) {
+	revision := response.Users[email]
+	revision.Error = err.Error()
+	response.Users[email] = revision
+}
+
 func getUserType(info GetUserServerResponse) string {
 	userType := ""
 	if info.NMO != "" && info.Certificate == "" { // добавляем участников с НМО, у которых еще ранее не создан сертификат, или ранее создан с ошибкой => не был добавлен в ДМ
@@ -470,6 +1194,23 @@ func getUserType(info GetUserServerResponse) string {
 	return userType
 }
 
+// attendanceEligibility проверяет посещение мероприятия зрителем email по отчету о вебинаре report. Зрителя нет в отчете -
+// он не смотрел мероприятие. Тип мероприятия сводного отчета по залам, как и для баллов ЗО, определяется по первому залу.
+func attendanceEligibility(report *GetReportServerResponse, email string, rules points.Rules) points.Eligibility {
+	videoName := report.EventInfo.VideoName
+	if len(report.Halls) > 0 {
+		videoName = report.Halls[0].VideoName
+	}
+
+	user := report.UsersInfo[strings.ToLower(email)]
+	return rules.Eligibility(videoName, report.EventInfo.Duration, user.MinutesViewedOnline, user.MinutesViewedOffline, user.Windows, user.AllWindows)
+}
+
+// isNMOCertificate - получает ли пользователь сертификат НМО (у студентов вместо ЗЕТ академические часы).
+func isNMOCertificate(userInfo CertificatePersonalInfo) bool {
+	return userInfo.ZET != ""
+}
+
 func checkUserValidity(info GetUserServerResponse, userType string) string {
 	switch {
 	case info.Name == "":
@@ -524,172 +1265,18 @@ func checkGeneralCertificatesInfo(certificatesInfo *GetCertificatesInfoServerRes
 	return fmt.Errorf("empty %s", emptyParam)
 }
 
-func checkEventDateValidity(eventDate string) (string, string, error) {
-	splt := strings.Split(eventDate, " ")
-	if len(splt) < 3 {
-		return "", "", fmt.Errorf("check event date format (must be like '01 января 1900' OR '01 01 1900' but got %s)", eventDate)
-	}
-
-	_, err := strconv.Atoi(splt[0])
-	if err != nil {
-		return "", "", fmt.Errorf("check event date day: %+v", err)
-	}
-
-	month := checkEventDateMonth(splt[1])
-	if month == "" {
-		return "", "", fmt.Errorf("check event date month: %+v", err)
-	}
-
-	year := splt[2]
-	_, err = strconv.Atoi(year)
-	if err != nil {
-		return "", "", fmt.Errorf("check event date year: %+v", err)
-	}
-
-	return month, year, nil
-}
-
-func checkEventDateMonth(month string) string {
-	switch month {
-	case "января", "01":
-		return "январь"
-	case "февраля", "02":
-		return "февраль"
-	case "марта", "03":
-		return "март"
-	case "апреля", "04":
-		return "апрель"
-	case "мая", "05":
-		return "май"
-	case "июня", "06":
-		return "июнь"
-	case "июля", "07":
-		return "июль"
-	case "августа", "08":
-		return "август"
-	case "сентября", "09":
-		return "сентябрь"
-	case "октября", "10":
-		return "октябрь"
-	case "ноября", "11":
-		return "ноябрь"
-	case "декабря", "12":
-		return "декабрь"
-	default:
-		return ""
-	}
-}
-
-func getDir() (string, error) {
-	wd, err := os.Getwd()
-	wd = strings.Replace(strings.Replace(wd, ":\\", "://", 1), "\\", "/", -1)
-	if err != nil {
-		return "", err
-	}
-
-	return wd, nil
-}
-
-func writePathFile(wd, eventDate string) error {
-	f, err := os.Create(wd + "/__dev__certificates__/.path")
-	if err != nil {
-		return err
-	}
-
-	path := filepath.Join(wd, eventDate)
-	_, err = f.WriteString(fmt.Sprintf("CERTIFICATES_PATH=\"%s\"", path))
-	if err != nil {
-		return err
-	}
-
-	err = f.Close()
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func setDashaMailFieldParam(d *DashaMailRequest, columnName string, columnValue interface{}, titles *map[string]string, debug *ServerDebug) error {
+// Записывает значение столбца columnName в fields под системным названием столбца (merge_1, merge_2, ...).
+func setDashaMailFieldParam(fields map[string]interface{}, columnName string, columnValue interface{}, titles *map[string]string, debug *ServerDebug) error {
 	debug.SetDebugLastStage("setDashaMailFieldParam")
 	if columnValue == "" {
 		return nil
 	}
 
-	switch (*titles)[columnName] {
-	case "merge_1":
-		d.Field1 = columnValue
-	case "merge_2":
-		d.Field2 = columnValue
-	case "merge_3":
-		d.Field3 = columnValue
-	case "merge_4":
-		d.Field4 = columnValue
-	case "merge_5":
-		d.Field5 = columnValue
-	case "merge_6":
-		d.Field6 = columnValue
-	case "merge_7":
-		d.Field7 = columnValue
-	case "merge_8":
-		d.Field8 = columnValue
-	case "merge_9":
-		d.Field9 = columnValue
-	case "merge_10":
-		d.Field10 = columnValue
-	case "merge_11":
-		d.Field11 = columnValue
-	case "merge_12":
-		d.Field12 = columnValue
-	case "merge_13":
-		d.Field13 = columnValue
-	case "merge_14":
-		d.Field14 = columnValue
-	case "merge_15":
-		d.Field15 = columnValue
-	case "merge_16":
-		d.Field16 = columnValue
-	case "merge_17":
-		d.Field17 = columnValue
-	case "merge_18":
-		d.Field18 = columnValue
-	case "merge_19":
-		d.Field19 = columnValue
-	case "merge_20":
-		d.Field20 = columnValue
-	case "merge_21":
-		d.Field21 = columnValue
-	case "merge_22":
-		d.Field22 = columnValue
-	case "merge_23":
-		d.Field23 = columnValue
-	case "merge_24":
-		d.Field24 = columnValue
-	case "merge_25":
-		d.Field25 = columnValue
-	case "merge_26":
-		d.Field26 = columnValue
-	case "merge_27":
-		d.Field27 = columnValue
-	case "merge_28":
-		d.Field28 = columnValue
-	case "merge_29":
-		d.Field29 = columnValue
-	case "merge_30":
-		d.Field30 = columnValue
-	case "merge_31":
-		d.Field31 = columnValue
-	case "merge_32":
-		d.Field32 = columnValue
-	case "merge_33":
-		d.Field33 = columnValue
-	case "merge_34":
-		d.Field34 = columnValue
-	case "merge_35":
-		d.Field35 = columnValue
-	default:
-		return fmt.Errorf("%v: unknown or unnecessary value struct field name %v", columnName, (*titles)[columnName])
+	field := (*titles)[columnName]
+	if !strings.HasPrefix(field, "merge_") {
+		return fmt.Errorf("%v: unknown or unnecessary value struct field name %v", columnName, field)
 	}
+	fields[field] = columnValue
 
 	return nil
 }
@@ -0,0 +1,2466 @@
+package v1
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/gorilla/websocket"
+	excel "github.com/xuri/excelize/v2"
+	"zo-backend/auth"
+	"zo-backend/certificates"
+	"zo-backend/dashamail"
+	"zo-backend/dashamail/dashamailtest"
+	"zo-backend/facecast"
+	"zo-backend/facecast/facecasttest"
+	"zo-backend/jobs"
+	"zo-backend/points"
+	. "zo-backend/server/api"
+	"zo-backend/webinars"
+)
+
+/*/
+ * Интеграционные тесты: веб-сервис работает с локальными заменами DashaMail и Facecast (dashamailtest, facecasttest),
+ * данные которых загружаются из testdata. Запросы отправляются так же, как их отправляет frontend: через REST и WebSocket.
+/*/
+
+const (
+	testDashaMailApiKey  = "dashamail-test-key"
+	testFacecastUID      = "facecast-test-uid"
+	testFacecastSecret   = "facecast-test-secret-0123456789"
+	testEventID          = "EVT1"
+	testWebinarBookID    = "90001"
+	testAppToken         = "app-test-token"
+	testWebSocketTimeout = 30 * time.Second
+)
+
+type testEnv struct {
+	s         *ServerApi
+	api       *httptest.Server
+	dashaMail *dashamailtest.Server
+	facecast  *facecasttest.Server
+
+	// token - токен клиента API со всеми правами, кроме admin; его отправляют getJSON, postJSON и callWebSocket
+	token string
+}
+
+// newTestEnv запускает веб-сервис и замены DashaMail и Facecast. Функция prepare (если не nil) может изменить данные
+// из testdata перед запуском замен.
+func newTestEnv(t *testing.T, prepare func(dm *dashamailtest.Fixture, fc *facecasttest.Fixture)) *testEnv {
+	t.Helper()
+
+	dmFixture, err := dashamailtest.LoadFixture("testdata/dashamail.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fcFixture, err := facecasttest.LoadFixture("testdata/facecast.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if prepare != nil {
+		prepare(dmFixture, fcFixture)
+	}
+
+	env := &testEnv{
+		dashaMail: dashamailtest.NewServer(testDashaMailApiKey, dmFixture),
+		facecast:  facecasttest.NewServer(testFacecastUID, testFacecastSecret, fcFixture),
+	}
+	t.Cleanup(env.dashaMail.Close)
+	t.Cleanup(env.facecast.Close)
+
+	t.Setenv("DASHAMAIL_URI", env.dashaMail.URL)
+	t.Setenv("FACECAST_URI", env.facecast.URL)
+	t.Setenv("CERTIFICATE_RENDERER", "")
+	t.Setenv("JOBS_DIR", t.TempDir())
+	t.Setenv("JOBS_WORKERS", "1")
+	t.Setenv("STORAGE_BACKEND", "local")
+	t.Setenv("STORAGE_LOCAL_DIR", t.TempDir())
+	t.Setenv("WEBINARS_FILE", filepath.Join(t.TempDir(), "webinars.json"))
+	t.Setenv("AUTH_CLIENTS_FILE", filepath.Join(t.TempDir(), "clients.json"))
+	t.Setenv("POINTS_RULES_FILE", filepath.Join(t.TempDir(), "points_rules.json"))
+	t.Setenv("POINTS_RULES_RELOAD_INTERVAL", "10ms")
+	t.Setenv("POINTS_LEDGER_FILE", filepath.Join(t.TempDir(), "points_ledger.json"))
+	t.Setenv("POINTS_LEDGER_SYNC_INTERVAL", "0")
+	t.Setenv("CERTIFICATES_REGISTRY_FILE", filepath.Join(t.TempDir(), "certificates_registry.json"))
+	t.Setenv("CERTIFICATES_VERIFY_URL", "https://zo.example.com/api/v1/certificates/verify/")
+	t.Setenv("CERTIFICATE_TEMPLATES_DIR", filepath.Join(t.TempDir(), "certificate_templates"))
+
+	// Init не используется, т.к. он читает .env и проверяет $APP_TOKEN
+	env.s = new(ServerApi)
+	env.s.appToken = testAppToken
+	env.s.dashaMailAcc.ApiKey = testDashaMailApiKey
+	env.s.facecastAcc.ApiKey = testFacecastUID
+	env.s.facecastAcc.ApiSecret = testFacecastSecret
+	if err = env.s.initServices(); err != nil {
+		t.Fatal(err)
+	}
+
+	var scopes []string
+	for _, scope := range auth.AllScopes() {
+		if scope != auth.SCOPE_ADMIN {
+			scopes = append(scopes, scope)
+		}
+	}
+	if _, env.token, err = env.s.apiClients.Issue("frontend", scopes); err != nil {
+		t.Fatal(err)
+	}
+
+	// так же, как в server.NewRouter: SendServerResponse пишет REST-ответы только через middleware.Compress
+	router := chi.NewRouter()
+	router.Use(middleware.Compress(5, "gzip"))
+	router.Mount("/api/v1/", env.s.routes())
+
+	env.api = httptest.NewServer(router)
+	t.Cleanup(env.api.Close)
+
+	return env
+}
+
+// getJSON и postJSON возвращают HTTP-статус ответа и декодируют тело ответа в result.
+func (env *testEnv) getJSON(t *testing.T, endpoint string, query url.Values, result interface{}) int {
+	t.Helper()
+
+	return env.request(t, http.MethodGet, endpoint+"?"+query.Encode(), nil, result)
+}
+
+func (env *testEnv) postJSON(t *testing.T, endpoint string, body interface{}, result interface{}) int {
+	t.Helper()
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return env.request(t, http.MethodPost, endpoint, bytes.NewReader(data), result)
+}
+
+func (env *testEnv) request(t *testing.T, method, endpoint string, body io.Reader, result interface{}) int {
+	t.Helper()
+
+	req, err := http.NewRequest(method, env.api.URL+"/api/v1/"+endpoint, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if env.token != "" {
+		req.Header.Set("Authorization", "Bearer "+env.token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	decodeResponse(t, resp, result)
+	return resp.StatusCode
+}
+
+func decodeResponse(t *testing.T, resp *http.Response, result interface{}) {
+	t.Helper()
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		t.Fatalf("can't decode response with status %s: %+v", resp.Status, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ErrorMessageServerResponse
+		_ = json.Unmarshal(raw, &errResp)
+		t.Logf("server responded with %s: %s", resp.Status, errResp.Message)
+		if result, ok := result.(*ErrorMessageServerResponse); ok {
+			*result = errResp
+		}
+		return
+	}
+
+	if result != nil {
+		if err := json.Unmarshal(raw, result); err != nil {
+			t.Fatalf("can't decode response %s: %+v", raw, err)
+		}
+	}
+}
+
+// callWebSocket отправляет сообщение через WebSocket и пропускает промежуточные сообщения о ходе выполнения.
+// Возвращает false, если сервер ответил ошибкой (текст ошибки - в errResp).
+func (env *testEnv) callWebSocket(t *testing.T, apiMethod string, data interface{}, result interface{}) (ok bool, errResp ErrorMessageServerResponse) {
+	t.Helper()
+
+	// токен передается в строке запроса, как это делает браузер
+	wsURL := "ws" + strings.TrimPrefix(env.api.URL, "http") + "/api/v1/websocket?" + url.Values{"token": {env.token}}.Encode()
+	ws, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err == websocket.ErrBadHandshake {
+		defer resp.Body.Close()
+		decodeResponse(t, resp, &errResp)
+		return false, errResp
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	err = ws.WriteJSON(WebSocketMessageRequest{APIMethod: apiMethod, Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = ws.SetReadDeadline(time.Now().Add(testWebSocketTimeout))
+	for {
+		var raw json.RawMessage
+		if err = ws.ReadJSON(&raw); err != nil {
+			t.Fatalf("reading WebSocket error: %+v", err)
+		}
+
+		var waiter WebSocketWaiterResponse
+		if json.Unmarshal(raw, &waiter) == nil && waiter.Status == "processing" {
+			continue
+		}
+
+		// ни один из успешных ответов проверяемых методов не содержит поля message на верхнем уровне
+		if json.Unmarshal(raw, &errResp) == nil && errResp.Message != "" {
+			return false, errResp
+		}
+
+		if result != nil {
+			if err = json.Unmarshal(raw, result); err != nil {
+				t.Fatalf("can't decode WebSocket response %s: %+v", raw, err)
+			}
+		}
+		return true, ErrorMessageServerResponse{}
+	}
+}
+
+func TestGetUserLK(t *testing.T) {
+	env := newTestEnv(t, nil)
+
+	var user GetUserServerResponse
+	status := env.getJSON(t, "getUserLK", url.Values{"email": {"ivanov@example.com"}}, &user)
+	if status != http.StatusOK {
+		t.Fatalf("status %v, want %v", status, http.StatusOK)
+	}
+
+	want := GetUserServerResponse{
+		Status:         1,
+		StatusExplain:  "active",
+		Name:           "Иванов Иван Иванович",
+		Phone:          "+79990000001",
+		City:           "Москва",
+		Specialization: "Кардиология",
+		Position:       "Врач",
+	}
+	if user != want {
+		t.Errorf("user %+v, want %+v", user, want)
+	}
+
+	var errResp ErrorMessageServerResponse
+	status = env.getJSON(t, "getUserLK", url.Values{"email": {"nobody@example.com"}}, &errResp)
+	if status != http.StatusBadRequest || !strings.Contains(errResp.Message, "DashaMail") {
+		t.Errorf("unknown email: status %v, message %q", status, errResp.Message)
+	}
+
+	status = env.getJSON(t, "getUserLK", nil, &errResp)
+	if status != http.StatusBadRequest || !strings.Contains(errResp.Message, "email") {
+		t.Errorf("no email: status %v, message %q", status, errResp.Message)
+	}
+}
+
+func TestGetUserPoints(t *testing.T) {
+	t.Run("NMO", func(t *testing.T) {
+		env := newTestEnv(t, nil)
+
+		var points GetUserPointsServerResponse
+		status := env.getJSON(t, "getUserPoints", url.Values{"email": {"ivanov@example.com"}, "type": {"NMO"}}, &points)
+		if status != http.StatusOK {
+			t.Fatalf("status %v, want %v", status, http.StatusOK)
+		}
+
+		want := []UserPointsInfo{{
+			EventDate:   "15 марта 2024",
+			EventName:   "Вебинар НМО",
+			NMO:         "NMO-2024-0315",
+			ZET:         "2",
+			Certificate: "https://example.com/certificates/ivanov.pdf",
+		}}
+		if len(points.UserPointsInfo) != 1 || points.UserPointsInfo[0] != want[0] {
+			t.Errorf("points info %+v, want %+v", points.UserPointsInfo, want)
+		}
+	})
+
+	t.Run("ZO", func(t *testing.T) {
+		// баллы ЗО считаются только за мероприятия текущего квартала
+		now := time.Now()
+		eventDate := "1 " + now.Month().String() + " " + strconv.Itoa(now.Year())
+
+		env := newTestEnv(t, func(dm *dashamailtest.Fixture, fc *facecasttest.Fixture) {
+			for _, list := range dm.Lists {
+				if list.ID == testWebinarBookID {
+					list.Members[0]["merge_3"] = eventDate
+				}
+			}
+		})
+
+		var points GetUserPointsServerResponse
+		status := env.getJSON(t, "getUserPoints", url.Values{"email": {"ivanov@example.com"}, "type": {"ZO"}}, &points)
+		if status != http.StatusOK {
+			t.Fatalf("status %v, want %v", status, http.StatusOK)
+		}
+
+		if points.YearPoints != 12 || points.QuarterPoints != 12 || len(points.UserPointsInfo) != 1 {
+			t.Errorf("points %+v, want 12 year and quarter points for one event", points)
+		}
+	})
+
+	t.Run("unknown type", func(t *testing.T) {
+		env := newTestEnv(t, nil)
+
+		var errResp ErrorMessageServerResponse
+		status := env.getJSON(t, "getUserPoints", url.Values{"email": {"ivanov@example.com"}, "type": {"XX"}}, &errResp)
+		if status != http.StatusBadRequest || !strings.Contains(errResp.Message, "unknown pointsType") {
+			t.Errorf("status %v, message %q", status, errResp.Message)
+		}
+	})
+}
+
+func checkWebinarReport(t *testing.T, report GetReportServerResponse) {
+	t.Helper()
+
+	if report.ReportName != "Отчёт 15.03.2024 10.00" {
+		t.Errorf("report name %q", report.ReportName)
+	}
+
+	if report.EventInfo.VideoName != "Вебинар" || report.EventInfo.Duration != 10 || report.EventInfo.ViewersTotal != 2 {
+		t.Errorf("event info %+v", report.EventInfo)
+	}
+
+	// модераторы с адресами congresscentr.com в отчет не попадают
+	if len(report.UsersInfo) != 2 {
+		t.Fatalf("users %+v, want ivanov and petrova", report.UsersInfo)
+	}
+
+	ivanov := report.UsersInfo["ivanov@example.com"]
+	if ivanov.MinutesViewedOnline != 6 || ivanov.FirstMinuteOnline != 1 || ivanov.LastMinuteOnline != 6 ||
+		ivanov.AllWindows != 2 || ivanov.Windows != 1 || ivanov.ViewRegime != "прямой эфир" || ivanov.PointsZOView != 12 ||
+		ivanov.City != "Москва" || ivanov.Specialization != "Кардиология" {
+		t.Errorf("ivanov %+v", ivanov)
+	}
+
+	petrova := report.UsersInfo["petrova@example.com"]
+	if petrova.MinutesViewedOffline != 2 || petrova.FirstMinuteOffline != 4 || petrova.LastMinuteOffline != 5 ||
+		petrova.AllWindows != 1 || petrova.Windows != 1 || petrova.ViewRegime != "запись" || petrova.PointsZOView != 4 ||
+		petrova.City != "Казань" {
+		t.Errorf("petrova %+v", petrova)
+	}
+}
+
+func TestGetWebinarReportInfo(t *testing.T) {
+	env := newTestEnv(t, nil)
+
+	t.Run("REST", func(t *testing.T) {
+		var report GetReportServerResponse
+		status := env.getJSON(t, "getWebinarReportInfo", url.Values{"eventID": {testEventID}}, &report)
+		if status != http.StatusOK {
+			t.Fatalf("status %v, want %v", status, http.StatusOK)
+		}
+		checkWebinarReport(t, report)
+	})
+
+	t.Run("WebSocket", func(t *testing.T) {
+		var report GetReportServerResponse
+		ok, errResp := env.callWebSocket(t, "getWebinarReportInfo", map[string]interface{}{"eventID": testEventID}, &report)
+		if !ok {
+			t.Fatalf("error response: %s", errResp.Message)
+		}
+		checkWebinarReport(t, report)
+	})
+
+	t.Run("unknown event", func(t *testing.T) {
+		var errResp ErrorMessageServerResponse
+		status := env.getJSON(t, "getWebinarReportInfo", url.Values{"eventID": {"EVT404"}}, &errResp)
+		if status != http.StatusBadRequest || !strings.Contains(errResp.Message, "event EVT404 not found") {
+			t.Errorf("status %v, message %q", status, errResp.Message)
+		}
+	})
+}
+
+func checkCampaignsReport(t *testing.T, report []CampaignReport) {
+	t.Helper()
+
+	// в отчет попадают только отправленные рассылки за период, более поздние - первыми
+	if len(report) != 3 {
+		t.Fatalf("report %+v, want campaigns 502, 501 and 505", report)
+	}
+
+	if report[0].Name != "Запись вебинара" || report[0].Sent != 900 || report[0].ContentUTM != "record" {
+		t.Errorf("first campaign %+v", report[0])
+	}
+
+	if report[1].Name != `Анонс вебинара "Кардиология"` || report[1].Sent != 1200 || report[1].UniqueClicked != 110 ||
+		report[1].Date != "2024-03-05 10:00:00" {
+		t.Errorf("second campaign %+v", report[1])
+	}
+
+	// переходы по ссылкам - из reports.clickstat; у рассылки без переходов ссылок нет
+	if len(report[1].Links) != 2 || report[1].Links[1].Link != "https://zo.example.com/webinar?a=1&b=2" || report[1].Links[1].UniqueClicks != 90 {
+		t.Errorf("second campaign links %+v", report[1].Links)
+	}
+	if report[2].Name != "Напоминание о вебинаре" || len(report[2].Links) != 0 {
+		t.Errorf("third campaign %+v", report[2])
+	}
+}
+
+func TestGetCampaignsReportInfo(t *testing.T) {
+	env := newTestEnv(t, nil)
+
+	t.Run("REST", func(t *testing.T) {
+		var report []CampaignReport
+		query := url.Values{"start_date": {"2024-03-01"}, "end_date": {"2024-03-31"}}
+		status := env.getJSON(t, "getCampaignsReportInfo", query, &report)
+		if status != http.StatusOK {
+			t.Fatalf("status %v, want %v", status, http.StatusOK)
+		}
+		checkCampaignsReport(t, report)
+	})
+
+	t.Run("WebSocket", func(t *testing.T) {
+		var report []CampaignReport
+		data := map[string]interface{}{"start_date": "2024-03-01", "end_date": "2024-03-31"}
+		ok, errResp := env.callWebSocket(t, "getCampaignsReportInfo", data, &report)
+		if !ok {
+			t.Fatalf("error response: %s", errResp.Message)
+		}
+		checkCampaignsReport(t, report)
+	})
+
+	t.Run("invalid date", func(t *testing.T) {
+		var errResp ErrorMessageServerResponse
+		query := url.Values{"start_date": {"01.03.2024"}, "end_date": {"2024-03-31"}}
+		status := env.getJSON(t, "getCampaignsReportInfo", query, &errResp)
+		if status != http.StatusBadRequest || !strings.Contains(errResp.Message, "startDate format") {
+			t.Errorf("status %v, message %q", status, errResp.Message)
+		}
+	})
+}
+
+func TestFacecastLogin(t *testing.T) {
+	env := newTestEnv(t, nil)
+
+	login := func(email, name string) FacecastLoginServerResponse {
+		t.Helper()
+
+		var resp FacecastLoginServerResponse
+		body := map[string]interface{}{"eventID": testEventID, "email": email, "name": name}
+		if status := env.postJSON(t, "facecastLogin", body, &resp); status != http.StatusOK {
+			t.Fatalf("login of %s: status %v", email, status)
+		}
+		return resp
+	}
+
+	// у зарегистрированного зрителя уже есть ключ
+	if resp := login("ivanov@example.com", "Иванов Иван Иванович"); resp.Key != "key-ivanov" {
+		t.Errorf("key %q, want key-ivanov", resp.Key)
+	}
+
+	var phrasesResp map[string]string
+	body := map[string]interface{}{"eventID": testEventID, "personalPhrases": "Добро пожаловать!"}
+	if status := env.postJSON(t, "facecastLogin", body, &phrasesResp); status != http.StatusOK {
+		t.Fatalf("personal phrases: status %v", status)
+	}
+
+	// новому зрителю ключ создается в Facecast
+	resp := login("sidorov@example.com", "Сидоров Петр")
+	wantKey := env.s.generateKey("sidorov@example.com")
+	if resp.Key != wantKey || resp.PersonalPhrases != "Добро пожаловать!" {
+		t.Errorf("response %+v, want key %s and personal phrases", resp, wantKey)
+	}
+
+	keysBefore := len(env.facecast.Keys(testEventID))
+	if resp = login("sidorov@example.com", "Сидоров Петр"); resp.Key != wantKey {
+		t.Errorf("repeated login: key %q, want %q", resp.Key, wantKey)
+	}
+	if keysAfter := len(env.facecast.Keys(testEventID)); keysAfter != keysBefore {
+		t.Errorf("repeated login inserted a new key: %v keys, want %v", keysAfter, keysBefore)
+	}
+
+	found := false
+	for _, key := range env.facecast.Keys(testEventID) {
+		found = found || key.Key == wantKey
+	}
+	if !found {
+		t.Errorf("key %s was not inserted into Facecast", wantKey)
+	}
+
+	// после перезапуска сервера зрители и персональные фразы читаются из файла
+	restored, err := webinars.NewFileStore(os.Getenv("WEBINARS_FILE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	webinar, ok := restored.Get(testEventID)
+	if !ok || webinar.PersonalPhrases != "Добро пожаловать!" {
+		t.Fatalf("restored webinar %+v", webinar)
+	}
+	if user, ok := webinar.Users.Find("sidorov@example.com"); !ok || user.Key != wantKey || user.WayToAdd != "manual" {
+		t.Errorf("restored user %+v, want manual user with key %s", user, wantKey)
+	}
+}
+
+func TestSendDataToDashaMail(t *testing.T) {
+	env := newTestEnv(t, nil)
+
+	t.Run("REST", func(t *testing.T) {
+		body := map[string]interface{}{
+			"bookID": testWebinarBookID,
+			"infoDM": map[string]interface{}{
+				"sidorov@example.com": map[string]interface{}{
+					"name":              "Сидоров Петр",
+					"eventName":         "Вебинар НМО",
+					"eventDate":         "15 марта 2024",
+					"окон_показано":     3,
+					"окон_подтверждено": 2,
+					"режим_просмотра":   "прямой эфир",
+				},
+			},
+		}
+		if status := env.postJSON(t, "sendDataToDashaMail", body, nil); status != http.StatusOK {
+			t.Fatalf("status %v, want %v", status, http.StatusOK)
+		}
+
+		member := env.dashaMail.Member(testWebinarBookID, "sidorov@example.com")
+		want := map[string]string{
+			"merge_1":  "Сидоров Петр",
+			"merge_2":  "Вебинар НМО",
+			"merge_3":  "15 марта 2024",
+			"merge_8":  "3",
+			"merge_9":  "2",
+			"merge_10": "прямой эфир",
+		}
+		for field, value := range want {
+			if member[field] != value {
+				t.Errorf("%s = %v, want %q (member %+v)", field, member[field], value, member)
+			}
+		}
+	})
+
+	t.Run("WebSocket", func(t *testing.T) {
+		link := "https://example.com/certificates/ivanov-2.pdf"
+		data := map[string]interface{}{
+			"bookID": testWebinarBookID,
+			"infoDM": map[string]interface{}{
+				"ivanov@example.com": map[string]interface{}{"link": link},
+			},
+		}
+		ok, errResp := env.callWebSocket(t, "sendDataToDashaMail", data, nil)
+		if !ok {
+			t.Fatalf("error response: %s", errResp.Message)
+		}
+
+		member := env.dashaMail.Member(testWebinarBookID, "ivanov@example.com")
+		if member["merge_6"] != link || member["merge_4"] != "NMO-2024-0315" {
+			t.Errorf("member %+v, want updated certificate link and untouched NMO code", member)
+		}
+	})
+
+	t.Run("unknown book", func(t *testing.T) {
+		var errResp ErrorMessageServerResponse
+		body := map[string]interface{}{
+			"bookID": "404",
+			"infoDM": map[string]interface{}{"ivanov@example.com": map[string]interface{}{"link": "x"}},
+		}
+		status := env.postJSON(t, "sendDataToDashaMail", body, &errResp)
+		if status != http.StatusBadRequest || !strings.Contains(errResp.Message, "DashaMail") {
+			t.Errorf("status %v, message %q", status, errResp.Message)
+		}
+	})
+}
+
+func TestAuthorization(t *testing.T) {
+	env := newTestEnv(t, nil)
+	frontendToken := env.token
+	lkQuery := url.Values{"email": {"ivanov@example.com"}}
+
+	t.Run("no token", func(t *testing.T) {
+		env.token = ""
+		defer func() { env.token = frontendToken }()
+
+		var errResp ErrorMessageServerResponse
+		if status := env.getJSON(t, "getUserLK", lkQuery, &errResp); status != http.StatusUnauthorized || errResp.Message == "" {
+			t.Errorf("REST: status %v, message %q", status, errResp.Message)
+		}
+
+		ok, errResp := env.callWebSocket(t, "getWebinarReportInfo", map[string]interface{}{"eventID": testEventID}, nil)
+		if ok || !strings.Contains(errResp.Message, "unauthorized") {
+			t.Errorf("WebSocket upgrade: ok %v, message %q", ok, errResp.Message)
+		}
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		env.token = frontendToken + "x"
+		defer func() { env.token = frontendToken }()
+
+		if status := env.getJSON(t, "getUserLK", lkQuery, nil); status != http.StatusUnauthorized {
+			t.Errorf("status %v, want %v", status, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("admin API requires admin scope", func(t *testing.T) {
+		var errResp ErrorMessageServerResponse
+		if status := env.getJSON(t, "admin/clients", nil, &errResp); status != http.StatusForbidden || !strings.Contains(errResp.Message, "admin") {
+			t.Errorf("status %v, message %q", status, errResp.Message)
+		}
+	})
+
+	// клиент сайта получает токен через admin API только с правом public:lk
+	env.token = testAppToken
+	var issued IssuedAPIClientServerResponse
+	body := map[string]interface{}{"name": "tilda", "scopes": []string{auth.SCOPE_PUBLIC_LK}}
+	if status := env.postJSON(t, "admin/clients", body, &issued); status != http.StatusOK || issued.Token == "" {
+		t.Fatalf("issuing token: status %v, response %+v", status, issued)
+	}
+
+	var errResp ErrorMessageServerResponse
+	body = map[string]interface{}{"name": "tilda", "scopes": []string{"everything"}}
+	if status := env.postJSON(t, "admin/clients", body, &errResp); status != http.StatusBadRequest || !strings.Contains(errResp.Message, "unknown scope") {
+		t.Errorf("unknown scope: status %v, message %q", status, errResp.Message)
+	}
+
+	env.token = issued.Token
+	t.Run("scoped token", func(t *testing.T) {
+		if status := env.getJSON(t, "getUserLK", lkQuery, nil); status != http.StatusOK {
+			t.Errorf("getUserLK: status %v, want %v", status, http.StatusOK)
+		}
+
+		var errResp ErrorMessageServerResponse
+		body := map[string]interface{}{
+			"bookID": testWebinarBookID,
+			"infoDM": map[string]interface{}{"ivanov@example.com": map[string]interface{}{"link": "x"}},
+		}
+		status := env.postJSON(t, "sendDataToDashaMail", body, &errResp)
+		if status != http.StatusForbidden || !strings.Contains(errResp.Message, auth.SCOPE_DASHAMAIL_WRITE) {
+			t.Errorf("sendDataToDashaMail: status %v, message %q", status, errResp.Message)
+		}
+		if member := env.dashaMail.Member(testWebinarBookID, "ivanov@example.com"); member["merge_6"] == "x" {
+			t.Errorf("forbidden request changed member %+v", member)
+		}
+
+		status = env.postJSON(t, "jobs", map[string]interface{}{"apiMethod": "createCertificates", "data": nil}, &errResp)
+		if status != http.StatusForbidden {
+			t.Errorf("submitJob: status %v, want %v", status, http.StatusForbidden)
+		}
+
+		ok, wsErr := env.callWebSocket(t, "getWebinarReportInfo", map[string]interface{}{"eventID": testEventID}, nil)
+		if ok || !strings.Contains(wsErr.Message, auth.SCOPE_REPORTS_READ) {
+			t.Errorf("WebSocket: ok %v, message %q", ok, wsErr.Message)
+		}
+	})
+
+	// токены переживают перезапуск сервера
+	restored, err := auth.NewStore(os.Getenv("AUTH_CLIENTS_FILE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client, err := restored.Authenticate(issued.Token); err != nil || client.Name != "tilda" {
+		t.Errorf("restored client %+v, error %v", client, err)
+	}
+
+	env.token = testAppToken
+	var clients []auth.Client
+	if status := env.getJSON(t, "admin/clients", nil, &clients); status != http.StatusOK || len(clients) != 2 {
+		t.Errorf("clients list: status %v, clients %+v", status, clients)
+	}
+
+	var revoked auth.Client
+	if status := env.postJSON(t, "admin/clients/"+issued.ID+"/revoke", nil, &revoked); status != http.StatusOK || revoked.RevokedAt == nil {
+		t.Fatalf("revoking token: status %v, client %+v", status, revoked)
+	}
+
+	env.token = issued.Token
+	if status := env.getJSON(t, "getUserLK", lkQuery, &errResp); status != http.StatusUnauthorized || !strings.Contains(errResp.Message, "revoked") {
+		t.Errorf("revoked token: status %v, message %q", status, errResp.Message)
+	}
+}
+
+func TestCreateWebinarReport(t *testing.T) {
+	env := newTestEnv(t, nil)
+
+	if status := env.postJSON(t, "createWebinarReport", map[string]interface{}{"eventID": testEventID}, nil); status != http.StatusOK {
+		t.Fatalf("status %v, want %v", status, http.StatusOK)
+	}
+
+	reports := storedFiles(t, ".xlsx")
+	if len(reports) != 1 || !strings.Contains(reports[0], filepath.Join("2024", "март", "Отчёт 15.03.2024 10.00.xlsx")) {
+		t.Fatalf("reports in the store: %v", reports)
+	}
+
+	f, rows := openReport(t, reports[0])
+
+	// шапка мероприятия, заголовок зрителей и два зрителя (модератор исключается), упорядоченные по email
+	if len(rows) != 5 {
+		t.Fatalf("%v rows, want 5: %v", len(rows), rows)
+	}
+	if rows[1][0] != testEventID || rows[1][6] != "10" {
+		t.Errorf("event row %v, want eventID and duration 10", rows[1])
+	}
+	if rows[3][1] != "ivanov@example.com" || rows[3][10] != "1, 2, 3, 4, 5, 6" || rows[3][21] != "прямой эфир" {
+		t.Errorf("ivanov row %v", rows[3])
+	}
+	if rows[4][1] != "petrova@example.com" || rows[4][14] != "4, 5" || rows[4][21] != "запись" {
+		t.Errorf("petrova row %v", rows[4])
+	}
+
+	if f.GetSheetIndex("Графики") == -1 {
+		t.Errorf("no charts sheet in %v", f.GetSheetList())
+	}
+}
+
+func TestCreateCampaignsReport(t *testing.T) {
+	env := newTestEnv(t, nil)
+
+	// рассылки из getCampaignsReportInfo передаются как есть, столбцы отчета задает CampaignsSchema
+	var campaigns []map[string]interface{}
+	query := url.Values{"start_date": {"2024-03-01"}, "end_date": {"2024-03-31"}}
+	if status := env.getJSON(t, "getCampaignsReportInfo", query, &campaigns); status != http.StatusOK || len(campaigns) == 0 {
+		t.Fatalf("status %v, campaigns %v", status, campaigns)
+	}
+
+	body := map[string]interface{}{"reportName": "Рассылки март", "reportData": campaigns}
+	if status := env.postJSON(t, "createCampaignsReport", body, nil); status != http.StatusOK {
+		t.Fatalf("status %v, want %v", status, http.StatusOK)
+	}
+
+	reports := storedFiles(t, ".xlsx")
+	if len(reports) != 1 || filepath.Base(reports[0]) != "Рассылки март.xlsx" {
+		t.Fatalf("reports in the store: %v", reports)
+	}
+
+	f, rows := openReport(t, reports[0])
+	if len(rows) != len(campaigns)+1 {
+		t.Fatalf("%v rows, want %v: %v", len(rows), len(campaigns)+1, rows)
+	}
+	for i, header := range CampaignsSchema.Headers() {
+		if rows[0][i] != header {
+			t.Errorf("column %v header %q, want %q", i, rows[0][i], header)
+		}
+	}
+
+	// доли записываются числами с процентным форматом
+	cell, err := excel.CoordinatesToCellName(CampaignsSchema.Index("openRate")+1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := f.GetCellValue("Отчёт", cell); value != "0.311111111111111" {
+		t.Errorf("open rate cell %s value %q", cell, value)
+	}
+	if format := cellNumberFormat(t, f, "Отчёт", cell); format != "0.00%" {
+		t.Errorf("open rate cell %s number format %q, want 0.00%%", cell, format)
+	}
+
+	// ссылки рассылки - по убыванию переходов
+	links, err := f.GetRows("Ссылки")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 4 || links[0][3] != "Ссылка" || links[1][0] != "2024-03-20 12:30:00" || links[2][3] != "https://zo.example.com/webinar?a=1&b=2" ||
+		links[3][3] != "https://zo.example.com/program.pdf" {
+		t.Errorf("links sheet %v", links)
+	}
+
+	// период отчета - с первой по последнюю рассылку, в предыдущем периоде (с 16 февраля по 3 марта) рассылок нет
+	comparison, err := f.GetRows("Сравнение")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comparison) != 11 || strings.Join(comparison[1], "|") != "Рассылок|3|0|0" ||
+		strings.Join(comparison[10][:3], "|") != "Предыдущий период|2024-02-16|2024-03-03" {
+		t.Errorf("comparison rows %v", comparison)
+	}
+	if f.GetSheetIndex("Графики") == -1 {
+		t.Errorf("no charts sheet in %v", f.GetSheetList())
+	}
+	for _, cell := range []string{"A1", "M1"} {
+		if name, picture, err := f.GetPicture("Графики", cell); err != nil || len(picture) == 0 {
+			t.Errorf("chart %q in %s: %v bytes (%v)", name, cell, len(picture), err)
+		}
+	}
+	if charts, _ := filepath.Glob("*.jpeg"); len(charts) != 0 {
+		t.Errorf("chart files in working directory: %v", charts)
+	}
+
+	// рассылки 501 и 505 с одинаковыми метками объединяются, группа с большим числом переходов - первая
+	utm, err := f.GetRows("UTM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"dashamail", "email", "cardio", "2", "2000", "740", "670", "0.335", "150", "125", "0.0625", "4"},
+		{"dashamail", "email", "", "1", "900", "300", "280", "0.311111111111111", "45", "40", "0.0444444444444444", "0"},
+	}
+	if len(utm) != 3 {
+		t.Fatalf("UTM sheet %v", utm)
+	}
+	for i, row := range want {
+		if strings.Join(utm[i+1], "|") != strings.Join(row, "|") {
+			t.Errorf("UTM row %v: %v, want %v", i+1, utm[i+1], row)
+		}
+	}
+}
+
+func TestCreateCampaignsReportPeriod(t *testing.T) {
+	env := newTestEnv(t, nil)
+
+	var campaigns []map[string]interface{}
+	query := url.Values{"start_date": {"2024-03-01"}, "end_date": {"2024-03-31"}}
+	if status := env.getJSON(t, "getCampaignsReportInfo", query, &campaigns); status != http.StatusOK {
+		t.Fatalf("status %v", status)
+	}
+
+	// период отчета передан явно: недели считаются с понедельника, крайние недели обрезаются по периоду; разделители пути
+	// в названии отчета заменяются, чтобы файл не попал за пределы папки отчетов
+	body := map[string]interface{}{"reportName": "../Рассылки за март", "reportData": campaigns, "start_date": "2024-03-01", "end_date": "2024-03-31"}
+	ok, errResp := env.callWebSocket(t, "createCampaignsReport", body, nil)
+	if !ok {
+		t.Fatalf("error response: %s", errResp.Message)
+	}
+
+	reports := storedFiles(t, ".xlsx")
+	if len(reports) != 1 || filepath.Base(reports[0]) != ".._Рассылки за март.xlsx" {
+		t.Fatalf("reports in the store: %v", reports)
+	}
+	if local, _ := filepath.Glob("*.xlsx"); len(local) != 0 {
+		t.Errorf("reports in the working directory: %v", local)
+	}
+	f, _ := openReport(t, reports[0])
+
+	weeks, err := f.GetRows("По неделям")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"2024-W09|2024-03-01|2024-03-03|0",
+		"2024-W10|2024-03-04|2024-03-10|2",
+		"2024-W11|2024-03-11|2024-03-17|0",
+		"2024-W12|2024-03-18|2024-03-24|1",
+		"2024-W13|2024-03-25|2024-03-31|0",
+	}
+	if len(weeks) != len(want)+1 {
+		t.Fatalf("weeks %v", weeks)
+	}
+	for i, row := range want {
+		if got := strings.Join(weeks[i+1][:4], "|"); got != row {
+			t.Errorf("week %v: %s, want %s", i+1, got, row)
+		}
+	}
+
+	// в неделе 2024-W10 - рассылки 505 и 501: 670 уникальных открытий из 2000 писем
+	if weeks[2][4] != "2000" || weeks[2][6] != "0.335" {
+		t.Errorf("week 2024-W10 %v", weeks[2])
+	}
+
+	months, _ := f.GetRows("По месяцам")
+	if len(months) != 2 || months[1][0] != "март 2024" || months[1][3] != "3" {
+		t.Errorf("months %v", months)
+	}
+
+	comparison, _ := f.GetRows("Сравнение")
+	if len(comparison) != 11 || strings.Join(comparison[10][:4], "|") != "Предыдущий период|2024-01-30|2024-02-29|1" {
+		t.Errorf("comparison rows %v", comparison)
+	}
+}
+
+func cellNumberFormat(t *testing.T, f *excel.File, sheet, cell string) string {
+	t.Helper()
+
+	styleID, err := f.GetCellStyle(sheet, cell)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	xf := f.Styles.CellXfs.Xf[styleID]
+	if xf.NumFmtID == nil || f.Styles.NumFmts == nil {
+		return ""
+	}
+	for _, numFmt := range f.Styles.NumFmts.NumFmt {
+		if numFmt.NumFmtID == *xf.NumFmtID {
+			return numFmt.FormatCode
+		}
+	}
+
+	return ""
+}
+
+// storedFiles возвращает файлы хранилища с расширением ext.
+func storedFiles(t *testing.T, ext string) []string {
+	t.Helper()
+
+	var files []string
+	err := filepath.Walk(os.Getenv("STORAGE_LOCAL_DIR"), func(path string, info os.FileInfo, err error) error {
+		if err == nil && strings.HasSuffix(path, ext) {
+			files = append(files, path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return files
+}
+
+func openReport(t *testing.T, path string) (*excel.File, [][]string) {
+	t.Helper()
+
+	f, err := excel.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = f.Close() })
+
+	rows, err := f.GetRows("Отчёт")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return f, rows
+}
+
+func TestDownloadReports(t *testing.T) {
+	env := newTestEnv(t, nil)
+
+	download := func(t *testing.T, env *testEnv, endpoint string, query url.Values, accept string) (*http.Response, []byte) {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodGet, env.api.URL+"/api/v1/"+endpoint+"?"+query.Encode(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+env.token)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status %s: %s", resp.Status, data)
+		}
+
+		return resp, data
+	}
+
+	t.Run("webinar CSV", func(t *testing.T) {
+		resp, data := download(t, env, "downloadWebinarReport", url.Values{"eventID": {testEventID}, "format": {"csv"}}, "")
+		if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+			t.Errorf("content type %q", ct)
+		}
+
+		records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 3 || records[0][0] != "ФИО" || records[1][1] != "ivanov@example.com" || records[2][1] != "petrova@example.com" {
+			t.Fatalf("records %v", records)
+		}
+		if minutes := records[1][WebinarUsersSchema.Index(WEBINAR_COLUMN_MINUTES_ONLINE)]; minutes != "1, 2, 3, 4, 5, 6" {
+			t.Errorf("minutes online %q", minutes)
+		}
+	})
+
+	t.Run("CSV formulas", func(t *testing.T) {
+		env := newTestEnv(t, func(dm *dashamailtest.Fixture, fc *facecasttest.Fixture) {
+			dm.Lists[0].Members[1]["merge_1"] = "=HYPERLINK(\"https://example.com\")"
+		})
+		_, data := download(t, env, "downloadWebinarReport", url.Values{"eventID": {testEventID}, "format": {"csv"}}, "")
+
+		records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 3 || records[2][0] != "'=HYPERLINK(\"https://example.com\")" {
+			t.Errorf("records %v", records)
+		}
+	})
+
+	t.Run("webinar NDJSON", func(t *testing.T) {
+		_, data := download(t, env, "downloadWebinarReport", url.Values{"eventID": {testEventID}}, "application/x-ndjson")
+
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("lines %q", lines)
+		}
+
+		var user map[string]interface{}
+		if err := json.Unmarshal([]byte(lines[1]), &user); err != nil {
+			t.Fatal(err)
+		}
+		if user["email"] != "petrova@example.com" || user[WEBINAR_COLUMN_VIEW_REGIME] != "запись" {
+			t.Errorf("user %v", user)
+		}
+	})
+
+	t.Run("webinar XLSX", func(t *testing.T) {
+		resp, data := download(t, env, "downloadWebinarReport", url.Values{"eventID": {testEventID}}, "")
+		if cd := resp.Header.Get("Content-Disposition"); !strings.HasPrefix(cd, "attachment") || !strings.Contains(cd, ".xlsx") {
+			t.Errorf("content disposition %q", cd)
+		}
+
+		f, err := excel.OpenReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		rows, err := f.GetRows("Отчёт")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 5 || rows[1][0] != testEventID || rows[2][0] != "ФИО" {
+			t.Errorf("rows %v", rows)
+		}
+	})
+
+	t.Run("campaigns XLSX", func(t *testing.T) {
+		query := url.Values{"start_date": {"2024-03-01"}, "end_date": {"2024-03-31"}, "format": {"xlsx"}}
+		_, data := download(t, env, "downloadCampaignsReport", query, "")
+
+		f, err := excel.OpenReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		cell, _ := excel.CoordinatesToCellName(CampaignsSchema.Index("openRate")+1, 2)
+		if format := cellNumberFormat(t, f, "Отчёт", cell); format != "0.00%" {
+			t.Errorf("open rate number format %q", format)
+		}
+		if sheets := f.GetSheetList(); strings.Join(sheets, ",") != "Отчёт,Ссылки,UTM,По неделям,По месяцам,Сравнение" {
+			t.Errorf("sheets %v", sheets)
+		}
+
+		// предыдущий период той же длины (31 день) - с 30 января по 29 февраля, в нем одна рассылка 504
+		comparison, _ := f.GetRows("Сравнение")
+		if len(comparison) != 11 || strings.Join(comparison[2], "|") != "Отправлено|2900|100|28" ||
+			strings.Join(comparison[10][:3], "|") != "Предыдущий период|2024-01-30|2024-02-29" {
+			t.Errorf("comparison rows %v", comparison)
+		}
+		if rows, _ := f.GetRows("UTM"); len(rows) != 3 || rows[1][2] != "cardio" {
+			t.Errorf("UTM rows %v", rows)
+		}
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		var errResp ErrorMessageServerResponse
+		query := url.Values{"eventID": {testEventID}, "format": {"pdf"}}
+		if status := env.getJSON(t, "downloadWebinarReport", query, &errResp); status != http.StatusBadRequest || !strings.Contains(errResp.Message, "unknown report format") {
+			t.Errorf("status %v, message %q", status, errResp.Message)
+		}
+	})
+}
+
+func TestPreviewPoints(t *testing.T) {
+	env := newTestEnv(t, nil)
+
+	preview := func(t *testing.T, body map[string]interface{}) PreviewPointsServerResponse {
+		t.Helper()
+
+		var resp PreviewPointsServerResponse
+		if status := env.postJSON(t, "previewPoints", body, &resp); status != http.StatusOK {
+			t.Fatalf("status %v", status)
+		}
+		return resp
+	}
+
+	// правила по умолчанию: вебинар длится 10 минут и стоит 20 баллов, порог - 10% просмотра
+	viewer := map[string]interface{}{"eventID": testEventID, "minutesViewedOnline": 3, "minutesViewedOffline": 2, "date": "2024-03-15"}
+	if resp := preview(t, viewer); resp.VideoName != "Вебинар" || resp.Duration != 10 || resp.EventType != "Вебинар" || resp.Points != 10 || resp.ExpiresAt != nil {
+		t.Errorf("default rules: %+v", resp)
+	}
+
+	short := map[string]interface{}{"videoName": "Круглый стол НМО", "duration": 60, "minutesViewedOnline": 5}
+	if resp := preview(t, short); resp.MaxPoints != 30 || resp.Points != 0 {
+		t.Errorf("below min watch share: %+v", resp)
+	}
+
+	rules := `{"eventTypes": [{"name": "Вебинар", "patterns": ["Вебинар.*"], "maxPoints": 100, "recordingWeight": 0.5, "expiryDays": 365}]}`
+	if err := os.WriteFile(os.Getenv("POINTS_RULES_FILE"), []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// файл правил перечитывается без перезапуска сервера
+	var resp PreviewPointsServerResponse
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if resp = preview(t, viewer); resp.MaxPoints == 100 {
+			break
+		}
+	}
+	if resp.Points != 40 || resp.ExpiresAt == nil || resp.ExpiresAt.Format("2006-01-02") != "2025-03-15" {
+		t.Errorf("reloaded rules: %+v", resp)
+	}
+	if resp := preview(t, short); resp.EventType != "" || resp.Points != 0 {
+		t.Errorf("unknown event type: %+v", resp)
+	}
+
+	// ошибка в файле не сбрасывает действующие правила
+	if err := os.WriteFile(os.Getenv("POINTS_RULES_FILE"), []byte(`{"eventTypes": [{"name": "Вебинар", "patterns": ["("]}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.s.pointsRules.Reload(); err == nil || !strings.Contains(err.Error(), "invalid pattern") {
+		t.Errorf("reload error %v", err)
+	}
+	if resp := preview(t, viewer); resp.Points != 40 {
+		t.Errorf("rules after invalid file: %+v", resp)
+	}
+
+	var errResp ErrorMessageServerResponse
+	if status := env.postJSON(t, "previewPoints", map[string]interface{}{"videoName": "Вебинар"}, &errResp); status != http.StatusBadRequest || !strings.Contains(errResp.Message, "'duration'") {
+		t.Errorf("status %v, message %q", status, errResp.Message)
+	}
+}
+
+func TestPointsLedger(t *testing.T) {
+	env := newTestEnv(t, nil)
+
+	setZET := func(t *testing.T, value string) {
+		t.Helper()
+
+		fields := map[string]interface{}{"merge_5": value}
+		if err := env.s.dashaMail.Lists.AddMember(testWebinarBookID, "ivanov@example.com", fields, dashamail.AddMemberOptions{Update: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	zet := func(t *testing.T) string {
+		t.Helper()
+
+		var points GetUserPointsServerResponse
+		if status := env.getJSON(t, "getUserPoints", url.Values{"email": {"IVANOV@example.com"}, "type": {"NMO"}}, &points); status != http.StatusOK {
+			t.Fatalf("status %v", status)
+		}
+		if len(points.UserPointsInfo) != 1 {
+			t.Fatalf("points info %+v", points.UserPointsInfo)
+		}
+		return points.UserPointsInfo[0].ZET
+	}
+
+	// до первой синхронизации книги читаются напрямую
+	setZET(t, "3")
+	if got := zet(t); got != "3" {
+		t.Errorf("zet before sync %q", got)
+	}
+
+	var ledger PointsLedgerServerResponse
+	if status := env.postJSON(t, "syncPointsLedger", nil, &ledger); status != http.StatusOK {
+		t.Fatalf("status %v", status)
+	}
+	if ledger.Books != 2 || ledger.Users != 1 || ledger.SyncedAt == "" {
+		t.Errorf("ledger %+v", ledger)
+	}
+
+	// после синхронизации баллы берутся из реестра, а изменения в DashaMail видны только после следующей синхронизации
+	setZET(t, "5")
+	if got := zet(t); got != "3" {
+		t.Errorf("zet from ledger %q", got)
+	}
+
+	var job jobs.Job
+	if status := env.postJSON(t, "jobs", map[string]interface{}{"apiMethod": "syncPointsLedger"}, &job); status != http.StatusOK {
+		t.Fatalf("status %v", status)
+	}
+	for deadline := time.Now().Add(5 * time.Second); !job.Finished() && time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		env.getJSON(t, "jobs/"+job.ID, nil, &job)
+	}
+	if job.Status != jobs.STATUS_DONE {
+		t.Fatalf("job %+v", job)
+	}
+	if got := zet(t); got != "5" {
+		t.Errorf("zet after job sync %q", got)
+	}
+
+	// задачу видит и отменяет только поставивший ее клиент
+	token := env.token
+	var err error
+	if _, env.token, err = env.s.apiClients.Issue("reports", []string{auth.SCOPE_REPORTS_WRITE}); err != nil {
+		t.Fatal(err)
+	}
+	if status := env.getJSON(t, "jobs/"+job.ID, nil, nil); status == http.StatusOK {
+		t.Errorf("other client got job %s", job.ID)
+	}
+	if status := env.postJSON(t, "jobs/"+job.ID+"/cancel", nil, nil); status == http.StatusOK {
+		t.Errorf("other client cancelled job %s", job.ID)
+	}
+	env.token = token
+
+	// данные, записанные в DashaMail через сервер, попадают в реестр сразу
+	body := map[string]interface{}{
+		"bookID": testWebinarBookID,
+		"infoDM": map[string]interface{}{"ivanov@example.com": map[string]interface{}{"бонусы_зо_за_просмотр": 7}},
+	}
+	if status := env.postJSON(t, "sendDataToDashaMail", body, nil); status != http.StatusOK {
+		t.Fatalf("status %v", status)
+	}
+	if entries := env.s.pointsLedger.Entries("ivanov@example.com"); len(entries) != 1 || entries[0].PointsZOView != "7" || entries[0].ZET != "5" {
+		t.Errorf("ledger after sendDataToDashaMail %+v", entries)
+	}
+
+	restored, err := points.NewLedger(os.Getenv("POINTS_LEDGER_FILE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := restored.Entries("ivanov@example.com"); !restored.Synced() || len(entries) != 1 || entries[0].BookID != testWebinarBookID || entries[0].ZET != "5" || entries[0].PointsZOView != "7" {
+		t.Errorf("restored ledger %+v", entries)
+	}
+}
+
+func TestGetUserPointsHistory(t *testing.T) {
+	env := newTestEnv(t, func(dm *dashamailtest.Fixture, fc *facecasttest.Fixture) {
+		fields := map[string]string{"merge_1": "event_name", "merge_2": "event_date", "merge_3": "бонусы_зо_за_просмотр", "merge_4": "бонусы_зо_за_вопрос"}
+		dm.Lists = append(dm.Lists,
+			dashamailtest.List{ID: "90002", Name: "Круглый стол 10.12.2023", Fields: fields, Members: []dashamail.Member{
+				{"email": "ivanov@example.com", "state": "active", "merge_1": "Круглый стол", "merge_2": "10 12 2023", "merge_3": "25", "merge_4": "5"},
+			}},
+			dashamailtest.List{ID: "90003", Name: "Без даты", Fields: fields, Members: []dashamail.Member{
+				{"email": "ivanov@example.com", "state": "active", "merge_1": "Школа", "merge_2": "скоро", "merge_3": "10"},
+			}},
+		)
+	})
+
+	history := func(t *testing.T, query url.Values) GetUserPointsHistoryServerResponse {
+		t.Helper()
+
+		query.Set("email", "ivanov@example.com")
+		var resp GetUserPointsHistoryServerResponse
+		if status := env.getJSON(t, "getUserPointsHistory", query, &resp); status != http.StatusOK {
+			t.Fatalf("status %v", status)
+		}
+		return resp
+	}
+
+	t.Run("all years", func(t *testing.T) {
+		resp := history(t, url.Values{})
+
+		want := PointsTotals{ZET: 2, NMOEvents: 1, ZO: 42, ZOView: 37, ZOQuestion: 5}
+		if resp.Total != want || resp.UndatedEvents != 1 || len(resp.Events) != 2 || resp.Events[0].EventDate != "2023-12-10" {
+			t.Errorf("history %+v", resp)
+		}
+		if len(resp.Periods) != 2 || resp.Periods[0].Period != "2023" || resp.Periods[0].ZO != 30 || resp.Periods[1].Period != "2024" || resp.Periods[1].ZET != 2 {
+			t.Errorf("periods %+v", resp.Periods)
+		}
+		if len(resp.EventTypes) != 2 || resp.EventTypes[0].EventType != "Круглый стол" || resp.EventTypes[1].EventType != "Вебинар" || resp.EventTypes[1].ZO != 12 {
+			t.Errorf("event types %+v", resp.EventTypes)
+		}
+	})
+
+	t.Run("quarter by months", func(t *testing.T) {
+		resp := history(t, url.Values{"year": {"2024"}, "quarter": {"1"}, "groupBy": {GROUP_BY_MONTH}})
+
+		if resp.StartDate != "2024-01-01" || resp.EndDate != "2024-03-31" || resp.Total.ZO != 12 || len(resp.Events) != 1 {
+			t.Errorf("history %+v", resp)
+		}
+		if len(resp.Periods) != 3 || resp.Periods[0].Period != "2024-01" || resp.Periods[0].ZO != 0 || resp.Periods[2].Period != "2024-03" || resp.Periods[2].ZO != 12 {
+			t.Errorf("periods %+v", resp.Periods)
+		}
+	})
+
+	t.Run("date range by quarters", func(t *testing.T) {
+		resp := history(t, url.Values{"start_date": {"2023-11-01"}, "end_date": {"2024-03-14"}, "groupBy": {GROUP_BY_QUARTER}})
+
+		if resp.Total.ZO != 30 || resp.Total.NMOEvents != 0 || len(resp.Periods) != 2 || resp.Periods[0].Period != "2023-Q4" || resp.Periods[1].Period != "2024-Q1" {
+			t.Errorf("history %+v", resp)
+		}
+	})
+
+	t.Run("invalid period", func(t *testing.T) {
+		var errResp ErrorMessageServerResponse
+		query := url.Values{"email": {"ivanov@example.com"}, "quarter": {"2"}}
+		if status := env.getJSON(t, "getUserPointsHistory", query, &errResp); status != http.StatusBadRequest || !strings.Contains(errResp.Message, "'year'") {
+			t.Errorf("status %v, message %q", status, errResp.Message)
+		}
+	})
+
+	t.Run("too many periods", func(t *testing.T) {
+		var errResp ErrorMessageServerResponse
+		query := url.Values{"email": {"ivanov@example.com"}, "start_date": {"0001-01-01"}, "end_date": {"9999-12-31"}, "groupBy": {GROUP_BY_MONTH}}
+		if status := env.getJSON(t, "getUserPointsHistory", query, &errResp); status != http.StatusBadRequest || !strings.Contains(errResp.Message, "more than 1200 periods") {
+			t.Errorf("status %v, message %q", status, errResp.Message)
+		}
+
+		query = url.Values{"email": {"ivanov@example.com"}, "start_date": {"1900-01-01"}, "groupBy": {GROUP_BY_MONTH}}
+		if status := env.getJSON(t, "getUserPointsHistory", query, &errResp); status != http.StatusBadRequest || !strings.Contains(errResp.Message, "more than 1200 periods") {
+			t.Errorf("open range: status %v, message %q", status, errResp.Message)
+		}
+
+		if resp := history(t, url.Values{"start_date": {"1900-01-01"}, "end_date": {"2999-12-31"}}); len(resp.Periods) != 1100 || resp.Total.ZO != 42 {
+			t.Errorf("periods by years %v, total %+v", len(resp.Periods), resp.Total)
+		}
+	})
+}
+
+func TestEventDateFormats(t *testing.T) {
+	// даты мероприятий в книгах ДМ записаны по-разному, но все попадают в свои периоды
+	dates := []string{"8 октября 2022", "08.11.2022", "2022-12-01", "5 Января 2023 г.", "15 марта 2023 года в 10.00", "скоро"}
+
+	env := newTestEnv(t, func(dm *dashamailtest.Fixture, fc *facecasttest.Fixture) {
+		fields := map[string]string{"merge_1": "event_name", "merge_2": "event_date", "merge_3": "бонусы_зо_за_просмотр"}
+		for i, date := range dates {
+			dm.Lists = append(dm.Lists, dashamailtest.List{ID: strconv.Itoa(91000 + i), Name: date, Fields: fields, Members: []dashamail.Member{
+				{"email": "ivanov@example.com", "state": "active", "merge_1": "Вебинар", "merge_2": date, "merge_3": "1"},
+			}})
+		}
+	})
+
+	var resp GetUserPointsHistoryServerResponse
+	query := url.Values{"email": {"ivanov@example.com"}, "start_date": {"2022-01-01"}, "end_date": {"2023-12-31"}, "groupBy": {GROUP_BY_QUARTER}}
+	if status := env.getJSON(t, "getUserPointsHistory", query, &resp); status != http.StatusOK {
+		t.Fatalf("status %v", status)
+	}
+
+	perQuarter := make(map[string]int)
+	for _, period := range resp.Periods {
+		perQuarter[period.Period] = period.ZO
+	}
+	want := map[string]int{"2022-Q4": 3, "2023-Q1": 2}
+	for period, zo := range perQuarter {
+		if zo != want[period] {
+			t.Errorf("%s: %v points, want %v (periods %+v)", period, zo, want[period], resp.Periods)
+		}
+	}
+	// и в обратную сторону: ожидаемый период не пропал из ответа
+	for period, zo := range want {
+		if got, ok := perQuarter[period]; !ok || got != zo {
+			t.Errorf("%s: %v points (in response %v), want %v (periods %+v)", period, got, ok, zo, resp.Periods)
+		}
+	}
+	if resp.UndatedEvents != 1 || len(resp.Events) != 5 || resp.Events[4].EventDate != "2023-03-15" {
+		t.Errorf("history %+v", resp)
+	}
+}
+
+func TestSeriesReport(t *testing.T) {
+	const nextEventID = "EVT2"
+
+	env := newTestEnv(t, func(dm *dashamailtest.Fixture, fc *facecasttest.Fixture) {
+		// второе занятие через неделю, его смотрит только ivanov
+		event := fc.Events[testEventID]
+		event.Info.PlanStartDate = "2024-03-22T10:00:00+03:00"
+		event.Info.StartDate = "2024-03-22T10:01:00+03:00"
+		event.Info.EndDate = "2024-03-22T10:11:00+03:00"
+		event.VisitStats = event.VisitStats[:1]
+		fc.Events[nextEventID] = event
+	})
+
+	// занятия сортируются по дате независимо от порядка eventIDs
+	eventIDs := []string{nextEventID, testEventID}
+
+	checkSeries := func(t *testing.T, series GetSeriesReportServerResponse) {
+		t.Helper()
+
+		if series.ReportName != "Отчёт по серии 15.03.2024 - 22.03.2024" || len(series.Sessions) != 2 {
+			t.Fatalf("series %+v", series)
+		}
+		first, second := series.Sessions[0], series.Sessions[1]
+		if first.EventID != testEventID || first.Viewers != 2 || first.NewViewers != 2 || first.Retention != 0 {
+			t.Errorf("first session %+v", first)
+		}
+		if second.EventID != nextEventID || second.Viewers != 1 || second.NewViewers != 0 || second.RetainedViewers != 1 || second.Retention != 0.5 {
+			t.Errorf("second session %+v", second)
+		}
+
+		if len(series.Users) != 2 {
+			t.Fatalf("users %+v", series.Users)
+		}
+		ivanov, petrova := series.Users[0], series.Users[1]
+		if ivanov.Email != "ivanov@example.com" || ivanov.Sessions != 2 || ivanov.LastSession != 2 || ivanov.PointsZOView != 24 ||
+			len(ivanov.MinutesBySession) != 2 || ivanov.MinutesBySession[1] != 6 {
+			t.Errorf("ivanov %+v", ivanov)
+		}
+		if petrova.Email != "petrova@example.com" || petrova.Sessions != 1 || petrova.MinutesBySession[1] != 0 {
+			t.Errorf("petrova %+v", petrova)
+		}
+	}
+
+	t.Run("REST", func(t *testing.T) {
+		var series GetSeriesReportServerResponse
+		if status := env.getJSON(t, "getSeriesReportInfo", url.Values{"eventIDs": {strings.Join(eventIDs, ",")}}, &series); status != http.StatusOK {
+			t.Fatalf("status %v, want %v", status, http.StatusOK)
+		}
+		checkSeries(t, series)
+	})
+
+	t.Run("WebSocket", func(t *testing.T) {
+		var series GetSeriesReportServerResponse
+		ok, errResp := env.callWebSocket(t, "getSeriesReportInfo", map[string]interface{}{"eventIDs": eventIDs}, &series)
+		if !ok {
+			t.Fatalf("error response: %s", errResp.Message)
+		}
+		checkSeries(t, series)
+	})
+
+	t.Run("repeated event", func(t *testing.T) {
+		var errResp ErrorMessageServerResponse
+		query := url.Values{"eventIDs": {testEventID + "," + testEventID}}
+		if status := env.getJSON(t, "getSeriesReportInfo", query, &errResp); status != http.StatusBadRequest || !strings.Contains(errResp.Message, "repeated") {
+			t.Errorf("status %v, message %q", status, errResp.Message)
+		}
+	})
+
+	t.Run("create", func(t *testing.T) {
+		if status := env.postJSON(t, "createSeriesReport", map[string]interface{}{"eventIDs": eventIDs}, nil); status != http.StatusOK {
+			t.Fatalf("status %v, want %v", status, http.StatusOK)
+		}
+
+		reports := storedFiles(t, ".xlsx")
+		if len(reports) != 1 || !strings.Contains(reports[0], filepath.Join("2024", "март", "Отчёт по серии 15.03.2024 - 22.03.2024.xlsx")) {
+			t.Fatalf("reports in the store: %v", reports)
+		}
+
+		f, rows := openReport(t, reports[0])
+		if len(rows) != 3 || rows[1][1] != testEventID || rows[2][1] != nextEventID || rows[2][10] != "0.5" {
+			t.Errorf("sessions %v", rows)
+		}
+		if format := cellNumberFormat(t, f, "Отчёт", "K3"); format != "0.00%" {
+			t.Errorf("retention format %q", format)
+		}
+		for _, sheet := range []string{"Зрители", "Посещаемость", "Графики"} {
+			if f.GetSheetIndex(sheet) == -1 {
+				t.Errorf("no sheet %s in %v", sheet, f.GetSheetList())
+			}
+		}
+
+		attendance, err := f.GetRows("Посещаемость")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(attendance) != 3 || attendance[0][2] != "1. 15.03.2024 10:00" || attendance[1][3] != "6" {
+			t.Errorf("attendance %v", attendance)
+		}
+	})
+}
+
+func TestConferenceReport(t *testing.T) {
+	const hallEventID = "EVT3"
+
+	env := newTestEnv(t, func(dm *dashamailtest.Fixture, fc *facecasttest.Fixture) {
+		// второй зал начался на 2 минуты позже первого: его минута 1 - третья минута конференции
+		hall := fc.Events[testEventID]
+		hall.Info.Name = "Вебинар (зал 2)"
+		hall.Info.StartDate = "2024-03-15T10:03:00+03:00"
+		hall.Info.EndDate = "2024-03-15T10:13:00+03:00"
+		hall.VisitStats = []facecast.VisitStats{
+			{Key: "key-ivanov", Minutes: []facecast.Minute{ // минуты конференции 6-10, минута 6 уже засчитана первому залу
+				{Position: 3, Views: []facecast.View{{IsLive: true}}},
+				{Position: 4, Views: []facecast.View{{IsLive: true}}},
+				{Position: 5, Views: []facecast.View{{IsLive: true}}},
+				{Position: 6, Views: []facecast.View{{IsLive: true}}},
+				{Position: 7, Views: []facecast.View{{IsLive: true}}},
+			}},
+			{Key: "key-petrova", Minutes: []facecast.Minute{ // минута конференции 3
+				{Position: 0, Views: []facecast.View{{IsLive: true}}},
+			}},
+		}
+		fc.Events[hallEventID] = hall
+	})
+
+	eventIDs := []string{hallEventID, testEventID}
+
+	checkConference := func(t *testing.T, report GetReportServerResponse) {
+		t.Helper()
+
+		info := report.EventInfo
+		if report.ReportName != "Отчёт по конференции 15.03.2024 10.00" || info.VideoName != "Вебинар / Вебинар (зал 2)" ||
+			info.Duration != 12 || info.ViewersTotal != 2 || info.ViewersMax != 2 || info.TimeViewersMax != "15.03.2024 10:03" ||
+			info.EndDate != "15.03.2024 10:13" {
+			t.Errorf("conference %+v", info)
+		}
+
+		if len(report.Halls) != 2 || report.Halls[0].EventID != testEventID || report.Halls[1].FirstMinute != 3 ||
+			report.Halls[0].MinutesViewed != 8 || report.Halls[1].MinutesViewed != 5 {
+			t.Errorf("halls %+v", report.Halls)
+		}
+
+		if len(report.UsersInfo) != 2 {
+			t.Fatalf("users %+v, want ivanov and petrova", report.UsersInfo)
+		}
+
+		ivanov := report.UsersInfo["ivanov@example.com"]
+		if ivanov.MinutesViewedOnline != 10 || ivanov.LastMinuteOnline != 10 || ivanov.AllWindows != 4 || ivanov.PointsZOView != 17 ||
+			ivanov.Key != "key-ivanov" || ivanov.EventID != testEventID+", "+hallEventID || ivanov.City != "Москва" {
+			t.Errorf("ivanov %+v", ivanov)
+		}
+		if !reflect.DeepEqual(ivanov.HallMinutes, map[string][]int{testEventID: {1, 2, 3, 4, 5, 6}, hallEventID: {7, 8, 9, 10}}) {
+			t.Errorf("ivanov halls %v", ivanov.HallMinutes)
+		}
+
+		petrova := report.UsersInfo["petrova@example.com"]
+		if petrova.MinutesViewedOnline != 1 || petrova.MinutesViewedOffline != 2 || petrova.ViewRegime != "прямой эфир и запись" || petrova.PointsZOView != 5 {
+			t.Errorf("petrova %+v", petrova)
+		}
+		if !reflect.DeepEqual(petrova.HallMinutes, map[string][]int{testEventID: {4, 5}, hallEventID: {3}}) {
+			t.Errorf("petrova halls %v", petrova.HallMinutes)
+		}
+	}
+
+	t.Run("REST", func(t *testing.T) {
+		var report GetReportServerResponse
+		if status := env.getJSON(t, "getWebinarReportInfo", url.Values{"eventIDs": {strings.Join(eventIDs, ",")}}, &report); status != http.StatusOK {
+			t.Fatalf("status %v, want %v", status, http.StatusOK)
+		}
+		checkConference(t, report)
+	})
+
+	t.Run("WebSocket", func(t *testing.T) {
+		var report GetReportServerResponse
+		ok, errResp := env.callWebSocket(t, "getWebinarReportInfo", map[string]interface{}{"eventIDs": eventIDs}, &report)
+		if !ok {
+			t.Fatalf("error response: %s", errResp.Message)
+		}
+		checkConference(t, report)
+	})
+
+	t.Run("create", func(t *testing.T) {
+		if status := env.postJSON(t, "createWebinarReport", map[string]interface{}{"eventIDs": eventIDs}, nil); status != http.StatusOK {
+			t.Fatalf("status %v, want %v", status, http.StatusOK)
+		}
+
+		reports := storedFiles(t, ".xlsx")
+		if len(reports) != 1 || !strings.Contains(reports[0], filepath.Join("2024", "март", "Отчёт по конференции 15.03.2024 10.00.xlsx")) {
+			t.Fatalf("reports in the store: %v", reports)
+		}
+
+		f, rows := openReport(t, reports[0])
+		if len(rows) != 5 || rows[1][0] != hallEventID+", "+testEventID || rows[1][6] != "12" {
+			t.Errorf("report rows %v", rows)
+		}
+
+		minutes, err := f.GetRows("Минуты по залам")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(minutes) != 5 || minutes[1][2] != testEventID || minutes[2][2] != hallEventID || minutes[2][5] != "7, 8, 9, 10" {
+			t.Errorf("hall minutes %v", minutes)
+		}
+		if f.GetSheetIndex("Залы") == -1 || f.GetSheetIndex("Графики") == -1 {
+			t.Errorf("sheets %v", f.GetSheetList())
+		}
+	})
+}
+
+func TestCertificatesEligibility(t *testing.T) {
+	env := newTestEnv(t, func(dm *dashamailtest.Fixture, fc *facecasttest.Fixture) {
+		for i := range dm.Lists {
+			if dm.Lists[i].ID != testWebinarBookID {
+				continue
+			}
+
+			// сертификаты еще не созданы; sidorov зарегистрировался, но трансляцию не смотрел
+			book := &dm.Lists[i]
+			delete(book.Members[0], "merge_6")
+			for _, email := range []string{"petrova@example.com", "sidorov@example.com"} {
+				book.Members = append(book.Members, dashamail.Member{
+					"email":   email,
+					"state":   "active",
+					"merge_1": email,
+					"merge_2": "Вебинар НМО",
+					"merge_3": "15 марта 2024",
+					"merge_4": "NMO-" + email,
+					"merge_5": "2",
+				})
+			}
+		}
+	})
+
+	t.Run("without event", func(t *testing.T) {
+		// без трансляций посещение зрителей с кодом НМО проверить нельзя
+		ok, errResp := env.callWebSocket(t, "getCertificatesInfo", map[string]interface{}{"bookID": testWebinarBookID}, nil)
+		if ok || !strings.Contains(errResp.Message, "eventID or eventIDs must be set") {
+			t.Errorf("ok %v, message %q", ok, errResp.Message)
+		}
+	})
+
+	t.Run("with event", func(t *testing.T) {
+		var info GetCertificatesInfoServerResponse
+		data := map[string]interface{}{"bookID": testWebinarBookID, "eventID": testEventID}
+		ok, errResp := env.callWebSocket(t, "getCertificatesInfo", data, &info)
+		if !ok {
+			t.Fatalf("error response: %s", errResp.Message)
+		}
+
+		// ivanov: 6 из 10 минут в эфире и 1 из 2 окон; petrova смотрела только запись
+		if len(info.UsersInfo) != 1 || info.UsersInfo["ivanov@example.com"].NMO != "NMO-2024-0315" || info.EventName != "Вебинар НМО" {
+			t.Errorf("certificates info %+v, want only ivanov", info)
+		}
+
+		if ivanov := info.Eligibility["ivanov@example.com"]; !ivanov.Eligible || ivanov.EventType != "Вебинар" || ivanov.WatchShare != 0.6 || ivanov.WindowsShare != 0.5 {
+			t.Errorf("ivanov %+v", ivanov)
+		}
+		if petrova := info.Eligibility["petrova@example.com"]; petrova.Eligible || len(petrova.Reasons) != 1 || !strings.Contains(petrova.Reasons[0], "только запись") {
+			t.Errorf("petrova %+v", petrova)
+		}
+		if sidorov := info.Eligibility["sidorov@example.com"]; sidorov.Eligible || len(sidorov.Reasons) != 1 || sidorov.Reasons[0] != "не смотрел мероприятие" {
+			t.Errorf("sidorov %+v", sidorov)
+		}
+	})
+
+	t.Run("unknown event", func(t *testing.T) {
+		data := map[string]interface{}{"bookID": testWebinarBookID, "eventID": "EVT404"}
+		if ok, errResp := env.callWebSocket(t, "getCertificatesInfo", data, nil); ok || !strings.Contains(errResp.Message, "event EVT404 not found") {
+			t.Errorf("ok %v, message %q", ok, errResp.Message)
+		}
+	})
+
+	t.Run("create certificates", func(t *testing.T) {
+		chdirWithTemplates(t)
+
+		// клиент прислал зрителя, не выполнившего требования, и поддельную проверку посещения
+		data := map[string]interface{}{
+			"eventName": "Вебинар НМО",
+			"eventDate": "15 марта 2024",
+			"usersInfo": map[string]interface{}{
+				"ivanov@example.com":  map[string]interface{}{"userName": "Иванов Иван Иванович", "zet": "2", "NMO": "NMO-2024-0315"},
+				"petrova@example.com": map[string]interface{}{"userName": "Петрова Мария Сергеевна", "zet": "2", "NMO": "NMO-petrova"},
+			},
+			"eligibility": map[string]interface{}{"petrova@example.com": map[string]interface{}{"eligible": true}},
+		}
+		if ok, errResp := env.callWebSocket(t, "createCertificates", data, nil); ok || !strings.Contains(errResp.Message, "eventID or eventIDs must be set") {
+			t.Errorf("without event: ok %v, message %q", ok, errResp.Message)
+		}
+
+		data["eventID"] = testEventID
+		var response struct {
+			Links       map[string]LoadedCertificateInfo `json:"links"`
+			Eligibility map[string]points.Eligibility    `json:"eligibility"`
+		}
+		if ok, errResp := env.callWebSocket(t, "createCertificates", data, &response); !ok {
+			t.Fatalf("error response: %s", errResp.Message)
+		}
+		if _, ok := response.Links["ivanov@example.com"]; !ok || len(response.Links) != 1 {
+			t.Errorf("links %+v, want only ivanov", response.Links)
+		}
+		if petrova := response.Eligibility["petrova@example.com"]; petrova.Eligible || len(petrova.Reasons) == 0 {
+			t.Errorf("petrova %+v", petrova)
+		}
+		if pdfs := storedFiles(t, ".pdf"); len(pdfs) != 1 {
+			t.Errorf("certificates in the store: %v", pdfs)
+		}
+	})
+}
+
+// chdirWithTemplates переходит во временную рабочую папку со ссылкой на шаблоны сертификатов: шаблоны и локальная
+// папка сертификатов ищутся относительно рабочей папки веб-сервиса.
+func chdirWithTemplates(t *testing.T) {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err = os.Symlink(filepath.Join(wd, "..", "..", "..", "__dev__certificates__"), filepath.Join(dir, "__dev__certificates__")); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+}
+
+func TestCertificateVerification(t *testing.T) {
+	env := newTestEnv(t, nil)
+	chdirWithTemplates(t)
+
+	// сертификаты создаются во временной папке запуска, которая удаляется после загрузки
+	tmpDir := t.TempDir()
+	t.Setenv("TMPDIR", tmpDir)
+
+	data := map[string]interface{}{
+		"eventName": "Вебинар НМО",
+		"eventDate": "15 марта 2024",
+		"eventID":   testEventID,
+		"usersInfo": map[string]interface{}{
+			"ivanov@example.com": map[string]interface{}{"userName": "Иванов Иван Иванович", "zet": "2", "NMO": "NMO-2024-0315"},
+		},
+	}
+	var created struct {
+		Links map[string]struct {
+			Link   string `json:"link"`
+			Serial string `json:"serial"`
+		} `json:"links"`
+	}
+	if ok, errResp := env.callWebSocket(t, "createCertificates", data, &created); !ok {
+		t.Fatalf("error response: %s", errResp.Message)
+	}
+
+	serial := created.Links["ivanov@example.com"].Serial
+	if !regexp.MustCompile(`^ZO-\d{4}-000001-[0-9A-F]{16}$`).MatchString(serial) {
+		t.Fatalf("links %+v, want ivanov's certificate with serial number", created.Links)
+	}
+	if files, err := os.ReadDir(tmpDir); err != nil || len(files) != 0 {
+		t.Errorf("temporary files %v (%v)", files, err)
+	}
+
+	// картинки сертификата: фон шаблона, его маска прозрачности и QR-код
+	pdfs := storedFiles(t, ".pdf")
+	if len(pdfs) != 1 {
+		t.Fatalf("certificates in the store: %v", pdfs)
+	}
+	pdf, err := ioutil.ReadFile(pdfs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if images := bytes.Count(pdf, []byte("/Subtype /Image")); images != 3 {
+		t.Errorf("certificate has %v images, want background with its mask and QR code", images)
+	}
+
+	// проверка сертификата - публичная, без токена
+	verify := func(t *testing.T, serial string, result interface{}) int {
+		t.Helper()
+
+		resp, err := http.Get(env.api.URL + "/api/v1/certificates/verify/" + url.PathEscape(serial))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		decodeResponse(t, resp, result)
+		return resp.StatusCode
+	}
+
+	t.Run("verify", func(t *testing.T) {
+		var certificate VerifyCertificateServerResponse
+		if status := verify(t, strings.ToLower(serial), &certificate); status != http.StatusOK {
+			t.Fatalf("status %v, want %v", status, http.StatusOK)
+		}
+		if certificate.Serial != serial || certificate.UserName != "Иванов И." || certificate.EventName != "Вебинар НМО" ||
+			certificate.EventDate != "15 марта 2024" || certificate.Status != certificates.STATUS_VALID || !certificate.Valid {
+			t.Errorf("certificate %+v", certificate)
+		}
+	})
+
+	t.Run("unknown serial", func(t *testing.T) {
+		var errResp ErrorMessageServerResponse
+		if status := verify(t, "ZO-2024-999999-0000", &errResp); status != http.StatusBadRequest || !strings.Contains(errResp.Message, "certificate ZO-2024-999999-0000 not found") {
+			t.Errorf("status %v, message %q", status, errResp.Message)
+		}
+	})
+
+	t.Run("registry file", func(t *testing.T) {
+		registry, err := certificates.NewRegistry(os.Getenv("CERTIFICATES_REGISTRY_FILE"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record, ok := registry.Find(serial); !ok || record.Email != "ivanov@example.com" || record.NMO != "NMO-2024-0315" || record.ZET != "2" {
+			t.Errorf("record %+v", record)
+		}
+	})
+
+	t.Run("repeated creation", func(t *testing.T) {
+		// повторный запуск заменяет файл в хранилище, поэтому прежний сертификат отзывается
+		if ok, errResp := env.callWebSocket(t, "createCertificates", data, &created); !ok {
+			t.Fatalf("error response: %s", errResp.Message)
+		}
+		repeated := created.Links["ivanov@example.com"].Serial
+
+		var previous VerifyCertificateServerResponse
+		if verify(t, serial, &previous); previous.Valid || previous.ReplacedBy != repeated {
+			t.Errorf("previous certificate %+v, want replaced by %s", previous, repeated)
+		}
+		if valid := env.s.certificatesRegistry.Valid("ivanov@example.com", "Вебинар НМО", "15.03.2024"); len(valid) != 1 || valid[0].Serial != repeated {
+			t.Errorf("valid certificates %+v, want only %s", valid, repeated)
+		}
+	})
+}
+
+func TestCertificateTemplates(t *testing.T) {
+	env := newTestEnv(t, nil)
+	chdirWithTemplates(t)
+
+	upload := func(t *testing.T, name, category, file string, result interface{}) int {
+		t.Helper()
+
+		content, err := ioutil.ReadFile(filepath.Join("__dev__certificates__", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body := map[string]interface{}{"name": name, "category": category, "content": base64.StdEncoding.EncodeToString(content)}
+		return env.postJSON(t, "certificates/templates", body, result)
+	}
+
+	var adults certificates.Template
+	if status := upload(t, "НМО 2024", certificates.CATEGORY_ADULTS, "template_adults.docx", &adults); status != http.StatusOK {
+		t.Fatalf("status %v, want %v", status, http.StatusOK)
+	}
+	if adults.ID != "tpl-1" || adults.Version != 1 || len(adults.Missing) != 0 ||
+		!reflect.DeepEqual(adults.Placeholders, []string{"ДАТА", "ЗЕТ", "ИМЯ", "МЕРОПРИЯТИЕ", "НМО"}) {
+		t.Errorf("template %+v", adults)
+	}
+
+	t.Run("missing placeholders", func(t *testing.T) {
+		// шаблон студентов без баллов НМО загружается, но не активируется
+		var template certificates.Template
+		if status := upload(t, "Без баллов", certificates.CATEGORY_ADULTS, "template_students.docx", &template); status != http.StatusOK {
+			t.Fatalf("status %v, want %v", status, http.StatusOK)
+		}
+		if !reflect.DeepEqual(template.Missing, []string{"НМО", "ЗЕТ"}) {
+			t.Errorf("missing placeholders %v", template.Missing)
+		}
+
+		var errResp ErrorMessageServerResponse
+		if status := env.postJSON(t, "certificates/templates/"+template.ID+"/activate", map[string]interface{}{}, &errResp); status != http.StatusBadRequest ||
+			!strings.Contains(errResp.Message, "has no required placeholders {НМО}, {ЗЕТ}") {
+			t.Errorf("status %v, message %q", status, errResp.Message)
+		}
+	})
+
+	t.Run("invalid template", func(t *testing.T) {
+		var errResp ErrorMessageServerResponse
+		body := map[string]interface{}{"name": "НМО 2024", "category": certificates.CATEGORY_ADULTS, "content": base64.StdEncoding.EncodeToString([]byte("not a docx"))}
+		if status := env.postJSON(t, "certificates/templates", body, &errResp); status != http.StatusBadRequest || !strings.Contains(errResp.Message, "invalid DOCX template") {
+			t.Errorf("status %v, message %q", status, errResp.Message)
+		}
+		if status := upload(t, "НМО 2024", "teachers", "template_adults.docx", &errResp); status != http.StatusBadRequest || !strings.Contains(errResp.Message, "unknown category 'teachers'") {
+			t.Errorf("status %v, message %q", status, errResp.Message)
+		}
+	})
+
+	var version2 certificates.Template
+	if status := upload(t, "НМО 2024", certificates.CATEGORY_ADULTS, "template_adults.docx", &version2); status != http.StatusOK || version2.Version != 2 {
+		t.Fatalf("status %v, template %+v, want version 2", status, version2)
+	}
+
+	t.Run("activate", func(t *testing.T) {
+		var assignment certificates.Assignment
+		body := map[string]interface{}{"eventName": "Вебинар НМО", "eventDate": "15.03.2024"}
+		if status := env.postJSON(t, "certificates/templates/"+version2.ID+"/activate", body, &assignment); status != http.StatusOK {
+			t.Fatalf("status %v, want %v", status, http.StatusOK)
+		}
+		if status := env.postJSON(t, "certificates/templates/"+adults.ID+"/activate", map[string]interface{}{}, &assignment); status != http.StatusOK {
+			t.Fatalf("status %v, want %v", status, http.StatusOK)
+		}
+
+		var list CertificateTemplatesServerResponse
+		if status := env.getJSON(t, "certificates/templates", nil, &list); status != http.StatusOK {
+			t.Fatalf("status %v, want %v", status, http.StatusOK)
+		}
+		if len(list.Templates) != 3 || len(list.Assignments) != 2 {
+			t.Errorf("templates %+v, assignments %+v", list.Templates, list.Assignments)
+		}
+
+		// шаблон мероприятия важнее шаблона категории, дата мероприятия - в любом формате
+		dir := os.Getenv("CERTIFICATE_TEMPLATES_DIR")
+		for _, c := range []struct{ eventName, eventDate, want string }{
+			{"вебинар нмо", "15 марта 2024", filepath.Join(dir, version2.ID+".docx")},
+			{"Вебинар НМО", "16 марта 2024", filepath.Join(dir, adults.ID+".docx")},
+		} {
+			if path, err := env.s.certificateTemplates.Resolve(certificates.CATEGORY_ADULTS, c.eventName, c.eventDate); err != nil || path != c.want {
+				t.Errorf("%s %s: template %s (%v), want %s", c.eventName, c.eventDate, path, err, c.want)
+			}
+		}
+		if path, _ := env.s.certificateTemplates.Resolve(certificates.CATEGORY_STUDENTS, "Вебинар НМО", "15.03.2024"); path != "./__dev__certificates__/template_students.docx" {
+			t.Errorf("students template %s, want builtin", path)
+		}
+	})
+
+	t.Run("create certificates", func(t *testing.T) {
+		data := map[string]interface{}{
+			"eventName": "Вебинар НМО",
+			"eventDate": "15 марта 2024",
+			"eventID":   testEventID,
+			"usersInfo": map[string]interface{}{
+				"ivanov@example.com": map[string]interface{}{"userName": "Иванов Иван Иванович", "zet": "2", "NMO": "NMO-2024-0315"},
+			},
+		}
+		if ok, errResp := env.callWebSocket(t, "createCertificates", data, nil); !ok {
+			t.Fatalf("error response: %s", errResp.Message)
+		}
+		if pdfs := storedFiles(t, ".pdf"); len(pdfs) != 1 {
+			t.Errorf("certificates in the store: %v", pdfs)
+		}
+	})
+
+	t.Run("templates index", func(t *testing.T) {
+		store, err := certificates.NewTemplateStore(os.Getenv("CERTIFICATE_TEMPLATES_DIR"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if templates, assignments := store.List(); len(templates) != 3 || len(assignments) != 2 {
+			t.Errorf("templates %+v, assignments %+v", templates, assignments)
+		}
+	})
+}
+
+func TestCertificatePreview(t *testing.T) {
+	env := newTestEnv(t, nil)
+	chdirWithTemplates(t)
+
+	preview := func(t *testing.T, data map[string]interface{}) PreviewCertificateServerResponse {
+		t.Helper()
+
+		var response PreviewCertificateServerResponse
+		if ok, errResp := env.callWebSocket(t, "previewCertificate", data, &response); !ok {
+			t.Fatalf("error response: %s", errResp.Message)
+		}
+
+		pdf, err := base64.StdEncoding.DecodeString(response.PDF)
+		if err != nil || !bytes.HasPrefix(pdf, []byte("%PDF")) {
+			t.Errorf("pdf is not a PDF document (%v)", err)
+		}
+
+		// QR-код - черные пиксели в левом нижнем углу страницы
+		pngData, err := base64.StdEncoding.DecodeString(response.PNG)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(bytes.NewReader(pngData))
+		if err != nil {
+			t.Fatal(err)
+		}
+		bounds := img.Bounds()
+		if bounds.Dx() != certificates.PREVIEW_WIDTH || bounds.Dy() >= bounds.Dx() {
+			t.Errorf("png size %v, want landscape certificate %v pixels wide", bounds.Size(), certificates.PREVIEW_WIDTH)
+		}
+		black := 0
+		for y := bounds.Dy() * 80 / 100; y < bounds.Dy()*94/100; y++ {
+			for x := bounds.Dx() * 3 / 100; x < bounds.Dx()*10/100; x++ {
+				if r, g, b, _ := img.At(x, y).RGBA(); r|g|b == 0 {
+					black++
+				}
+			}
+		}
+		if black == 0 {
+			t.Error("png has no QR code")
+		}
+
+		return response
+	}
+
+	usersInfo := map[string]interface{}{
+		"ivanov@example.com":  map[string]interface{}{"userName": "Иванов Иван Иванович", "zet": "2", "NMO": "NMO-2024-0315"},
+		"petrova@example.com": map[string]interface{}{"userName": "Петрова Анна Сергеевна", "academicHours": "4"},
+	}
+
+	t.Run("sample", func(t *testing.T) {
+		response := preview(t, map[string]interface{}{"eventName": "Вебинар НМО", "eventDate": "15 марта 2024", "category": certificates.CATEGORY_STUDENTS})
+		if response.Email != "" || response.Category != certificates.CATEGORY_STUDENTS || !regexp.MustCompile(`^ZO-\d{4}-000000-0{16}$`).MatchString(response.Serial) {
+			t.Errorf("response email %q, category %q, serial %q", response.Email, response.Category, response.Serial)
+		}
+	})
+
+	t.Run("given user", func(t *testing.T) {
+		response := preview(t, map[string]interface{}{"eventName": "Вебинар НМО", "eventDate": "15 марта 2024", "usersInfo": usersInfo, "email": "petrova@example.com"})
+		if response.Email != "petrova@example.com" || response.Category != certificates.CATEGORY_STUDENTS {
+			t.Errorf("response email %q, category %q", response.Email, response.Category)
+		}
+
+		// без email - первый пользователь по алфавиту
+		response = preview(t, map[string]interface{}{"eventName": "Вебинар НМО", "eventDate": "15 марта 2024", "usersInfo": usersInfo})
+		if response.Email != "ivanov@example.com" || response.Category != certificates.CATEGORY_ADULTS {
+			t.Errorf("response email %q, category %q", response.Email, response.Category)
+		}
+	})
+
+	t.Run("invalid data", func(t *testing.T) {
+		for _, c := range []struct {
+			data    map[string]interface{}
+			message string
+		}{
+			{map[string]interface{}{"eventName": "Вебинар НМО", "eventDate": "15 марта 2024", "usersInfo": usersInfo, "email": "sidorov@example.com"}, "user sidorov@example.com not found in usersInfo"},
+			{map[string]interface{}{"eventName": "Вебинар НМО", "eventDate": "15 марта 2024", "category": "teachers"}, "unknown category 'teachers'"},
+			{map[string]interface{}{"eventName": "Вебинар НМО", "eventDate": "в марте"}, "parsing event date"},
+		} {
+			if ok, errResp := env.callWebSocket(t, "previewCertificate", c.data, nil); ok || !strings.Contains(errResp.Message, c.message) {
+				t.Errorf("ok %v, message %q, want %q", ok, errResp.Message, c.message)
+			}
+		}
+	})
+
+	// превью ничего не загружает и не выдает серийных номеров
+	if pdfs := storedFiles(t, ".pdf"); len(pdfs) != 0 {
+		t.Errorf("certificates in the store: %v", pdfs)
+	}
+	if _, err := os.Stat(os.Getenv("CERTIFICATES_REGISTRY_FILE")); !os.IsNotExist(err) {
+		t.Errorf("registry file exists (%v)", err)
+	}
+	if _, err := os.Stat("15 марта 2024"); !os.IsNotExist(err) {
+		t.Errorf("local certificates directory exists (%v)", err)
+	}
+}
+
+func TestCertificatesWithoutVerifyURL(t *testing.T) {
+	env := newTestEnv(t, nil)
+	chdirWithTemplates(t)
+
+	// сервер запускается без адреса проверки, но сертификаты с QR-кодом без него не создаются
+	t.Setenv("CERTIFICATES_VERIFY_URL", "")
+	if err := env.s.initCertificatesRegistry(); err != nil {
+		t.Fatalf("init error %v", err)
+	}
+
+	certificateData := map[string]interface{}{
+		"eventName": "Вебинар НМО",
+		"eventDate": "15 марта 2024",
+		"eventID":   testEventID,
+		"usersInfo": map[string]interface{}{
+			"ivanov@example.com": map[string]interface{}{"userName": "Иванов Иван Иванович", "zet": "2", "NMO": "NMO-2024-0315"},
+		},
+	}
+	reissueData := map[string]interface{}{"bookID": testWebinarBookID, "email": "ivanov@example.com", "eventID": testEventID, "reason": "опечатка в ФИО"}
+
+	for apiMethod, data := range map[string]map[string]interface{}{
+		"createCertificates":  certificateData,
+		"previewCertificate":  certificateData,
+		"reissueCertificates": reissueData,
+	} {
+		if ok, errResp := env.callWebSocket(t, apiMethod, data, nil); ok || !strings.Contains(errResp.Message, "$CERTIFICATES_VERIFY_URL is not set") {
+			t.Errorf("%s: ok %v, message %q", apiMethod, ok, errResp.Message)
+		}
+	}
+	if pdfs := storedFiles(t, ".pdf"); len(pdfs) != 0 {
+		t.Errorf("certificates in the store: %v", pdfs)
+	}
+}
+
+func TestCertificatesReissueAndRevoke(t *testing.T) {
+	env := newTestEnv(t, func(dm *dashamailtest.Fixture, fc *facecasttest.Fixture) {
+		for i := range dm.Lists {
+			if dm.Lists[i].ID != testWebinarBookID {
+				continue
+			}
+
+			// у petrova есть сертификат, но она смотрела только запись; sidorov сертификат не получал
+			book := &dm.Lists[i]
+			for email, link := range map[string]string{"petrova@example.com": "https://example.com/certificates/petrova.pdf", "sidorov@example.com": ""} {
+				book.Members = append(book.Members, dashamail.Member{
+					"email":   email,
+					"state":   "active",
+					"merge_1": email,
+					"merge_2": "Вебинар НМО",
+					"merge_3": "15 марта 2024",
+					"merge_4": "NMO-" + email,
+					"merge_5": "2",
+					"merge_6": link,
+				})
+			}
+		}
+	})
+	chdirWithTemplates(t)
+
+	// сертификат создан с опечаткой в ФИО, в книге ДМ ФИО уже исправлено; название мероприятия в книге другое, поэтому
+	// прежний сертификат находится в реестре по ссылке
+	data := map[string]interface{}{
+		"eventName": "Вебинар НМО (основной зал)",
+		"eventDate": "15 марта 2024",
+		"eventID":   testEventID,
+		"usersInfo": map[string]interface{}{
+			"ivanov@example.com": map[string]interface{}{"userName": "Иванов Иван Иваныч", "zet": "2", "NMO": "NMO-2024-0315"},
+		},
+	}
+	var created struct {
+		Links map[string]LoadedCertificateInfo `json:"links"`
+	}
+	if ok, errResp := env.callWebSocket(t, "createCertificates", data, &created); !ok {
+		t.Fatalf("error response: %s", errResp.Message)
+	}
+	oldSerial := created.Links["ivanov@example.com"].Serial
+
+	verify := func(t *testing.T, serial string) VerifyCertificateServerResponse {
+		t.Helper()
+
+		resp, err := http.Get(env.api.URL + "/api/v1/certificates/verify/" + url.PathEscape(serial))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		var certificate VerifyCertificateServerResponse
+		decodeResponse(t, resp, &certificate)
+		return certificate
+	}
+
+	var newSerial string
+	t.Run("reissue", func(t *testing.T) {
+		var response CertificatesRevisionServerResponse
+		emails := []string{"Ivanov@example.com", "nobody@example.com", "petrova@example.com", "sidorov@example.com"}
+		data := map[string]interface{}{"bookID": testWebinarBookID, "emails": emails, "eventID": testEventID, "reason": "опечатка в ФИО"}
+		if ok, errResp := env.callWebSocket(t, "reissueCertificates", data, &response); !ok {
+			t.Fatalf("error response: %s", errResp.Message)
+		}
+
+		ivanov := response.Users["ivanov@example.com"]
+		newSerial = ivanov.Serial
+		if ivanov.Error != "" || newSerial == "" || newSerial == oldSerial || ivanov.Link == "" || !reflect.DeepEqual(ivanov.RevokedSerials, []string{oldSerial}) {
+			t.Errorf("ivanov %+v, want new certificate instead of %s", ivanov, oldSerial)
+		}
+		if nobody := response.Users["nobody@example.com"]; !strings.Contains(nobody.Error, "user not found in DM book") {
+			t.Errorf("nobody %+v", nobody)
+		}
+		if petrova := response.Users["petrova@example.com"]; petrova.Serial != "" || !strings.Contains(petrova.Error, "attendance requirements") {
+			t.Errorf("petrova %+v", petrova)
+		}
+		if sidorov := response.Users["sidorov@example.com"]; sidorov.Serial != "" || !strings.Contains(sidorov.Error, "no certificate") {
+			t.Errorf("sidorov %+v", sidorov)
+		}
+
+		// файл заменен в хранилище, ссылка записана в книгу ДМ
+		if pdfs := storedFiles(t, ".pdf"); len(pdfs) != 1 {
+			t.Errorf("certificates in the store: %v", pdfs)
+		}
+		if member := env.dashaMail.Member(testWebinarBookID, "ivanov@example.com"); member["merge_6"] != ivanov.Link {
+			t.Errorf("DM link %v, want %v", member["merge_6"], ivanov.Link)
+		}
+
+		if old := verify(t, oldSerial); old.Valid || old.Status != certificates.STATUS_REVOKED || old.ReplacedBy != newSerial || old.RevokedAt == "" {
+			t.Errorf("old certificate %+v", old)
+		}
+		if reissued := verify(t, newSerial); !reissued.Valid || reissued.UserName != "Иванов И." {
+			t.Errorf("reissued certificate %+v", reissued)
+		}
+	})
+
+	t.Run("history", func(t *testing.T) {
+		var history []certificates.Record
+		if status := env.getJSON(t, "certificates/history", url.Values{"email": {"ivanov@example.com"}}, &history); status != http.StatusOK {
+			t.Fatalf("status %v, want %v", status, http.StatusOK)
+		}
+		if len(history) != 2 || history[0].Serial != oldSerial || history[0].RevocationReason != "опечатка в ФИО" || history[1].Serial != newSerial {
+			t.Errorf("history %+v", history)
+		}
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		var response CertificatesRevisionServerResponse
+		if status := env.postJSON(t, "syncPointsLedger", nil, nil); status != http.StatusOK {
+			t.Fatalf("points ledger sync status %v", status)
+		}
+
+		data := map[string]interface{}{"bookID": testWebinarBookID, "email": "ivanov@example.com", "reason": "выдан по ошибке"}
+		if ok, errResp := env.callWebSocket(t, "revokeCertificates", data, &response); !ok {
+			t.Fatalf("error response: %s", errResp.Message)
+		}
+		if ivanov := response.Users["ivanov@example.com"]; ivanov.Error != "" || !reflect.DeepEqual(ivanov.RevokedSerials, []string{newSerial}) {
+			t.Errorf("ivanov %+v", ivanov)
+		}
+
+		if pdfs := storedFiles(t, ".pdf"); len(pdfs) != 0 {
+			t.Errorf("certificates in the store: %v", pdfs)
+		}
+		if member := env.dashaMail.Member(testWebinarBookID, "ivanov@example.com"); member["merge_6"] != "" {
+			t.Errorf("DM link %v, want empty", member["merge_6"])
+		}
+		if revoked := verify(t, newSerial); revoked.Valid || revoked.ReplacedBy != "" {
+			t.Errorf("revoked certificate %+v", revoked)
+		}
+		for _, entry := range env.s.pointsLedger.Entries("ivanov@example.com") {
+			if entry.BookID == testWebinarBookID && entry.Certificate != "" {
+				t.Errorf("points ledger certificate %q, want empty", entry.Certificate)
+			}
+		}
+
+		// отзывать больше нечего
+		if ok, _ := env.callWebSocket(t, "revokeCertificates", data, &response); !ok || !strings.Contains(response.Users["ivanov@example.com"].Error, "user has no certificate") {
+			t.Errorf("ok %v, response %+v", ok, response)
+		}
+	})
+
+	t.Run("invalid data", func(t *testing.T) {
+		data := map[string]interface{}{"bookID": testWebinarBookID, "email": "ivanov@example.com"}
+		if ok, errResp := env.callWebSocket(t, "reissueCertificates", data, nil); ok || !strings.Contains(errResp.Message, "reason") {
+			t.Errorf("ok %v, message %q", ok, errResp.Message)
+		}
+
+		// без трансляций посещение не проверить
+		data = map[string]interface{}{"bookID": testWebinarBookID, "email": "petrova@example.com", "reason": "опечатка в ФИО"}
+		if ok, errResp := env.callWebSocket(t, "reissueCertificates", data, nil); ok || !strings.Contains(errResp.Message, "eventID or eventIDs must be set") {
+			t.Errorf("ok %v, message %q", ok, errResp.Message)
+		}
+	})
+}
+
+// failingAddMember пропускает первые allowed вызовов lists.add_member к DashaMail, а следующие завершает сетевой ошибкой.
+type failingAddMember struct {
+	allowed int
+}
+
+func (f *failingAddMember) RoundTrip(r *http.Request) (*http.Response, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if strings.Contains(string(body), `"lists.add_member"`) {
+		if f.allowed == 0 {
+			return nil, errors.New("connection reset by peer")
+		}
+		f.allowed--
+	}
+
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestCertificatesRevokeAfterDashaMailFailure(t *testing.T) {
+	env := newTestEnv(t, func(dm *dashamailtest.Fixture, fc *facecasttest.Fixture) {
+		for i := range dm.Lists {
+			if dm.Lists[i].ID == testWebinarBookID {
+				dm.Lists[i].Members = append(dm.Lists[i].Members, dashamail.Member{
+					"email":   "kuznetsov@example.com",
+					"state":   "active",
+					"merge_1": "Кузнецов Петр Петрович",
+					"merge_2": "Вебинар НМО",
+					"merge_3": "15 марта 2024",
+					"merge_6": "https://example.com/certificates/kuznetsov.pdf",
+				})
+			}
+		}
+	})
+	chdirWithTemplates(t)
+
+	data := map[string]interface{}{
+		"eventName": "Вебинар НМО",
+		"eventDate": "15 марта 2024",
+		"eventID":   testEventID,
+		"usersInfo": map[string]interface{}{
+			"ivanov@example.com": map[string]interface{}{"userName": "Иванов Иван Иванович", "zet": "2", "NMO": "NMO-2024-0315"},
+		},
+	}
+	var created struct {
+		Links map[string]LoadedCertificateInfo `json:"links"`
+	}
+	if ok, errResp := env.callWebSocket(t, "createCertificates", data, &created); !ok {
+		t.Fatalf("error response: %s", errResp.Message)
+	}
+	serial := created.Links["ivanov@example.com"].Serial
+
+	// ссылка ivanov очищается, а на kuznetsov связь с DashaMail пропадает
+	env.s.dashaMail = dashamail.NewClient(env.dashaMail.URL, testDashaMailApiKey, &http.Client{Transport: &failingAddMember{allowed: 1}})
+
+	emails := []string{"ivanov@example.com", "kuznetsov@example.com"}
+	response, debug := env.s.revokeCertificates(testWebinarBookID, emails, "выдан по ошибке", nil)
+	if debug.Error == nil || !strings.Contains(debug.Error.Error(), "connection reset by peer") {
+		t.Errorf("error %v, want DashaMail connection error", debug.Error)
+	}
+	if response == nil {
+		t.Fatal("no response with revoked certificates")
+	}
+
+	// файл ivanov удален и ссылка очищена до ошибки, поэтому его сертификат отозван и в реестре
+	if ivanov := response.Users["ivanov@example.com"]; ivanov.Error != "" || !reflect.DeepEqual(ivanov.RevokedSerials, []string{serial}) {
+		t.Errorf("ivanov %+v", ivanov)
+	}
+	if record, ok := env.s.certificatesRegistry.Find(serial); !ok || record.Status != certificates.STATUS_REVOKED {
+		t.Errorf("certificate with deleted file %+v", record)
+	}
+	if member := env.dashaMail.Member(testWebinarBookID, "ivanov@example.com"); member["merge_6"] != "" {
+		t.Errorf("DM link %v, want empty", member["merge_6"])
+	}
+
+	if kuznetsov := response.Users["kuznetsov@example.com"]; !strings.Contains(kuznetsov.Error, "connection reset by peer") {
+		t.Errorf("kuznetsov %+v", kuznetsov)
+	}
+}
+
+func TestCertificatesReissueAfterDashaMailFailure(t *testing.T) {
+	env := newTestEnv(t, nil)
+	chdirWithTemplates(t)
+
+	data := map[string]interface{}{
+		"eventName": "Вебинар НМО",
+		"eventDate": "15 марта 2024",
+		"eventID":   testEventID,
+		"usersInfo": map[string]interface{}{
+			"ivanov@example.com": map[string]interface{}{"userName": "Иванов Иван Иваныч", "zet": "2", "NMO": "NMO-2024-0315"},
+		},
+	}
+	var created struct {
+		Links map[string]LoadedCertificateInfo `json:"links"`
+	}
+	if ok, errResp := env.callWebSocket(t, "createCertificates", data, &created); !ok {
+		t.Fatalf("error response: %s", errResp.Message)
+	}
+	oldSerial := created.Links["ivanov@example.com"].Serial
+
+	// сертификат перевыпускается, но ссылку на него в книгу ДМ записать не удается
+	env.s.dashaMail = dashamail.NewClient(env.dashaMail.URL, testDashaMailApiKey, &http.Client{Transport: &failingAddMember{}})
+
+	response, debug := env.s.reissueCertificates(testWebinarBookID, []string{"ivanov@example.com"}, []string{testEventID}, "опечатка в ФИО", nil)
+	if debug.Error != nil {
+		t.Errorf("error %v", debug.Error)
+	}
+	if response == nil {
+		t.Fatal("no response with reissued certificates")
+	}
+
+	ivanov := response.Users["ivanov@example.com"]
+	if !strings.Contains(ivanov.Error, "connection reset by peer") || ivanov.Serial == "" || ivanov.Serial == oldSerial || ivanov.Link == "" ||
+		!reflect.DeepEqual(ivanov.RevokedSerials, []string{oldSerial}) {
+		t.Errorf("ivanov %+v, want new certificate with DM error", ivanov)
+	}
+	if record, ok := env.s.certificatesRegistry.Find(ivanov.Serial); !ok || record.Status == certificates.STATUS_REVOKED {
+		t.Errorf("reissued certificate %+v", record)
+	}
+}
+
+func TestCertificatesRevokeFromLegacyFolder(t *testing.T) {
+	env := newTestEnv(t, func(dm *dashamailtest.Fixture, fc *facecasttest.Fixture) {
+		for i := range dm.Lists {
+			if dm.Lists[i].ID == testWebinarBookID {
+				dm.Lists[i].Members = append(dm.Lists[i].Members, dashamail.Member{
+					"email":   "kuznetsov@example.com",
+					"state":   "active",
+					"merge_1": "Кузнецов Петр Петрович",
+					"merge_2": "Вебинар НМО",
+					"merge_3": "05 марта 2024",
+					"merge_6": "https://example.com/certificates/kuznetsov.pdf",
+				})
+			}
+		}
+	})
+
+	// сертификат загружен, когда папку мероприятия называли датой из книги ДМ, а не eventDate.Human() ("5 марта 2024")
+	legacyDir := filepath.Join(os.Getenv("STORAGE_LOCAL_DIR"), "Сертификаты НМО", "2024", "март", "05 марта 2024")
+	if err := os.MkdirAll(legacyDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(legacyDir, "Сертификат НМО для kuznetsov@example.com.pdf"), []byte("%PDF"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var response CertificatesRevisionServerResponse
+	data := map[string]interface{}{"bookID": testWebinarBookID, "email": "kuznetsov@example.com", "reason": "выдан по ошибке"}
+	if ok, errResp := env.callWebSocket(t, "revokeCertificates", data, &response); !ok {
+		t.Fatalf("error response: %s", errResp.Message)
+	}
+	if kuznetsov := response.Users["kuznetsov@example.com"]; kuznetsov.Error != "" {
+		t.Errorf("kuznetsov %+v", kuznetsov)
+	}
+
+	if pdfs := storedFiles(t, ".pdf"); len(pdfs) != 0 {
+		t.Errorf("certificates in the store: %v", pdfs)
+	}
+	if member := env.dashaMail.Member(testWebinarBookID, "kuznetsov@example.com"); member["merge_6"] != "" {
+		t.Errorf("DM link %v, want empty", member["merge_6"])
+	}
+}
+
+func TestCertificatesLinksWriteBack(t *testing.T) {
+	env := newTestEnv(t, nil)
+	chdirWithTemplates(t)
+
+	data := map[string]interface{}{
+		"eventName": "Вебинар НМО",
+		"eventDate": "15 марта 2024",
+		"eventID":   testEventID,
+		"bookID":    testWebinarBookID,
+		"usersInfo": map[string]interface{}{
+			"ivanov@example.com":  map[string]interface{}{"userName": "Иванов Иван Иванович", "zet": "2", "NMO": "NMO-2024-0315"},
+			"petrova@example.com": map[string]interface{}{"userName": "Петрова Анна Сергеевна", "academicHours": "2"},
+		},
+	}
+
+	t.Run("links written to the book", func(t *testing.T) {
+		var response struct {
+			Links     map[string]LoadedCertificateInfo `json:"links"`
+			DashaMail map[string]string                `json:"dashaMail"`
+		}
+		if ok, errResp := env.callWebSocket(t, "createCertificates", data, &response); !ok {
+			t.Fatalf("error response: %s", errResp.Message)
+		}
+
+		for _, email := range []string{"ivanov@example.com", "petrova@example.com"} {
+			link := response.Links[email].Link
+			if link == "" || response.DashaMail[email] != "ok" {
+				t.Errorf("%s: link %q, DM result %q", email, link, response.DashaMail[email])
+			}
+			if member := env.dashaMail.Member(testWebinarBookID, email); member["merge_6"] != link {
+				t.Errorf("%s: DM link %v, want %v", email, member["merge_6"], link)
+			}
+		}
+	})
+
+	t.Run("without book", func(t *testing.T) {
+		data := map[string]interface{}{"eventName": data["eventName"], "eventDate": data["eventDate"], "eventID": testEventID, "usersInfo": data["usersInfo"]}
+		var response map[string]interface{}
+		if ok, errResp := env.callWebSocket(t, "createCertificates", data, &response); !ok {
+			t.Fatalf("error response: %s", errResp.Message)
+		}
+		if _, ok := response["dashaMail"]; ok {
+			t.Errorf("response %+v, want no DM results", response)
+		}
+	})
+
+	t.Run("unknown book", func(t *testing.T) {
+		before := len(storedFiles(t, ".pdf"))
+
+		data := map[string]interface{}{"eventName": data["eventName"], "eventDate": "16 марта 2024", "eventID": testEventID, "usersInfo": data["usersInfo"], "bookID": "404"}
+		if ok, errResp := env.callWebSocket(t, "createCertificates", data, nil); ok || !strings.Contains(errResp.Message, "DashaMail") {
+			t.Errorf("ok %v, message %q", ok, errResp.Message)
+		}
+		if after := len(storedFiles(t, ".pdf")); after != before {
+			t.Errorf("certificates in the store: %v, want %v (nothing created for unknown book)", after, before)
+		}
+	})
+}
+
+func TestCertificatesDashaMailScope(t *testing.T) {
+	env := newTestEnv(t, nil)
+
+	var err error
+	if _, env.token, err = env.s.apiClients.Issue("certificates", []string{auth.SCOPE_CERTIFICATES_WRITE}); err != nil {
+		t.Fatal(err)
+	}
+
+	// без права dashamail:write нельзя писать в книгу ДМ через методы сертификатов
+	createData := map[string]interface{}{
+		"eventName": "Вебинар НМО",
+		"eventDate": "15 марта 2024",
+		"bookID":    testWebinarBookID,
+		"usersInfo": map[string]interface{}{"ivanov@example.com": map[string]interface{}{"userName": "Иванов Иван Иванович", "zet": "2", "NMO": "NMO-2024-0315"}},
+	}
+	revisionData := map[string]interface{}{"bookID": testWebinarBookID, "email": "ivanov@example.com", "reason": "выдан по ошибке"}
+	for apiMethod, data := range map[string]map[string]interface{}{
+		"createCertificates":  createData,
+		"reissueCertificates": revisionData,
+		"revokeCertificates":  revisionData,
+	} {
+		if ok, errResp := env.callWebSocket(t, apiMethod, data, nil); ok || !strings.Contains(errResp.Message, auth.SCOPE_DASHAMAIL_WRITE) {
+			t.Errorf("%s: ok %v, message %q", apiMethod, ok, errResp.Message)
+		}
+
+		var errResp ErrorMessageServerResponse
+		if status := env.postJSON(t, "jobs", map[string]interface{}{"apiMethod": apiMethod, "data": data}, &errResp); status != http.StatusForbidden || !strings.Contains(errResp.Message, auth.SCOPE_DASHAMAIL_WRITE) {
+			t.Errorf("%s job: status %v, message %q", apiMethod, status, errResp.Message)
+		}
+	}
+
+	// без книги createCertificates в ДМ не пишет (параметры неполные, чтобы задача не создавала сертификаты)
+	withoutBook := map[string]interface{}{"eventName": createData["eventName"]}
+	if status := env.postJSON(t, "jobs", map[string]interface{}{"apiMethod": "createCertificates", "data": withoutBook}, nil); status != http.StatusOK {
+		t.Errorf("createCertificates job without book: status %v, want %v", status, http.StatusOK)
+	}
+}
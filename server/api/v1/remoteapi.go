@@ -1,25 +1,33 @@
 package v1
 
 import (
-	"encoding/json"
+	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"github.com/lukasjarosch/go-docx"
 	excel "github.com/xuri/excelize/v2"
 	"html"
 	"io/ioutil"
 	"math"
-	"net/http"
 	"net/url"
 	"os"
-	"os/exec"
+	"path"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
+	"zo-backend/auth"
+	"zo-backend/certificates"
+	"zo-backend/dashamail"
+	"zo-backend/eventdate"
+	"zo-backend/facecast"
+	"zo-backend/jobs"
+	"zo-backend/points"
 	. "zo-backend/server/api"
-	yd "zo-backend/ya-disk"
+	"zo-backend/storage"
+	"zo-backend/webinars"
 )
 
 func (s *ServerApi) getUserLK(email string) (*GetUserServerResponse, *ServerDebug) {
@@ -33,30 +41,13 @@ func (s *ServerApi) getUserLK(email string) (*GetUserServerResponse, *ServerDebu
 		return nil, debug
 	}
 
-	jsonData := s.getJSONBytes(DashaMailRequest{
-		Method: "lists.get_members",
-		Email:  email,
-		BookID: "82599",
-	})
-
-	response, err := DoRequestPOST(s.dashaMailAcc.URI, jsonData, debug)
-	if err != nil {
-		return nil, debug
-	}
-
-	data := UnmarshalResponseData(response)
-
-	err = data.Msg.CheckForError(debug)
-	if err != nil {
-		return nil, debug
-	}
-
-	err = data.Data.CheckForOnlyOneElement(debug)
+	member, err := s.dashaMail.Lists.GetMember("82599", email)
 	if err != nil {
+		debug.SetDebugDataFromError(err)
 		return nil, debug
 	}
 
-	return setServerApiUserFields(data.Data[0], titles, debug), nil
+	return setServerApiUserFields(member, titles, debug), nil
 }
 
 // Параметр tildaView отвечает за то, какие параметры будут использованы в качестве ключей в возвращаемой карте.
@@ -76,58 +67,20 @@ func (s *ServerApi) getBookTitles(bookID string, tildaView bool, debug *ServerDe
 		return nil, err
 	}
 
-	jsonData := s.getJSONBytes(DashaMailRequest{
-		Method:     "lists.get",
-		BookID:     bookID,
-		JSONFormat: 1, // любой int вернет данные массивов в виде JSON-представления
-	})
-
-	response, err := DoRequestPOST(s.dashaMailAcc.URI, jsonData, debug)
-	if err != nil {
-		return nil, err
-	}
-
-	data := UnmarshalResponseData(response)
-
-	err = data.Msg.CheckForError(debug)
-	if err != nil {
-		return nil, err
-	}
-
-	err = data.Data.CheckForOnlyOneElement(debug)
+	list, err := s.dashaMail.Lists.GetOne(bookID)
 	if err != nil {
+		debug.SetDebugDataFromError(err)
 		return nil, err
 	}
 
-	/*/
-	 * Здесь и далее, скорее всего, это нечего не даст, так как если что-то произойдет с горутинами, то нигде не выведется мой Debug
-	 * на досуге подумать, надо ли так делать
-	/*/
-	debug.SetDebugLastStage("group of goroutines")
 	titles := make(map[string]string)
-	respData := data.Data[0]
-	var mu sync.Mutex
-	var wg sync.WaitGroup
-	wg.Add(len(respData))
-
-	for columnName := range respData {
-		go func(columnName string) {
-			defer wg.Done()
-
-			if strings.Contains(columnName, "merge_") {
-				val := DashaMailColumnTitle{}
-				_ = json.Unmarshal([]byte(respData[columnName].(string)), &val)
-				mu.Lock()
-				if tildaView {
-					titles[strings.ToLower(val.Title)] = strings.ToLower(columnName)
-				} else {
-					titles[strings.ToLower(columnName)] = strings.ToLower(val.Title)
-				}
-				mu.Unlock()
-			}
-		}(columnName)
+	for columnName, title := range list.Fields {
+		if tildaView {
+			titles[strings.ToLower(title)] = strings.ToLower(columnName)
+		} else {
+			titles[strings.ToLower(columnName)] = strings.ToLower(title)
+		}
 	}
-	wg.Wait()
 
 	return &titles, nil
 }
@@ -143,14 +96,9 @@ func (s *ServerApi) getUserPoints(email, pointsType string) (*GetUserPointsServe
 		return nil, debug
 	}
 
-	booksIDs, err := s.getAllBooks(debug)
-	if err != nil {
-		return nil, debug
-	}
-
-	nowQuarter, nowYear := getPointZOTimeFrames(pointsType)
+	nowYear, nowQuarter := getPointZOTimeFrames(pointsType)
 	pointsInfo := GetUserPointsServerResponse{}
-	data, err := s.getDashaMailDataForEmail(*booksIDs, email, debug, nil)
+	data, err := s.getUserPointsData(email, debug)
 	if err != nil {
 		return nil, debug
 	}
@@ -163,12 +111,13 @@ func (s *ServerApi) getUserPoints(email, pointsType string) (*GetUserPointsServe
 	case "NMO":
 		for _, userPointsInfo := range *data {
 			if correctPoints(userPointsInfo.NMO) {
-				if dateInYear(userPointsInfo.EventDate, nowYear) {
+				eventDate, _ := eventdate.Parse(userPointsInfo.EventDate) // нераспознанная дата не попадает ни в год, ни в квартал
+				if eventDate.InYear(nowYear) {
 					pointsNMO, _ := strconv.Atoi(userPointsInfo.ZET)
 					pointsInfo.YearPoints += pointsNMO
 				}
 
-				if dateInQuarter(userPointsInfo.EventDate, nowYear, nowQuarter) {
+				if eventDate.InQuarter(nowYear, nowQuarter) {
 					pointsNMO, _ := strconv.Atoi(userPointsInfo.ZET)
 					pointsInfo.QuarterPoints += pointsNMO
 				}
@@ -186,14 +135,15 @@ func (s *ServerApi) getUserPoints(email, pointsType string) (*GetUserPointsServe
 	case "ZO":
 		for _, userPointsInfo := range *data {
 			if pointsType == "ZO" && (correctPoints(userPointsInfo.PointsZOView) || correctPoints(userPointsInfo.PointsZOQuestion) || correctPoints(userPointsInfo.PointsZOPoll)) {
-				if dateInYear(userPointsInfo.EventDate, nowYear) {
+				eventDate, _ := eventdate.Parse(userPointsInfo.EventDate)
+				if eventDate.InYear(nowYear) {
 					pointsZOView, _ := strconv.Atoi(userPointsInfo.PointsZOView)
 					pointsZOQuestion, _ := strconv.Atoi(userPointsInfo.PointsZOQuestion)
 					pointsZOPool, _ := strconv.Atoi(userPointsInfo.PointsZOPoll)
 					pointsInfo.YearPoints += pointsZOView + pointsZOQuestion + pointsZOPool
 				}
 
-				if dateInQuarter(userPointsInfo.EventDate, nowYear, nowQuarter) {
+				if eventDate.InQuarter(nowYear, nowQuarter) {
 					pointsZOView, _ := strconv.Atoi(userPointsInfo.PointsZOView)
 					pointsZOQuestion, _ := strconv.Atoi(userPointsInfo.PointsZOQuestion)
 					pointsZOPool, _ := strconv.Atoi(userPointsInfo.PointsZOPoll)
@@ -214,32 +164,184 @@ func (s *ServerApi) getUserPoints(email, pointsType string) (*GetUserPointsServe
 	return &pointsInfo, debug
 }
 
-func (s *ServerApi) getAllBooks(debug *ServerDebug) (*[]string, error) {
-	debug.SetDebugLastStage("getAllBooks -> ")
+// getUserPointsHistory возвращает баллы НМО и ЗО пользователя за период с разбивкой по периодам и типам мероприятий.
+func (s *ServerApi) getUserPointsHistory(email string, period pointsHistoryPeriod) (*GetUserPointsHistoryServerResponse, *ServerDebug) {
+	debug := NewServerDebug("start of getUserPointsHistory -> ")
+
+	var err error
+	defer debug.SetDebugFinalStage(&err, "end of getUserPointsHistory")
+
+	data, err := s.getUserPointsData(email, debug)
+	if err != nil {
+		return nil, debug
+	}
+
+	history, err := buildPointsHistory(*data, s.pointsRules.Rules(), period)
+	if err != nil {
+		return nil, debug
+	}
+
+	return history, debug
+}
+
+// getUserPointsData возвращает баллы пользователя по книгам DashaMail из реестра баллов. До первой синхронизации реестра
+// книги читаются напрямую из DashaMail.
+func (s *ServerApi) getUserPointsData(email string, debug *ServerDebug) (*map[string]GetUserServerResponse, error) {
+	debug.SetDebugLastStage("getUserPointsData -> ")
 
 	var err error
 	defer debug.DeleteDebugLastStage(&err)
 
-	jsonData := s.getJSONBytes(DashaMailRequest{
-		Method:     "lists.get",
-		JSONFormat: 1, // любой int вернет данные массивов в виде JSON-представления
-	})
+	if s.pointsLedger.Synced() {
+		return ledgerUserData(s.pointsLedger.Entries(email)), nil
+	}
+
+	booksIDs, err := s.getAllBooks(debug)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.getDashaMailDataForEmail(*booksIDs, email, debug, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// syncPointsLedger пересобирает реестр баллов: читает все книги DashaMail и сохраняет баллы НМО и ЗО каждого пользователя.
+func (s *ServerApi) syncPointsLedger(wsWaiterResp *WebSocketWaiterResponse) (*PointsLedgerServerResponse, *ServerDebug) {
+	debug := NewServerDebug("start of syncPointsLedger -> ")
+	setNewWSWaiterMessage(wsWaiterResp, "started points ledger sync")
+
+	var err error
+	defer debug.SetDebugFinalStage(&err, "end of syncPointsLedger")
+
+	if !s.ledgerSync.TryLock() {
+		err = fmt.Errorf("points ledger sync is already running")
+		return nil, debug
+	}
+	defer s.ledgerSync.Unlock()
+
+	booksIDs, err := s.getAllBooks(debug)
+	if err != nil {
+		return nil, debug
+	}
+
+	entries, err := s.readPointsEntries(*booksIDs, debug, wsWaiterResp)
+	if err != nil {
+		return nil, debug
+	}
+
+	err = s.pointsLedger.Replace(entries, len(*booksIDs), time.Now())
+	if err != nil {
+		return nil, debug
+	}
+
+	syncedAt, books, users := s.pointsLedger.Stats()
+	return &PointsLedgerServerResponse{SyncedAt: TimeToHuman(syncedAt), Books: books, Users: users}, debug
+}
+
+// readPointsEntries читает книги booksIDs (не больше 20 одновременно) и собирает записи реестра баллов по email пользователей.
+func (s *ServerApi) readPointsEntries(booksIDs []string, debug *ServerDebug, wsWaiterResp *WebSocketWaiterResponse) (map[string][]points.Entry, error) {
+	debug.SetDebugLastStage("readPointsEntries -> ")
+
+	var err error
+	defer debug.DeleteDebugLastStage(&err)
+
+	if err = checkCancelled(wsWaiterResp); err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string][]points.Entry)
+	if len(booksIDs) == 0 {
+		return entries, nil
+	}
+
+	errChan := initErrChan()
+	goNum := initGoNum(len(booksIDs), 20)
+	books := initSyncMap()
+	debug.SetDebugLastStage("group of goroutines")
+
+	for _, bookID := range booksIDs {
+		go func(bookID string) {
+			goNum.ControlMaxNum <- struct{}{}
+
+			defer func() {
+				setNewWSWaiterMessage(wsWaiterResp, goNumProgress(goNum, "reading books' points from DashaMail"))
+				<-goNum.ControlMaxNum
+				calcGoNum(goNum, errChan)
+			}()
+
+			if !errChan.OpenedState {
+				return
+			}
+
+			localDebug := NewServerDebug(fmt.Sprintf(" -> goroutine for bookID %v -> ", bookID))
+			if err := checkCancelled(wsWaiterResp); err != nil {
+				sendErrToErrChan(err, errChan, debug, localDebug)
+				return
+			}
+
+			infoDM, err := s.getDashaMailDataForBook(bookID, localDebug, nil)
+			if err != nil {
+				sendErrToErrChan(err, errChan, debug, localDebug)
+				return
+			}
 
-	response, err := DoRequestPOST(s.dashaMailAcc.URI, jsonData, debug)
+			addToSyncMap(books, bookID, *infoDM)
+		}(bookID)
+	}
+
+	err = <-errChan.Chan
 	if err != nil {
 		return nil, err
 	}
 
-	data := UnmarshalResponseData(response)
+	for bookID, infoDM := range books.Map {
+		for email, info := range infoDM.(map[string]GetUserServerResponse) {
+			if entry, ok := pointsEntry(bookID, info); ok {
+				entries[email] = append(entries[email], entry)
+			}
+		}
+	}
+
+	return entries, nil
+}
+
+// schedulePointsLedgerSync ставит синхронизацию реестра баллов в очередь фоновых задач раз в interval
+// (и сразу после запуска, если реестр еще ни разу не синхронизировался).
+func (s *ServerApi) schedulePointsLedgerSync(interval time.Duration) {
+	submit := func() {
+		if _, debug := s.submitJob("", "syncPointsLedger", nil); debug != nil && debug.Error != nil {
+			fmt.Println(fmt.Errorf("+++++++ CAN'T SCHEDULE POINTS LEDGER SYNC: %s +++++++", GetErrorMessage(debug)))
+		}
+	}
+
+	if !s.pointsLedger.Synced() {
+		submit()
+	}
+
+	for range time.Tick(interval) {
+		submit()
+	}
+}
+
+func (s *ServerApi) getAllBooks(debug *ServerDebug) (*[]string, error) {
+	debug.SetDebugLastStage("getAllBooks -> ")
 
-	err = data.Msg.CheckForError(debug)
+	var err error
+	defer debug.DeleteDebugLastStage(&err)
+
+	lists, err := s.dashaMail.Lists.Get("")
 	if err != nil {
+		debug.SetDebugDataFromError(err)
 		return nil, err
 	}
 
-	booksIDs := make([]string, 0)
-	for _, book := range data.Data {
-		booksIDs = append(booksIDs, book["id"].(string))
+	booksIDs := make([]string, 0, len(lists))
+	for _, book := range lists {
+		booksIDs = append(booksIDs, book.ID)
 	}
 
 	return &booksIDs, nil
@@ -251,6 +353,10 @@ func (s *ServerApi) getDashaMailDataForEmail(booksIDs []string, email string, de
 	var err error
 	defer debug.DeleteDebugLastStage(&err)
 
+	if err = checkCancelled(wsWaiterResp); err != nil {
+		return nil, err
+	}
+
 	errChan := initErrChan()
 	goNum := initGoNum(len(booksIDs), 300)
 	usersInfo := initSyncMap()
@@ -261,17 +367,17 @@ func (s *ServerApi) getDashaMailDataForEmail(booksIDs []string, email string, de
 			goNum.ControlMaxNum <- struct{}{}
 
 			defer func() {
-				setNewWSWaiterMessage(wsWaiterResp, fmt.Sprintf("reading books' info from DashaMail: %v done, %v left", goNum.Counter, goNum.Num-goNum.Counter))
+				setNewWSWaiterMessage(wsWaiterResp, goNumProgress(goNum, "reading books' info from DashaMail"))
 				<-goNum.ControlMaxNum
 				calcGoNum(goNum, errChan)
 			}()
 
 			localDebug := NewServerDebug(fmt.Sprintf(" -> goroutine for bookID %v -> ", bookID))
 			var user *GetUserServerResponse
-			var err error
 			var titles *map[string]string
 
-			if errChan.OpenedState {
+			err := checkCancelled(wsWaiterResp)
+			if err == nil && errChan.OpenedState {
 				titles, err = s.getBookTitles(bookID, false, localDebug)
 				if err != nil {
 					sendErrToErrChan(err, errChan, debug, localDebug)
@@ -309,35 +415,74 @@ func (s *ServerApi) readEmailData(bookID string, titles *map[string]string, emai
 	var err error
 	defer debug.DeleteDebugLastStage(&err)
 
-	jsonData := s.getJSONBytes(DashaMailRequest{
-		Method: "lists.get_members",
-		Email:  email,
-		BookID: bookID,
-	})
-
-	response, err := DoRequestPOST(s.dashaMailAcc.URI, jsonData, debug)
+	member, err := s.dashaMail.Lists.GetMember(bookID, email)
 	if err != nil {
+		// ошибку DashaMail (например, "нет такого подписчика") возвращаем как информацию о пользователе
+		var dmErr *dashamail.Error
+		if errors.As(err, &dmErr) {
+			err = nil
+			return &GetUserServerResponse{Message: "ошибка чтения: " + dmErr.Error()}, nil
+		}
+
+		debug.SetDebugDataFromError(err)
 		return nil, err
 	}
 
-	data := UnmarshalResponseData(response)
+	return setServerApiUserFields(member, titles, debug), nil
+}
+
+// getWebinarReportInfo строит отчет по вебинару, а если трансляций несколько - сводный отчет по залам конференции.
+func (s *ServerApi) getWebinarReportInfo(eventIDs []string, wsWaiterResp *WebSocketWaiterResponse) (*GetReportServerResponse, *ServerDebug) {
+	debug := NewServerDebug("start of getWebinarReportInfo -> ")
+	setNewWSWaiterMessage(wsWaiterResp, "started getting the report")
 
-	err = data.Msg.CheckForError(debug)
+	var err error
+	defer debug.SetDebugFinalStage(&err, "end of getWebinarReportInfo")
+
+	report, err := s.buildEventsReport(eventIDs, debug, wsWaiterResp)
 	if err != nil {
-		return &GetUserServerResponse{Message: "ошибка чтения: " + err.Error()}, nil
+		return nil, debug
 	}
 
-	err = data.Data.CheckForOnlyOneElement(debug)
-	if err != nil {
-		return nil, err
+	return report, debug
+}
+
+// buildEventsReport строит отчет по вебинару eventIDs[0] или, если трансляций несколько, сводный отчет по залам конференции.
+func (s *ServerApi) buildEventsReport(eventIDs []string, debug *ServerDebug, wsWaiterResp *WebSocketWaiterResponse) (*GetReportServerResponse, error) {
+	if len(eventIDs) == 1 {
+		return s.buildWebinarReport(eventIDs[0], debug, wsWaiterResp)
 	}
 
-	return setServerApiUserFields(data.Data[0], titles, debug), nil
+	return s.buildConferenceReport(eventIDs, debug, wsWaiterResp)
 }
 
-func (s *ServerApi) getWebinarReportInfo(eventID string, wsWaiterResp *WebSocketWaiterResponse) (*GetReportServerResponse, *ServerDebug) {
-	debug := NewServerDebug("start of getWebinarReportInfo -> ")
-	setNewWSWaiterMessage(wsWaiterResp, "started getting the report")
+// buildConferenceReport строит отчеты по всем залам конференции так же, как отчет по одному вебинару, и сводит их
+// в один отчет. Залы читаются по очереди, как и занятия серии.
+func (s *ServerApi) buildConferenceReport(eventIDs []string, debug *ServerDebug, wsWaiterResp *WebSocketWaiterResponse) (*GetReportServerResponse, error) {
+	debug.SetDebugLastStage("buildConferenceReport -> ")
+
+	var err error
+	defer debug.DeleteDebugLastStage(&err)
+
+	reports := make([]*GetReportServerResponse, 0, len(eventIDs))
+	for i, eventID := range eventIDs {
+		setNewWSWaiterMessage(wsWaiterResp, fmt.Sprintf("building the report for hall %s: %v done, %v left", eventID, i, len(eventIDs)-i))
+
+		var report *GetReportServerResponse
+		report, err = s.buildWebinarReport(eventID, debug, nil)
+		if err != nil {
+			err = fmt.Errorf("event %s: %+v", eventID, err)
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+
+	return BuildConferenceReport(eventIDs, reports, s.pointsRules.Rules()), nil
+}
+
+// buildWebinarReport собирает данные отчета по вебинару из ФК (зрители, минуты и окна) и ДМ (анкеты зрителей).
+func (s *ServerApi) buildWebinarReport(eventID string, debug *ServerDebug, wsWaiterResp *WebSocketWaiterResponse) (*GetReportServerResponse, error) {
+	debug.SetDebugLastStage("buildWebinarReport -> ")
 
 	var (
 		report *GetReportServerResponse
@@ -345,7 +490,7 @@ func (s *ServerApi) getWebinarReportInfo(eventID string, wsWaiterResp *WebSocket
 	)
 
 	var err error
-	defer debug.SetDebugFinalStage(&err, "end of getWebinarReportInfo")
+	defer debug.DeleteDebugLastStage(&err)
 
 	errChan := initErrChan()
 	goNum := initGoNum(3)
@@ -439,10 +584,14 @@ func (s *ServerApi) getWebinarReportInfo(eventID string, wsWaiterResp *WebSocket
 
 	err = <-errChan.Chan
 	if err != nil {
-		return nil, debug
+		return nil, err
 	}
 
-	eventMaxPoints := GetEventMaxPoints(report.EventInfo.VideoName) // получаем здесь отдельно один раз, чтобы не получать отдельно для каждого пользователя
+	pointsRules := s.pointsRules.Rules() // снимок правил, чтобы весь отчет считался по одним правилам даже при их перезагрузке
+	awardPoints := func(user UserInfo) int {
+		award := pointsRules.Award(report.EventInfo.VideoName, report.EventInfo.Duration, user.MinutesViewedOnline, user.MinutesViewedOffline, time.Time{})
+		return award.Points
+	}
 	for _, user := range users {
 		email := user.Email
 
@@ -480,8 +629,8 @@ func (s *ServerApi) getWebinarReportInfo(eventID string, wsWaiterResp *WebSocket
 				newUser.LastMinuteOffline = newUser.MinutesOffline[newUser.MinutesViewedOffline-1] // обновляем информацию по последней минуте офлайн
 			}
 
-			newUser.ViewRegime = GetViewRegime(newUser.MinutesViewedOnline, newUser.MinutesViewedOffline)                                                    // перезаписываем режим просмотра, т.к. мог измениться
-			newUser.PointsZOView = int(GetPointsZOView(eventMaxPoints, report.EventInfo.Duration, newUser.MinutesViewedOnline+newUser.MinutesViewedOffline)) // пересчитываем бонусы ЗО, т.к. могли измениться
+			newUser.ViewRegime = GetViewRegime(newUser.MinutesViewedOnline, newUser.MinutesViewedOffline) // перезаписываем режим просмотра, т.к. мог измениться
+			newUser.PointsZOView = awardPoints(newUser)                                                   // пересчитываем бонусы ЗО, т.к. могли измениться
 
 			report.UsersInfo[strings.ToLower(email)] = newUser
 		} else {
@@ -496,7 +645,7 @@ func (s *ServerApi) getWebinarReportInfo(eventID string, wsWaiterResp *WebSocket
 			user.Position = (*infoDM)[email].Position
 			user.Own = (*infoDM)[email].Own
 			user.ViewRegime = GetViewRegime(user.MinutesViewedOnline, user.MinutesViewedOffline)
-			user.PointsZOView = int(GetPointsZOView(eventMaxPoints, report.EventInfo.Duration, user.MinutesViewedOnline+user.MinutesViewedOffline))
+			user.PointsZOView = awardPoints(user)
 			if user.MinutesViewedOnline != 0 {
 				user.FirstMinuteOnline = user.MinutesOnline[0]
 				user.LastMinuteOnline = user.MinutesOnline[len(user.MinutesOnline)-1]
@@ -518,240 +667,1050 @@ func (s *ServerApi) getWebinarReportInfo(eventID string, wsWaiterResp *WebSocket
 	return report, nil
 }
 
-func (s *ServerApi) getCampaignsReportInfo(startDate, endDate string, wsWaiterResp *WebSocketWaiterResponse) (*[]interface{}, *ServerDebug) {
-	debug := NewServerDebug("start of getCampaignsReportInfo -> ")
-	setNewWSWaiterMessage(wsWaiterResp, "started getting the report")
+func (s *ServerApi) getSeriesReportInfo(eventIDs []string, wsWaiterResp *WebSocketWaiterResponse) (*GetSeriesReportServerResponse, *ServerDebug) {
+	debug := NewServerDebug("start of getSeriesReportInfo -> ")
+	setNewWSWaiterMessage(wsWaiterResp, "started getting the series report")
 
 	var err error
-	defer debug.SetDebugFinalStage(&err, "end of getCampaignsReportInfo")
+	defer debug.SetDebugFinalStage(&err, "end of getSeriesReportInfo")
 
-	campaignsMainInfo, err := s.getCampaignsMainInfo(startDate, endDate, debug)
+	series, err := s.buildSeriesReport(eventIDs, debug, wsWaiterResp)
 	if err != nil {
 		return nil, debug
 	}
 
-	errChan := initErrChan()
-	goNum := initGoNum(len(*campaignsMainInfo), 300)
-	campaignsReport := initSyncArray()
-	debug.SetDebugLastStage("group of goroutines")
-
-	for i, campaignMainInfo := range *campaignsMainInfo {
-		go func(i int, campaignMainInfo DashaMailCampaignReport) {
-			goNum.ControlMaxNum <- struct{}{}
+	return series, debug
+}
 
-			defer func() {
-				setNewWSWaiterMessage(wsWaiterResp, fmt.Sprintf("reading detailed campaigns' info from DashaMail: %v done, %v left", goNum.Counter, goNum.Num-goNum.Counter))
-				<-goNum.ControlMaxNum
-				calcGoNum(goNum, errChan)
-			}()
+// buildSeriesReport строит отчеты по всем занятиям серии так же, как отчет по одному вебинару, и сводит их в отчет по серии.
+// Занятия читаются по очереди, чтобы не умножать нагрузку на Facecast и DashaMail на число занятий.
+func (s *ServerApi) buildSeriesReport(eventIDs []string, debug *ServerDebug, wsWaiterResp *WebSocketWaiterResponse) (*GetSeriesReportServerResponse, error) {
+	debug.SetDebugLastStage("buildSeriesReport -> ")
 
-			localDebug := NewServerDebug(fmt.Sprintf(" -> goroutine for campaign %v with id %v -> ", campaignMainInfo.Name, campaignMainInfo.ID))
-			var campaignDetailedInfo *DashaMailCampaignReport
-			var err error
-			if errChan.OpenedState {
-				campaignDetailedInfo, err = s.getCampaignDetailedInfo(campaignMainInfo.ID, localDebug)
-			}
+	var err error
+	defer debug.DeleteDebugLastStage(&err)
 
-			if err != nil {
-				sendErrToErrChan(err, errChan, debug, localDebug)
-			}
+	reports := make([]*GetReportServerResponse, 0, len(eventIDs))
+	for i, eventID := range eventIDs {
+		setNewWSWaiterMessage(wsWaiterResp, fmt.Sprintf("building the report for event %s: %v done, %v left", eventID, i, len(eventIDs)-i))
 
-			if campaignDetailedInfo != nil {
-				atoi := func(a string) int { i, _ := strconv.Atoi(a); return i }
-				addToSyncArray(campaignsReport, CampaignReport{
-					Date:              campaignMainInfo.Date,
-					Name:              html.UnescapeString(campaignMainInfo.Name),
-					TagUTM:            campaignMainInfo.TagUTM,
-					SourceUTM:         campaignMainInfo.SourceUTM,
-					MediumUTM:         campaignMainInfo.MediumUTM,
-					ContentUTM:        campaignMainInfo.ContentUTM,
-					TermUTM:           campaignMainInfo.TermUTM,
-					Sent:              atoi(campaignDetailedInfo.Sent),
-					Clicked:           atoi(campaignDetailedInfo.Clicked),
-					Opened:            atoi(campaignDetailedInfo.Opened),
-					FirstSent:         campaignDetailedInfo.FirstSent,
-					FirstOpen:         campaignDetailedInfo.FirstOpen,
-					LastOpen:          campaignDetailedInfo.LastOpen,
-					FirstClick:        campaignDetailedInfo.FirstClick,
-					LastClick:         campaignDetailedInfo.LastClick,
-					UniqueOpened:      atoi(campaignDetailedInfo.UniqueOpened),
-					UniqueClicked:     atoi(campaignDetailedInfo.UniqueClicked),
-					Unsubscribed:      atoi(campaignDetailedInfo.Unsubscribed),
-					SpamComplained:    atoi(campaignDetailedInfo.SpamComplained),
-					SpamBlocked:       atoi(campaignDetailedInfo.SpamBlocked),
-					SpamMarked:        atoi(campaignDetailedInfo.SpamMarked),
-					MailSystemBlocked: atoi(campaignDetailedInfo.MailSystemBlocked),
-					Hard:              atoi(campaignDetailedInfo.Hard),
-					Soft:              atoi(campaignDetailedInfo.Soft),
-				})
-			}
-		}(i, campaignMainInfo)
+		var report *GetReportServerResponse
+		report, err = s.buildWebinarReport(eventID, debug, nil)
+		if err != nil {
+			err = fmt.Errorf("event %s: %+v", eventID, err)
+			return nil, err
+		}
+		reports = append(reports, report)
 	}
 
-	err = <-errChan.Chan
-	if err != nil {
-		return nil, debug
-	}
+	return BuildSeriesReport(eventIDs, reports), nil
+}
 
-	sort.Slice(campaignsReport.Array, func(i, j int) bool {
-		earlier, _ := time.Parse("2006-01-02 15:04:05", campaignsReport.Array[j].(CampaignReport).Date)
-		later, _ := time.Parse("2006-01-02 15:04:05", campaignsReport.Array[i].(CampaignReport).Date)
-		return later.After(earlier)
-	})
+// previewPoints считает по действующим правилам баллы ЗО, которые получит зритель за мероприятие, без записи в DashaMail.
+func (s *ServerApi) previewPoints(req pointsPreviewRequest) (*PreviewPointsServerResponse, *ServerDebug) {
+	debug := NewServerDebug("start of previewPoints -> ")
+
+	var err error
+	defer debug.SetDebugFinalStage(&err, "end of previewPoints")
+
+	if req.eventID != "" {
+		var report *GetReportServerResponse
+		report, err = s.getWebinarHeader(req.eventID, debug)
+		if err != nil {
+			return nil, debug
+		}
+
+		req.videoName = report.EventInfo.VideoName
+		req.duration = report.EventInfo.Duration
+	}
 
-	//fmt.Printf("---DATA: %+v\n", campaignsReport.Array)
+	award := s.pointsRules.Rules().Award(req.videoName, req.duration, req.minutesOnline, req.minutesOffline, req.earnedAt)
 
-	return &campaignsReport.Array, nil
+	return &PreviewPointsServerResponse{VideoName: req.videoName, Duration: req.duration, Award: award}, debug
 }
 
-func (s *ServerApi) getCampaignsMainInfo(startDate, endDate string, debug *ServerDebug) (*[]DashaMailCampaignReport, error) {
-	debug.SetDebugLastStage("getCampaignsMainInfo -> ")
+func (s *ServerApi) getCampaignsReportInfo(startDate, endDate string, wsWaiterResp *WebSocketWaiterResponse) (*[]interface{}, *ServerDebug) {
+	debug := NewServerDebug("start of getCampaignsReportInfo -> ")
+	setNewWSWaiterMessage(wsWaiterResp, "started getting the report")
 
 	var err error
-	defer debug.DeleteDebugLastStage(&err)
+	defer debug.SetDebugFinalStage(&err, "end of getCampaignsReportInfo")
 
-	_, err = time.Parse("2006-01-02", startDate)
+	campaignsMainInfo, err := s.getCampaignsMainInfo(startDate, endDate, debug)
 	if err != nil {
-		err = fmt.Errorf("error startDate format (need 'YYYY-MM-DD')")
-		return nil, err
+		return nil, debug
 	}
 
-	end, err := time.Parse("2006-01-02", endDate)
+	campaignsReport, err := s.readCampaignsReports(*campaignsMainInfo, true, debug, wsWaiterResp)
 	if err != nil {
-		err = fmt.Errorf("error endDate format (need 'YYYY-MM-DD')")
-		return nil, err
+		return nil, debug
 	}
-	/*/
+
+	//fmt.Printf("---DATA: %+v\n", campaignsReport)
+
+	return campaignsReport, nil
+}
+
+// getCampaignsReportTables возвращает таблицы отчета по рассылкам за период с динамикой и сравнением с предыдущим периодом.
+func (s *ServerApi) getCampaignsReportTables(startDate, endDate string) ([]ReportTable, *ServerDebug) {
+	debug := NewServerDebug("start of getCampaignsReportTables -> ")
+
+	var err error
+	defer debug.SetDebugFinalStage(&err, "end of getCampaignsReportTables")
+
+	campaignsMainInfo, err := s.getCampaignsMainInfo(startDate, endDate, debug)
+	if err != nil {
+		return nil, debug
+	}
+
+	campaignsReport, err := s.readCampaignsReports(*campaignsMainInfo, true, debug, nil)
+	if err != nil {
+		return nil, debug
+	}
+
+	campaigns := make([]CampaignReport, 0, len(*campaignsReport))
+	for _, campaign := range *campaignsReport {
+		campaigns = append(campaigns, campaign.(CampaignReport))
+	}
+
+	analytics, err := s.getCampaignsAnalytics(campaigns, startDate, endDate, debug, nil)
+	if err != nil {
+		return nil, debug
+	}
+
+	tables, err := BuildCampaignsReportTables(campaigns, analytics)
+	if err != nil {
+		return nil, debug
+	}
+
+	return tables, nil
+}
+
+// readCampaignsReports читает статистику рассылок (и переходы по ссылкам, если withLinks) и возвращает рассылки
+// в формате getCampaignsReportInfo, более поздние - первыми.
+func (s *ServerApi) readCampaignsReports(campaignsMainInfo []dashamail.Campaign, withLinks bool, debug *ServerDebug, wsWaiterResp *WebSocketWaiterResponse) (*[]interface{}, error) {
+	debug.SetDebugLastStage("readCampaignsReports -> ")
+
+	var err error
+	defer debug.DeleteDebugLastStage(&err)
+
+	if err = checkCancelled(wsWaiterResp); err != nil {
+		return nil, err
+	}
+
+	if len(campaignsMainInfo) == 0 { // иначе errChan.Chan никто не закроет
+		return &[]interface{}{}, nil
+	}
+
+	errChan := initErrChan()
+	goNum := initGoNum(len(campaignsMainInfo), 300)
+	campaignsReport := initSyncArray()
+	debug.SetDebugLastStage("group of goroutines")
+
+	for i, campaignMainInfo := range campaignsMainInfo {
+		go func(i int, campaignMainInfo dashamail.Campaign) {
+			goNum.ControlMaxNum <- struct{}{}
+
+			defer func() {
+				setNewWSWaiterMessage(wsWaiterResp, goNumProgress(goNum, "reading detailed campaigns' info from DashaMail"))
+				<-goNum.ControlMaxNum
+				calcGoNum(goNum, errChan)
+			}()
+
+			localDebug := NewServerDebug(fmt.Sprintf(" -> goroutine for campaign %v with id %v -> ", campaignMainInfo.Name, campaignMainInfo.ID))
+			var campaignDetailedInfo *dashamail.Summary
+			var campaignLinksInfo []CampaignLinkReport
+			err := checkCancelled(wsWaiterResp)
+			if err == nil && errChan.OpenedState {
+				campaignDetailedInfo, err = s.getCampaignDetailedInfo(campaignMainInfo.ID, localDebug)
+			}
+			if err == nil && campaignDetailedInfo != nil && withLinks {
+				campaignLinksInfo, err = s.getCampaignLinksInfo(campaignMainInfo.ID, localDebug)
+			}
+
+			if err != nil {
+				sendErrToErrChan(err, errChan, debug, localDebug)
+			}
+
+			if err == nil && campaignDetailedInfo != nil {
+				addToSyncArray(campaignsReport, CampaignReport{
+					Date:              campaignMainInfo.DeliveryTime,
+					Name:              html.UnescapeString(campaignMainInfo.Name),
+					TagUTM:            campaignMainInfo.AnalyticsTag,
+					SourceUTM:         campaignMainInfo.AnalyticsSource,
+					MediumUTM:         campaignMainInfo.AnalyticsMedium,
+					ContentUTM:        campaignMainInfo.AnalyticsContent,
+					TermUTM:           campaignMainInfo.AnalyticsTerm,
+					Sent:              campaignDetailedInfo.Sent,
+					Clicked:           campaignDetailedInfo.Clicked,
+					Opened:            campaignDetailedInfo.Opened,
+					FirstSent:         campaignDetailedInfo.FirstSent,
+					FirstOpen:         campaignDetailedInfo.FirstOpen,
+					LastOpen:          campaignDetailedInfo.LastOpen,
+					FirstClick:        campaignDetailedInfo.FirstClick,
+					LastClick:         campaignDetailedInfo.LastClick,
+					UniqueOpened:      campaignDetailedInfo.UniqueOpened,
+					UniqueClicked:     campaignDetailedInfo.UniqueClicked,
+					Unsubscribed:      campaignDetailedInfo.Unsubscribed,
+					SpamComplained:    campaignDetailedInfo.SpamComplained,
+					SpamBlocked:       campaignDetailedInfo.SpamBlocked,
+					SpamMarked:        campaignDetailedInfo.SpamMarked,
+					MailSystemBlocked: campaignDetailedInfo.MailSystemBlocked,
+					Hard:              campaignDetailedInfo.Hard,
+					Soft:              campaignDetailedInfo.Soft,
+					Links:             campaignLinksInfo,
+				})
+			}
+		}(i, campaignMainInfo)
+	}
+
+	err = <-errChan.Chan
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(campaignsReport.Array, func(i, j int) bool {
+		earlier, _ := time.Parse("2006-01-02 15:04:05", campaignsReport.Array[j].(CampaignReport).Date)
+		later, _ := time.Parse("2006-01-02 15:04:05", campaignsReport.Array[i].(CampaignReport).Date)
+		return later.After(earlier)
+	})
+
+	return &campaignsReport.Array, nil
+}
+
+// getCampaignsAnalytics группирует рассылки campaigns периода с startDate по endDate по неделям и месяцам и сравнивает
+// их с рассылками предыдущего периода той же длины, статистику которых читает из DashaMail.
+func (s *ServerApi) getCampaignsAnalytics(campaigns []CampaignReport, startDate, endDate string, debug *ServerDebug, wsWaiterResp *WebSocketWaiterResponse) (*CampaignsAnalytics, error) {
+	debug.SetDebugLastStage("getCampaignsAnalytics -> ")
+
+	var err error
+	defer debug.DeleteDebugLastStage(&err)
+
+	if err = checkCancelled(wsWaiterResp); err != nil {
+		return nil, err
+	}
+
+	previousStartDate, previousEndDate, err := PreviousCampaignsPeriod(startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	setNewWSWaiterMessage(wsWaiterResp, fmt.Sprintf("reading campaigns of the previous period %s - %s", previousStartDate, previousEndDate))
+	previousMainInfo, err := s.getCampaignsMainInfo(previousStartDate, previousEndDate, debug)
+	if dashamail.IsCode(err, dashamail.ERR_NO_DATA) { // в предыдущем периоде рассылок не было
+		previousMainInfo, err = &[]dashamail.Campaign{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	previousReports, err := s.readCampaignsReports(*previousMainInfo, false, debug, wsWaiterResp)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := make([]CampaignReport, 0, len(*previousReports))
+	for _, campaign := range *previousReports {
+		previous = append(previous, campaign.(CampaignReport))
+	}
+
+	analytics, err := NewCampaignsAnalytics(campaigns, previous, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	return analytics, nil
+}
+
+func (s *ServerApi) getCampaignsMainInfo(startDate, endDate string, debug *ServerDebug) (*[]dashamail.Campaign, error) {
+	debug.SetDebugLastStage("getCampaignsMainInfo -> ")
+
+	var err error
+	defer debug.DeleteDebugLastStage(&err)
+
+	_, err = time.Parse("2006-01-02", startDate)
+	if err != nil {
+		err = fmt.Errorf("error startDate format (need 'YYYY-MM-DD')")
+		return nil, err
+	}
+
+	end, err := time.Parse("2006-01-02", endDate)
+	if err != nil {
+		err = fmt.Errorf("error endDate format (need 'YYYY-MM-DD')")
+		return nil, err
+	}
+	/*/
 	 * Из поддержки ДМ про фильтр delivery_time при status="SENT":
 	 * "start - больше 0 часов 0 минут 0 секунд указанного дня, end - меньше 0 часов 0 минут 0 секунд указанного дня."
 	 * Значит, как будто, для включения end в фильтр необходимо добавить к end один день (24 часа).
 	/*/
-	endDate = end.Add(24 * time.Hour).Format("2006-01-02")
+	endDate = end.Add(24 * time.Hour).Format("2006-01-02")
+
+	campaignsMainInfo, err := s.dashaMail.Campaigns.Get(dashamail.CampaignsFilter{
+		Status: "SENT",
+		Start:  startDate,
+		End:    endDate,
+	})
+	if err != nil {
+		debug.SetDebugDataFromError(err)
+		return nil, err
+	}
+
+	return &campaignsMainInfo, nil
+}
+
+func (s *ServerApi) getCampaignDetailedInfo(campaignID string, debug *ServerDebug) (*dashamail.Summary, error) {
+	debug.SetDebugLastStage("getCampaignDetailedInfo -> ")
+
+	var err error
+	defer debug.DeleteDebugLastStage(&err)
+
+	_campaignID, err := strconv.Atoi(campaignID)
+	if err != nil {
+		return nil, err
+	}
+
+	summary, err := s.dashaMail.Reports.Summary(_campaignID)
+	if err != nil {
+		debug.SetDebugDataFromError(err)
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+// getCampaignLinksInfo возвращает переходы по ссылкам рассылки.
+func (s *ServerApi) getCampaignLinksInfo(campaignID string, debug *ServerDebug) ([]CampaignLinkReport, error) {
+	debug.SetDebugLastStage("getCampaignLinksInfo -> ")
+
+	var err error
+	defer debug.DeleteDebugLastStage(&err)
+
+	_campaignID, err := strconv.Atoi(campaignID)
+	if err != nil {
+		return nil, err
+	}
+
+	clicks, err := s.dashaMail.Reports.ClickStat(_campaignID)
+	if err != nil {
+		debug.SetDebugDataFromError(err)
+		return nil, err
+	}
+
+	links := make([]CampaignLinkReport, 0, len(clicks))
+	for _, link := range clicks {
+		links = append(links, CampaignLinkReport{Link: html.UnescapeString(link.Link), Clicks: link.Clicks, UniqueClicks: link.UniqueClicks})
+	}
+
+	return links, nil
+}
+
+// getCertificatesInfo собирает данные для сертификатов из книги ДМ bookID. Если указаны трансляции мероприятия eventIDs,
+// зрители с кодом НМО получают сертификат, только если их посещение по отчету о вебинаре выполняет требования правил
+// (см. points.Rules.Eligibility); результаты проверки всех зрителей с кодом НМО возвращаются в Eligibility.
+func (s *ServerApi) getCertificatesInfo(bookID string, eventIDs []string, wsWaiterResp *WebSocketWaiterResponse) (*GetCertificatesInfoServerResponse, *ServerDebug) {
+	debug := NewServerDebug("start of getCertificatesInfo -> ")
+	setNewWSWaiterMessage(wsWaiterResp, "started getting the certificates info for all users")
+
+	var err error
+	defer debug.SetDebugFinalStage(&err, "end of getCertificatesInfo")
+
+	infoDM, err := s.getDashaMailDataForBook(bookID, debug, wsWaiterResp)
+	if err != nil {
+		return nil, debug
+	}
+
+	var adults []string
+	for user, info := range *infoDM {
+		if getUserType(info) == ADULT {
+			adults = append(adults, user)
+		}
+	}
+
+	eligibility, err := s.getAttendanceEligibility(eventIDs, adults, debug, wsWaiterResp)
+	if err != nil {
+		return nil, debug
+	}
+
+	certificatesInfo := &GetCertificatesInfoServerResponse{UsersInfo: make(map[string]CertificatePersonalInfo), Eligibility: eligibility}
+	setNewWSWaiterMessage(wsWaiterResp, "started getting the certificates info for users with NMO codes")
+	debug.SetDebugLastStage("getting the certificates info")
+
+	for user, info := range *infoDM {
+		userType := getUserType(info)
+		if userType == ADULT && !eligibility[user].Eligible {
+			setGeneralCertificatesInfo(certificatesInfo, info)
+			continue
+		}
+
+		if userType != "" {
+			errParam := checkUserValidity(info, userType)
+			if errParam != "" {
+				err = fmt.Errorf("required user %s has empty '%s' (try to add '%s' for this user in DM book '%s' and restart)", user, errParam, errParam, bookID)
+				return nil, debug
+			}
+
+			setGeneralCertificatesInfo(certificatesInfo, info)
+			certificatesInfo.UsersInfo[user] = *setPersonalCertificatesInfo(info, userType)
+		}
+	}
+
+	if len(certificatesInfo.UsersInfo) == 0 && len(certificatesInfo.Eligibility) == 0 {
+		err = fmt.Errorf("there are no users with NMO code or offline students without certificates in DM book '%s'", bookID)
+		return nil, debug
+	}
+
+	err = checkGeneralCertificatesInfo(certificatesInfo, debug)
+	if err != nil {
+		return nil, debug
+	}
+
+	return certificatesInfo, debug
+}
+
+// getAttendanceEligibility проверяет по отчету о трансляциях eventIDs (сводному отчету по залам), выполнили ли зрители
+// emails с кодом НМО требования к посещению для сертификата НМО. Без зрителей с кодом НМО отчет не строится, а без
+// трансляций сертификаты НМО выдавать нельзя.
+func (s *ServerApi) getAttendanceEligibility(eventIDs, emails []string, debug *ServerDebug, wsWaiterResp *WebSocketWaiterResponse) (map[string]points.Eligibility, error) {
+	debug.SetDebugLastStage("getAttendanceEligibility -> ")
+
+	var err error
+	defer debug.DeleteDebugLastStage(&err)
+
+	if err = checkCancelled(wsWaiterResp); err != nil {
+		return nil, err
+	}
+
+	if len(emails) == 0 {
+		return nil, nil
+	} else if len(eventIDs) == 0 {
+		err = fmt.Errorf("eventID or eventIDs must be set to check attendance of users with NMO codes")
+		return nil, err
+	}
+
+	setNewWSWaiterMessage(wsWaiterResp, "started getting the webinar report to check attendance of users with NMO codes")
+	report, err := s.buildEventsReport(eventIDs, debug, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	pointsRules := s.pointsRules.Rules()
+	eligibility := make(map[string]points.Eligibility, len(emails))
+	for _, email := range emails {
+		eligibility[email] = attendanceEligibility(report, email, pointsRules)
+	}
+
+	return eligibility, nil
+}
+
+// verifyCertificate ищет сертификат в реестре выданных сертификатов по серийному номеру.
+func (s *ServerApi) verifyCertificate(serial string) (*VerifyCertificateServerResponse, *ServerDebug) {
+	debug := NewServerDebug("start of verifyCertificate -> ")
+
+	var err error
+	defer debug.SetDebugFinalStage(&err, "end of verifyCertificate")
+
+	record, ok := s.certificatesRegistry.Find(serial)
+	if !ok {
+		err = fmt.Errorf("certificate %s not found", serial)
+		return nil, debug
+	}
+
+	response := &VerifyCertificateServerResponse{
+		Serial:     record.Serial,
+		UserName:   certificates.MaskUserName(record.UserName),
+		EventName:  record.EventName,
+		EventDate:  record.EventDate,
+		IssuedAt:   TimeToHuman(record.IssuedAt),
+		Status:     record.Status,
+		Valid:      record.Status == certificates.STATUS_VALID,
+		ReplacedBy: record.ReplacedBy,
+	}
+	if record.RevokedAt != nil {
+		response.RevokedAt = TimeToHuman(*record.RevokedAt)
+	}
+
+	return response, debug
+}
+
+// createCertificates создает сертификаты пользователей usersInfo и загружает их в хранилище. Посещение зрителей с кодом НМО
+// проверяется заново по трансляциям eventIDs: сертификаты НМО получают только зрители, выполнившие требования, даже если
+// клиент передал в usersInfo других пользователей.
+func (s *ServerApi) createCertificates(data map[string]interface{}, eventIDs []string, wsWaiterResp *WebSocketWaiterResponse) (map[string]interface{}, *ServerDebug) {
+	debug := NewServerDebug("start of createCertificates -> ")
+	setNewWSWaiterMessage(wsWaiterResp, "started creating certificates")
+
+	var err error
+	defer debug.SetDebugFinalStage(&err, "end of createCertificates")
+
+	if err = s.checkCertificatesVerifyURL(); err != nil {
+		return nil, debug
+	}
+
+	_certificatesInfo, err := DecodeToStruct((*GetCertificatesInfoServerResponse)(nil), data, debug)
+	if err != nil {
+		err = fmt.Errorf("decoding interface{} to struct error: " + err.Error())
+		return nil, debug
+	}
+	certificatesInfo := _certificatesInfo.(*GetCertificatesInfoServerResponse)
+
+	// книга ДМ проверяется до создания сертификатов, чтобы не загружать в хранилище сертификаты, ссылки на которые некуда записать
+	bookID, _ := data["bookID"].(string)
+	if bookID != "" {
+		if _, err = s.getCertificateLinkField(bookID, debug); err != nil {
+			return nil, debug
+		}
+	}
+
+	var adults []string
+	for email, userInfo := range certificatesInfo.UsersInfo {
+		if isNMOCertificate(userInfo) {
+			adults = append(adults, email)
+		}
+	}
+
+	// проверка посещения, присланная клиентом, не используется
+	certificatesInfo.Eligibility, err = s.getAttendanceEligibility(eventIDs, adults, debug, wsWaiterResp)
+	if err != nil {
+		return nil, debug
+	}
+	for email, eligibility := range certificatesInfo.Eligibility {
+		if !eligibility.Eligible {
+			delete(certificatesInfo.UsersInfo, email)
+		}
+	}
+
+	infoDM := map[string]interface{}{"links": map[string]interface{}{}, "unloadedFiles": map[string]interface{}{}}
+	if len(certificatesInfo.UsersInfo) != 0 {
+		// у каждого запуска своя временная папка, чтобы одновременные запуски за одну дату не загружали чужие файлы
+		var certificatesLocalDir string
+		certificatesLocalDir, err = ioutil.TempDir("", "certificates_")
+		if err != nil {
+			return nil, debug
+		}
+		defer os.RemoveAll(certificatesLocalDir)
+
+		var records *SyncMap
+		records, err = s.createPDFCertificates(certificatesInfo, certificatesLocalDir, debug, wsWaiterResp)
+		if err != nil {
+			return nil, debug
+		}
+
+		setNewWSWaiterMessage(wsWaiterResp, "started loading certificates to the artifact store")
+		var eventDate eventdate.EventDate
+		eventDate, err = eventdate.Parse(certificatesInfo.EventDate)
+		if err != nil {
+			return nil, debug
+		}
+
+		var certificatesRemoteDir string
+		certificatesRemoteDir, err = s.checkRemoteFolderValidity(storage.CERTIFICATES_ARTIFACT, eventDate, debug)
+		if err != nil {
+			return nil, debug
+		}
+
+		infoDM, err = s.loadCertificatesToStore(certificatesLocalDir, certificatesRemoteDir, records, debug, wsWaiterResp)
+		if err != nil {
+			return nil, debug
+		}
+
+		// новый файл заменил в хранилище сертификат, созданный раньше (например, при повторном запуске после ошибки)
+		_, err = s.issueLoadedCertificates(records, infoDM, "сертификат создан заново", debug)
+		if err != nil {
+			return nil, debug
+		}
+	}
+
+	if certificatesInfo.Eligibility != nil {
+		infoDM["eligibility"] = certificatesInfo.Eligibility
+	}
+	if bookID != "" {
+		infoDM["dashaMail"] = s.writeCertificateLinks(bookID, infoDM, debug, wsWaiterResp)
+	}
+
+	return infoDM, nil
+}
+
+// writeCertificateLinks записывает ссылки на загруженные сертификаты в столбец "ссылка_на_сертификат" книги ДМ bookID и
+// возвращает результат записи по каждому пользователю: "ok" или ошибку. Сертификаты к этому моменту уже загружены в
+// хранилище, поэтому ошибка записи не прерывает createCertificates: ссылки остаются в ответе, и их можно отправить
+// повторно через sendDataToDashaMail.
+func (s *ServerApi) writeCertificateLinks(bookID string, loaded map[string]interface{}, debug *ServerDebug, wsWaiterResp *WebSocketWaiterResponse) map[string]string {
+	setNewWSWaiterMessage(wsWaiterResp, "started writing certificate links to DashaMail")
+
+	links, _ := loaded["links"].(map[string]interface{})
+	unloadedFiles, _ := loaded["unloadedFiles"].(map[string]interface{})
+
+	results := make(map[string]string, len(links)+len(unloadedFiles))
+	for email := range unloadedFiles {
+		results[email] = "ссылка не записана: сертификат не загружен в хранилище"
+	}
+
+	linksDM := make(map[string]interface{}, len(links))
+	for email, info := range links {
+		if loadedInfo, ok := info.(LoadedCertificateInfo); ok {
+			linksDM[email] = map[string]interface{}{"link": loadedInfo.Link}
+			results[email] = "ok"
+		}
+	}
+	if len(linksDM) == 0 {
+		return results
+	}
+
+	invalidEmails, err := s.updateDashaMailData(bookID, linksDM, debug, wsWaiterResp)
+	if err != nil {
+		for email := range linksDM {
+			results[email] = "ошибка записи: " + err.Error()
+		}
+		return results
+	}
+
+	for email, message := range *invalidEmails {
+		results[email] = message
+	}
+
+	return results
+}
+
+// reissueCertificates перевыпускает сертификаты пользователей emails книги ДМ bookID по исправленным в книге данным:
+// создает сертификаты с новыми серийными номерами, заменяет ими файлы в хранилище (новый файл загружается по тому же
+// пути), записывает ссылки в книгу и отзывает прежние сертификаты пользователей за это мероприятие с причиной reason.
+// Перевыпустить можно только уже выданный сертификат; посещение зрителей с кодом НМО проверяется по трансляциям
+// eventIDs так же, как в getCertificatesInfo. Ошибки по отдельным пользователям возвращаются в ответе и не прерывают
+// перевыпуск остальных.
+func (s *ServerApi) reissueCertificates(bookID string, emails, eventIDs []string, reason string, wsWaiterResp *WebSocketWaiterResponse) (*CertificatesRevisionServerResponse, *ServerDebug) {
+	debug := NewServerDebug("start of reissueCertificates -> ")
+	setNewWSWaiterMessage(wsWaiterResp, "started reissuing certificates")
+
+	var err error
+	defer debug.SetDebugFinalStage(&err, "end of reissueCertificates")
+
+	if err = s.checkCertificatesVerifyURL(); err != nil {
+		return nil, debug
+	}
+
+	infoDM, err := s.getDashaMailDataForBook(bookID, debug, wsWaiterResp)
+	if err != nil {
+		return nil, debug
+	}
+
+	response := newCertificatesRevisionResponse(emails)
+	certificatesInfo := &GetCertificatesInfoServerResponse{UsersInfo: make(map[string]CertificatePersonalInfo)}
+	var adults []string
+	debug.SetDebugLastStage("getting the certificates info")
+
+	for _, email := range emails {
+		info, ok := (*infoDM)[email]
+		if !ok {
+			setRevisionError(response, email, fmt.Errorf("user not found in DM book '%s'", bookID))
+			continue
+		}
+
+		if info.Certificate == "" && len(s.findUserCertificates(email, info)) == 0 {
+			setRevisionError(response, email, fmt.Errorf("user has no certificate for event '%s' (%s) to reissue", info.EventName, info.EventDate))
+			continue
+		}
+
+		// ссылка на прежний сертификат не мешает перевыпуску
+		info.Certificate = ""
+		userType := getUserType(info)
+		if userType == "" {
+			setRevisionError(response, email, fmt.Errorf("user has neither NMO code nor offline student visit in DM book '%s'", bookID))
+			continue
+		}
+		if errParam := checkUserValidity(info, userType); errParam != "" {
+			setRevisionError(response, email, fmt.Errorf("user has empty '%s' in DM book '%s'", errParam, bookID))
+			continue
+		}
+
+		setGeneralCertificatesInfo(certificatesInfo, info)
+		certificatesInfo.UsersInfo[email] = *setPersonalCertificatesInfo(info, userType)
+		if userType == ADULT {
+			adults = append(adults, email)
+		}
+	}
+
+	eligibility, err := s.getAttendanceEligibility(eventIDs, adults, debug, wsWaiterResp)
+	if err != nil {
+		return nil, debug
+	}
+	for email, userEligibility := range eligibility {
+		if !userEligibility.Eligible {
+			delete(certificatesInfo.UsersInfo, email)
+			setRevisionError(response, email, fmt.Errorf("user doesn't meet attendance requirements for NMO certificate: %s", strings.Join(userEligibility.Reasons, "; ")))
+		}
+	}
+
+	if len(certificatesInfo.UsersInfo) == 0 {
+		return response, debug
+	}
+
+	err = checkGeneralCertificatesInfo(certificatesInfo, debug)
+	if err != nil {
+		return nil, debug
+	}
+
+	certificatesLocalDir, err := ioutil.TempDir("", "certificates_")
+	if err != nil {
+		return nil, debug
+	}
+	defer os.RemoveAll(certificatesLocalDir)
+
+	records, err := s.createPDFCertificates(certificatesInfo, certificatesLocalDir, debug, wsWaiterResp)
+	if err != nil {
+		return nil, debug
+	}
+
+	setNewWSWaiterMessage(wsWaiterResp, "started replacing certificates in the artifact store")
+	eventDate, err := eventdate.Parse(certificatesInfo.EventDate)
+	if err != nil {
+		return nil, debug
+	}
+
+	certificatesRemoteDir, err := s.checkRemoteFolderValidity(storage.CERTIFICATES_ARTIFACT, eventDate, debug)
+	if err != nil {
+		return nil, debug
+	}
+
+	loaded, err := s.loadCertificatesToStore(certificatesLocalDir, certificatesRemoteDir, records, debug, wsWaiterResp)
+	if err != nil {
+		return nil, debug
+	}
+	links, _ := loaded["links"].(map[string]interface{})
+	unloadedFiles, _ := loaded["unloadedFiles"].(map[string]interface{})
+
+	/*/
+	 * Новые сертификаты записываются в реестр, а прежние отзываются, только если новый сертификат загружен в хранилище:
+	 * иначе по ссылке из книги ДМ остается прежний файл, и прежний сертификат должен оставаться действительным.
+	/*/
+	setNewWSWaiterMessage(wsWaiterResp, "started revoking previous certificates")
+	revoked, err := s.issueLoadedCertificates(records, loaded, reason, debug)
+	if err != nil {
+		return nil, debug
+	}
+
+	linksDM := make(map[string]interface{})
+	for email := range certificatesInfo.UsersInfo {
+		revision := response.Users[email]
+		if unloaded, ok := unloadedFiles[email].(UnloadedCertificateInfo); ok {
+			revision.Error = "uploading to the artifact store error: " + unloaded.Error
+		} else if loaded, ok := links[email].(LoadedCertificateInfo); ok {
+			revision.Serial, revision.Link, revision.RevokedSerials = loaded.Serial, loaded.Link, revoked[email]
+			linksDM[email] = map[string]interface{}{"link": loaded.Link}
+		}
+		response.Users[email] = revision
+	}
+
+	/*/
+	 * Сертификаты к этому моменту уже перевыпущены, поэтому ошибка записи ссылок, как и в writeCertificateLinks, не
+	 * проваливает перевыпуск: она записывается каждому пользователю, а ссылки остаются в ответе, и их можно отправить
+	 * повторно через sendDataToDashaMail. Прежние файлы в этом случае не удаляются: на них еще ведут ссылки из книги.
+	/*/
+	if len(linksDM) != 0 {
+		invalidEmails, errDM := s.updateDashaMailData(bookID, linksDM, debug, wsWaiterResp)
+		if errDM != nil {
+			for email := range linksDM {
+				setRevisionError(response, email, fmt.Errorf("writing certificate link to DM error: %+v", errDM))
+			}
+			return response, debug
+		}
+		for email, message := range *invalidEmails {
+			setRevisionError(response, email, errors.New(message))
+		}
+	}
 
-	jsonData := s.getJSONBytes(DashaMailRequest{
-		Method:     "campaigns.get",
-		Status:     "SENT",
-		StartDate:  startDate,
-		EndDate:    endDate,
-		JSONFormat: 1, // любой int вернет данные массивов в виде JSON-представления
-	})
+	// прежние файлы из папки со старым названием больше никуда не ведут, их не должно быть видно по старым ссылкам
+	s.deleteLegacyCertificates(eventDate, linksDM)
+
+	return response, debug
+}
+
+// deleteLegacyCertificates удаляет перевыпущенные сертификаты пользователей emails из папки мероприятия eventDate со
+// старым названием (см. findLegacyCertificatesFolder). Новые сертификаты к этому моменту уже загружены, поэтому ошибка
+// удаления не проваливает перевыпуск, а только пишется в лог.
+func (s *ServerApi) deleteLegacyCertificates(eventDate eventdate.EventDate, emails map[string]interface{}) {
+	if len(emails) == 0 {
+		return
+	}
+
+	debug := NewServerDebug("start of deleteLegacyCertificates -> ")
+	legacyRemoteDir, err := s.findLegacyCertificatesFolder(eventDate, debug)
+	if err == nil && legacyRemoteDir != "" {
+		for email := range emails {
+			if err = s.deleteCertificateFile(legacyRemoteDir, email, debug); err != nil {
+				break
+			}
+		}
+	}
 
-	response, err := DoRequestPOST(s.dashaMailAcc.URI, jsonData, debug)
 	if err != nil {
-		return nil, err
+		fmt.Println(fmt.Errorf("+++++++ CAN'T DELETE LEGACY CERTIFICATES FOR %s: %+v (es: %s) +++++++", eventDate, err, debug.ExecutionStages))
 	}
+}
 
-	data := UnmarshalResponseData(response)
+// revokeCertificates отзывает сертификаты пользователей emails книги ДМ bookID за мероприятие из книги с причиной reason:
+// удаляет файлы из хранилища, очищает ссылку на сертификат в книге и только после этого отмечает сертификаты
+// отозванными в реестре, чтобы проверка сертификата не расходилась с доступным файлом. Сертификаты ищутся в реестре по
+// ссылке из книги (после этого пользователю можно снова создать сертификат через createCertificates).
+func (s *ServerApi) revokeCertificates(bookID string, emails []string, reason string, wsWaiterResp *WebSocketWaiterResponse) (*CertificatesRevisionServerResponse, *ServerDebug) {
+	debug := NewServerDebug("start of revokeCertificates -> ")
+	setNewWSWaiterMessage(wsWaiterResp, "started revoking certificates")
+
+	var err error
+	defer debug.SetDebugFinalStage(&err, "end of revokeCertificates")
 
-	err = data.Msg.CheckForError(debug)
+	infoDM, err := s.getDashaMailDataForBook(bookID, debug, wsWaiterResp)
 	if err != nil {
-		return nil, err
+		return nil, debug
+	}
+
+	linkField, err := s.getCertificateLinkField(bookID, debug)
+	if err != nil {
+		return nil, debug
 	}
 
-	campaignsMainInfo := make([]DashaMailCampaignReport, 0, len(data.Data))
-	for _, mainInfo := range data.Data {
-		var m interface{}
-		m, err = DecodeToStruct((*DashaMailCampaignReport)(nil), mainInfo, debug)
+	response := newCertificatesRevisionResponse(emails)
+	serials := make(map[string][]string, len(emails))
+	cleared := make([]string, 0, len(emails))
+	// после отмены задачи или ошибки связи с DashaMail оставшиеся файлы не удаляются, но сертификаты, файлы которых уже
+	// удалены, а ссылки очищены, отзываются до конца - иначе проверка сертификата расходилась бы с хранилищем
+	var stopErr error
+	for i, email := range emails {
+		setNewWSWaiterMessage(wsWaiterResp, fmt.Sprintf("revoking certificates: %v done, %v left", i, len(emails)-i))
+
+		if stopErr == nil {
+			stopErr = checkCancelled(wsWaiterResp)
+		}
+		if stopErr != nil {
+			setRevisionError(response, email, stopErr)
+			continue
+		}
+
+		info, ok := (*infoDM)[email]
+		if !ok {
+			setRevisionError(response, email, fmt.Errorf("user not found in DM book '%s'", bookID))
+			continue
+		}
+
+		serials[email] = s.findUserCertificates(email, info)
+		if len(serials[email]) == 0 && info.Certificate == "" {
+			setRevisionError(response, email, fmt.Errorf("user has no certificate for event '%s' (%s)", info.EventName, info.EventDate))
+			continue
+		}
+
+		localDebug := NewServerDebug(fmt.Sprintf(" -> revoking certificates for email %v -> ", email))
+		if err := s.deleteCertificateFromStore(email, info.EventDate, localDebug); err != nil {
+			setRevisionError(response, email, fmt.Errorf("deleting from the artifact store error: %+v", err))
+			continue
+		}
+
+		// пустое значение не записывается через updateDashaMailData, поэтому ссылка очищается напрямую
+		err = s.dashaMail.Lists.AddMember(bookID, email, map[string]interface{}{linkField: ""}, dashamail.AddMemberOptions{
+			Update:  true,
+			NoCheck: true,
+		})
 		if err != nil {
-			err = fmt.Errorf("decoding interface{} to struct error: " + err.Error())
-			return nil, err
+			var dmErr *dashamail.Error
+			if errors.As(err, &dmErr) {
+				setRevisionError(response, email, errors.New("ошибка записи: "+dmErr.Error()))
+			} else {
+				stopErr = err
+				setRevisionError(response, email, fmt.Errorf("clearing certificate link in DM error: %+v", err))
+			}
+			err = nil
+			continue
 		}
+		cleared = append(cleared, email)
+	}
 
-		campaignsMainInfo = append(campaignsMainInfo, *m.(*DashaMailCampaignReport))
+	// отозванный сертификат сразу пропадает и из реестра баллов
+	s.refreshPointsLedgerBook(bookID, cleared)
+
+	setNewWSWaiterMessage(wsWaiterResp, "started revoking certificates in the registry")
+	for _, email := range cleared {
+		revision := response.Users[email]
+		for _, serial := range serials[email] {
+			if _, revokeErr := s.certificatesRegistry.Revoke(serial, reason, ""); revokeErr != nil {
+				revision.Error = fmt.Sprintf("revoking in the registry error: %+v", revokeErr)
+				if stopErr == nil {
+					stopErr = revokeErr
+				}
+				continue
+			}
+			revision.RevokedSerials = append(revision.RevokedSerials, serial)
+		}
+		response.Users[email] = revision
 	}
 
-	return &campaignsMainInfo, nil
+	// результат уже отозванных сертификатов возвращается и вместе с ошибкой (например, у отмененной задачи)
+	err = stopErr
+	return response, debug
 }
 
-func (s *ServerApi) getCampaignDetailedInfo(campaignID string, debug *ServerDebug) (*DashaMailCampaignReport, error) {
-	debug.SetDebugLastStage("getCampaignDetailedInfo -> ")
+// getCertificateLinkField возвращает поле DashaMail (merge_N) столбца "ссылка_на_сертификат" книги bookID.
+func (s *ServerApi) getCertificateLinkField(bookID string, debug *ServerDebug) (string, error) {
+	debug.SetDebugLastStage("getCertificateLinkField -> ")
 
 	var err error
 	defer debug.DeleteDebugLastStage(&err)
 
-	_campaignID, err := strconv.Atoi(campaignID)
+	titles, err := s.getBookTitles(bookID, true, debug)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	jsonData := s.getJSONBytes(DashaMailRequest{
-		Method:     "reports.summary",
-		CampaignID: _campaignID,
-	})
 
-	response, err := DoRequestPOST(s.dashaMailAcc.URI, jsonData, debug)
-	if err != nil {
-		return nil, err
+	linkField, ok := (*titles)["ссылка_на_сертификат"]
+	if !ok {
+		err = fmt.Errorf("DM book '%s' has no column 'ссылка_на_сертификат'", bookID)
+		return "", err
+	}
+
+	return linkField, nil
+}
+
+// findUserCertificates возвращает серийные номера действующих сертификатов пользователя, загруженных по ссылке из книги ДМ
+// info. Если по ссылке ничего не найдено (сертификаты, выданные до того, как в реестр стали записываться ссылки), ищутся
+// сертификаты за мероприятие из книги. Сертификаты, созданные до появления реестра, в нем не найдутся.
+func (s *ServerApi) findUserCertificates(email string, info GetUserServerResponse) []string {
+	records := s.certificatesRegistry.ValidByLink(email, info.Certificate)
+	if len(records) == 0 {
+		records = s.certificatesRegistry.Valid(email, info.EventName, info.EventDate)
+	}
+
+	serials := make([]string, 0, len(records))
+	for _, record := range records {
+		serials = append(serials, record.Serial)
 	}
 
-	data := UnmarshalResponseData(response)
+	return serials
+}
+
+// deleteCertificateFromStore удаляет сертификат пользователя email за мероприятие eventDate из папки мероприятия и из
+// папки, в которую он мог быть загружен до того, как в названиях папок стали писать дату в виде eventDate.Human().
+func (s *ServerApi) deleteCertificateFromStore(email, eventDate string, debug *ServerDebug) error {
+	debug.SetDebugLastStage("deleteCertificateFromStore -> ")
+
+	var err error
+	defer debug.DeleteDebugLastStage(&err)
 
-	err = data.Msg.CheckForError(debug)
+	date, err := eventdate.Parse(eventDate)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	campaignReport := struct {
-		Response struct {
-			Data *DashaMailCampaignReport `json:"data"`
-		} `json:"response"`
-	}{}
-	err = json.Unmarshal(response, &campaignReport)
+	certificatesRemoteDir, err := s.checkRemoteFolderValidity(storage.CERTIFICATES_ARTIFACT, date, debug)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	err = s.deleteCertificateFile(certificatesRemoteDir, email, debug)
+	if err != nil {
+		return err
+	}
+
+	legacyRemoteDir, err := s.findLegacyCertificatesFolder(date, debug)
+	if err != nil || legacyRemoteDir == "" {
+		return err
 	}
 
-	return campaignReport.Response.Data, nil
+	err = s.deleteCertificateFile(legacyRemoteDir, email, debug)
+	return err
 }
 
-func (s *ServerApi) getCertificatesInfo(bookID string, wsWaiterResp *WebSocketWaiterResponse) (*GetCertificatesInfoServerResponse, *ServerDebug) {
-	debug := NewServerDebug("start of getCertificatesInfo -> ")
-	setNewWSWaiterMessage(wsWaiterResp, "started getting the certificates info for all users")
+// deleteCertificateFile удаляет сертификат пользователя email из папки хранилища folder, если он там есть: файл мог быть
+// уже удален прошлым отзывом, который не дошел до записи в книгу ДМ.
+func (s *ServerApi) deleteCertificateFile(folder, email string, debug *ServerDebug) error {
+	debug.SetDebugLastStage("deleteCertificateFile -> ")
 
 	var err error
-	defer debug.SetDebugFinalStage(&err, "end of getCertificatesInfo")
+	defer debug.DeleteDebugLastStage(&err)
 
-	infoDM, err := s.getDashaMailDataForBook(bookID, debug, wsWaiterResp)
+	debug.SetDebugLastStage("listing certificates folder")
+	files, err := s.artifactStore.List(folder)
 	if err != nil {
-		return nil, debug
+		return err
 	}
 
-	certificatesInfo := &GetCertificatesInfoServerResponse{UsersInfo: make(map[string]CertificatePersonalInfo)}
-	setNewWSWaiterMessage(wsWaiterResp, "started getting the certificates info for users with NMO codes")
-	debug.SetDebugLastStage("getting the certificates info")
+	fileName := certificateFileName(email)
+	for _, file := range files {
+		if file == fileName {
+			debug.SetDebugLastStage("deleting certificate file")
+			err = s.artifactStore.Delete(path.Join(folder, fileName))
+			return err
+		}
+	}
 
-	for user, info := range *infoDM {
-		userType := getUserType(info)
-		if userType != "" {
-			errParam := checkUserValidity(info, userType)
-			if errParam != "" {
-				err = fmt.Errorf("required user %s has empty '%s' (try to add '%s' for this user in DM book '%s' and restart)", user, errParam, errParam, bookID)
-				return nil, debug
-			}
+	return nil
+}
 
-			setGeneralCertificatesInfo(certificatesInfo, info)
-			certificatesInfo.UsersInfo[user] = *setPersonalCertificatesInfo(info, userType)
-		}
+// findLegacyCertificatesFolder возвращает папку сертификатов мероприятия eventDate, в названии которой дата записана в том
+// виде, в котором ее передали ("08 октября 2022"), а не в виде eventDate.Human() ("8 октября 2022"): так называлась папка
+// сертификатов, созданных до перехода на eventDate.Human(). Если дата не отличается или такой папки нет, возвращается "".
+func (s *ServerApi) findLegacyCertificatesFolder(eventDate eventdate.EventDate, debug *ServerDebug) (string, error) {
+	debug.SetDebugLastStage("findLegacyCertificatesFolder -> ")
+
+	var err error
+	defer debug.DeleteDebugLastStage(&err)
+
+	if eventDate.Raw == "" || eventDate.Raw == eventDate.Human() {
+		return "", nil
 	}
 
-	if len(certificatesInfo.UsersInfo) == 0 {
-		err = fmt.Errorf("there are no users with NMO code or offline students without certificates in DM book '%s'", bookID)
-		return nil, debug
+	debug.SetDebugLastStage("resolving folder layout")
+	folder, err := s.folderLayouts.Resolve(storage.CERTIFICATES_ARTIFACT, map[string]string{
+		"year":      strconv.Itoa(eventDate.Year()),
+		"month":     eventDate.MonthName(),
+		"eventDate": eventDate.Raw,
+	})
+	if err != nil {
+		return "", err
 	}
 
-	err = checkGeneralCertificatesInfo(certificatesInfo, debug)
+	// несуществующую папку не все хранилища умеют отличить от ошибки List, поэтому папка ищется в родительской папке
+	parent := path.Dir(folder)
+	if parent == "." {
+		parent = ""
+	} else {
+		debug.SetDebugLastStage("ensuring parent folder")
+		err = s.artifactStore.EnsureFolder(parent)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	debug.SetDebugLastStage("listing parent folder")
+	files, err := s.artifactStore.List(parent)
 	if err != nil {
-		return nil, debug
+		return "", err
 	}
 
-	return certificatesInfo, debug
+	for _, file := range files {
+		if file == path.Base(folder) {
+			return folder, nil
+		}
+	}
+
+	return "", nil
 }
 
-func (s *ServerApi) createCertificates(data map[string]interface{}, wsWaiterResp *WebSocketWaiterResponse) (map[string]interface{}, *ServerDebug) {
-	debug := NewServerDebug("start of createCertificates -> ")
-	setNewWSWaiterMessage(wsWaiterResp, "started creating certificates")
+// Данные образца для превью сертификата, если не передан ни один пользователь.
+var previewCertificateSamples = map[string]CertificatePersonalInfo{
+	certificates.CATEGORY_ADULTS:   {UserName: "Иванов Иван Иванович", ZET: "1", NMO: "NMO-0000-000000"},
+	certificates.CATEGORY_STUDENTS: {UserName: "Иванов Иван Иванович", AcademicHours: "2"},
+}
+
+// previewCertificate создает один сертификат так же, как createCertificates, и возвращает его PDF и PNG в ответе: файл не
+// загружается в хранилище, а серийный номер не выдается (на сертификате печатается номер-заглушка с нулевым порядковым
+// номером, которого нет в реестре).
+func (s *ServerApi) previewCertificate(data map[string]interface{}, wsWaiterResp *WebSocketWaiterResponse) (*PreviewCertificateServerResponse, *ServerDebug) {
+	debug := NewServerDebug("start of previewCertificate -> ")
+	setNewWSWaiterMessage(wsWaiterResp, "started rendering certificate preview")
 
 	var err error
-	defer debug.SetDebugFinalStage(&err, "end of createCertificates")
+	defer debug.SetDebugFinalStage(&err, "end of previewCertificate")
+
+	if err = s.checkCertificatesVerifyURL(); err != nil {
+		return nil, debug
+	}
 
 	_certificatesInfo, err := DecodeToStruct((*GetCertificatesInfoServerResponse)(nil), data, debug)
 	if err != nil {
@@ -760,272 +1719,323 @@ func (s *ServerApi) createCertificates(data map[string]interface{}, wsWaiterResp
 	}
 	certificatesInfo := _certificatesInfo.(*GetCertificatesInfoServerResponse)
 
-	err = s.createDOCXCertificates(certificatesInfo, debug, wsWaiterResp)
-	if err != nil {
+	// ошибка в дате иначе обнаружится только при загрузке сертификатов в хранилище
+	debug.SetDebugLastStage("parsing event date")
+	if _, err = eventdate.Parse(certificatesInfo.EventDate); err != nil {
 		return nil, debug
 	}
 
-	certificatesLocalDir := certificatesInfo.EventDate
-	err = s.convertDOCX2PDF(certificatesLocalDir, debug, wsWaiterResp)
+	/*/
+	 * Пользователь для превью: переданный в email, иначе первый по алфавиту из usersInfo, иначе образец категории category.
+	/*/
+	response := &PreviewCertificateServerResponse{}
+	var userInfo CertificatePersonalInfo
+	email, _ := data["email"].(string)
+	switch {
+	case email != "":
+		var ok bool
+		if userInfo, ok = certificatesInfo.UsersInfo[email]; !ok {
+			err = fmt.Errorf("user %s not found in usersInfo", email)
+			return nil, debug
+		}
+		response.Email = email
+	case len(certificatesInfo.UsersInfo) != 0:
+		emails := make([]string, 0, len(certificatesInfo.UsersInfo))
+		for user := range certificatesInfo.UsersInfo {
+			emails = append(emails, user)
+		}
+		sort.Strings(emails)
+		response.Email, userInfo = emails[0], certificatesInfo.UsersInfo[emails[0]]
+	default:
+		category, _ := data["category"].(string)
+		if category == "" {
+			category = certificates.CATEGORY_ADULTS
+		}
+
+		var ok bool
+		if userInfo, ok = previewCertificateSamples[category]; !ok {
+			err = fmt.Errorf("unknown category '%s' (only '%s' and '%s' are available)", category, certificates.CATEGORY_ADULTS, certificates.CATEGORY_STUDENTS)
+			return nil, debug
+		}
+	}
+
+	response.Category = certificates.CATEGORY_ADULTS
+	if userInfo.ZET == "" {
+		response.Category = certificates.CATEGORY_STUDENTS
+	}
+
+	debug.SetDebugLastStage("filling certificate template")
+	filledDOCX, err := s.fillCertificateTemplate(certificatesInfo.EventName, certificatesInfo.EventDate, userInfo)
 	if err != nil {
 		return nil, debug
 	}
 
-	setNewWSWaiterMessage(wsWaiterResp, "started loading certificates to Yandex Disk")
-	d, err := yd.InitYaDisk(s.yaDiskAcc.ApiKey)
+	response.Serial = fmt.Sprintf("ZO-%d-000000-%016X", time.Now().Year(), 0)
+	filledDOCX, err = certificates.AddVerification(filledDOCX, response.Serial, s.certificatesVerifyURL+url.PathEscape(response.Serial))
 	if err != nil {
 		return nil, debug
 	}
 
-	err = (&YaDisk{d}).checkYaDiskFoldersValidity("Сертификаты НМО/{year}/{month}/{eventDate}", certificatesInfo.EventDate, debug)
+	debug.SetDebugLastStage("rendering certificate to PDF")
+	pdf, err := s.certificateRenderer.Render(filledDOCX)
 	if err != nil {
 		return nil, debug
 	}
 
-	infoDM, err := (&YaDisk{d}).loadCertificatesToYaDisk(certificatesLocalDir, debug, wsWaiterResp)
+	debug.SetDebugLastStage("rendering certificate to PNG")
+	png, err := certificates.RenderPNG(filledDOCX, certificates.PREVIEW_WIDTH)
 	if err != nil {
 		return nil, debug
 	}
 
-	return infoDM, nil
+	response.PDF = base64.StdEncoding.EncodeToString(pdf)
+	response.PNG = base64.StdEncoding.EncodeToString(png)
+
+	return response, nil
 }
 
-func (s *ServerApi) createDOCXCertificates(certificatesInfo *GetCertificatesInfoServerResponse, debug *ServerDebug, wsWaiterResp *WebSocketWaiterResponse) error {
-	debug.SetDebugLastStage("createDOCXCertificates -> ")
+// createPDFCertificates создает сертификаты в папке certificatesLocalDir (временной папке запуска) и возвращает их записи для реестра (с
+// занятыми серийными номерами) по email владельцев.
+func (s *ServerApi) createPDFCertificates(certificatesInfo *GetCertificatesInfoServerResponse, certificatesLocalDir string, debug *ServerDebug, wsWaiterResp *WebSocketWaiterResponse) (*SyncMap, error) {
+	debug.SetDebugLastStage("createPDFCertificates -> ")
 
 	var err error
 	defer debug.DeleteDebugLastStage(&err)
 
+	if err = checkCancelled(wsWaiterResp); err != nil {
+		return nil, err
+	}
+
 	errChan := initErrChan()
 	goNum := initGoNum(len(certificatesInfo.UsersInfo))
+	records := initSyncMap()
 	debug.SetDebugLastStage("group of goroutines")
 
 	for user, userInfo := range certificatesInfo.UsersInfo {
 		go func(userEmail string, userInfo CertificatePersonalInfo) {
 			defer func() {
-				setNewWSWaiterMessage(wsWaiterResp, fmt.Sprintf("creating certificates: %v done, %v left", goNum.Counter, goNum.Num-goNum.Counter))
+				setNewWSWaiterMessage(wsWaiterResp, goNumProgress(goNum, "creating certificates"))
 				calcGoNum(goNum, errChan)
 			}()
 
 			localDebug := NewServerDebug(fmt.Sprintf(" -> goroutine for email %v -> ", userEmail))
-			var err error
-			if errChan.OpenedState {
-				err = s.createDOCXCertificate(userEmail, certificatesInfo.EventName, certificatesInfo.EventDate, userInfo, localDebug)
+			var (
+				record certificates.Record
+				err    = checkCancelled(wsWaiterResp)
+			)
+			if err == nil && errChan.OpenedState {
+				record, err = s.createPDFCertificate(userEmail, certificatesInfo.EventName, certificatesInfo.EventDate, certificatesLocalDir, userInfo, localDebug)
 			}
 
 			if err != nil {
 				sendErrToErrChan(err, errChan, debug, localDebug)
+			} else if record.Serial != "" {
+				addToSyncMap(records, userEmail, record)
 			}
 		}(user, userInfo)
 	}
 
 	err = <-errChan.Chan
+	if err != nil {
+		return nil, err
+	}
 
-	return err
+	return records, nil
 }
 
-func (s *ServerApi) createDOCXCertificate(userEmail, eventName, eventDate string, userInfo CertificatePersonalInfo, debug *ServerDebug) error {
-	debug.SetDebugLastStage("createDOCXCertificate")
+// createPDFCertificate создает сертификат и возвращает его запись для реестра выданных сертификатов с серийным номером,
+// который печатается на сертификате вместе с QR-кодом для проверки. В реестр сертификат записывается после загрузки
+// в хранилище (issueLoadedCertificates), чтобы проверка не подтверждала сертификаты, которые не были доставлены.
+func (s *ServerApi) createPDFCertificate(userEmail, eventName, eventDate, certificatesLocalDir string, userInfo CertificatePersonalInfo, debug *ServerDebug) (certificates.Record, error) {
+	debug.SetDebugLastStage("createPDFCertificate")
 
 	var err error
 	defer debug.DeleteDebugLastStage(&err)
 
-	replaceMap := docx.PlaceholderMap{
-		"ИМЯ":         userInfo.UserName,
-		"МЕРОПРИЯТИЕ": eventName,
-		"ДАТА":        eventDate,
+	filledDOCX, err := s.fillCertificateTemplate(eventName, eventDate, userInfo)
+	if err != nil {
+		return certificates.Record{}, err
 	}
 
-	if userInfo.ZET == "" {
-		replaceMap["АКАДЕМ"] = userInfo.AcademicHours
-		replaceMap["ШАБЛОН"] = "./__dev__certificates__/template_students.docx"
-	} else {
-		replaceMap["НМО"] = userInfo.NMO
-		replaceMap["ЗЕТ"] = userInfo.ZET
-		replaceMap["ШАБЛОН"] = "./__dev__certificates__/template_adults.docx"
+	record, err := s.certificatesRegistry.Reserve(certificates.Record{
+		Email:         userEmail,
+		UserName:      userInfo.UserName,
+		EventName:     eventName,
+		EventDate:     eventDate,
+		NMO:           userInfo.NMO,
+		ZET:           userInfo.ZET,
+		AcademicHours: userInfo.AcademicHours,
+	})
+	if err != nil {
+		return certificates.Record{}, err
 	}
 
-	doc, err := docx.Open(replaceMap["ШАБЛОН"].(string))
+	filledDOCX, err = certificates.AddVerification(filledDOCX, record.Serial, s.certificatesVerifyURL+url.PathEscape(record.Serial))
 	if err != nil {
-		return err
+		return certificates.Record{}, err
 	}
-	defer doc.Close()
 
-	err = doc.ReplaceAll(replaceMap)
+	pdf, err := s.certificateRenderer.Render(filledDOCX)
 	if err != nil {
-		return err
+		return certificates.Record{}, err
 	}
 
-	err = doc.WriteToFile(fmt.Sprintf("./%s/Сертификат НМО для %s.docx", eventDate, userEmail))
+	err = ioutil.WriteFile(filepath.Join(certificatesLocalDir, certificateFileName(userEmail)), pdf, 0644)
 	if err != nil {
-		return err
+		return certificates.Record{}, err
 	}
 
-	return nil
+	return record, nil
 }
 
-func (s *ServerApi) convertDOCX2PDF(certificatesLocalDir string, debug *ServerDebug, wsWaiterResp *WebSocketWaiterResponse) error {
-	debug.SetDebugLastStage("convertDOCX2PDF -> ")
-
-	var err error
-	defer debug.DeleteDebugLastStage(&err)
-
-	setNewWSWaiterMessage(wsWaiterResp, "converting certificates")
-	debug.SetDebugLastStage("getting go-script directory")
-	wd, err := getDir()
-	if err != nil {
-		return err
+// issueLoadedCertificates записывает в реестр сертификаты из records, загруженные в хранилище (параметр "links" ответа
+// loadCertificatesToStore), и отзывает прежние сертификаты их владельцев за то же мероприятие по причине reason.
+// Возвращает серийные номера отозванных сертификатов по email владельцев.
+func (s *ServerApi) issueLoadedCertificates(records *SyncMap, loaded map[string]interface{}, reason string, debug *ServerDebug) (map[string][]string, error) {
+	debug.SetDebugLastStage("issueLoadedCertificates")
+
+	links, _ := loaded["links"].(map[string]interface{})
+	issued := make([]certificates.Record, 0, len(links))
+	emails := make(map[string]string, len(links))
+	for email, link := range links {
+		if record, ok := records.Map[email].(certificates.Record); ok {
+			if loadedInfo, ok := link.(LoadedCertificateInfo); ok {
+				record.Link = loadedInfo.Link
+			}
+			issued = append(issued, record)
+			emails[record.Serial] = email
+		}
 	}
 
-	debug.SetDebugLastStage("writing to '.path' file")
-	err = writePathFile(wd, certificatesLocalDir)
+	revoked, err := s.certificatesRegistry.IssueAll(issued, reason)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	debug.SetDebugLastStage("running 'docx2pdf.exe' converter")
-	err = exec.Command(wd + "/__dev__certificates__/docx2pdf.exe").Run()
-	if err != nil {
-		err = fmt.Errorf("running 'docx2pdf.exe' converter error: %v", err)
-		return err
+	revokedByEmail := make(map[string][]string, len(revoked))
+	for serial, serials := range revoked {
+		revokedByEmail[emails[serial]] = serials
 	}
 
-	return nil
+	return revokedByEmail, nil
 }
 
-type YaDisk struct{ *yd.YaDisk }
-
-func (d *YaDisk) checkYaDiskFoldersValidity(destinationFolder, eventDate string, debug *ServerDebug) error {
-	debug.SetDebugLastStage("checkYaDiskFoldersValidity -> ")
+// fillCertificateTemplate заполняет активный шаблон категории пользователя (сертификат НМО, если у пользователя есть ЗЕТ,
+// иначе сертификат студента) для мероприятия eventName от eventDate.
+func (s *ServerApi) fillCertificateTemplate(eventName, eventDate string, userInfo CertificatePersonalInfo) ([]byte, error) {
+	replaceMap := docx.PlaceholderMap{
+		"ИМЯ":         userInfo.UserName,
+		"МЕРОПРИЯТИЕ": eventName,
+		"ДАТА":        eventDate,
+	}
 
-	var err error
-	defer debug.DeleteDebugLastStage(&err)
+	category := certificates.CATEGORY_ADULTS
+	if !isNMOCertificate(userInfo) {
+		replaceMap["АКАДЕМ"] = userInfo.AcademicHours
+		category = certificates.CATEGORY_STUDENTS
+	} else {
+		replaceMap["НМО"] = userInfo.NMO
+		replaceMap["ЗЕТ"] = userInfo.ZET
+	}
 
-	debug.SetDebugLastStage("checkEventDateValidity")
-	month, year, err := checkEventDateValidity(eventDate)
+	template, err := s.certificateTemplates.Resolve(category, eventName, eventDate)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	destinationFolder = strings.Replace(destinationFolder, "{year}", year, -1)
-	destinationFolder = strings.Replace(destinationFolder, "{month}", month, -1)
-	destinationFolder = strings.Replace(destinationFolder, "{eventDate}", eventDate, -1)
-	underlyingFolders := strings.Split(destinationFolder, "/")
-	folder := ""
+	return certificates.FillTemplate(template, replaceMap)
+}
 
-	debug.SetDebugLastStage("checkYaDiskFolderValidity")
-	for i := range underlyingFolders {
-		folder += underlyingFolders[i] + "/"
-		err = d.checkYaDiskFolderValidity(folder)
-		if err != nil {
-			return err
-		}
-	}
+// checkRemoteFolderValidity создает в хранилище папку для файлов типа artifactType по шаблону из s.folderLayouts и возвращает ее путь.
+func (s *ServerApi) checkRemoteFolderValidity(artifactType string, eventDate eventdate.EventDate, debug *ServerDebug) (string, error) {
+	debug.SetDebugLastStage("checkRemoteFolderValidity -> ")
 
-	return nil
-}
+	var err error
+	defer debug.DeleteDebugLastStage(&err)
 
-func (d *YaDisk) checkYaDiskFolderValidity(folderName string) error {
-	checkYaDiskError := func(err error) error {
-		switch {
-		case strings.HasSuffix(err.Error(), "DiskNotFoundError"):
-			return nil
-		case strings.HasSuffix(err.Error(), "DiskPathPointsToExistentDirectoryError"):
-			return nil
-		default:
-			return err
-		}
+	debug.SetDebugLastStage("resolving folder layout")
+	folder, err := s.folderLayouts.Resolve(artifactType, map[string]string{
+		"year":      strconv.Itoa(eventDate.Year()),
+		"month":     eventDate.MonthName(),
+		"eventDate": eventDate.Human(),
+	})
+	if err != nil {
+		return "", err
 	}
 
-	err := d.GetYaDiskFolder(folderName, false)
+	debug.SetDebugLastStage("ensuring folder")
+	err = s.artifactStore.EnsureFolder(folder)
 	if err != nil {
-		err = checkYaDiskError(err)
-		if err != nil {
-			return err
-		}
-
-		err = d.CreateYaDiskFolder(folderName)
-		if err != nil {
-			err = checkYaDiskError(err)
-			if err != nil {
-				return err
-			}
-		}
+		return "", err
 	}
 
-	return nil
+	return folder, nil
 }
 
-func (d *YaDisk) loadCertificatesToYaDisk(certificatesLocalDir string, debug *ServerDebug, wsWaiterResp *WebSocketWaiterResponse) (map[string]interface{}, error) {
-	debug.SetDebugLastStage("loadCertificatesToYaDisk -> ")
+// loadCertificatesToStore загружает сертификаты из временной папки запуска certificatesLocalDir в папку хранилища
+// certificatesRemoteDir. Папку удаляет вызывающая функция, поэтому незагруженные сертификаты нужно создать заново.
+func (s *ServerApi) loadCertificatesToStore(certificatesLocalDir, certificatesRemoteDir string, records *SyncMap, debug *ServerDebug, wsWaiterResp *WebSocketWaiterResponse) (map[string]interface{}, error) {
+	debug.SetDebugLastStage("loadCertificatesToStore -> ")
 
 	var err error
 	defer debug.DeleteDebugLastStage(&err)
 
-	filesFromDir, err := ioutil.ReadDir(filepath.Join(".", certificatesLocalDir))
+	if err = checkCancelled(wsWaiterResp); err != nil {
+		return nil, err
+	}
+
+	filesFromDir, err := ioutil.ReadDir(certificatesLocalDir)
 	if err != nil {
 		return nil, err
 	}
 
+	pdfFiles := make([]string, 0, len(filesFromDir))
+	for _, file := range filesFromDir {
+		if filepath.Ext(file.Name()) == ".pdf" {
+			pdfFiles = append(pdfFiles, file.Name())
+		}
+	}
+
 	errChan := initErrChan()
-	goNum := initGoNum(len(filesFromDir) / 2) // в папке точно половина .docx, половина - .pdf, иначе ранее вернется ошибка при конвертации
+	goNum := initGoNum(len(pdfFiles))
 	loadedFiles := initSyncMap()
 	unloadedFiles := initSyncMap()
-	month, year, _ := checkEventDateValidity(certificatesLocalDir) // можно не проверять ошибку, т.к. выше уже проверялась валидность этой даты
-	certificatesRemoteDir := filepath.Join("Сертификаты НМО", year, month, certificatesLocalDir)
 	debug.SetDebugLastStage("group of goroutines")
 
-	for _, file := range filesFromDir {
+	for _, fileName := range pdfFiles {
 		go func(fileName string) {
-			if filepath.Ext(fileName) == ".pdf" {
-				defer func() {
-					setNewWSWaiterMessage(wsWaiterResp, fmt.Sprintf("uploading certificates to YD: %v done, %v left", goNum.Counter, goNum.Num-goNum.Counter))
-					calcGoNum(goNum, errChan)
-				}()
-
-				localDebug := NewServerDebug(fmt.Sprintf(" -> goroutine for file %v -> ", fileName))
-				var loadedFileInfo YaDiskLoadedFileInfo
-				if errChan.OpenedState {
-					loadedFileInfo = d.loadFileToYaDisk(fileName, certificatesLocalDir, certificatesRemoteDir, localDebug)
-				}
-
-				pdfFilePath := filepath.Join(certificatesLocalDir, fileName)
-				docxFilePath := strings.Replace(pdfFilePath, ".pdf", ".docx", -1)
-				email := strings.TrimSuffix(strings.TrimPrefix(fileName, "Сертификат НМО для "), ".pdf")
+			defer func() {
+				setNewWSWaiterMessage(wsWaiterResp, goNumProgress(goNum, "uploading certificates to the artifact store"))
+				calcGoNum(goNum, errChan)
+			}()
 
-				err := os.Remove(docxFilePath) // удаляем файл с расширением .docx
-				if err != nil {
-					sendErrToErrChan(err, errChan, debug, localDebug)
-					return
-				}
+			localDebug := NewServerDebug(fmt.Sprintf(" -> goroutine for file %v -> ", fileName))
+			var loadedFileInfo LoadedFileInfo
+			if errChan.OpenedState {
+				loadedFileInfo = s.loadFileToStore(fileName, certificatesLocalDir, certificatesRemoteDir, localDebug)
+			}
 
-				if loadedFileInfo.Error != nil {
-					// если файл СОЗДАН локально И НЕ ЗАГРУЖЕН на ЯД, то записать в созданные и незагруженные файлы (такие файлы позже можно будет переносить на ЯД вручную при необходимости)
-					unloadedFileInfo := struct {
-						FileName string `json:"fileName"`
-						Error    string `json:"error"`
-					}{
-						FileName: fileName,
-						Error:    loadedFileInfo.Error.Error(),
-					}
-					addToSyncMap(unloadedFiles, email, unloadedFileInfo)
-				} else {
-					// если файл СОЗДАН локально И ЗАГРУЖЕН на ЯД, то записать в созданные и загруженные файлы
-					err := os.Remove(pdfFilePath) // удаляем файл с расширением .pdf
-					if err != nil {
-						sendErrToErrChan(err, errChan, debug, localDebug)
-						return
-					}
+			email := strings.TrimSuffix(strings.TrimPrefix(fileName, "Сертификат НМО для "), ".pdf")
+			records.Locker.RLock()
+			record, _ := records.Map[email].(certificates.Record)
+			records.Locker.RUnlock()
 
-					loadedFileInfo := struct {
-						Link string `json:"link"`
-					}{
-						Link: loadedFileInfo.Link,
-					}
-					addToSyncMap(loadedFiles, email, loadedFileInfo)
+			if loadedFileInfo.Error != nil {
+				// если файл СОЗДАН локально И НЕ ЗАГРУЖЕН в хранилище, то записать в созданные и незагруженные файлы
+				unloadedFileInfo := UnloadedCertificateInfo{
+					Serial: record.Serial,
+					Error:  loadedFileInfo.Error.Error(),
 				}
+				addToSyncMap(unloadedFiles, email, unloadedFileInfo)
+			} else {
+				// если файл СОЗДАН локально И ЗАГРУЖЕН в хранилище, то записать в созданные и загруженные файлы
+				loadedFileInfo := LoadedCertificateInfo{
+					Link:   loadedFileInfo.Link,
+					Serial: record.Serial,
+				}
+				addToSyncMap(loadedFiles, email, loadedFileInfo)
 			}
-		}(file.Name())
+		}(fileName)
 	}
 
 	err = <-errChan.Chan
@@ -1033,29 +2043,27 @@ func (d *YaDisk) loadCertificatesToYaDisk(certificatesLocalDir string, debug *Se
 		return nil, err
 	}
 
-	// если ВСЕ файлы СОЗДАНЫ локально И ЗАГРУЖЕНЫ на ЯД, то удаляем локальную папку для хранения сертификатов на конкретную дату
-	if len(unloadedFiles.Map) == 0 {
-		err = os.Remove(certificatesLocalDir)
-		if err != nil {
-			return nil, err
-		}
-	}
-
 	return map[string]interface{}{"links": loadedFiles.Map, "unloadedFiles": unloadedFiles.Map}, nil
 }
 
-func (d *YaDisk) loadFileToYaDisk(fileName, localDir, remoteDir string, debug *ServerDebug) YaDiskLoadedFileInfo {
-	debug.SetDebugLastStage("loadFileToYaDisk")
+func (s *ServerApi) loadFileToStore(fileName, localDir, remoteDir string, debug *ServerDebug) LoadedFileInfo {
+	debug.SetDebugLastStage("loadFileToStore")
 
 	var err error
 	defer debug.DeleteDebugLastStage(&err)
 
-	link, err := d.LoadToYaDisk(fileName, localDir, remoteDir, true)
+	remoteFilePath := path.Join(remoteDir, fileName)
+	err = s.artifactStore.Upload(filepath.Join(localDir, fileName), remoteFilePath, true)
 	if err != nil {
-		return YaDiskLoadedFileInfo{Error: err}
+		return LoadedFileInfo{Error: err}
 	}
 
-	return YaDiskLoadedFileInfo{Link: link}
+	link, err := s.artifactStore.Publish(remoteFilePath)
+	if err != nil {
+		return LoadedFileInfo{Error: err}
+	}
+
+	return LoadedFileInfo{Link: link}
 }
 
 func (s *ServerApi) getDashaMailDataForBook(bookID string, debug *ServerDebug, wsWaiterResp *WebSocketWaiterResponse) (*map[string]GetUserServerResponse, error) {
@@ -1070,21 +2078,9 @@ func (s *ServerApi) getDashaMailDataForBook(bookID string, debug *ServerDebug, w
 		err = fmt.Errorf("bookID '%v' must be of type int", bookID)
 		return nil, err
 	}
-	jsonData := s.getJSONBytes(DashaMailRequest{
-		Method: "lists.get_members",
-		BookID: bookID,
-		Limit:  1e6, // любое большое число (лишь бы больше максимального количества в книге), иначе вернется информация не по всем пользователям в книге
-	})
-
-	response, err := DoRequestPOST(s.dashaMailAcc.URI, jsonData, debug)
-	if err != nil {
-		return nil, err
-	}
-
-	data := UnmarshalResponseData(response)
-
-	err = data.Msg.CheckForError(debug)
+	members, err := s.dashaMail.Lists.GetAllMembers(bookID, 0)
 	if err != nil {
+		debug.SetDebugDataFromError(err)
 		return nil, err
 	}
 
@@ -1093,9 +2089,9 @@ func (s *ServerApi) getDashaMailDataForBook(bookID string, debug *ServerDebug, w
 		return nil, err
 	}
 
-	for num, user := range data.Data {
-		setNewWSWaiterMessage(wsWaiterResp, fmt.Sprintf("readting users info in book %v: %v done, %v left", bookID, num, len(data.Data)-num))
-		infoDM[user["email"].(string)] = *setServerApiUserFields(user, titles, debug)
+	for num, user := range members {
+		setNewWSWaiterMessage(wsWaiterResp, fmt.Sprintf("readting users info in book %v: %v done, %v left", bookID, num, len(members)-num))
+		infoDM[user.Email()] = *setServerApiUserFields(user, titles, debug)
 	}
 
 	return &infoDM, nil
@@ -1107,23 +2103,24 @@ func (s *ServerApi) getWebinarHeader(eventID string, debug *ServerDebug) (*GetRe
 	var err error
 	defer debug.DeleteDebugLastStage(&err)
 
-	params := url.Values{}
-	params.Add("uid", s.facecastAcc.ApiKey)
-	params.Add("api_key", s.facecastAcc.ApiSecret)
-	params.Add("event_code", eventID)
-
-	uri := fmt.Sprintf("%sv1/get_event?%s", s.facecastAcc.URI, params.Encode())
-	response, err := DoRequestGET(uri, debug)
+	event, err := s.facecast.GetEvent(eventID)
 	if err != nil {
+		debug.SetDebugDataFromError(err)
 		return nil, err
 	}
 
 	var report GetReportServerResponse
-	err = json.Unmarshal(response, &report.EventInfo)
-	if err != nil {
-		return nil, fmt.Errorf(err.Error()+" Server response: "+string(response), http.StatusBadRequest)
+	report.EventInfo = FacecastEventInfoResponse{
+		VideoName:      event.Name,
+		Description:    event.Description,
+		PlanStartDate:  event.PlanStartDate,
+		StartDate:      event.StartDate,
+		EndDate:        event.EndDate,
+		Duration:       event.Duration,
+		ViewersMax:     event.ViewersMax,
+		TimeViewersMax: event.TimeViewersMax,
+		ViewersTotal:   event.ViewersTotal,
 	}
-
 	report.EventInfo.StartDate = ISOToHuman(report.EventInfo.StartDate)
 	report.EventInfo.PlanStartDate = ISOToHuman(report.EventInfo.PlanStartDate)
 	report.EventInfo.EndDate = ISOToHuman(report.EventInfo.EndDate)
@@ -1143,47 +2140,23 @@ func (s *ServerApi) getFacecastUsers(eventID string, debug *ServerDebug) ([]User
 	var err error
 	defer debug.DeleteDebugLastStage(&err)
 
-	params := url.Values{}
-	params.Add("uid", s.facecastAcc.ApiKey)
-	params.Add("api_key", s.facecastAcc.ApiSecret)
-	params.Add("event_code", eventID)
-
-	uri := s.facecastAcc.URI + "v1/get_event_tickets"
-	response, err := DoRequestPOST(uri, []byte(params.Encode()), debug)
+	tickets, err := s.facecast.GetEventTickets(eventID)
 	if err != nil {
+		debug.SetDebugDataFromError(err)
 		return nil, err
 	}
 
-	var _err FacecastErrorResponse
-	_ = json.Unmarshal(response, &_err)
-	if _err.Error != "" {
-		err = fmt.Errorf("%s", _err.Error)
-		return nil, err
-	}
-
-	var tickets []FacecastTicketResponse
-	err = json.Unmarshal(response, &tickets)
-	if err != nil {
-		return nil, fmt.Errorf("%s Server response: %s", err.Error(), string(response))
-	}
-
-	uri = s.facecastAcc.URI + "v1/get_event_keys"
-	response, err = DoRequestPOST(uri, []byte(params.Encode()), debug)
+	keys, err := s.facecast.GetEventKeys(eventID)
 	if err != nil {
+		debug.SetDebugDataFromError(err)
 		return nil, err
 	}
 
-	var keys []FacecastKeyResponse
-	err = json.Unmarshal(response, &keys)
-	if err != nil {
-		return nil, fmt.Errorf("%s Server response: %s", err.Error(), string(response))
-	}
-
 	users := make([]UserInfo, 0)
 	singleKeys := 0
 
-	serviceKeys := make([]FacecastKeyResponse, 0)
-	serviceTickets := make(map[int64]FacecastTicketResponse, 0) // без email, созданные через менеджер зрителей в ЛК ФК
+	serviceKeys := make([]facecast.Key, 0)
+	serviceTickets := make(map[int64]facecast.Ticket, 0) // без email, созданные через менеджер зрителей в ЛК ФК
 	for _, k := range keys {
 		isSingle := true
 		if k.TicketID == 0 {
@@ -1191,7 +2164,7 @@ func (s *ServerApi) getFacecastUsers(eventID string, debug *ServerDebug) ([]User
 			continue
 		}
 		for _, t := range tickets {
-			if k.TicketID == t.TicketID && t.Email != "" {
+			if k.TicketID == t.ID && t.Email != "" {
 				isSingle = false
 				users = append(users, UserInfo{
 					Name:     t.Name,
@@ -1202,8 +2175,8 @@ func (s *ServerApi) getFacecastUsers(eventID string, debug *ServerDebug) ([]User
 				})
 				break
 			}
-			if _, ok := serviceTickets[t.TicketID]; t.Email == "" && !ok {
-				serviceTickets[t.TicketID] = t
+			if _, ok := serviceTickets[t.ID]; t.Email == "" && !ok {
+				serviceTickets[t.ID] = t
 			}
 		}
 		if isSingle {
@@ -1213,7 +2186,7 @@ func (s *ServerApi) getFacecastUsers(eventID string, debug *ServerDebug) ([]User
 
 	//// проверка отсутствие юзеров без почт
 	//if len(serviceTickets) != 0 {
-	//	var tickets []FacecastTicketResponse
+	//	var tickets []facecast.Ticket
 	//	for _, ticket := range serviceTickets {
 	//		tickets = append(tickets, ticket)
 	//	}
@@ -1236,42 +2209,18 @@ func (s *ServerApi) getUsersWindowsAndMinutes(users *[]UserInfo, eventID string,
 	var err error
 	defer debug.DeleteDebugLastStage(&err)
 
-	params := url.Values{}
-	params.Add("uid", s.facecastAcc.ApiKey)
-	params.Add("api_key", s.facecastAcc.ApiSecret)
-	params.Add("event_code", eventID)
-
-	uri := s.facecastAcc.URI + "v1/get_visit_stats" // минуты
-	response, err := DoRequestPOST(uri, []byte(params.Encode()), debug)
+	minutes, err := s.facecast.GetVisitStats(eventID) // минуты
 	if err != nil {
+		debug.SetDebugDataFromError(err)
 		return err
 	}
 
-	var _err FacecastErrorResponse
-	_ = json.Unmarshal(response, &_err)
-	if _err.Error != "" {
-		err = fmt.Errorf("%s", _err.Error)
-		return err
-	}
-
-	var minutes []FacecastMinutesResponse
-	err = json.Unmarshal(response, &minutes)
-	if err != nil {
-		return fmt.Errorf("%s Server response: %s", err.Error(), string(response))
-	}
-
-	uri = s.facecastAcc.URI + "v1/get_user_activity_detailed_all" // окна
-	response, err = DoRequestPOST(uri, []byte(params.Encode()), debug)
+	windows, err := s.facecast.GetUserActivityDetailedAll(eventID) // окна
 	if err != nil {
+		debug.SetDebugDataFromError(err)
 		return err
 	}
 
-	var windows []FacecastWindowsResponse
-	err = json.Unmarshal(response, &windows)
-	if err != nil {
-		return fmt.Errorf("%s Server response: %s", err.Error(), string(response))
-	}
-
 	//// проверка на совпадение количества юзеров и окон
 	//if len(*users) != len(windows) {
 	//	err = fmt.Errorf("Have some mismatches with users and windows!!! len(users) %v len(windows) %v", len(*users), len(windows))
@@ -1289,7 +2238,7 @@ func (s *ServerApi) getUsersWindowsAndMinutes(users *[]UserInfo, eventID string,
 			if m.Key == userInfo.Key {
 				for _, minuteInfo := range m.Minutes {
 					if len(minuteInfo.Views) != 0 {
-						if online := minuteInfo.Views[0].(map[string]interface{})["is_live"].(bool); online {
+						if minuteInfo.Views[0].IsLive {
 							(*users)[userNum].MinutesViewedOnline += 1
 							(*users)[userNum].MinutesOnline = append((*users)[userNum].MinutesOnline, minuteInfo.Position+1)
 						} else {
@@ -1321,6 +2270,10 @@ func (s *ServerApi) getDashaMailDataForEmails(bookID string, emails []string, de
 	var err error
 	defer debug.DeleteDebugLastStage(&err)
 
+	if err = checkCancelled(wsWaiterResp); err != nil {
+		return nil, err
+	}
+
 	titles, err := s.getBookTitles(bookID, false, debug)
 	if err != nil {
 		return nil, err
@@ -1336,15 +2289,15 @@ func (s *ServerApi) getDashaMailDataForEmails(bookID string, emails []string, de
 			goNum.ControlMaxNum <- struct{}{}
 
 			defer func() {
-				setNewWSWaiterMessage(wsWaiterResp, fmt.Sprintf("reading users' info from DashaMail: %v done, %v left", goNum.Counter, goNum.Num-goNum.Counter))
+				setNewWSWaiterMessage(wsWaiterResp, goNumProgress(goNum, "reading users' info from DashaMail"))
 				<-goNum.ControlMaxNum
 				calcGoNum(goNum, errChan)
 			}()
 
 			localDebug := NewServerDebug(fmt.Sprintf(" -> goroutine for email %v -> ", email))
 			var user *GetUserServerResponse
-			var err error
-			if errChan.OpenedState {
+			err := checkCancelled(wsWaiterResp)
+			if err == nil && errChan.OpenedState {
 				user, err = s.readEmailData(bookID, titles, email, localDebug)
 			}
 
@@ -1378,12 +2331,10 @@ func (s *ServerApi) facecastLogin(eventID, email, name string) (*FacecastLoginSe
 	defer debug.SetDebugFinalStage(&err, "end of facecastLogin")
 
 	/*/
-	 * Далее на протяжении блока работаем с локальной копией информации по конкретному вебинару => для сохранения возможных изменений
-	 * необходимо (возможно) измененную копию вписать в map перед выходом из функции
+	 * Запросы к Facecast выполняются без блокировки хранилища, а их результаты вписываются в хранилище отдельными
+	 * вызовами Update => одновременные входы разных зрителей не ждут друг друга
 	/*/
-	webinar := new(ServerWebinar)
-	*webinar = (*s.webinars)[eventID]
-	defer func() { (*s.webinars)[eventID] = *webinar }()
+	webinar, _ := s.webinarStore.Get(eventID)
 
 	if webinar.Users.PreviousQueryTime == nil || webinar.Users.PreviousQueryTime.Before(time.Now().Add(-1*time.Hour)) {
 		var users []UserInfo
@@ -1392,62 +2343,49 @@ func (s *ServerApi) facecastLogin(eventID, email, name string) (*FacecastLoginSe
 			return nil, debug
 		}
 
-		for _, user := range users {
-			webinar.Users.Info = append(webinar.Users.Info, ServerUser{
-				Email:    user.Email,
-				Name:     user.Name,
-				Key:      user.Key,
-				WayToAdd: user.WayToAdd,
-			})
-		}
+		webinar, err = s.webinarStore.Update(eventID, func(webinar *webinars.Webinar) {
+			for _, user := range users {
+				webinar.Users.Add(webinars.User{
+					Email:    user.Email,
+					Name:     user.Name,
+					Key:      user.Key,
+					WayToAdd: user.WayToAdd,
+				})
+			}
 
-		now := time.Now()
-		webinar.Users.PreviousQueryTime = &now
-		webinar.DeletionDate = time.Now().Add(7 * 24 * time.Hour)
+			now := time.Now()
+			webinar.Users.PreviousQueryTime = &now
+			webinar.DeletionDate = time.Now().Add(7 * 24 * time.Hour)
+		})
+		if err != nil {
+			return nil, debug
+		}
 	}
 
-	for _, user := range webinar.Users.Info {
-		if user.Email == email {
-			return &FacecastLoginServerResponse{Key: user.Key, PersonalPhrases: webinar.PersonalPhrases}, nil
-		}
+	if user, ok := webinar.Users.Find(email); ok {
+		return &FacecastLoginServerResponse{Key: user.Key, PersonalPhrases: webinar.PersonalPhrases}, nil
 	}
 
 	key := s.generateKey(email)
-	params := url.Values{}
-	params.Add("uid", s.facecastAcc.ApiKey)
-	params.Add("api_key", s.facecastAcc.ApiSecret)
-	params.Add("event_code", eventID)
-	params.Add("name", name)
-	params.Add("email", email)
-	params.Add("key", key)
-	params.Add("multiple_vpp", "0")
-
-	uri := s.facecastAcc.URI + "v1/insert_key"
-	response, err := DoRequestPOST(uri, []byte(params.Encode()), debug)
+	err = s.facecast.InsertKey(eventID, facecast.NewKey{Name: name, Email: email, Key: key})
 	if err != nil {
+		debug.SetDebugDataFromError(err)
 		return nil, debug
 	}
 
-	var insertKey FacecastInsertKeyResponse
-	err = json.Unmarshal(response, &insertKey)
+	webinar, err = s.webinarStore.Update(eventID, func(webinar *webinars.Webinar) {
+		webinar.Users.Add(webinars.User{
+			Email:    email,
+			Name:     name,
+			Key:      key,
+			WayToAdd: "manual",
+		})
+		webinar.DeletionDate = time.Now().Add(7 * 24 * time.Hour)
+	})
 	if err != nil {
-		err = fmt.Errorf("%s; Facecast server response: %s", err.Error(), response)
-		return nil, debug
-	}
-
-	if !insertKey.Success {
-		err = fmt.Errorf("can't insert key because not success Facecast server response: %s", response)
 		return nil, debug
 	}
 
-	webinar.Users.Info = append(webinar.Users.Info, ServerUser{
-		Email:    email,
-		Name:     name,
-		Key:      key,
-		WayToAdd: "manual",
-	})
-	webinar.DeletionDate = time.Now().Add(7 * 24 * time.Hour)
-
 	return &FacecastLoginServerResponse{Key: key, PersonalPhrases: webinar.PersonalPhrases}, nil
 }
 
@@ -1479,60 +2417,152 @@ func (s *ServerApi) getDashaMailData(bookID string, emails []interface{}) (*map[
 	return response, debug
 }
 
-func (s *ServerApi) createWebinarReport(reportName string, reportData []interface{}, wsWaiterResp *WebSocketWaiterResponse) *ServerDebug {
+// createWebinarReport строит отчет по вебинару и загружает его в хранилище. Если переданы трансляции (eventIDs), данные
+// отчета собираются на сервере (как в getWebinarReportInfo), а reportName необязателен. Иначе отчет строится из строк
+// reportData, подготовленных frontend.
+func (s *ServerApi) createWebinarReport(eventIDs []string, reportName string, reportData []interface{}, wsWaiterResp *WebSocketWaiterResponse) *ServerDebug {
 	debug := NewServerDebug("start of createWebinarReport -> ")
 	setNewWSWaiterMessage(wsWaiterResp, "started creating the report")
 
 	var err error
 	defer debug.SetDebugFinalStage(&err, "end of createWebinarReport")
 
+	var report *GetReportServerResponse
+	if len(eventIDs) == 1 {
+		report, err = s.buildWebinarReport(eventIDs[0], debug, wsWaiterResp)
+	} else if len(eventIDs) > 1 {
+		report, err = s.buildConferenceReport(eventIDs, debug, wsWaiterResp)
+	}
+	if err != nil {
+		return debug
+	}
+	if report != nil && reportName == "" {
+		reportName = report.ReportName
+	}
+	if reportName, err = sanitizeReportName(reportName); err != nil {
+		return debug
+	}
+
 	setNewWSWaiterMessage(wsWaiterResp, "started creating the excel report")
-	err = s.writeReportData(reportName, "webinar", reportData, debug, wsWaiterResp)
+	f, err := s.writeReportData(reportName, "webinar", reportData, strings.Join(eventIDs, ", "), report, nil, debug, wsWaiterResp)
+	if err != nil {
+		return debug
+	}
+
+	setNewWSWaiterMessage(wsWaiterResp, "started loading the excel report to the artifact store")
+	// дата вебинара - плановая дата начала трансляции, а для отчета из строк frontend - дата в названии отчета
+	var eventDate eventdate.EventDate
+	if report != nil {
+		eventDate, err = eventdate.Parse(report.EventInfo.PlanStartDate)
+	} else if date, ok := eventdate.Find(reportName); ok {
+		eventDate = date
+	} else {
+		err = fmt.Errorf("can't find the event date in the report name '%s'", reportName)
+	}
 	if err != nil {
 		return debug
 	}
 
-	setNewWSWaiterMessage(wsWaiterResp, "started loading the excel report to Yandex Disk")
-	d, err := yd.InitYaDisk(s.yaDiskAcc.ApiKey)
+	remoteDir, err := s.checkRemoteFolderValidity(storage.WEBINAR_REPORT_ARTIFACT, eventDate, debug)
 	if err != nil {
 		return debug
 	}
 
-	eventDate := strings.Join(strings.Split(strings.Split(reportName, " ")[1], "."), " ")
-	err = (&YaDisk{d}).checkYaDiskFoldersValidity("Отчёты по мероприятиям/{year}/{month}/", eventDate, debug)
+	err = s.loadReportToStore(f, reportName, remoteDir, debug)
+
+	return debug
+}
+
+// createSeriesReport строит отчет по серии и загружает его в папку отчетов по мероприятиям по дате первого занятия.
+func (s *ServerApi) createSeriesReport(eventIDs []string, reportName string, wsWaiterResp *WebSocketWaiterResponse) *ServerDebug {
+	debug := NewServerDebug("start of createSeriesReport -> ")
+	setNewWSWaiterMessage(wsWaiterResp, "started creating the series report")
+
+	var err error
+	defer debug.SetDebugFinalStage(&err, "end of createSeriesReport")
+
+	series, err := s.buildSeriesReport(eventIDs, debug, wsWaiterResp)
 	if err != nil {
 		return debug
 	}
+	if reportName == "" {
+		reportName = series.ReportName
+	}
+	if reportName, err = sanitizeReportName(reportName); err != nil {
+		return debug
+	}
 
-	month, year, _ := checkEventDateValidity(eventDate) // можно не проверять ошибку, т.к. выше уже проверялась валидность этой даты
-	remoteDir := filepath.Join("Отчёты по мероприятиям", year, month)
-	loadedFileInfo := (&YaDisk{d}).loadFileToYaDisk(reportName+".xlsx", "", remoteDir, debug)
-	if loadedFileInfo.Error != nil {
-		err = fmt.Errorf("can't load file %s to Yandex Disk: %+v", reportName+".xlsx", loadedFileInfo.Error)
+	setNewWSWaiterMessage(wsWaiterResp, "started creating the excel report")
+	f := excel.NewFile()
+	f.SetSheetName("Sheet1", "Отчёт")
+	if err = WriteExcelSeriesReport(f, series, debug); err != nil {
+		err = fmt.Errorf("writing error for file %s: %+v", reportName, err)
+		return debug
+	}
+	if err = FormatExcelSeriesReport(f, series, debug); err != nil {
+		return debug
+	}
+
+	setNewWSWaiterMessage(wsWaiterResp, "started loading the excel report to the artifact store")
+	eventDate, err := eventdate.Parse(series.Sessions[0].PlanStartDate)
+	if err != nil {
 		return debug
 	}
-	err = os.Remove(reportName + ".xlsx")
+
+	remoteDir, err := s.checkRemoteFolderValidity(storage.WEBINAR_REPORT_ARTIFACT, eventDate, debug)
+	if err != nil {
+		return debug
+	}
+
+	err = s.loadReportToStore(f, reportName, remoteDir, debug)
 
 	return debug
 }
 
-func (s *ServerApi) writeReportData(reportName, reportType string, reportData []interface{}, debug *ServerDebug, wsWaiterResp *WebSocketWaiterResponse) error {
+// writeReportData строит в памяти excel-отчет reportName. Отчет по вебинару пишется из report, если он собран на сервере,
+// иначе - из строк reportData.
+func (s *ServerApi) writeReportData(reportName, reportType string, reportData []interface{}, eventID string, report *GetReportServerResponse, analytics *CampaignsAnalytics, debug *ServerDebug, wsWaiterResp *WebSocketWaiterResponse) (*excel.File, error) {
 	debug.SetDebugLastStage("writeReportData -> ")
 
 	var err error
 	defer debug.DeleteDebugLastStage(&err)
 
+	if err = checkCancelled(wsWaiterResp); err != nil {
+		return nil, err
+	}
+
 	f := excel.NewFile()
 	f.SetSheetName("Sheet1", "Отчёт")
 
+	// форматы столбцов из схемы отчета (только для отчетов, собранных на сервере)
+	var applyFormats func() error
+
 	switch reportType {
 	case "webinar":
 		// построение статистики просмотров и распределений по минутам и специальностям по данным в excel-отчете
 		setNewWSWaiterMessage(wsWaiterResp, fmt.Sprintf("writing excel report info"))
-		viewingRegimesChartData, specialisationsChartData, minutesDistributionChartData, _err := WriteExcelWebinarData(f, reportData, debug) // запись данных в excel-отчет и сбор данных для графиков
+		var (
+			viewingRegimesChartData, specialisationsChartData map[string]int
+			minutesDistributionChartData                      map[int]struct{ Online, Offline, Total int }
+			_err                                              error
+		)
+		if report != nil { // запись данных в excel-отчет и сбор данных для графиков
+			viewingRegimesChartData, specialisationsChartData, minutesDistributionChartData, _err = WriteExcelWebinarReport(f, eventID, report, debug)
+			if _err == nil {
+				_err = WriteExcelConferenceHalls(f, report, debug) // листы залов сводного отчета
+			}
+			applyFormats = func() error {
+				if err := WebinarUsersSchema.ApplyFormats(f, "Отчёт", 4, 3+len(report.UsersInfo)); err != nil {
+					return err
+				}
+				return FormatExcelConferenceHalls(f, report, debug)
+			}
+		} else {
+			viewingRegimesChartData, specialisationsChartData, minutesDistributionChartData, _err = WriteExcelWebinarData(f, reportData, debug)
+		}
 		if _err != nil {
 			err = fmt.Errorf("writing error for file %s: %+v", reportName, _err)
-			return err
+			return nil, err
 		}
 
 		// построение графиков excel-отчета
@@ -1540,66 +2570,113 @@ func (s *ServerApi) writeReportData(reportName, reportType string, reportData []
 		err = PlotWebinarCharts(f, viewingRegimesChartData, specialisationsChartData, minutesDistributionChartData, debug)
 		if err != nil {
 			err = fmt.Errorf("can't plot charts for file %s: %+v", reportName, err)
-			return err
+			return nil, err
 		}
 
 	case "campaigns":
 		// построение excel-отчета по рассылкам
 		setNewWSWaiterMessage(wsWaiterResp, fmt.Sprintf("writing excel report info"))
-		err = WriteExcelCampaignsData(f, reportData, debug)
+		if campaigns, ok := DecodeCampaignsReport(reportData); ok {
+			err = WriteExcelCampaignsReport(f, campaigns, analytics, debug)
+			applyFormats = func() error { return FormatExcelCampaignsReport(f, campaigns, analytics, debug) }
+		} else {
+			err = WriteExcelCampaignsData(f, reportData, debug)
+		}
 		if err != nil {
 			err = fmt.Errorf("writing error for file %s: %+v", reportName, err)
-			return err
+			return nil, err
 		}
 	}
 
 	// настройка стилей excel-отчета
 	err = AutoResizeColumns(f, "Отчёт", debug)
+	if err != nil {
+		return nil, err
+	}
+
+	if applyFormats != nil {
+		debug.SetDebugLastStage("applying report schema formats")
+		if err = applyFormats(); err != nil {
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+// loadReportToStore сохраняет excel-отчет f во временную папку, своя у каждого запуска (отчеты строятся одновременно
+// в фоновых задачах, и отчеты с одинаковыми названиями не должны перезаписывать друг друга), и загружает его в папку
+// хранилища remoteDir как reportName.xlsx.
+func (s *ServerApi) loadReportToStore(f *excel.File, reportName, remoteDir string, debug *ServerDebug) error {
+	debug.SetDebugLastStage("loadReportToStore -> ")
+
+	var err error
+	defer debug.DeleteDebugLastStage(&err)
+
+	reportLocalDir, err := ioutil.TempDir("", "report_")
 	if err != nil {
 		return err
 	}
+	defer os.RemoveAll(reportLocalDir)
 
-	// сохранение excel-отчета
 	debug.SetDebugLastStage("saving an excel report")
-	if err = f.SaveAs(reportName + ".xlsx"); err != nil {
+	fileName := reportName + ".xlsx"
+	if err = f.SaveAs(filepath.Join(reportLocalDir, fileName)); err != nil {
 		err = fmt.Errorf("saving error for file %s: %+v", reportName, err)
 		return err
 	}
 
+	loadedFileInfo := s.loadFileToStore(fileName, reportLocalDir, remoteDir, debug)
+	if loadedFileInfo.Error != nil {
+		err = fmt.Errorf("can't load file %s to the artifact store: %+v", fileName, loadedFileInfo.Error)
+		return err
+	}
+
 	return nil
 }
 
-func (s *ServerApi) createCampaignsReport(reportName string, reportData []interface{}, wsWaiterResp *WebSocketWaiterResponse) *ServerDebug {
+// createCampaignsReport строит отчет по рассылкам. Если reportData - рассылки в формате getCampaignsReportInfo, в отчет
+// добавляются динамика и сравнение с предыдущим периодом. Период отчета - с startDate по endDate, а если они пустые -
+// с первой по последнюю дату отправки рассылок.
+func (s *ServerApi) createCampaignsReport(reportName string, reportData []interface{}, startDate, endDate string, wsWaiterResp *WebSocketWaiterResponse) *ServerDebug {
 	debug := NewServerDebug("start of createCampaignsReport -> ")
 	setNewWSWaiterMessage(wsWaiterResp, "started creating the report")
 
 	var err error
 	defer debug.SetDebugFinalStage(&err, "end of createCampaignsReport")
 
-	setNewWSWaiterMessage(wsWaiterResp, "started creating the excel report")
-	err = s.writeReportData(reportName, "campaigns", reportData, debug, wsWaiterResp)
-	if err != nil {
+	if reportName, err = sanitizeReportName(reportName); err != nil {
 		return debug
 	}
 
-	setNewWSWaiterMessage(wsWaiterResp, "started loading the excel report to Yandex Disk")
-	d, err := yd.InitYaDisk(s.yaDiskAcc.ApiKey)
-	if err != nil {
-		return debug
+	var analytics *CampaignsAnalytics
+	if campaigns, ok := DecodeCampaignsReport(reportData); ok {
+		if startDate == "" && endDate == "" {
+			startDate, endDate, ok = CampaignsReportPeriod(campaigns)
+		}
+
+		if ok {
+			setNewWSWaiterMessage(wsWaiterResp, "started comparing the campaigns with the previous period")
+			analytics, err = s.getCampaignsAnalytics(campaigns, startDate, endDate, debug, wsWaiterResp)
+			if err != nil {
+				return debug
+			}
+		}
 	}
 
-	err = (&YaDisk{d}).checkYaDiskFoldersValidity("Отчёты по рассылкам/{year}", time.Now().Format("02 01 2006"), debug)
+	setNewWSWaiterMessage(wsWaiterResp, "started creating the excel report")
+	f, err := s.writeReportData(reportName, "campaigns", reportData, "", nil, analytics, debug, wsWaiterResp)
 	if err != nil {
 		return debug
 	}
 
-	remoteDir := filepath.Join("Отчёты по рассылкам", fmt.Sprintf("%v", time.Now().Year()))
-	loadedFileInfo := (&YaDisk{d}).loadFileToYaDisk(reportName+".xlsx", "", remoteDir, debug)
-	if loadedFileInfo.Error != nil {
-		err = fmt.Errorf("can't load file %s to Yandex Disk: %+v", reportName+".xlsx", loadedFileInfo.Error)
+	setNewWSWaiterMessage(wsWaiterResp, "started loading the excel report to the artifact store")
+	remoteDir, err := s.checkRemoteFolderValidity(storage.CAMPAIGNS_REPORT_ARTIFACT, eventdate.FromTime(time.Now()), debug)
+	if err != nil {
 		return debug
 	}
-	err = os.Remove(reportName + ".xlsx")
+
+	err = s.loadReportToStore(f, reportName, remoteDir, debug)
 
 	return debug
 }
@@ -1610,6 +2687,10 @@ func (s *ServerApi) updateDashaMailData(bookID string, infoDM map[string]interfa
 	var err error
 	defer debug.DeleteDebugLastStage(&err)
 
+	if err = checkCancelled(wsWaiterResp); err != nil {
+		return nil, err
+	}
+
 	i, err := DecodeToStruct((*map[string]DashaMailUpdateInfo)(nil), infoDM, debug)
 	if err != nil {
 		return nil, fmt.Errorf("decoding interface{} to struct error: " + err.Error())
@@ -1631,7 +2712,7 @@ func (s *ServerApi) updateDashaMailData(bookID string, infoDM map[string]interfa
 			goNum.ControlMaxNum <- struct{}{}
 
 			defer func() {
-				setNewWSWaiterMessage(wsWaiterResp, fmt.Sprintf("updating DashaMail users' info: %v done, %v left", goNum.Counter, goNum.Num-goNum.Counter))
+				setNewWSWaiterMessage(wsWaiterResp, goNumProgress(goNum, "updating DashaMail users' info"))
 				<-goNum.ControlMaxNum
 				calcGoNum(goNum, errChan)
 			}()
@@ -1644,8 +2725,9 @@ func (s *ServerApi) updateDashaMailData(bookID string, infoDM map[string]interfa
 			}
 
 			if err != nil {
-				if strings.Index(err.Error(), "DashaMail error") != -1 {
-					addToSyncMap(writingDMLogs, email, "ошибка записи: "+err.Error())
+				var dmErr *dashamail.Error
+				if errors.As(err, &dmErr) {
+					addToSyncMap(writingDMLogs, email, "ошибка записи: "+dmErr.Error())
 				} else {
 					sendErrToErrChan(err, errChan, debug, localDebug)
 				}
@@ -1663,57 +2745,82 @@ func (s *ServerApi) updateDashaMailData(bookID string, infoDM map[string]interfa
 		return nil, fmt.Errorf("decoding interface{} to struct error: " + err.Error())
 	}
 
-	return invalidEmails.(*map[string]string), nil
-}
+	written := make([]string, 0, len(_infoDM))
+	for email := range _infoDM {
+		if _, ok := writingDMLogs.Map[email]; !ok {
+			written = append(written, email)
+		}
+	}
 
-func (s *ServerApi) addUserToDashaMailBook(bookID string, titles *map[string]string, email string, columnsNames []string, params []interface{}, debug *ServerDebug) error {
-	debug.SetDebugLastStage("addUserToDashaMailBook -> ")
+	s.refreshPointsLedgerBook(bookID, written)
 
-	var err error
-	defer debug.DeleteDebugLastStage(&err)
+	return invalidEmails.(*map[string]string), nil
+}
 
-	d := DashaMailRequest{
-		Method:  "lists.add_member",
-		BookID:  bookID,
-		Email:   email,
-		Update:  "update",   // любая string перезапишет данные для существующего email
-		NoCheck: "no_check", // любая string впишет email в книгу в DashaMail без валидации
+// refreshPointsLedgerBook обновляет реестр баллов после записи в книгу ДМ bookID. Данные уже записаны в DashaMail, а реестр
+// баллов восстановит плановая синхронизация, поэтому ошибка обновления реестра только логируется и не меняет результат записи.
+func (s *ServerApi) refreshPointsLedgerBook(bookID string, emails []string) {
+	debug := NewServerDebug(fmt.Sprintf("refreshPointsLedgerBook for book %s -> ", bookID))
+	if err := s.updatePointsLedgerBook(bookID, emails, debug); err != nil {
+		fmt.Println(fmt.Errorf("+++++++ CAN'T UPDATE POINTS LEDGER FOR BOOK %s: %+v (es: %s) +++++++", bookID, err, debug.ExecutionStages))
 	}
+}
 
-	errChan := initErrChan()
-	goNum := initGoNum(len(columnsNames))
-	debug.SetDebugLastStage("group of goroutines")
-	for i := 0; i < len(columnsNames); i++ {
-		go func(i int) {
-			defer calcGoNum(goNum, errChan)
+// updatePointsLedgerBook перечитывает книгу bookID после записи в DashaMail и обновляет в реестре баллов записи этой книги
+// у пользователей emails (иначе изменения были бы видны только после следующей синхронизации реестра).
+func (s *ServerApi) updatePointsLedgerBook(bookID string, emails []string, debug *ServerDebug) error {
+	debug.SetDebugLastStage("updatePointsLedgerBook -> ")
 
-			localDebug := NewServerDebug(fmt.Sprintf(" -> goroutine for columnsNames %v -> ", columnsNames[i]))
-			var err error
-			if errChan.OpenedState {
-				err = setDashaMailFieldParam(&d, columnsNames[i], params[i], titles, localDebug)
-			}
+	var err error
+	defer debug.DeleteDebugLastStage(&err)
 
-			if err != nil {
-				sendErrToErrChan(err, errChan, debug, localDebug)
-			}
-		}(i)
+	// до первой синхронизации баллы читаются из DashaMail напрямую
+	if !s.pointsLedger.Synced() || len(emails) == 0 {
+		return nil
 	}
 
-	err = <-errChan.Chan
+	infoDM, err := s.getDashaMailDataForBook(bookID, debug, nil)
 	if err != nil {
 		return err
 	}
 
-	jsonData := s.getJSONBytes(d)
-	response, err := DoRequestPOST(s.dashaMailAcc.URI, jsonData, debug)
-	if err != nil {
-		return err
+	members := make(map[string]GetUserServerResponse, len(*infoDM))
+	for email, info := range *infoDM {
+		members[strings.ToLower(email)] = info
 	}
 
-	data := UnmarshalResponseData(response)
+	entries := make(map[string][]points.Entry, len(emails))
+	for _, email := range emails {
+		entries[email] = nil
+		if entry, ok := pointsEntry(bookID, members[strings.ToLower(email)]); ok {
+			entries[email] = []points.Entry{entry}
+		}
+	}
+
+	err = s.pointsLedger.UpdateBook(bookID, entries)
+	return err
+}
+
+func (s *ServerApi) addUserToDashaMailBook(bookID string, titles *map[string]string, email string, columnsNames []string, params []interface{}, debug *ServerDebug) error {
+	debug.SetDebugLastStage("addUserToDashaMailBook -> ")
+
+	var err error
+	defer debug.DeleteDebugLastStage(&err)
+
+	fields := make(map[string]interface{}, len(columnsNames))
+	for i := range columnsNames {
+		err = setDashaMailFieldParam(fields, columnsNames[i], params[i], titles, debug)
+		if err != nil {
+			return err
+		}
+	}
 
-	err = data.Msg.CheckForError(debug)
+	err = s.dashaMail.Lists.AddMember(bookID, email, fields, dashamail.AddMemberOptions{
+		Update:  true, // перезапишет данные для существующего email
+		NoCheck: true, // впишет email в книгу в DashaMail без валидации
+	})
 	if err != nil {
+		debug.SetDebugDataFromError(err)
 		return err
 	}
 
@@ -1733,3 +2840,152 @@ func (s *ServerApi) sendDataToDashaMail(bookID string, infoDM map[string]interfa
 
 	return debug
 }
+
+// Методы, которые можно запускать в виде фоновых задач (остальные методы выполняются достаточно быстро)
+var jobAPIMethods = []string{
+	"getWebinarReportInfo",
+	"createWebinarReport",
+	"getCampaignsReportInfo",
+	"createCampaignsReport",
+	"getSeriesReportInfo",
+	"createSeriesReport",
+	"getCertificatesInfo",
+	"createCertificates",
+	"reissueCertificates",
+	"revokeCertificates",
+	"sendDataToDashaMail",
+	"syncPointsLedger",
+}
+
+// submitJob ставит API-метод в очередь фоновых задач от имени клиента API ownerID (пустой ownerID - задача самого
+// сервера, например плановая синхронизация реестра баллов).
+func (s *ServerApi) submitJob(ownerID, apiMethod string, msgData interface{}) (*jobs.Job, *ServerDebug) {
+	debug := NewServerDebug("start of submitJob -> ")
+
+	var err error
+	defer debug.SetDebugFinalStage(&err, "end of submitJob")
+
+	allowed := false
+	for _, m := range jobAPIMethods {
+		if m == apiMethod {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		err = fmt.Errorf("API method '%v' can't be run as a job (available methods: %v)", apiMethod, strings.Join(jobAPIMethods, ", "))
+		return nil, debug
+	}
+
+	job, err := s.jobsManager.Submit(apiMethod, ownerID, s.runAPIMethodJob(apiMethod, msgData))
+	if err != nil {
+		return nil, debug
+	}
+
+	return &job, debug
+}
+
+// Задача выполняет тот же код, что и WebSocket-метод. Сообщения о ходе выполнения, которые методы пишут в
+// WebSocketWaiterResponse, сразу попадают в прогресс задачи, откуда их забирают GET /jobs/{jobID} и subscribeJob, а об
+// отмене задачи методы узнают через WebSocketWaiterResponse.Cancelled.
+func (s *ServerApi) runAPIMethodJob(apiMethod string, msgData interface{}) jobs.RunFunc {
+	return func(ctx context.Context, progress *jobs.Progress) (interface{}, error) {
+		wsWaiterResp := &WebSocketWaiterResponse{
+			Status:    "processing",
+			OnMessage: progress.Set,
+			Cancelled: func() bool { return ctx.Err() != nil },
+		}
+
+		response, debug := s.handleAPIMethod(apiMethod, msgData, wsWaiterResp)
+		if debug != nil && debug.Error != nil {
+			return response, fmt.Errorf("%s", GetErrorMessage(debug))
+		}
+
+		return response, nil
+	}
+}
+
+// findClientJob возвращает задачу jobID, если ее поставил клиент API client. Администраторам доступны все задачи,
+// а чужие задачи для остальных клиентов не существуют.
+func (s *ServerApi) findClientJob(jobID string, client auth.Client) (jobs.Job, error) {
+	job, err := s.jobsManager.Get(jobID)
+	if err != nil {
+		return jobs.Job{}, err
+	}
+
+	if job.OwnerID != client.ID && !client.HasScope(auth.SCOPE_ADMIN) {
+		return jobs.Job{}, fmt.Errorf("unknown job '%s'", jobID)
+	}
+
+	return job, nil
+}
+
+func (s *ServerApi) getJob(jobID string, client auth.Client) (*jobs.Job, *ServerDebug) {
+	debug := NewServerDebug("start of getJob -> ")
+
+	var err error
+	defer debug.SetDebugFinalStage(&err, "end of getJob")
+
+	job, err := s.findClientJob(jobID, client)
+	if err != nil {
+		return nil, debug
+	}
+
+	return &job, debug
+}
+
+// subscribeJob ждет завершения задачи, пересылая клиенту ее текущий прогресс, и возвращает итоговое состояние задачи.
+func (s *ServerApi) subscribeJob(jobID string, client auth.Client, wsWaiterResp *WebSocketWaiterResponse) (*jobs.Job, *ServerDebug) {
+	debug := NewServerDebug("start of subscribeJob -> ")
+
+	var err error
+	defer debug.SetDebugFinalStage(&err, "end of subscribeJob")
+
+	if _, err = s.findClientJob(jobID, client); err != nil {
+		return nil, debug
+	}
+
+	done, err := s.jobsManager.Done(jobID)
+	if err != nil {
+		return nil, debug
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			var job jobs.Job
+			job, err = s.jobsManager.Get(jobID)
+			if err != nil {
+				return nil, debug
+			}
+			return &job, debug
+		case <-ticker.C:
+			if job, err := s.jobsManager.Get(jobID); err == nil {
+				setNewWSWaiterMessage(wsWaiterResp, fmt.Sprintf("job %s: %s", job.Status, job.Message))
+			}
+		}
+	}
+}
+
+// cancelJob отменяет задачу клиента API: задача из очереди отменяется сразу, а выполняющаяся - после того, как метод
+// дойдет до проверки отмены.
+func (s *ServerApi) cancelJob(jobID string, client auth.Client) (*jobs.Job, *ServerDebug) {
+	debug := NewServerDebug("start of cancelJob -> ")
+
+	var err error
+	defer debug.SetDebugFinalStage(&err, "end of cancelJob")
+
+	if _, err = s.findClientJob(jobID, client); err != nil {
+		return nil, debug
+	}
+
+	job, err := s.jobsManager.Cancel(jobID)
+	if err != nil {
+		return nil, debug
+	}
+
+	return &job, debug
+}
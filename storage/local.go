@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStore хранит файлы в локальной папке. Используется при разработке и в тестах вместо Яндекс.Диска.
+type LocalStore struct {
+	root      string
+	publicURL string
+}
+
+// NewLocalStore создает папку root, если ее нет. Если publicURL пустой, Publish возвращает ссылки вида file://.
+func NewLocalStore(root, publicURL string) (*LocalStore, error) {
+	if root == "" {
+		return nil, fmt.Errorf("local store directory must be set")
+	}
+
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(root, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LocalStore{root: root, publicURL: strings.TrimSuffix(publicURL, "/")}, nil
+}
+
+func (s *LocalStore) EnsureFolder(folder string) error {
+	err := os.MkdirAll(s.localPath(folder), 0755)
+	if err != nil {
+		return errWithExplanation("ensuring local folder error", err)
+	}
+
+	return nil
+}
+
+func (s *LocalStore) Upload(localFilePath, remoteFilePath string, overwrite bool) error {
+	errExplanation := "uploading to local store error"
+
+	dst := s.localPath(remoteFilePath)
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !overwrite {
+		flags |= os.O_EXCL
+	}
+
+	src, err := os.Open(localFilePath)
+	if err != nil {
+		return errWithExplanation(errExplanation, err)
+	}
+	defer src.Close()
+
+	file, err := os.OpenFile(dst, flags, 0644)
+	if err != nil {
+		return errWithExplanation(errExplanation, err)
+	}
+
+	_, err = io.Copy(file, src)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errWithExplanation(errExplanation, err)
+	}
+
+	return nil
+}
+
+func (s *LocalStore) Publish(remotePath string) (string, error) {
+	localPath := s.localPath(remotePath)
+	if _, err := os.Stat(localPath); err != nil {
+		return "", errWithExplanation("publishing local file error", err)
+	}
+
+	if s.publicURL == "" {
+		return (&url.URL{Scheme: "file", Path: filepath.ToSlash(localPath)}).String(), nil
+	}
+
+	return s.publicURL + "/" + escapePath(cleanPath(remotePath)), nil
+}
+
+func (s *LocalStore) List(folder string) ([]string, error) {
+	files, err := ioutil.ReadDir(s.localPath(folder))
+	if err != nil {
+		return nil, errWithExplanation("listing local folder error", err)
+	}
+
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+
+	return names, nil
+}
+
+func (s *LocalStore) Delete(remotePath string) error {
+	localPath := s.localPath(remotePath)
+	if localPath == s.root {
+		return fmt.Errorf("deleting local store root is forbidden")
+	}
+
+	if _, err := os.Stat(localPath); err != nil {
+		return errWithExplanation("deleting from local store error", err)
+	}
+
+	err := os.RemoveAll(localPath)
+	if err != nil {
+		return errWithExplanation("deleting from local store error", err)
+	}
+
+	return nil
+}
+
+// cleanPath убирает "..", поэтому путь не может выйти за пределы root.
+func (s *LocalStore) localPath(remotePath string) string {
+	return filepath.Join(s.root, filepath.FromSlash(cleanPath(remotePath)))
+}
+
+func escapePath(remotePath string) string {
+	parts := strings.Split(remotePath, "/")
+	for i := range parts {
+		parts[i] = url.PathEscape(parts[i])
+	}
+
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const (
+	YANDEX_STORE = "yandex"
+	LOCAL_STORE  = "local"
+	WEBDAV_STORE = "webdav"
+)
+
+// ArtifactStore - хранилище файлов, которые создает веб-сервис (сертификаты, отчеты).
+// Пути в хранилище всегда относительные и разделяются символом "/" независимо от ОС.
+type ArtifactStore interface {
+	// EnsureFolder создает папку folder вместе со всеми недостающими родительскими папками.
+	EnsureFolder(folder string) error
+	// Upload загружает локальный файл localFilePath по пути remoteFilePath.
+	Upload(localFilePath, remoteFilePath string, overwrite bool) error
+	// Publish открывает доступ к загруженному файлу и возвращает публичную ссылку на него.
+	Publish(remotePath string) (string, error)
+	// List возвращает названия файлов и папок, лежащих непосредственно в папке folder.
+	List(folder string) ([]string, error)
+	// Delete удаляет файл или папку со всем содержимым.
+	Delete(remotePath string) error
+}
+
+// StoreConfig - параметры всех реализаций ArtifactStore; каждая реализация использует только свои поля.
+type StoreConfig struct {
+	YandexApiKey string
+
+	LocalDir string
+
+	WebDAVURI      string
+	WebDAVUser     string
+	WebDAVPassword string
+
+	// PublicURL - базовый URL, по которому файлы хранилища доступны извне (для local и webdav).
+	PublicURL string
+}
+
+// InitArtifactStore возвращает реализацию ArtifactStore по ее названию. Пустое название соответствует YANDEX_STORE.
+func InitArtifactStore(storeType string, config StoreConfig) (ArtifactStore, error) {
+	errExplanation := "can't init artifact store"
+
+	var store ArtifactStore
+	var err error
+
+	switch storeType {
+	case "", YANDEX_STORE:
+		store, err = NewYandexStore(config.YandexApiKey)
+	case LOCAL_STORE:
+		store, err = NewLocalStore(config.LocalDir, config.PublicURL)
+	case WEBDAV_STORE:
+		store, err = NewWebDAVStore(config.WebDAVURI, config.WebDAVUser, config.WebDAVPassword, config.PublicURL)
+	default:
+		err = fmt.Errorf("unknown store type '%s' (only '%s', '%s' and '%s' are available)", storeType, YANDEX_STORE, LOCAL_STORE, WEBDAV_STORE)
+	}
+
+	if err != nil {
+		return nil, errWithExplanation(errExplanation, err)
+	}
+
+	return store, nil
+}
+
+const (
+	CERTIFICATES_ARTIFACT     = "certificates"
+	WEBINAR_REPORT_ARTIFACT   = "webinarReport"
+	CAMPAIGNS_REPORT_ARTIFACT = "campaignsReport"
+)
+
+// FolderLayouts - шаблоны папок хранилища для каждого типа файлов. В шаблонах доступны плейсхолдеры
+// {year}, {month} (название месяца, например, "январь") и {eventDate} (дата мероприятия в виде "8 октября 2022").
+type FolderLayouts map[string]string
+
+func DefaultFolderLayouts() FolderLayouts {
+	return FolderLayouts{
+		CERTIFICATES_ARTIFACT:     "Сертификаты НМО/{year}/{month}/{eventDate}",
+		WEBINAR_REPORT_ARTIFACT:   "Отчёты по мероприятиям/{year}/{month}",
+		CAMPAIGNS_REPORT_ARTIFACT: "Отчёты по рассылкам/{year}",
+	}
+}
+
+var layoutPlaceholder = regexp.MustCompile(`{[^{}]*}`)
+
+// InitFolderLayouts дополняет шаблоны по умолчанию непустыми шаблонами из overrides и проверяет плейсхолдеры.
+func InitFolderLayouts(overrides map[string]string) (FolderLayouts, error) {
+	errExplanation := "can't init folder layouts"
+
+	layouts := DefaultFolderLayouts()
+	for artifactType, layout := range overrides {
+		if _, ok := layouts[artifactType]; !ok {
+			return nil, errWithExplanation(errExplanation, fmt.Errorf("unknown artifact type '%s'", artifactType))
+		}
+		if layout == "" {
+			continue
+		}
+
+		for _, placeholder := range layoutPlaceholder.FindAllString(layout, -1) {
+			if placeholder != "{year}" && placeholder != "{month}" && placeholder != "{eventDate}" {
+				err := fmt.Errorf("unknown placeholder %s in layout '%s' for %s", placeholder, layout, artifactType)
+				return nil, errWithExplanation(errExplanation, err)
+			}
+		}
+		layouts[artifactType] = layout
+	}
+
+	return layouts, nil
+}
+
+// Resolve подставляет значения плейсхолдеров (ключи values - названия плейсхолдеров без скобок) в шаблон для artifactType.
+func (l FolderLayouts) Resolve(artifactType string, values map[string]string) (string, error) {
+	layout, ok := l[artifactType]
+	if !ok {
+		return "", fmt.Errorf("no folder layout for artifact type '%s'", artifactType)
+	}
+
+	folder := layout
+	for placeholder, value := range values {
+		folder = strings.Replace(folder, "{"+placeholder+"}", value, -1)
+	}
+
+	if unresolved := layoutPlaceholder.FindString(folder); unresolved != "" {
+		return "", fmt.Errorf("no value for placeholder %s in folder layout '%s'", unresolved, layout)
+	}
+
+	return cleanPath(folder), nil
+}
+
+// Приводит путь к виду "a/b/c" (без ведущего и завершающего "/"), в котором его ожидают реализации ArtifactStore.
+func cleanPath(remotePath string) string {
+	remotePath = path.Clean("/" + strings.Replace(remotePath, "\\", "/", -1))
+	return strings.TrimPrefix(remotePath, "/")
+}
+
+// Возвращает все папки на пути к folder, начиная с верхней: "a/b/c" -> ["a", "a/b", "a/b/c"].
+func parentFolders(folder string) []string {
+	folder = cleanPath(folder)
+	if folder == "" {
+		return nil
+	}
+
+	parts := strings.Split(folder, "/")
+	folders := make([]string, len(parts))
+	for i := range parts {
+		folders[i] = strings.Join(parts[:i+1], "/")
+	}
+
+	return folders
+}
+
+func errWithExplanation(errExplanation string, err error) error {
+	return fmt.Errorf("%s: %+v", errExplanation, err)
+}
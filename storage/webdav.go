@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// WebDAVStore хранит файлы на любом WebDAV-сервере (Nextcloud, ownCloud, nginx с модулем dav и т.д.).
+// В WebDAV нет понятия публичной ссылки, поэтому Publish возвращает ссылку от publicURL (или от самого WebDAV-сервера),
+// а настройка доступа к файлам остается на стороне сервера.
+type WebDAVStore struct {
+	uri       string
+	user      string
+	password  string
+	publicURL string
+	client    *http.Client
+}
+
+func NewWebDAVStore(uri, user, password, publicURL string) (*WebDAVStore, error) {
+	if uri == "" {
+		return nil, fmt.Errorf("WebDAV URI must be set")
+	}
+
+	if _, err := url.ParseRequestURI(uri); err != nil {
+		return nil, fmt.Errorf("invalid WebDAV URI: %+v", err)
+	}
+
+	if publicURL == "" {
+		publicURL = uri
+	}
+
+	return &WebDAVStore{
+		uri:       strings.TrimSuffix(uri, "/"),
+		user:      user,
+		password:  password,
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+		client:    &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+func (s *WebDAVStore) EnsureFolder(folder string) error {
+	errExplanation := "ensuring WebDAV folder error"
+
+	for _, f := range parentFolders(folder) {
+		resp, err := s.request("MKCOL", f+"/", nil, nil)
+		if err != nil {
+			return errWithExplanation(errExplanation, err)
+		}
+
+		// 405 Method Not Allowed - папка уже существует
+		if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusMethodNotAllowed {
+			return errWithExplanation(errExplanation, responseError(resp))
+		}
+		resp.Body.Close()
+	}
+
+	return nil
+}
+
+func (s *WebDAVStore) Upload(localFilePath, remoteFilePath string, overwrite bool) error {
+	errExplanation := "uploading to WebDAV error"
+
+	file, err := os.Open(localFilePath)
+	if err != nil {
+		return errWithExplanation(errExplanation, err)
+	}
+	defer file.Close()
+
+	// If-None-Match поддерживают не все серверы, поэтому наличие файла дополнительно проверяется запросом HEAD
+	headers := map[string]string{}
+	if !overwrite {
+		headers["If-None-Match"] = "*"
+
+		resp, err := s.request(http.MethodHead, remoteFilePath, nil, nil)
+		if err != nil {
+			return errWithExplanation(errExplanation, err)
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusNotFound:
+			resp.Body.Close()
+		case isSuccess(resp):
+			resp.Body.Close()
+			return errWithExplanation(errExplanation, fmt.Errorf("file %s already exists (%s)", cleanPath(remoteFilePath), resp.Status))
+		default:
+			// например, 401 или 5xx: наличие файла неизвестно
+			return errWithExplanation(errExplanation, responseError(resp))
+		}
+	}
+
+	resp, err := s.request(http.MethodPut, remoteFilePath, file, headers)
+	if err != nil {
+		return errWithExplanation(errExplanation, err)
+	}
+
+	if !isSuccess(resp) {
+		return errWithExplanation(errExplanation, responseError(resp))
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+func (s *WebDAVStore) Publish(remotePath string) (string, error) {
+	resp, err := s.request(http.MethodHead, remotePath, nil, nil)
+	if err != nil {
+		return "", errWithExplanation("publishing WebDAV file error", err)
+	}
+
+	if !isSuccess(resp) {
+		return "", errWithExplanation("publishing WebDAV file error", responseError(resp))
+	}
+	resp.Body.Close()
+
+	return s.publicURL + "/" + escapePath(cleanPath(remotePath)), nil
+}
+
+func (s *WebDAVStore) List(folder string) ([]string, error) {
+	errExplanation := "listing WebDAV folder error"
+
+	body := bytes.NewBufferString(`<?xml version="1.0" encoding="utf-8"?><d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/></d:prop></d:propfind>`)
+	headers := map[string]string{"Depth": "1", "Content-Type": "application/xml"}
+
+	resp, err := s.request("PROPFIND", cleanPath(folder)+"/", body, headers)
+	if err != nil {
+		return nil, errWithExplanation(errExplanation, err)
+	}
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, errWithExplanation(errExplanation, responseError(resp))
+	}
+	defer resp.Body.Close()
+
+	var multistatus struct {
+		Responses []struct {
+			Href string `xml:"href"`
+		} `xml:"response"`
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&multistatus)
+	if err != nil {
+		return nil, errWithExplanation(errExplanation, err)
+	}
+
+	self := path.Clean(s.resourceURL(cleanPath(folder)).Path)
+	names := make([]string, 0, len(multistatus.Responses))
+	for _, r := range multistatus.Responses {
+		href, err := url.Parse(r.Href)
+		if err != nil {
+			return nil, errWithExplanation(errExplanation, err)
+		}
+
+		hrefPath := path.Clean(href.Path)
+		if hrefPath == self { // первым элементом ответа сервер присылает саму папку
+			continue
+		}
+		names = append(names, path.Base(hrefPath))
+	}
+
+	return names, nil
+}
+
+func (s *WebDAVStore) Delete(remotePath string) error {
+	resp, err := s.request(http.MethodDelete, remotePath, nil, nil)
+	if err != nil {
+		return errWithExplanation("deleting from WebDAV error", err)
+	}
+
+	if !isSuccess(resp) {
+		return errWithExplanation("deleting from WebDAV error", responseError(resp))
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+func (s *WebDAVStore) request(method, remotePath string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	resourceURL := s.resourceURL(cleanPath(remotePath))
+	if strings.HasSuffix(remotePath, "/") {
+		resourceURL.Path += "/"
+	}
+
+	req, err := http.NewRequest(method, resourceURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.user != "" {
+		req.SetBasicAuth(s.user, s.password)
+	}
+	for header, value := range headers {
+		req.Header.Set(header, value)
+	}
+
+	return s.client.Do(req)
+}
+
+func (s *WebDAVStore) resourceURL(remotePath string) *url.URL {
+	u, _ := url.Parse(s.uri) // URI проверен в NewWebDAVStore
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + remotePath
+	u.RawPath = ""
+	return u
+}
+
+func isSuccess(resp *http.Response) bool {
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
+
+// Закрывает тело ответа и возвращает ошибку со статусом и началом тела ответа.
+func responseError(resp *http.Response) error {
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("%s %s: %s: %s", resp.Request.Method, resp.Request.URL.Path, resp.Status, bytes.TrimSpace(body))
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWebDAVUploadHeadStatus(t *testing.T) {
+	var headStatus, puts int
+	dav := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodHead:
+			w.WriteHeader(headStatus)
+		case http.MethodPut:
+			puts++
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	t.Cleanup(dav.Close)
+
+	store, err := NewWebDAVStore(dav.URL, "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	local := filepath.Join(t.TempDir(), "certificate.pdf")
+	if err = os.WriteFile(local, []byte("%PDF"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		status  int
+		message string
+	}{
+		{http.StatusNotFound, ""},
+		{http.StatusOK, "already exists"},
+		{http.StatusUnauthorized, "401 Unauthorized"},
+		{http.StatusBadGateway, "502 Bad Gateway"},
+	} {
+		headStatus, puts = tc.status, 0
+		err := store.Upload(local, "certificates/certificate.pdf", false)
+
+		switch {
+		case tc.message == "" && (err != nil || puts != 1):
+			t.Errorf("HEAD %v: error %v, %v PUT requests", tc.status, err, puts)
+		case tc.message != "" && (err == nil || !strings.Contains(err.Error(), tc.message) || puts != 0):
+			t.Errorf("HEAD %v: error %v, %v PUT requests", tc.status, err, puts)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"strings"
+	yd "zo-backend/ya-disk"
+)
+
+// YandexStore хранит файлы на Яндекс.Диске через REST API.
+type YandexStore struct {
+	disk *yd.YaDisk
+}
+
+func NewYandexStore(apiKey string) (*YandexStore, error) {
+	disk, err := yd.InitYaDisk(apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &YandexStore{disk: disk}, nil
+}
+
+func (s *YandexStore) EnsureFolder(folder string) error {
+	errExplanation := "ensuring Yandex Disk folder error"
+
+	// отсутствие папки и попытка создать уже существующую папку ошибками не считаются
+	checkYaDiskError := func(err error) error {
+		switch {
+		case strings.HasSuffix(err.Error(), "DiskNotFoundError"):
+			return nil
+		case strings.HasSuffix(err.Error(), "DiskPathPointsToExistentDirectoryError"):
+			return nil
+		default:
+			return err
+		}
+	}
+
+	for _, f := range parentFolders(folder) {
+		err := s.disk.GetYaDiskFolder(f+"/", false)
+		if err == nil {
+			continue
+		}
+		if err = checkYaDiskError(err); err != nil {
+			return errWithExplanation(errExplanation, err)
+		}
+
+		err = s.disk.CreateYaDiskFolder(f + "/")
+		if err != nil {
+			if err = checkYaDiskError(err); err != nil {
+				return errWithExplanation(errExplanation, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *YandexStore) Upload(localFilePath, remoteFilePath string, overwrite bool) error {
+	return s.disk.UploadToYaDisk(localFilePath, cleanPath(remoteFilePath), overwrite)
+}
+
+func (s *YandexStore) Publish(remotePath string) (string, error) {
+	return s.disk.PublishYaDiskResource(cleanPath(remotePath))
+}
+
+func (s *YandexStore) List(folder string) ([]string, error) {
+	return s.disk.ListYaDiskFolder(cleanPath(folder) + "/")
+}
+
+func (s *YandexStore) Delete(remotePath string) error {
+	return s.disk.DeleteFromYaDisk(cleanPath(remotePath), false)
+}
@@ -0,0 +1,64 @@
+package webinars
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+	"zo-backend/atomicfile"
+)
+
+// FileStore - MemoryStore, который после каждого изменения сохраняет снимок всех вебинаров в JSON-файл,
+// поэтому зрители, ключи и персональные фразы переживают перезапуск сервера.
+type FileStore struct {
+	*MemoryStore
+	path string
+}
+
+// NewFileStore загружает снимок из файла path (если файл уже есть) и удаляет из него устаревшие вебинары.
+func NewFileStore(path string) (*FileStore, error) {
+	errExplanation := "can't init webinar store"
+
+	if path == "" {
+		return nil, errWithExplanation(errExplanation, fmt.Errorf("snapshot file path must be set"))
+	}
+
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, errWithExplanation(errExplanation, err)
+	}
+
+	s := &FileStore{MemoryStore: NewMemoryStore(), path: path}
+
+	data, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, errWithExplanation(errExplanation, err)
+	default:
+		if err = json.Unmarshal(data, &s.webinars); err != nil {
+			return nil, errWithExplanation(errExplanation, fmt.Errorf("can't read snapshot file %s: %+v", path, err))
+		}
+		if s.webinars == nil {
+			s.webinars = make(map[string]Webinar)
+		}
+	}
+
+	s.persist = s.writeSnapshot
+	if err = s.DeleteExpired(time.Now()); err != nil {
+		return nil, errWithExplanation(errExplanation, err)
+	}
+
+	return s, nil
+}
+
+func (s *FileStore) writeSnapshot(webinars map[string]Webinar) error {
+	data, err := json.Marshal(webinars)
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.WriteFile(s.path, data, 0644)
+}
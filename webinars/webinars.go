@@ -0,0 +1,154 @@
+package webinars
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Webinar - данные вебинара, которые веб-сервис хранит между запросами: зрители с ключами Facecast и персональные фразы.
+type Webinar struct {
+	DeletionDate    time.Time `json:"deletionDate"` // храним 7 дней с последнего изменения
+	PersonalPhrases string    `json:"personalPhrases,omitempty"`
+	Users           Users     `json:"users"`
+}
+
+type Users struct {
+	Info              []User     `json:"info,omitempty"`
+	PreviousQueryTime *time.Time `json:"previousQueryTime,omitempty"` // время последнего чтения зрителей из Facecast
+}
+
+type User struct {
+	Email    string `json:"email"`
+	Name     string `json:"name"`
+	Key      string `json:"key"`
+	WayToAdd string `json:"wayToAdd"` // "server" - прочитан из Facecast, "manual" - ключ создан веб-сервисом
+}
+
+// Find возвращает первого зрителя с адресом email.
+func (u Users) Find(email string) (User, bool) {
+	for _, user := range u.Info {
+		if user.Email == email {
+			return user, true
+		}
+	}
+
+	return User{}, false
+}
+
+// Add добавляет зрителя, если зрителя с тем же адресом и ключом еще нет.
+func (u *Users) Add(user User) {
+	for _, existing := range u.Info {
+		if existing.Email == user.Email && existing.Key == user.Key {
+			return
+		}
+	}
+
+	u.Info = append(u.Info, user)
+}
+
+func (w Webinar) clone() Webinar {
+	c := w
+	c.Users.Info = append([]User(nil), w.Users.Info...)
+	if w.Users.PreviousQueryTime != nil {
+		t := *w.Users.PreviousQueryTime
+		c.Users.PreviousQueryTime = &t
+	}
+
+	return c
+}
+
+// WebinarStore - хранилище данных вебинаров по их eventID. Реализации безопасны для использования из нескольких горутин.
+type WebinarStore interface {
+	// Get возвращает копию данных вебинара eventID.
+	Get(eventID string) (Webinar, bool)
+	// Update атомарно изменяет данные вебинара eventID (для нового вебинара update получает нулевой Webinar)
+	// и возвращает копию измененных данных.
+	Update(eventID string, update func(webinar *Webinar)) (Webinar, error)
+	// DeleteExpired удаляет вебинары, у которых DeletionDate раньше now.
+	DeleteExpired(now time.Time) error
+}
+
+// MemoryStore хранит данные вебинаров в памяти процесса, поэтому они теряются при перезапуске сервера.
+type MemoryStore struct {
+	webinars map[string]Webinar
+	locker   sync.RWMutex
+
+	// persist вызывается под locker с измененной копией webinars (используется FileStore); копия заменяет webinars,
+	// только если persist завершился без ошибки
+	persist func(webinars map[string]Webinar) error
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{webinars: make(map[string]Webinar)}
+}
+
+func (s *MemoryStore) Get(eventID string) (Webinar, bool) {
+	s.locker.RLock()
+	defer s.locker.RUnlock()
+
+	webinar, ok := s.webinars[eventID]
+	return webinar.clone(), ok
+}
+
+func (s *MemoryStore) Update(eventID string, update func(webinar *Webinar)) (Webinar, error) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	webinar := s.webinars[eventID].clone()
+	update(&webinar)
+
+	updated := s.copyWebinars()
+	updated[eventID] = webinar
+	if err := s.save(updated); err != nil {
+		return s.webinars[eventID].clone(), errWithExplanation(fmt.Sprintf("updating webinar %s error", eventID), err)
+	}
+	s.webinars = updated
+
+	return webinar.clone(), nil
+}
+
+func (s *MemoryStore) DeleteExpired(now time.Time) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	updated := s.copyWebinars()
+	for eventID, webinar := range updated {
+		if now.After(webinar.DeletionDate) {
+			delete(updated, eventID)
+		}
+	}
+
+	if len(updated) == len(s.webinars) {
+		return nil
+	}
+
+	if err := s.save(updated); err != nil {
+		return errWithExplanation("deleting expired webinars error", err)
+	}
+	s.webinars = updated
+
+	return nil
+}
+
+// copyWebinars вызывается под locker. Данные вебинаров не копируются: Update заменяет вебинар измененной копией.
+func (s *MemoryStore) copyWebinars() map[string]Webinar {
+	webinars := make(map[string]Webinar, len(s.webinars))
+	for eventID, webinar := range s.webinars {
+		webinars[eventID] = webinar
+	}
+
+	return webinars
+}
+
+func (s *MemoryStore) save(webinars map[string]Webinar) error {
+	if s.persist == nil {
+		return nil
+	}
+
+	return s.persist(webinars)
+}
+
+func errWithExplanation(errExplanation string, err error) error {
+	return fmt.Errorf("%s: %+v", errExplanation, err)
+}
@@ -0,0 +1,70 @@
+package webinars
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreKeepsDataWhenSaveFails(t *testing.T) {
+	store := NewMemoryStore()
+	if _, err := store.Update("EVT1", func(webinar *Webinar) {
+		webinar.PersonalPhrases = "Добро пожаловать"
+		webinar.DeletionDate = time.Now().Add(time.Hour)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	store.persist = func(map[string]Webinar) error { return errors.New("disk is full") }
+
+	webinar, err := store.Update("EVT1", func(webinar *Webinar) {
+		webinar.PersonalPhrases = "Новая фраза"
+	})
+	if err == nil || webinar.PersonalPhrases != "Добро пожаловать" {
+		t.Errorf("update with failed save: %+v, %v", webinar, err)
+	}
+	if _, err = store.Update("EVT2", func(*Webinar) {}); err == nil {
+		t.Error("update of new webinar with failed save")
+	}
+	if err = store.DeleteExpired(time.Now().Add(2 * time.Hour)); err == nil {
+		t.Error("deleting expired webinars with failed save")
+	}
+
+	// в памяти осталось то же, что сохранено на диске
+	if webinar, ok := store.Get("EVT1"); !ok || webinar.PersonalPhrases != "Добро пожаловать" {
+		t.Errorf("webinar after failed saves: %+v, %v", webinar, ok)
+	}
+	if _, ok := store.Get("EVT2"); ok {
+		t.Error("new webinar is stored after failed save")
+	}
+}
+
+func TestFileStoreRestoresSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "webinars.json")
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for eventID, deletionDate := range map[string]time.Time{"EVT1": time.Now().Add(time.Hour), "EVT2": time.Now().Add(-time.Hour)} {
+		if _, err = store.Update(eventID, func(webinar *Webinar) {
+			webinar.Users.Add(User{Email: "ivanov@example.com", Key: "key-" + eventID})
+			webinar.DeletionDate = deletionDate
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// при загрузке снимка устаревшие вебинары удаляются
+	restored, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if webinar, ok := restored.Get("EVT1"); !ok || len(webinar.Users.Info) != 1 || webinar.Users.Info[0].Key != "key-EVT1" {
+		t.Errorf("restored webinar %+v, %v", webinar, ok)
+	}
+	if _, ok := restored.Get("EVT2"); ok {
+		t.Error("expired webinar was restored")
+	}
+}
@@ -10,7 +10,6 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"strings"
 )
 
 type YaDisk struct{ yd.YaDisk }
@@ -54,42 +53,41 @@ func (d *YaDisk) CreateYaDiskFolder(folderName string) error {
 	return nil
 }
 
-func (d *YaDisk) LoadToYaDisk(fileName, localDir, remoteDir string, overwrite bool) (string, error) {
-	errExplanation := "loading to Yandex Disk error"
+func (d *YaDisk) UploadToYaDisk(localFilePath, remoteFilePath string, overwrite bool) error {
+	errExplanation := "uploading to Yandex Disk error"
 
-	remoteFilePath := strings.Replace(filepath.Join(remoteDir, fileName), "\\", "/", -1)
 	uploadLink, err := d.GetResourceUploadLink(remoteFilePath, nil, overwrite)
 	if err != nil {
-		return "", errWithExplanation(errExplanation, err)
-	}
-
-	wd, err := os.Getwd()
-	if err != nil {
-		return "", errWithExplanation(errExplanation, err)
+		return errWithExplanation(errExplanation, err)
 	}
 
-	localFilePath := filepath.Join(wd, localDir, fileName)
 	data, err := readLocalFile(localFilePath)
 	if err != nil {
-		return "", errWithExplanation(errExplanation, err)
+		return errWithExplanation(errExplanation, err)
 	}
 
 	pu, err := d.PerformUpload(uploadLink, data)
 	if err != nil {
-		return "", errWithExplanation(errExplanation, err)
+		return errWithExplanation(errExplanation, err)
 	}
 
 	if pu == nil {
 		err = fmt.Errorf("nil pu (perform upload) caused by error %v", err)
-		return "", errWithExplanation(errExplanation, err)
+		return errWithExplanation(errExplanation, err)
 	}
 
-	_, err = d.PublishResource(remoteFilePath, nil)
+	return nil
+}
+
+func (d *YaDisk) PublishYaDiskResource(remotePath string) (string, error) {
+	errExplanation := "publishing Yandex Disk resource error"
+
+	_, err := d.PublishResource(remotePath, nil)
 	if err != nil {
 		return "", errWithExplanation(errExplanation, err)
 	}
 
-	fileInfo, err := d.GetResource(remoteFilePath, nil, 1, 0, false, "", "")
+	fileInfo, err := d.GetResource(remotePath, nil, 1, 0, false, "", "")
 	if err != nil {
 		return "", errWithExplanation(errExplanation, err)
 	}
@@ -102,6 +100,34 @@ func (d *YaDisk) LoadToYaDisk(fileName, localDir, remoteDir string, overwrite bo
 	return fileInfo.PublicURL, nil
 }
 
+// ListYaDiskFolder возвращает названия файлов и папок, лежащих непосредственно в папке folderName.
+func (d *YaDisk) ListYaDiskFolder(folderName string) ([]string, error) {
+	errExplanation := "listing Yandex Disk folder error"
+
+	folder, err := d.GetResource(folderName, nil, 1e9, 0, false, "", "")
+	if err != nil {
+		return nil, errWithExplanation(errExplanation, err)
+	}
+
+	names := make([]string, 0, len(folder.Embedded.Items))
+	for _, item := range folder.Embedded.Items {
+		names = append(names, item.Name)
+	}
+
+	return names, nil
+}
+
+func (d *YaDisk) DeleteFromYaDisk(remotePath string, permanently bool) error {
+	errExplanation := "deleting from Yandex Disk error"
+
+	_, err := d.DeleteResource(remotePath, nil, false, "", permanently)
+	if err != nil {
+		return errWithExplanation(errExplanation, err)
+	}
+
+	return nil
+}
+
 func errWithExplanation(errExplanation string, err error) error {
 	return fmt.Errorf("%s: %+v", errExplanation, err)
 }